@@ -0,0 +1,4 @@
+// Package history contains the location history API definitions.
+package history
+
+//go:generate protoc -I . --go_out=plugins=grpc,paths=source_relative:. history.proto
@@ -0,0 +1,782 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: history.proto
+
+package history
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	timestamp "github.com/golang/protobuf/ptypes/timestamp"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type LocationRecord struct {
+	// Device EUI (8 bytes).
+	DevEui []byte `protobuf:"bytes,1,opt,name=dev_eui,json=devEUI,proto3" json:"dev_eui,omitempty"`
+	// Time of the location.
+	Time *timestamp.Timestamp `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	// Latitude.
+	Latitude float64 `protobuf:"fixed64,3,opt,name=latitude,proto3" json:"latitude,omitempty"`
+	// Longitude.
+	Longitude float64 `protobuf:"fixed64,4,opt,name=longitude,proto3" json:"longitude,omitempty"`
+	// Altitude.
+	Altitude float64 `protobuf:"fixed64,5,opt,name=altitude,proto3" json:"altitude,omitempty"`
+	// Accuracy (in meters).
+	Accuracy             uint32   `protobuf:"varint,6,opt,name=accuracy,proto3" json:"accuracy,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *LocationRecord) Reset()         { *m = LocationRecord{} }
+func (m *LocationRecord) String() string { return proto.CompactTextString(m) }
+func (*LocationRecord) ProtoMessage()    {}
+func (*LocationRecord) Descriptor() ([]byte, []int) {
+	return fileDescriptor_454388b49b309873, []int{0}
+}
+
+func (m *LocationRecord) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_LocationRecord.Unmarshal(m, b)
+}
+func (m *LocationRecord) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_LocationRecord.Marshal(b, m, deterministic)
+}
+func (m *LocationRecord) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_LocationRecord.Merge(m, src)
+}
+func (m *LocationRecord) XXX_Size() int {
+	return xxx_messageInfo_LocationRecord.Size(m)
+}
+func (m *LocationRecord) XXX_DiscardUnknown() {
+	xxx_messageInfo_LocationRecord.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_LocationRecord proto.InternalMessageInfo
+
+func (m *LocationRecord) GetDevEui() []byte {
+	if m != nil {
+		return m.DevEui
+	}
+	return nil
+}
+
+func (m *LocationRecord) GetTime() *timestamp.Timestamp {
+	if m != nil {
+		return m.Time
+	}
+	return nil
+}
+
+func (m *LocationRecord) GetLatitude() float64 {
+	if m != nil {
+		return m.Latitude
+	}
+	return 0
+}
+
+func (m *LocationRecord) GetLongitude() float64 {
+	if m != nil {
+		return m.Longitude
+	}
+	return 0
+}
+
+func (m *LocationRecord) GetAltitude() float64 {
+	if m != nil {
+		return m.Altitude
+	}
+	return 0
+}
+
+func (m *LocationRecord) GetAccuracy() uint32 {
+	if m != nil {
+		return m.Accuracy
+	}
+	return 0
+}
+
+type GetTrackRequest struct {
+	// Device EUI (8 bytes).
+	DevEui []byte `protobuf:"bytes,1,opt,name=dev_eui,json=devEUI,proto3" json:"dev_eui,omitempty"`
+	// Start time (inclusive).
+	Start *timestamp.Timestamp `protobuf:"bytes,2,opt,name=start,proto3" json:"start,omitempty"`
+	// End time (exclusive).
+	End *timestamp.Timestamp `protobuf:"bytes,3,opt,name=end,proto3" json:"end,omitempty"`
+	// Max number of items to return (default 100, max 1000).
+	Limit uint32 `protobuf:"varint,4,opt,name=limit,proto3" json:"limit,omitempty"`
+	// Offset in the result-set (for pagination).
+	Offset               uint32   `protobuf:"varint,5,opt,name=offset,proto3" json:"offset,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetTrackRequest) Reset()         { *m = GetTrackRequest{} }
+func (m *GetTrackRequest) String() string { return proto.CompactTextString(m) }
+func (*GetTrackRequest) ProtoMessage()    {}
+func (*GetTrackRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_454388b49b309873, []int{1}
+}
+
+func (m *GetTrackRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetTrackRequest.Unmarshal(m, b)
+}
+func (m *GetTrackRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetTrackRequest.Marshal(b, m, deterministic)
+}
+func (m *GetTrackRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetTrackRequest.Merge(m, src)
+}
+func (m *GetTrackRequest) XXX_Size() int {
+	return xxx_messageInfo_GetTrackRequest.Size(m)
+}
+func (m *GetTrackRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetTrackRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetTrackRequest proto.InternalMessageInfo
+
+func (m *GetTrackRequest) GetDevEui() []byte {
+	if m != nil {
+		return m.DevEui
+	}
+	return nil
+}
+
+func (m *GetTrackRequest) GetStart() *timestamp.Timestamp {
+	if m != nil {
+		return m.Start
+	}
+	return nil
+}
+
+func (m *GetTrackRequest) GetEnd() *timestamp.Timestamp {
+	if m != nil {
+		return m.End
+	}
+	return nil
+}
+
+func (m *GetTrackRequest) GetLimit() uint32 {
+	if m != nil {
+		return m.Limit
+	}
+	return 0
+}
+
+func (m *GetTrackRequest) GetOffset() uint32 {
+	if m != nil {
+		return m.Offset
+	}
+	return 0
+}
+
+type GetTrackResponse struct {
+	// Total number of locations within the time-range.
+	TotalCount uint32 `protobuf:"varint,1,opt,name=total_count,json=totalCount,proto3" json:"total_count,omitempty"`
+	// Locations, ordered by time.
+	Result               []*LocationRecord `protobuf:"bytes,2,rep,name=result,proto3" json:"result,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *GetTrackResponse) Reset()         { *m = GetTrackResponse{} }
+func (m *GetTrackResponse) String() string { return proto.CompactTextString(m) }
+func (*GetTrackResponse) ProtoMessage()    {}
+func (*GetTrackResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_454388b49b309873, []int{2}
+}
+
+func (m *GetTrackResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetTrackResponse.Unmarshal(m, b)
+}
+func (m *GetTrackResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetTrackResponse.Marshal(b, m, deterministic)
+}
+func (m *GetTrackResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetTrackResponse.Merge(m, src)
+}
+func (m *GetTrackResponse) XXX_Size() int {
+	return xxx_messageInfo_GetTrackResponse.Size(m)
+}
+func (m *GetTrackResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetTrackResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetTrackResponse proto.InternalMessageInfo
+
+func (m *GetTrackResponse) GetTotalCount() uint32 {
+	if m != nil {
+		return m.TotalCount
+	}
+	return 0
+}
+
+func (m *GetTrackResponse) GetResult() []*LocationRecord {
+	if m != nil {
+		return m.Result
+	}
+	return nil
+}
+
+type GetLastLocationRequest struct {
+	// Device EUI (8 bytes).
+	DevEui               []byte   `protobuf:"bytes,1,opt,name=dev_eui,json=devEUI,proto3" json:"dev_eui,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetLastLocationRequest) Reset()         { *m = GetLastLocationRequest{} }
+func (m *GetLastLocationRequest) String() string { return proto.CompactTextString(m) }
+func (*GetLastLocationRequest) ProtoMessage()    {}
+func (*GetLastLocationRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_454388b49b309873, []int{3}
+}
+
+func (m *GetLastLocationRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetLastLocationRequest.Unmarshal(m, b)
+}
+func (m *GetLastLocationRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetLastLocationRequest.Marshal(b, m, deterministic)
+}
+func (m *GetLastLocationRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetLastLocationRequest.Merge(m, src)
+}
+func (m *GetLastLocationRequest) XXX_Size() int {
+	return xxx_messageInfo_GetLastLocationRequest.Size(m)
+}
+func (m *GetLastLocationRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetLastLocationRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetLastLocationRequest proto.InternalMessageInfo
+
+func (m *GetLastLocationRequest) GetDevEui() []byte {
+	if m != nil {
+		return m.DevEui
+	}
+	return nil
+}
+
+type GetLastLocationResponse struct {
+	// Last location.
+	Location             *LocationRecord `protobuf:"bytes,1,opt,name=location,proto3" json:"location,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *GetLastLocationResponse) Reset()         { *m = GetLastLocationResponse{} }
+func (m *GetLastLocationResponse) String() string { return proto.CompactTextString(m) }
+func (*GetLastLocationResponse) ProtoMessage()    {}
+func (*GetLastLocationResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_454388b49b309873, []int{4}
+}
+
+func (m *GetLastLocationResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetLastLocationResponse.Unmarshal(m, b)
+}
+func (m *GetLastLocationResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetLastLocationResponse.Marshal(b, m, deterministic)
+}
+func (m *GetLastLocationResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetLastLocationResponse.Merge(m, src)
+}
+func (m *GetLastLocationResponse) XXX_Size() int {
+	return xxx_messageInfo_GetLastLocationResponse.Size(m)
+}
+func (m *GetLastLocationResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetLastLocationResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetLastLocationResponse proto.InternalMessageInfo
+
+func (m *GetLastLocationResponse) GetLocation() *LocationRecord {
+	if m != nil {
+		return m.Location
+	}
+	return nil
+}
+
+type ListDevicesInBoundingBoxRequest struct {
+	// South-west latitude.
+	MinLatitude float64 `protobuf:"fixed64,1,opt,name=min_latitude,json=minLatitude,proto3" json:"min_latitude,omitempty"`
+	// South-west longitude.
+	MinLongitude float64 `protobuf:"fixed64,2,opt,name=min_longitude,json=minLongitude,proto3" json:"min_longitude,omitempty"`
+	// North-east latitude.
+	MaxLatitude float64 `protobuf:"fixed64,3,opt,name=max_latitude,json=maxLatitude,proto3" json:"max_latitude,omitempty"`
+	// North-east longitude.
+	MaxLongitude float64 `protobuf:"fixed64,4,opt,name=max_longitude,json=maxLongitude,proto3" json:"max_longitude,omitempty"`
+	// Max number of items to return (default 100, max 1000).
+	Limit uint32 `protobuf:"varint,5,opt,name=limit,proto3" json:"limit,omitempty"`
+	// Offset in the result-set (for pagination).
+	Offset               uint32   `protobuf:"varint,6,opt,name=offset,proto3" json:"offset,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListDevicesInBoundingBoxRequest) Reset()         { *m = ListDevicesInBoundingBoxRequest{} }
+func (m *ListDevicesInBoundingBoxRequest) String() string { return proto.CompactTextString(m) }
+func (*ListDevicesInBoundingBoxRequest) ProtoMessage()    {}
+func (*ListDevicesInBoundingBoxRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_454388b49b309873, []int{5}
+}
+
+func (m *ListDevicesInBoundingBoxRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListDevicesInBoundingBoxRequest.Unmarshal(m, b)
+}
+func (m *ListDevicesInBoundingBoxRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListDevicesInBoundingBoxRequest.Marshal(b, m, deterministic)
+}
+func (m *ListDevicesInBoundingBoxRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListDevicesInBoundingBoxRequest.Merge(m, src)
+}
+func (m *ListDevicesInBoundingBoxRequest) XXX_Size() int {
+	return xxx_messageInfo_ListDevicesInBoundingBoxRequest.Size(m)
+}
+func (m *ListDevicesInBoundingBoxRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListDevicesInBoundingBoxRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListDevicesInBoundingBoxRequest proto.InternalMessageInfo
+
+func (m *ListDevicesInBoundingBoxRequest) GetMinLatitude() float64 {
+	if m != nil {
+		return m.MinLatitude
+	}
+	return 0
+}
+
+func (m *ListDevicesInBoundingBoxRequest) GetMinLongitude() float64 {
+	if m != nil {
+		return m.MinLongitude
+	}
+	return 0
+}
+
+func (m *ListDevicesInBoundingBoxRequest) GetMaxLatitude() float64 {
+	if m != nil {
+		return m.MaxLatitude
+	}
+	return 0
+}
+
+func (m *ListDevicesInBoundingBoxRequest) GetMaxLongitude() float64 {
+	if m != nil {
+		return m.MaxLongitude
+	}
+	return 0
+}
+
+func (m *ListDevicesInBoundingBoxRequest) GetLimit() uint32 {
+	if m != nil {
+		return m.Limit
+	}
+	return 0
+}
+
+func (m *ListDevicesInBoundingBoxRequest) GetOffset() uint32 {
+	if m != nil {
+		return m.Offset
+	}
+	return 0
+}
+
+type ListDevicesInRadiusRequest struct {
+	// Latitude of the center.
+	Latitude float64 `protobuf:"fixed64,1,opt,name=latitude,proto3" json:"latitude,omitempty"`
+	// Longitude of the center.
+	Longitude float64 `protobuf:"fixed64,2,opt,name=longitude,proto3" json:"longitude,omitempty"`
+	// Radius (in meters).
+	Radius float64 `protobuf:"fixed64,3,opt,name=radius,proto3" json:"radius,omitempty"`
+	// Max number of items to return (default 100, max 1000).
+	Limit uint32 `protobuf:"varint,4,opt,name=limit,proto3" json:"limit,omitempty"`
+	// Offset in the result-set (for pagination).
+	Offset               uint32   `protobuf:"varint,5,opt,name=offset,proto3" json:"offset,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListDevicesInRadiusRequest) Reset()         { *m = ListDevicesInRadiusRequest{} }
+func (m *ListDevicesInRadiusRequest) String() string { return proto.CompactTextString(m) }
+func (*ListDevicesInRadiusRequest) ProtoMessage()    {}
+func (*ListDevicesInRadiusRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_454388b49b309873, []int{6}
+}
+
+func (m *ListDevicesInRadiusRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListDevicesInRadiusRequest.Unmarshal(m, b)
+}
+func (m *ListDevicesInRadiusRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListDevicesInRadiusRequest.Marshal(b, m, deterministic)
+}
+func (m *ListDevicesInRadiusRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListDevicesInRadiusRequest.Merge(m, src)
+}
+func (m *ListDevicesInRadiusRequest) XXX_Size() int {
+	return xxx_messageInfo_ListDevicesInRadiusRequest.Size(m)
+}
+func (m *ListDevicesInRadiusRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListDevicesInRadiusRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListDevicesInRadiusRequest proto.InternalMessageInfo
+
+func (m *ListDevicesInRadiusRequest) GetLatitude() float64 {
+	if m != nil {
+		return m.Latitude
+	}
+	return 0
+}
+
+func (m *ListDevicesInRadiusRequest) GetLongitude() float64 {
+	if m != nil {
+		return m.Longitude
+	}
+	return 0
+}
+
+func (m *ListDevicesInRadiusRequest) GetRadius() float64 {
+	if m != nil {
+		return m.Radius
+	}
+	return 0
+}
+
+func (m *ListDevicesInRadiusRequest) GetLimit() uint32 {
+	if m != nil {
+		return m.Limit
+	}
+	return 0
+}
+
+func (m *ListDevicesInRadiusRequest) GetOffset() uint32 {
+	if m != nil {
+		return m.Offset
+	}
+	return 0
+}
+
+type ListDevicesResponse struct {
+	// Total number of matching devices.
+	TotalCount uint32 `protobuf:"varint,1,opt,name=total_count,json=totalCount,proto3" json:"total_count,omitempty"`
+	// Last location of each matching device, ordered by DevEUI.
+	Result               []*LocationRecord `protobuf:"bytes,2,rep,name=result,proto3" json:"result,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *ListDevicesResponse) Reset()         { *m = ListDevicesResponse{} }
+func (m *ListDevicesResponse) String() string { return proto.CompactTextString(m) }
+func (*ListDevicesResponse) ProtoMessage()    {}
+func (*ListDevicesResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_454388b49b309873, []int{7}
+}
+
+func (m *ListDevicesResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListDevicesResponse.Unmarshal(m, b)
+}
+func (m *ListDevicesResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListDevicesResponse.Marshal(b, m, deterministic)
+}
+func (m *ListDevicesResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListDevicesResponse.Merge(m, src)
+}
+func (m *ListDevicesResponse) XXX_Size() int {
+	return xxx_messageInfo_ListDevicesResponse.Size(m)
+}
+func (m *ListDevicesResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListDevicesResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListDevicesResponse proto.InternalMessageInfo
+
+func (m *ListDevicesResponse) GetTotalCount() uint32 {
+	if m != nil {
+		return m.TotalCount
+	}
+	return 0
+}
+
+func (m *ListDevicesResponse) GetResult() []*LocationRecord {
+	if m != nil {
+		return m.Result
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*LocationRecord)(nil), "history.LocationRecord")
+	proto.RegisterType((*GetTrackRequest)(nil), "history.GetTrackRequest")
+	proto.RegisterType((*GetTrackResponse)(nil), "history.GetTrackResponse")
+	proto.RegisterType((*GetLastLocationRequest)(nil), "history.GetLastLocationRequest")
+	proto.RegisterType((*GetLastLocationResponse)(nil), "history.GetLastLocationResponse")
+	proto.RegisterType((*ListDevicesInBoundingBoxRequest)(nil), "history.ListDevicesInBoundingBoxRequest")
+	proto.RegisterType((*ListDevicesInRadiusRequest)(nil), "history.ListDevicesInRadiusRequest")
+	proto.RegisterType((*ListDevicesResponse)(nil), "history.ListDevicesResponse")
+}
+
+func init() { proto.RegisterFile("history.proto", fileDescriptor_454388b49b309873) }
+
+var fileDescriptor_454388b49b309873 = []byte{
+	// 617 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xb4, 0x54, 0xcd, 0x6e, 0xd3, 0x40,
+	0x10, 0x66, 0x93, 0xc6, 0x2d, 0x93, 0x86, 0xa2, 0x2d, 0x4a, 0x8d, 0x55, 0x29, 0xc1, 0xbd, 0xe4,
+	0x40, 0x6d, 0x68, 0xaf, 0x08, 0x89, 0x02, 0x2a, 0x95, 0x22, 0x0e, 0xa6, 0x70, 0xe8, 0x25, 0xda,
+	0xac, 0xb7, 0xee, 0xaa, 0xb6, 0x37, 0xec, 0xae, 0xa3, 0xf6, 0x5d, 0x78, 0x10, 0xde, 0x81, 0x87,
+	0xe0, 0x29, 0xb8, 0x23, 0xaf, 0x7f, 0xf2, 0x43, 0x9a, 0xc2, 0x81, 0xe3, 0xcc, 0x7c, 0xf3, 0xed,
+	0x7c, 0x9e, 0x6f, 0x0c, 0x9d, 0x2b, 0xae, 0xb4, 0x90, 0xb7, 0xde, 0x44, 0x0a, 0x2d, 0xf0, 0x66,
+	0x19, 0x3a, 0xbd, 0x48, 0x88, 0x28, 0x66, 0xbe, 0x49, 0x8f, 0xb3, 0x4b, 0x5f, 0xf3, 0x84, 0x29,
+	0x4d, 0x92, 0x49, 0x81, 0x74, 0x7f, 0x20, 0x78, 0x34, 0x14, 0x94, 0x68, 0x2e, 0xd2, 0x80, 0x51,
+	0x21, 0x43, 0xbc, 0x07, 0x9b, 0x21, 0x9b, 0x8e, 0x58, 0xc6, 0x6d, 0xd4, 0x47, 0x83, 0xed, 0xc0,
+	0x0a, 0xd9, 0xf4, 0xfd, 0xe7, 0x33, 0xec, 0xc1, 0x46, 0xde, 0x6e, 0x37, 0xfa, 0x68, 0xd0, 0x3e,
+	0x72, 0xbc, 0x82, 0xdb, 0xab, 0xb8, 0xbd, 0xf3, 0x8a, 0x3b, 0x30, 0x38, 0xec, 0xc0, 0x56, 0x4c,
+	0x34, 0xd7, 0x59, 0xc8, 0xec, 0x66, 0x1f, 0x0d, 0x50, 0x50, 0xc7, 0x78, 0x1f, 0x1e, 0xc6, 0x22,
+	0x8d, 0x8a, 0xe2, 0x86, 0x29, 0xce, 0x12, 0x79, 0x27, 0x89, 0xcb, 0xce, 0x56, 0xd1, 0x59, 0xc5,
+	0xa6, 0x46, 0x69, 0x26, 0x09, 0xbd, 0xb5, 0xad, 0x3e, 0x1a, 0x74, 0x82, 0x3a, 0x76, 0xbf, 0x23,
+	0xd8, 0x39, 0x65, 0xfa, 0x5c, 0x12, 0x7a, 0x1d, 0xb0, 0xaf, 0x19, 0x53, 0xfa, 0x6e, 0x39, 0x2f,
+	0xa0, 0xa5, 0x34, 0x91, 0xfa, 0x2f, 0xf4, 0x14, 0x40, 0xfc, 0x1c, 0x9a, 0x2c, 0x0d, 0xed, 0xe6,
+	0xbd, 0xf8, 0x1c, 0x86, 0x9f, 0x40, 0x2b, 0xe6, 0x09, 0xd7, 0x46, 0x5e, 0x27, 0x28, 0x02, 0xdc,
+	0x05, 0x4b, 0x5c, 0x5e, 0x2a, 0xa6, 0x8d, 0xb0, 0x4e, 0x50, 0x46, 0x6e, 0x08, 0x8f, 0x67, 0x93,
+	0xab, 0x89, 0x48, 0x15, 0xc3, 0x3d, 0x68, 0x6b, 0xa1, 0x49, 0x3c, 0xa2, 0x22, 0x4b, 0xb5, 0x19,
+	0xbf, 0x13, 0x80, 0x49, 0xbd, 0xcd, 0x33, 0xd8, 0x07, 0x4b, 0x32, 0x95, 0xc5, 0xb9, 0x86, 0xe6,
+	0xa0, 0x7d, 0xb4, 0xe7, 0x55, 0x3e, 0x58, 0xdc, 0x69, 0x50, 0xc2, 0xdc, 0x97, 0xd0, 0x3d, 0x65,
+	0x7a, 0x48, 0x94, 0x9e, 0x01, 0xd6, 0x7f, 0x26, 0xf7, 0x23, 0xec, 0xfd, 0xd1, 0x52, 0xce, 0x77,
+	0x0c, 0x5b, 0x71, 0x99, 0x33, 0x4d, 0x6b, 0x06, 0xa8, 0x81, 0xee, 0x4f, 0x04, 0xbd, 0x21, 0x57,
+	0xfa, 0x1d, 0x9b, 0x72, 0xca, 0xd4, 0x59, 0x7a, 0x22, 0xb2, 0x34, 0xe4, 0x69, 0x74, 0x22, 0x6e,
+	0xaa, 0x61, 0x9e, 0xc1, 0x76, 0xc2, 0xd3, 0x51, 0xed, 0x1e, 0x64, 0x3c, 0xd0, 0x4e, 0x78, 0x3a,
+	0x2c, 0x53, 0xf8, 0x00, 0x3a, 0x06, 0x52, 0x9b, 0xa8, 0x61, 0x30, 0x79, 0xdf, 0xb0, 0xca, 0x19,
+	0x1e, 0x72, 0x33, 0x5a, 0x72, 0x61, 0x3b, 0x21, 0x37, 0x0b, 0x3c, 0x39, 0x64, 0xc9, 0x8c, 0x79,
+	0xdf, 0x8c, 0xa7, 0x5e, 0x65, 0x6b, 0xf5, 0x2a, 0xad, 0x85, 0x55, 0x7e, 0x43, 0xe0, 0x2c, 0x28,
+	0x0c, 0x48, 0xc8, 0x33, 0x55, 0x89, 0x9b, 0x3f, 0x0b, 0xb4, 0xee, 0x2c, 0x1a, 0xcb, 0x67, 0xd1,
+	0x05, 0x4b, 0x1a, 0xaa, 0x52, 0x48, 0x19, 0xfd, 0xa3, 0xd3, 0x22, 0xd8, 0x9d, 0x9b, 0xee, 0xff,
+	0x99, 0xed, 0xe8, 0x57, 0x03, 0xba, 0x55, 0xe9, 0x43, 0x01, 0xfd, 0xc4, 0x64, 0xfe, 0x2a, 0x7e,
+	0x03, 0x5b, 0x95, 0xdb, 0xb1, 0x5d, 0xf3, 0x2c, 0x9d, 0xae, 0xf3, 0x74, 0x45, 0xa5, 0x98, 0xd6,
+	0x7d, 0x80, 0xbf, 0xc0, 0xce, 0x92, 0x2f, 0x71, 0x6f, 0x1e, 0xbf, 0xc2, 0xe4, 0x4e, 0xff, 0x6e,
+	0x40, 0xcd, 0x1b, 0x82, 0x7d, 0x97, 0x3d, 0xf1, 0x60, 0x26, 0x79, 0xbd, 0x83, 0x9d, 0xfd, 0x55,
+	0xc8, 0xb9, 0x57, 0x2e, 0x60, 0x77, 0x85, 0x45, 0xf0, 0xc1, 0xea, 0x07, 0x16, 0x0c, 0x74, 0x1f,
+	0xf7, 0xc9, 0xeb, 0x8b, 0x57, 0x11, 0xd7, 0x57, 0xd9, 0xd8, 0xa3, 0x22, 0xf1, 0xc7, 0x52, 0x50,
+	0x42, 0xa4, 0x4f, 0xaf, 0xb8, 0x9c, 0x28, 0x4d, 0xe8, 0xf5, 0x61, 0xc4, 0x44, 0x75, 0x8e, 0x87,
+	0x8a, 0xc9, 0x29, 0x93, 0x3e, 0x99, 0x70, 0xbf, 0x64, 0x1d, 0x5b, 0xe6, 0x8f, 0x76, 0xfc, 0x7b,
+	0x00, 0xd2, 0x47, 0x17, 0xb2, 0x55, 0x06, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// LocationHistoryServiceClient is the client API for LocationHistoryService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type LocationHistoryServiceClient interface {
+	// GetTrack returns the locations of a device within the given time-range.
+	GetTrack(ctx context.Context, in *GetTrackRequest, opts ...grpc.CallOption) (*GetTrackResponse, error)
+	// GetLastLocation returns the last resolved location of a device.
+	GetLastLocation(ctx context.Context, in *GetLastLocationRequest, opts ...grpc.CallOption) (*GetLastLocationResponse, error)
+	// ListDevicesInBoundingBox returns the devices of which the last resolved
+	// location is within the given bounding-box.
+	ListDevicesInBoundingBox(ctx context.Context, in *ListDevicesInBoundingBoxRequest, opts ...grpc.CallOption) (*ListDevicesResponse, error)
+	// ListDevicesInRadius returns the devices of which the last resolved
+	// location is within the given radius.
+	ListDevicesInRadius(ctx context.Context, in *ListDevicesInRadiusRequest, opts ...grpc.CallOption) (*ListDevicesResponse, error)
+}
+
+type locationHistoryServiceClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewLocationHistoryServiceClient(cc *grpc.ClientConn) LocationHistoryServiceClient {
+	return &locationHistoryServiceClient{cc}
+}
+
+func (c *locationHistoryServiceClient) GetTrack(ctx context.Context, in *GetTrackRequest, opts ...grpc.CallOption) (*GetTrackResponse, error) {
+	out := new(GetTrackResponse)
+	err := c.cc.Invoke(ctx, "/history.LocationHistoryService/GetTrack", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *locationHistoryServiceClient) GetLastLocation(ctx context.Context, in *GetLastLocationRequest, opts ...grpc.CallOption) (*GetLastLocationResponse, error) {
+	out := new(GetLastLocationResponse)
+	err := c.cc.Invoke(ctx, "/history.LocationHistoryService/GetLastLocation", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *locationHistoryServiceClient) ListDevicesInBoundingBox(ctx context.Context, in *ListDevicesInBoundingBoxRequest, opts ...grpc.CallOption) (*ListDevicesResponse, error) {
+	out := new(ListDevicesResponse)
+	err := c.cc.Invoke(ctx, "/history.LocationHistoryService/ListDevicesInBoundingBox", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *locationHistoryServiceClient) ListDevicesInRadius(ctx context.Context, in *ListDevicesInRadiusRequest, opts ...grpc.CallOption) (*ListDevicesResponse, error) {
+	out := new(ListDevicesResponse)
+	err := c.cc.Invoke(ctx, "/history.LocationHistoryService/ListDevicesInRadius", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LocationHistoryServiceServer is the server API for LocationHistoryService service.
+type LocationHistoryServiceServer interface {
+	// GetTrack returns the locations of a device within the given time-range.
+	GetTrack(context.Context, *GetTrackRequest) (*GetTrackResponse, error)
+	// GetLastLocation returns the last resolved location of a device.
+	GetLastLocation(context.Context, *GetLastLocationRequest) (*GetLastLocationResponse, error)
+	// ListDevicesInBoundingBox returns the devices of which the last resolved
+	// location is within the given bounding-box.
+	ListDevicesInBoundingBox(context.Context, *ListDevicesInBoundingBoxRequest) (*ListDevicesResponse, error)
+	// ListDevicesInRadius returns the devices of which the last resolved
+	// location is within the given radius.
+	ListDevicesInRadius(context.Context, *ListDevicesInRadiusRequest) (*ListDevicesResponse, error)
+}
+
+// UnimplementedLocationHistoryServiceServer can be embedded to have forward compatible implementations.
+type UnimplementedLocationHistoryServiceServer struct {
+}
+
+func (*UnimplementedLocationHistoryServiceServer) GetTrack(ctx context.Context, req *GetTrackRequest) (*GetTrackResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTrack not implemented")
+}
+func (*UnimplementedLocationHistoryServiceServer) GetLastLocation(ctx context.Context, req *GetLastLocationRequest) (*GetLastLocationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLastLocation not implemented")
+}
+func (*UnimplementedLocationHistoryServiceServer) ListDevicesInBoundingBox(ctx context.Context, req *ListDevicesInBoundingBoxRequest) (*ListDevicesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListDevicesInBoundingBox not implemented")
+}
+func (*UnimplementedLocationHistoryServiceServer) ListDevicesInRadius(ctx context.Context, req *ListDevicesInRadiusRequest) (*ListDevicesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListDevicesInRadius not implemented")
+}
+
+func RegisterLocationHistoryServiceServer(s *grpc.Server, srv LocationHistoryServiceServer) {
+	s.RegisterService(&_LocationHistoryService_serviceDesc, srv)
+}
+
+func _LocationHistoryService_GetTrack_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTrackRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LocationHistoryServiceServer).GetTrack(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/history.LocationHistoryService/GetTrack",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LocationHistoryServiceServer).GetTrack(ctx, req.(*GetTrackRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LocationHistoryService_GetLastLocation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLastLocationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LocationHistoryServiceServer).GetLastLocation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/history.LocationHistoryService/GetLastLocation",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LocationHistoryServiceServer).GetLastLocation(ctx, req.(*GetLastLocationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LocationHistoryService_ListDevicesInBoundingBox_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDevicesInBoundingBoxRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LocationHistoryServiceServer).ListDevicesInBoundingBox(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/history.LocationHistoryService/ListDevicesInBoundingBox",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LocationHistoryServiceServer).ListDevicesInBoundingBox(ctx, req.(*ListDevicesInBoundingBoxRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LocationHistoryService_ListDevicesInRadius_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDevicesInRadiusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LocationHistoryServiceServer).ListDevicesInRadius(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/history.LocationHistoryService/ListDevicesInRadius",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LocationHistoryServiceServer).ListDevicesInRadius(ctx, req.(*ListDevicesInRadiusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _LocationHistoryService_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "history.LocationHistoryService",
+	HandlerType: (*LocationHistoryServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetTrack",
+			Handler:    _LocationHistoryService_GetTrack_Handler,
+		},
+		{
+			MethodName: "GetLastLocation",
+			Handler:    _LocationHistoryService_GetLastLocation_Handler,
+		},
+		{
+			MethodName: "ListDevicesInBoundingBox",
+			Handler:    _LocationHistoryService_ListDevicesInBoundingBox_Handler,
+		},
+		{
+			MethodName: "ListDevicesInRadius",
+			Handler:    _LocationHistoryService_ListDevicesInRadius_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "history.proto",
+}
@@ -0,0 +1,4 @@
+// Package integration contains the integration event definitions.
+package integration
+
+//go:generate protoc -I . --go_out=paths=source_relative:. integration.proto
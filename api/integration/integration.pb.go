@@ -0,0 +1,439 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: integration.proto
+
+package integration
+
+import (
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	duration "github.com/golang/protobuf/ptypes/duration"
+	timestamp "github.com/golang/protobuf/ptypes/timestamp"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type GeofenceEventType int32
+
+const (
+	// The device entered the geofence.
+	GeofenceEventType_ENTER GeofenceEventType = 0
+	// The device exited the geofence.
+	GeofenceEventType_EXIT GeofenceEventType = 1
+	// The device has been inside the geofence for the configured dwell time.
+	GeofenceEventType_DWELL GeofenceEventType = 2
+)
+
+var GeofenceEventType_name = map[int32]string{
+	0: "ENTER",
+	1: "EXIT",
+	2: "DWELL",
+}
+
+var GeofenceEventType_value = map[string]int32{
+	"ENTER": 0,
+	"EXIT":  1,
+	"DWELL": 2,
+}
+
+func (x GeofenceEventType) String() string {
+	return proto.EnumName(GeofenceEventType_name, int32(x))
+}
+
+func (GeofenceEventType) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_a47e644ecb1478e7, []int{0}
+}
+
+type Location struct {
+	// Latitude.
+	Latitude float64 `protobuf:"fixed64,1,opt,name=latitude,proto3" json:"latitude,omitempty"`
+	// Longitude.
+	Longitude float64 `protobuf:"fixed64,2,opt,name=longitude,proto3" json:"longitude,omitempty"`
+	// Altitude.
+	Altitude float64 `protobuf:"fixed64,3,opt,name=altitude,proto3" json:"altitude,omitempty"`
+	// Accuracy (in meters).
+	Accuracy             uint32   `protobuf:"varint,4,opt,name=accuracy,proto3" json:"accuracy,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Location) Reset()         { *m = Location{} }
+func (m *Location) String() string { return proto.CompactTextString(m) }
+func (*Location) ProtoMessage()    {}
+func (*Location) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a47e644ecb1478e7, []int{0}
+}
+
+func (m *Location) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Location.Unmarshal(m, b)
+}
+func (m *Location) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Location.Marshal(b, m, deterministic)
+}
+func (m *Location) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Location.Merge(m, src)
+}
+func (m *Location) XXX_Size() int {
+	return xxx_messageInfo_Location.Size(m)
+}
+func (m *Location) XXX_DiscardUnknown() {
+	xxx_messageInfo_Location.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Location proto.InternalMessageInfo
+
+func (m *Location) GetLatitude() float64 {
+	if m != nil {
+		return m.Latitude
+	}
+	return 0
+}
+
+func (m *Location) GetLongitude() float64 {
+	if m != nil {
+		return m.Longitude
+	}
+	return 0
+}
+
+func (m *Location) GetAltitude() float64 {
+	if m != nil {
+		return m.Altitude
+	}
+	return 0
+}
+
+func (m *Location) GetAccuracy() uint32 {
+	if m != nil {
+		return m.Accuracy
+	}
+	return 0
+}
+
+type GatewayRXInfo struct {
+	// Gateway ID (8 bytes).
+	GatewayId []byte `protobuf:"bytes,1,opt,name=gateway_id,json=gatewayID,proto3" json:"gateway_id,omitempty"`
+	// Index of the frame in which the gateway received the uplink.
+	Frame uint32 `protobuf:"varint,2,opt,name=frame,proto3" json:"frame,omitempty"`
+	// RSSI.
+	Rssi int32 `protobuf:"varint,3,opt,name=rssi,proto3" json:"rssi,omitempty"`
+	// LoRa SNR.
+	LoraSnr float64 `protobuf:"fixed64,4,opt,name=lora_snr,json=loRaSNR,proto3" json:"lora_snr,omitempty"`
+	// Gateway location.
+	Location *Location `protobuf:"bytes,5,opt,name=location,proto3" json:"location,omitempty"`
+	// Gateway provided a fine-timestamp.
+	FineTimestamp        bool     `protobuf:"varint,6,opt,name=fine_timestamp,json=fineTimestamp,proto3" json:"fine_timestamp,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GatewayRXInfo) Reset()         { *m = GatewayRXInfo{} }
+func (m *GatewayRXInfo) String() string { return proto.CompactTextString(m) }
+func (*GatewayRXInfo) ProtoMessage()    {}
+func (*GatewayRXInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a47e644ecb1478e7, []int{1}
+}
+
+func (m *GatewayRXInfo) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GatewayRXInfo.Unmarshal(m, b)
+}
+func (m *GatewayRXInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GatewayRXInfo.Marshal(b, m, deterministic)
+}
+func (m *GatewayRXInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GatewayRXInfo.Merge(m, src)
+}
+func (m *GatewayRXInfo) XXX_Size() int {
+	return xxx_messageInfo_GatewayRXInfo.Size(m)
+}
+func (m *GatewayRXInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_GatewayRXInfo.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GatewayRXInfo proto.InternalMessageInfo
+
+func (m *GatewayRXInfo) GetGatewayId() []byte {
+	if m != nil {
+		return m.GatewayId
+	}
+	return nil
+}
+
+func (m *GatewayRXInfo) GetFrame() uint32 {
+	if m != nil {
+		return m.Frame
+	}
+	return 0
+}
+
+func (m *GatewayRXInfo) GetRssi() int32 {
+	if m != nil {
+		return m.Rssi
+	}
+	return 0
+}
+
+func (m *GatewayRXInfo) GetLoraSnr() float64 {
+	if m != nil {
+		return m.LoraSnr
+	}
+	return 0
+}
+
+func (m *GatewayRXInfo) GetLocation() *Location {
+	if m != nil {
+		return m.Location
+	}
+	return nil
+}
+
+func (m *GatewayRXInfo) GetFineTimestamp() bool {
+	if m != nil {
+		return m.FineTimestamp
+	}
+	return false
+}
+
+// LocationEvent is published for each resolved location.
+type LocationEvent struct {
+	// Device EUI (8 bytes).
+	DevEui []byte `protobuf:"bytes,1,opt,name=dev_eui,json=devEUI,proto3" json:"dev_eui,omitempty"`
+	// Time of the location.
+	Time *timestamp.Timestamp `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	// Geolocation backend which resolved the location.
+	Backend string `protobuf:"bytes,3,opt,name=backend,proto3" json:"backend,omitempty"`
+	// Resolved location.
+	Location *Location `protobuf:"bytes,4,opt,name=location,proto3" json:"location,omitempty"`
+	// Number of frames used to resolve the location.
+	FrameCount uint32 `protobuf:"varint,5,opt,name=frame_count,json=frameCount,proto3" json:"frame_count,omitempty"`
+	// Gateway meta-data of the frames.
+	RxInfo               []*GatewayRXInfo `protobuf:"bytes,6,rep,name=rx_info,json=rxInfo,proto3" json:"rx_info,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}         `json:"-"`
+	XXX_unrecognized     []byte           `json:"-"`
+	XXX_sizecache        int32            `json:"-"`
+}
+
+func (m *LocationEvent) Reset()         { *m = LocationEvent{} }
+func (m *LocationEvent) String() string { return proto.CompactTextString(m) }
+func (*LocationEvent) ProtoMessage()    {}
+func (*LocationEvent) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a47e644ecb1478e7, []int{2}
+}
+
+func (m *LocationEvent) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_LocationEvent.Unmarshal(m, b)
+}
+func (m *LocationEvent) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_LocationEvent.Marshal(b, m, deterministic)
+}
+func (m *LocationEvent) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_LocationEvent.Merge(m, src)
+}
+func (m *LocationEvent) XXX_Size() int {
+	return xxx_messageInfo_LocationEvent.Size(m)
+}
+func (m *LocationEvent) XXX_DiscardUnknown() {
+	xxx_messageInfo_LocationEvent.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_LocationEvent proto.InternalMessageInfo
+
+func (m *LocationEvent) GetDevEui() []byte {
+	if m != nil {
+		return m.DevEui
+	}
+	return nil
+}
+
+func (m *LocationEvent) GetTime() *timestamp.Timestamp {
+	if m != nil {
+		return m.Time
+	}
+	return nil
+}
+
+func (m *LocationEvent) GetBackend() string {
+	if m != nil {
+		return m.Backend
+	}
+	return ""
+}
+
+func (m *LocationEvent) GetLocation() *Location {
+	if m != nil {
+		return m.Location
+	}
+	return nil
+}
+
+func (m *LocationEvent) GetFrameCount() uint32 {
+	if m != nil {
+		return m.FrameCount
+	}
+	return 0
+}
+
+func (m *LocationEvent) GetRxInfo() []*GatewayRXInfo {
+	if m != nil {
+		return m.RxInfo
+	}
+	return nil
+}
+
+// GeofenceEvent is published when a device enters, exits or dwells in a
+// geofence.
+type GeofenceEvent struct {
+	// Device EUI (8 bytes).
+	DevEui []byte `protobuf:"bytes,1,opt,name=dev_eui,json=devEUI,proto3" json:"dev_eui,omitempty"`
+	// Time of the location.
+	Time *timestamp.Timestamp `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	// Event type.
+	Type GeofenceEventType `protobuf:"varint,3,opt,name=type,proto3,enum=integration.GeofenceEventType" json:"type,omitempty"`
+	// Geofence ID.
+	GeofenceId string `protobuf:"bytes,4,opt,name=geofence_id,json=geofenceID,proto3" json:"geofence_id,omitempty"`
+	// Geofence name.
+	GeofenceName string `protobuf:"bytes,5,opt,name=geofence_name,json=geofenceName,proto3" json:"geofence_name,omitempty"`
+	// Location of the device.
+	Location *Location `protobuf:"bytes,6,opt,name=location,proto3" json:"location,omitempty"`
+	// Time the device has been inside the geofence (set for EXIT and DWELL
+	// events).
+	DwellTime            *duration.Duration `protobuf:"bytes,7,opt,name=dwell_time,json=dwellTime,proto3" json:"dwell_time,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
+func (m *GeofenceEvent) Reset()         { *m = GeofenceEvent{} }
+func (m *GeofenceEvent) String() string { return proto.CompactTextString(m) }
+func (*GeofenceEvent) ProtoMessage()    {}
+func (*GeofenceEvent) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a47e644ecb1478e7, []int{3}
+}
+
+func (m *GeofenceEvent) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GeofenceEvent.Unmarshal(m, b)
+}
+func (m *GeofenceEvent) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GeofenceEvent.Marshal(b, m, deterministic)
+}
+func (m *GeofenceEvent) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GeofenceEvent.Merge(m, src)
+}
+func (m *GeofenceEvent) XXX_Size() int {
+	return xxx_messageInfo_GeofenceEvent.Size(m)
+}
+func (m *GeofenceEvent) XXX_DiscardUnknown() {
+	xxx_messageInfo_GeofenceEvent.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GeofenceEvent proto.InternalMessageInfo
+
+func (m *GeofenceEvent) GetDevEui() []byte {
+	if m != nil {
+		return m.DevEui
+	}
+	return nil
+}
+
+func (m *GeofenceEvent) GetTime() *timestamp.Timestamp {
+	if m != nil {
+		return m.Time
+	}
+	return nil
+}
+
+func (m *GeofenceEvent) GetType() GeofenceEventType {
+	if m != nil {
+		return m.Type
+	}
+	return GeofenceEventType_ENTER
+}
+
+func (m *GeofenceEvent) GetGeofenceId() string {
+	if m != nil {
+		return m.GeofenceId
+	}
+	return ""
+}
+
+func (m *GeofenceEvent) GetGeofenceName() string {
+	if m != nil {
+		return m.GeofenceName
+	}
+	return ""
+}
+
+func (m *GeofenceEvent) GetLocation() *Location {
+	if m != nil {
+		return m.Location
+	}
+	return nil
+}
+
+func (m *GeofenceEvent) GetDwellTime() *duration.Duration {
+	if m != nil {
+		return m.DwellTime
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterEnum("integration.GeofenceEventType", GeofenceEventType_name, GeofenceEventType_value)
+	proto.RegisterType((*Location)(nil), "integration.Location")
+	proto.RegisterType((*GatewayRXInfo)(nil), "integration.GatewayRXInfo")
+	proto.RegisterType((*LocationEvent)(nil), "integration.LocationEvent")
+	proto.RegisterType((*GeofenceEvent)(nil), "integration.GeofenceEvent")
+}
+
+func init() { proto.RegisterFile("integration.proto", fileDescriptor_a47e644ecb1478e7) }
+
+var fileDescriptor_a47e644ecb1478e7 = []byte{
+	// 565 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x53, 0xcd, 0x6a, 0xdb, 0x4c,
+	0x14, 0xfd, 0x94, 0xc8, 0x7f, 0xd7, 0x51, 0x48, 0x86, 0xaf, 0x54, 0x31, 0x6d, 0x62, 0x5c, 0x0a,
+	0xa6, 0x10, 0x89, 0x3a, 0x9b, 0x2e, 0x4b, 0x6a, 0x11, 0x0c, 0x21, 0x8b, 0xa9, 0x4b, 0x43, 0x37,
+	0x62, 0x2c, 0x8d, 0x94, 0x21, 0xf2, 0x8c, 0x18, 0x8d, 0x9c, 0x18, 0xfa, 0x6e, 0x7d, 0x82, 0x3e,
+	0x51, 0x37, 0x45, 0xa3, 0x9f, 0xca, 0xcd, 0x26, 0x8b, 0xae, 0xec, 0x7b, 0xee, 0xb9, 0x33, 0xe7,
+	0x9c, 0xb9, 0x82, 0x63, 0xc6, 0x15, 0x8d, 0x25, 0x51, 0x4c, 0x70, 0x27, 0x95, 0x42, 0x09, 0x34,
+	0x6c, 0x41, 0xa3, 0xb3, 0x58, 0x88, 0x38, 0xa1, 0xae, 0x6e, 0xad, 0xf2, 0xc8, 0x55, 0x6c, 0x4d,
+	0x33, 0x45, 0xd6, 0x69, 0xc9, 0x1e, 0x9d, 0xfe, 0x4d, 0x08, 0xf3, 0xf6, 0x69, 0x93, 0xef, 0xd0,
+	0xbf, 0x16, 0x81, 0x46, 0xd0, 0x08, 0xfa, 0x09, 0x51, 0x4c, 0xe5, 0x21, 0xb5, 0x8d, 0xb1, 0x31,
+	0x35, 0x70, 0x53, 0xa3, 0x57, 0x30, 0x48, 0x04, 0x8f, 0xcb, 0xe6, 0x9e, 0x6e, 0xfe, 0x01, 0x8a,
+	0x49, 0x92, 0x54, 0x93, 0xfb, 0xe5, 0x64, 0x5d, 0xeb, 0x5e, 0x10, 0xe4, 0x92, 0x04, 0x5b, 0xdb,
+	0x1c, 0x1b, 0x53, 0x0b, 0x37, 0xf5, 0xe4, 0xa7, 0x01, 0xd6, 0x15, 0x51, 0xf4, 0x81, 0x6c, 0xf1,
+	0xed, 0x82, 0x47, 0x02, 0xbd, 0x06, 0x88, 0x4b, 0xc0, 0x67, 0xa1, 0x56, 0x71, 0x80, 0x07, 0x15,
+	0xb2, 0x98, 0xa3, 0xff, 0xa1, 0x13, 0x49, 0xb2, 0x2e, 0x25, 0x58, 0xb8, 0x2c, 0x10, 0x02, 0x53,
+	0x66, 0x19, 0xd3, 0x57, 0x77, 0xb0, 0xfe, 0x8f, 0x4e, 0xa0, 0x9f, 0x08, 0x49, 0xfc, 0x8c, 0x4b,
+	0x7d, 0xad, 0x81, 0x7b, 0x89, 0xc0, 0xe4, 0xf3, 0x0d, 0x46, 0xef, 0x8b, 0x56, 0xe9, 0xd9, 0xee,
+	0x8c, 0x8d, 0xe9, 0x70, 0xf6, 0xc2, 0x69, 0xe7, 0x5c, 0x07, 0x82, 0x1b, 0x1a, 0x7a, 0x0b, 0x87,
+	0x11, 0xe3, 0xd4, 0x6f, 0xe2, 0xb5, 0xbb, 0x63, 0x63, 0xda, 0xc7, 0x56, 0x81, 0x2e, 0x6b, 0x70,
+	0xf2, 0xcb, 0x00, 0xab, 0x9e, 0xf6, 0x36, 0x94, 0x2b, 0xf4, 0x12, 0x7a, 0x21, 0xdd, 0xf8, 0x34,
+	0x67, 0x95, 0x99, 0x6e, 0x48, 0x37, 0xde, 0x97, 0x05, 0x72, 0xc0, 0x54, 0xac, 0x32, 0x32, 0x9c,
+	0x8d, 0x9c, 0xf2, 0x9d, 0x9c, 0xfa, 0x9d, 0x9c, 0xe6, 0x50, 0xac, 0x79, 0xc8, 0x86, 0xde, 0x8a,
+	0x04, 0xf7, 0x94, 0x87, 0xda, 0xe6, 0x00, 0xd7, 0xe5, 0x8e, 0x1d, 0xf3, 0x79, 0x76, 0xce, 0x60,
+	0xa8, 0x93, 0xf3, 0x03, 0x91, 0x73, 0xa5, 0x43, 0xb0, 0x30, 0x68, 0xe8, 0x53, 0x81, 0xa0, 0x0b,
+	0xe8, 0xc9, 0x47, 0x9f, 0xf1, 0x48, 0xd8, 0xdd, 0xf1, 0xbe, 0x16, 0xd8, 0x3e, 0x72, 0xe7, 0xcd,
+	0x70, 0x57, 0x3e, 0x16, 0xbf, 0x93, 0x1f, 0x7b, 0x60, 0x5d, 0x51, 0x11, 0x51, 0x1e, 0xd0, 0x7f,
+	0xec, 0x7e, 0x06, 0xa6, 0xda, 0xa6, 0xe5, 0x72, 0x1d, 0xce, 0x4e, 0x77, 0xc5, 0xb4, 0xaf, 0x5c,
+	0x6e, 0x53, 0x8a, 0x35, 0xb7, 0x30, 0x19, 0x57, 0xad, 0x62, 0x97, 0x4c, 0x9d, 0x1a, 0xd4, 0xd0,
+	0x62, 0x8e, 0xde, 0x80, 0xd5, 0x10, 0x78, 0xb1, 0x54, 0x1d, 0x4d, 0x39, 0xa8, 0xc1, 0x9b, 0x62,
+	0xb7, 0xda, 0xe9, 0x76, 0x9f, 0x97, 0xee, 0x07, 0x80, 0xf0, 0x81, 0x26, 0x89, 0xde, 0x16, 0xbb,
+	0xa7, 0x87, 0x4e, 0x9e, 0x58, 0x9c, 0x57, 0x1f, 0x22, 0x1e, 0x68, 0x72, 0xe1, 0xf8, 0xdd, 0x05,
+	0x1c, 0x3f, 0x71, 0x83, 0x06, 0xd0, 0xf1, 0x6e, 0x96, 0x1e, 0x3e, 0xfa, 0x0f, 0xf5, 0xc1, 0xf4,
+	0x6e, 0x17, 0xcb, 0x23, 0xa3, 0x00, 0xe7, 0x5f, 0xbd, 0xeb, 0xeb, 0xa3, 0xbd, 0xcb, 0xcb, 0x6f,
+	0x1f, 0x63, 0xa6, 0xee, 0xf2, 0x95, 0x13, 0x88, 0xb5, 0xbb, 0x92, 0x22, 0x20, 0x44, 0xba, 0xc1,
+	0x1d, 0x93, 0x69, 0xa6, 0x48, 0x70, 0x7f, 0x1e, 0x53, 0x51, 0x6b, 0x3b, 0xcf, 0xa8, 0xdc, 0x50,
+	0xe9, 0x92, 0x94, 0xb9, 0x2d, 0x17, 0xab, 0xae, 0x96, 0x75, 0xf1, 0x7b, 0x00, 0x85, 0xd0, 0x28,
+	0x3c, 0x70, 0x04, 0x00, 0x00,
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+)
+
+var configDumpFormat string
+var configDumpAnnotate bool
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "ChirpStack Geolocation Server configuration commands",
+}
+
+var configDumpCmd = &cobra.Command{
+	Use:   "dump",
+	Short: "Print the effective configuration (defaults, file, env variables and flags merged)",
+	Long: `Print the effective configuration, as it is used by the ChirpStack Geolocation Server.
+Secrets are redacted. When --annotate is set, each value is annotated with
+its source (default, file, env or flag).`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if configErr != nil {
+			return configErr
+		}
+
+		var source config.SourceFunc
+		if configDumpAnnotate {
+			var err error
+			source, err = configSource()
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := config.Dump(os.Stdout, config.C, configDumpFormat, source); err != nil {
+			return errors.Wrap(err, "dump config error")
+		}
+		return nil
+	},
+}
+
+func init() {
+	configDumpCmd.Flags().StringVarP(&configDumpFormat, "format", "f", config.DumpFormatTOML, "output format (toml or json)")
+	configDumpCmd.Flags().BoolVarP(&configDumpAnnotate, "annotate", "a", false, "annotate each value with its source")
+
+	configCmd.AddCommand(configDumpCmd)
+}
+
+// configSource returns a function returning the source of the given
+// configuration key. The precedence is the same as used by viper: flag,
+// env variable, configuration file and default.
+func configSource() (config.SourceFunc, error) {
+	var file *viper.Viper
+
+	path := cfgFile
+	if path == "" {
+		path = viper.ConfigFileUsed()
+	}
+
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "read config file error")
+		}
+
+		file = viper.New()
+		file.SetConfigType("toml")
+		if err := file.ReadConfig(bytes.NewBuffer(b)); err != nil {
+			return nil, errors.Wrap(err, "load config file error")
+		}
+	}
+
+	return func(key string) string {
+		if name, ok := flagKeys[key]; ok && rootCmd.PersistentFlags().Lookup(name).Changed {
+			return fmt.Sprintf("flag (--%s)", name)
+		}
+
+		// see viperBindEnvs
+		env := strings.ToUpper(strings.Replace(key, ".", "__", -1))
+		if v, ok := os.LookupEnv(env); ok && v != "" {
+			return fmt.Sprintf("env (%s)", env)
+		}
+
+		if file != nil && file.IsSet(key) {
+			return fmt.Sprintf("file (%s)", path)
+		}
+
+		return "default"
+	}, nil
+}
@@ -10,12 +10,37 @@ import (
 	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
 )
 
-const configTemplate = `[general]
+const configTemplate = `# This configuration file can be reloaded without restarting the server by
+# sending a SIGHUP signal. Changes to the [geo_server.api],
+# [geo_server.rest_api], [geo_server.history], [geo_server.integration],
+# [metrics] and [tracing] sections require a restart.
+#
+# Secrets (tokens, keys and passwords) can be set inline, or using one of
+# the following references, which are resolved on (re)load:
+#   * "${ENV_VAR}", replaced by the value of the environment variable
+#   * "file:///path/to/secret", replaced by the content of the file
+# Most secrets also have a *_file variant, containing the path of the file
+# holding the secret. Secrets are redacted when the configuration is printed.
+
+[general]
 # Log level
 #
 # debug=5, info=4, warning=3, error=2, fatal=1, panic=0
 log_level={{ .General.LogLevel }}
 
+# Log format.
+#
+# Valid options are:
+#   * text: human readable text format
+#   * json: one JSON object per line, e.g. for log pipelines
+#
+# Each API request is assigned a request ID, which is added to the log lines
+# of the request as request_id. When the client provides a request ID (using
+# the x-request-id gRPC metadata or X-Request-ID HTTP header), this ID is used.
+# The request ID is also sent as X-Request-ID header to the geolocation
+# service.
+log_format="{{ .General.LogFormat }}"
+
 # Geolocation-server configuration.
 [geo_server]
   # Geolocation API.
@@ -26,6 +51,8 @@ log_level={{ .General.LogLevel }}
   bind="{{ .GeoServer.API.Bind }}"
 
   # CA certificate used by the api server (optional)
+  #
+  # This CA certificate is used to verify the client certificates.
   ca_cert="{{ .GeoServer.API.CACert }}"
 
   # TLS certificate used by the api server (optional)
@@ -34,6 +61,58 @@ log_level={{ .General.LogLevel }}
   # TLS key used by the api server (optional)
   tls_key="{{ .GeoServer.API.TLSKey }}"
 
+  # Client authentication.
+  #
+  # When TLS is enabled, this defines if clients must present a certificate
+  # signed by the CA certificate. Valid options are:
+  #  * none:     client certificates are not requested (server-only TLS)
+  #  * optional: client certificates are verified when presented
+  #  * required: clients must present a valid certificate
+  #
+  # When left blank, client certificates are required when a CA certificate
+  # is configured.
+  client_auth="{{ .GeoServer.API.ClientAuth }}"
+
+  # Certificate reload interval.
+  #
+  # The certificate, key and CA certificate files are checked for changes
+  # (at most once per interval) and are reloaded without restarting the
+  # server, e.g. after being renewed.
+  cert_reload_interval="{{ .GeoServer.API.CertReloadInterval }}"
+
+  # Drain timeout.
+  #
+  # On shutdown, the api servers stop accepting new requests and in-flight
+  # requests are given this duration to complete. After the timeout, the
+  # remaining requests are cancelled.
+  drain_timeout="{{ .GeoServer.API.DrainTimeout }}"
+
+
+  # REST API.
+  #
+  # This exposes the geolocation API as REST/JSON API, for clients that
+  # can't use gRPC. Requests and responses use the Protobuf JSON mapping
+  # (the same format as used by the request log). The following endpoints
+  # are available:
+  #  * POST /api/v1/resolve/tdoa
+  #  * POST /api/v1/resolve/multi-frame-tdoa
+  [geo_server.rest_api]
+  # ip:port to bind the REST API server
+  #
+  # When left blank, the REST API is disabled.
+  bind="{{ .GeoServer.RESTAPI.Bind }}"
+
+  # TLS certificate used by the REST API server (optional)
+  tls_cert="{{ .GeoServer.RESTAPI.TLSCert }}"
+
+  # TLS key used by the REST API server (optional)
+  tls_key="{{ .GeoServer.RESTAPI.TLSKey }}"
+
+  # Certificate reload interval.
+  #
+  # The certificate and key files are checked for changes (at most once
+  # per interval) and are reloaded without restarting the server.
+  cert_reload_interval="{{ .GeoServer.RESTAPI.CertReloadInterval }}"
 
   # Geolocation backend configuration.
   [geo_server.backend]
@@ -45,9 +124,222 @@ log_level={{ .General.LogLevel }}
   # Request log directory.
   #
   # Logging requests can be used to "replay" geolocation requests and to compare
-  # different geolocation backends. When left blank, logging will be disabled.
+  # different geolocation backends. When left blank (and the s3 sink is not
+  # used), logging will be disabled.
+  # Each API call is logged as a single record, containing the request, the
+  # response or error, the backend, the latency and the request ID. The records
+  # are stored in a sub-directory per API method.
   request_log_dir="{{ .GeoServer.Backend.RequestLogDir }}"
 
+    # Request log settings.
+    [geo_server.backend.request_log]
+    # Sink.
+    #
+    # Valid options are:
+    #   * file: records are written to the request log directory
+    #   * s3: records are uploaded in batches to S3-compatible object storage
+    #         (see the s3 section below), using the same layout as the
+    #         request log directory, with an NDJSON object per batch
+    #
+    # Applications embedding the server can register other sinks (e.g. a
+    # sink publishing the records to Kafka), which are selected by name.
+    #
+    # The mode, ndjson_period, max_file_size_mb, max_age and max_total_size_mb
+    # settings only apply to the file sink. The compression setting applies to
+    # the uploaded objects as well.
+    sink="{{ .GeoServer.Backend.RequestLog.Sink }}"
+
+    # Mode.
+    #
+    # Valid options are:
+    #   * file: each record is written to a separate file, named by the time
+    #           (nanosecond precision), the DevEUI and a random suffix
+    #   * ndjson: the records are appended to NDJSON files, one record per line,
+    #             using a file per hour or day (see ndjson_period), split into
+    #             numbered parts (see max_file_size_mb)
+    #
+    # The test commands are able to read both layouts.
+    mode="{{ .GeoServer.Backend.RequestLog.Mode }}"
+
+    # NDJSON period.
+    #
+    # This defines the period covered by each NDJSON file. Valid options are
+    # hourly and daily.
+    ndjson_period="{{ .GeoServer.Backend.RequestLog.NDJSONPeriod }}"
+
+    # Max. NDJSON file size (MB).
+    #
+    # When appending a record would exceed this size, a new part is started.
+    # Set this to 0 to disable size based rotation.
+    max_file_size_mb={{ .GeoServer.Backend.RequestLog.MaxFileSizeMB }}
+
+    # Compression.
+    #
+    # Closed files (NDJSON files of which the period has ended or for which
+    # a new part has been started, and record files) are compressed in the
+    # background. Closed files are never appended to, records of an ended
+    # period which are written afterwards are written to a new part.
+    # Valid options are:
+    #   * none: files are not compressed
+    #   * gzip: files are gzip compressed (.gz suffix)
+    #   * zstd: files are zstd compressed (.zst suffix)
+    #
+    # The test commands are able to read compressed files.
+    compression="{{ .GeoServer.Backend.RequestLog.Compression }}"
+
+    # Max. age.
+    #
+    # Closed files older than this duration are removed. Set this to 0 to
+    # keep files regardless of their age.
+    max_age="{{ .GeoServer.Backend.RequestLog.MaxAge }}"
+
+    # Max. total size (MB).
+    #
+    # When the request log files exceed this total size, the oldest closed
+    # files are removed. Set this to 0 to disable this limit.
+    max_total_size_mb={{ .GeoServer.Backend.RequestLog.MaxTotalSizeMB }}
+
+    # Log upstream bodies.
+    #
+    # When enabled, the raw request and response bodies of the calls to the
+    # geolocation service are included in each record.
+    upstream_bodies={{ .GeoServer.Backend.RequestLog.UpstreamBodies }}
+
+    # Queue size.
+    #
+    # Records are written by a background worker, such that logging does not
+    # block the API calls. This defines the max. number of records waiting
+    # to be written. When the queue is full, records are dropped (see the
+    # backend_request_log_record_dropped_count metric).
+    queue_size={{ .GeoServer.Backend.RequestLog.QueueSize }}
+
+      # Request log privacy.
+      #
+      # These settings are applied before the records are written, such that
+      # request logs can be shared (e.g. with geolocation vendors) while they
+      # remain replayable. The test commands pseudonymize the identifiers of
+      # requests which were logged without pseudonymization (coordinates are
+      # replayed as logged), and refuse requests which were pseudonymized
+      # using a different HMAC key.
+      [geo_server.backend.request_log.privacy]
+      # HMAC key.
+      #
+      # When set, the DevEUIs and gateway IDs are replaced by a keyed
+      # HMAC-SHA256 pseudonym of the same length. The same key always results
+      # in the same pseudonyms, so keep the key secret and stable. When
+      # pseudonymization or coordinate rounding is enabled, upstream bodies
+      # are not logged.
+      hmac_key="{{ .GeoServer.Backend.RequestLog.Privacy.HMACKey }}"
+
+      # HMAC key file.
+      #
+      # Path of the file containing the HMAC key. This can't be used in
+      # combination with hmac_key.
+      hmac_key_file="{{ .GeoServer.Backend.RequestLog.Privacy.HMACKeyFile }}"
+
+      # Coordinate decimals.
+      #
+      # When set, the gateway and resolved coordinates are rounded to this
+      # number of decimals (e.g. 3 decimals is roughly 100 meters). Set this
+      # to 0 to disable rounding.
+      coordinate_decimals={{ .GeoServer.Backend.RequestLog.Privacy.CoordinateDecimals }}
+
+      # Drop fields.
+      #
+      # The fields to remove from each record, as dot-separated paths. Arrays
+      # are traversed, e.g.:
+      # drop_fields=["request.frameRXInfo.rxInfo.rssi", "error.message"]
+      drop_fields=[{{ range $index, $elm := .GeoServer.Backend.RequestLog.Privacy.DropFields }}{{ if $index }}, {{ end }}"{{ $elm }}"{{ end }}]
+
+      # Request log sampling.
+      #
+      # These settings define which calls are logged. A call is only logged
+      # when all conditions are met.
+      [geo_server.backend.request_log.sampling]
+      # Percentage.
+      #
+      # The percentage (0 - 100) of calls to log, selected randomly. When set
+      # to 0, all calls are logged. To log no calls, disable the request log.
+      percentage={{ .GeoServer.Backend.RequestLog.Sampling.Percentage }}
+
+      # DevEUIs.
+      #
+      # When set, only the calls for these devices are logged, e.g.:
+      # dev_euis=["0102030405060708"]
+      dev_euis=[{{ range $index, $elm := .GeoServer.Backend.RequestLog.Sampling.DevEUIs }}{{ if $index }}, {{ end }}"{{ $elm }}"{{ end }}]
+
+      # Only failures.
+      #
+      # When enabled, only the calls returning an error are logged.
+      only_failures={{ .GeoServer.Backend.RequestLog.Sampling.OnlyFailures }}
+
+      # Min. gateway count.
+      #
+      # Only the calls for frames received by at least this number of
+      # (unique) gateways are logged.
+      min_gateway_count={{ .GeoServer.Backend.RequestLog.Sampling.MinGatewayCount }}
+
+      # S3 sink.
+      #
+      # This can be used with AWS S3 or any S3-compatible object storage (e.g.
+      # MinIO). Requests are signed using AWS Signature Version 4.
+      [geo_server.backend.request_log.s3]
+      # Endpoint.
+      #
+      # E.g. https://s3.eu-west-1.amazonaws.com or http://localhost:9000.
+      endpoint="{{ .GeoServer.Backend.RequestLog.S3.Endpoint }}"
+
+      # Region.
+      region="{{ .GeoServer.Backend.RequestLog.S3.Region }}"
+
+      # Bucket.
+      bucket="{{ .GeoServer.Backend.RequestLog.S3.Bucket }}"
+
+      # Prefix.
+      #
+      # The objects are stored as <prefix>/<method>/<time>.<random>.ndjson.
+      prefix="{{ .GeoServer.Backend.RequestLog.S3.Prefix }}"
+
+      # Path-style addressing.
+      #
+      # When enabled, the bucket is added to the path (<endpoint>/<bucket>/<key>)
+      # instead of the hostname (<bucket>.<endpoint host>/<key>). Most
+      # self-hosted S3-compatible services require path-style addressing.
+      path_style={{ .GeoServer.Backend.RequestLog.S3.PathStyle }}
+
+      # Access key ID.
+      access_key_id="{{ .GeoServer.Backend.RequestLog.S3.AccessKeyID }}"
+
+      # Secret access key.
+      secret_access_key="{{ .GeoServer.Backend.RequestLog.S3.SecretAccessKey }}"
+
+      # Secret access key file.
+      #
+      # Path of the file containing the secret access key. This can't be used
+      # in combination with secret_access_key.
+      secret_access_key_file="{{ .GeoServer.Backend.RequestLog.S3.SecretAccessKeyFile }}"
+
+      # Batch size.
+      #
+      # The max. number of records per object. A batch is uploaded once it is
+      # full, or when the batch interval has elapsed. A batch which can't be
+      # uploaded because of a connection or server error is kept in memory
+      # and retried with an increasing backoff (up to 5 minutes). It is
+      # dropped after 12 attempts, or when more than 100 batches are waiting
+      # to be retried. On shutdown, the failed batches are retried 3 times.
+      batch_size={{ .GeoServer.Backend.RequestLog.S3.BatchSize }}
+
+      # Batch interval.
+      #
+      # The interval in which the pending batches are uploaded.
+      batch_interval="{{ .GeoServer.Backend.RequestLog.S3.BatchInterval }}"
+
+      # Request timeout.
+      #
+      # Batches which fail to upload within this timeout are dropped (see the
+      # backend_request_log_object_upload_count metric).
+      request_timeout="{{ .GeoServer.Backend.RequestLog.S3.RequestTimeout }}"
+
     # Collos backend.
     [geo_server.backend.collos]
     # Collos subscription key.
@@ -56,6 +348,12 @@ log_level={{ .General.LogLevel }}
     # http://preview.collos.org/
     subscription_key="{{ .GeoServer.Backend.Collos.SubscriptionKey }}"
 
+    # Subscription key file.
+    #
+    # Path of the file containing the subscription key. This can't be used
+    # in combination with subscription_key.
+    subscription_key_file="{{ .GeoServer.Backend.Collos.SubscriptionKeyFile }}"
+
     # Request timeout.
     #
     # This defines the request timeout when making calls to the Collos API.
@@ -76,15 +374,418 @@ log_level={{ .General.LogLevel }}
     # API token.
     token="{{ .GeoServer.Backend.LoRaCloud.Token }}"
 
+    # API token file.
+    #
+    # Path of the file containing the API token. This can't be used in
+    # combination with token.
+    token_file="{{ .GeoServer.Backend.LoRaCloud.TokenFile }}"
+
     # Request timeout.
     #
     # This defines the request timeout when making calls to the LoRa Cloud API.
     request_timeout="{{ .GeoServer.Backend.LoRaCloud.RequestTimeout }}"
 
 
+    # Upstream probe.
+    #
+    # When enabled, the upstream geolocation service is periodically probed.
+    # After the configured number of consecutive failed probes, the server
+    # reports itself as not ready (see the /readyz endpoint and the gRPC
+    # health service), until the next successful probe.
+    [geo_server.backend.upstream_probe]
+    # Probe interval.
+    #
+    # Set to 0 to disable the upstream probe.
+    interval="{{ .GeoServer.Backend.UpstreamProbe.Interval }}"
+
+    # Probe timeout.
+    timeout="{{ .GeoServer.Backend.UpstreamProbe.Timeout }}"
+
+    # Failure threshold.
+    #
+    # The number of consecutive failed probes before reporting not ready.
+    failure_threshold={{ .GeoServer.Backend.UpstreamProbe.FailureThreshold }}
+
+
+  # Location history.
+  #
+  # When enabled, all resolved locations are stored and can be retrieved
+  # using the location history API, which is served on the same ip:port
+  # as the geolocation API.
+  [geo_server.history]
+  # Database path.
+  #
+  # Path to the database file in which the location history is stored.
+  # When left blank, the location history will be disabled.
+  path="{{ .GeoServer.History.Path }}"
+
+  # Max. age.
+  #
+  # Locations older than this duration are deleted (checked every hour).
+  # Set this to 0 to keep all locations.
+  max_age="{{ .GeoServer.History.MaxAge }}"
+
+
+  # Location smoothing.
+  #
+  # When enabled, each resolved location is smoothed using a per-device
+  # constant-velocity Kalman filter. The reported accuracy of the location is
+  # used as measurement noise.
+  [geo_server.smoothing]
+  # Enable location smoothing.
+  enabled={{ .GeoServer.Smoothing.Enabled }}
+
+  # Process noise.
+  #
+  # This defines the (default) process noise of the Kalman filter, expressed
+  # as acceleration in m/s². Lower values result in smoother tracks, but
+  # the filter will be slower to follow changes in speed or direction.
+  # This value can be overridden per device profile.
+  process_noise={{ .GeoServer.Smoothing.ProcessNoise }}
+
+  # State timeout.
+  #
+  # When the previous location of a device is older than the configured
+  # timeout, the filter state of the device is reset. The state of devices
+  # which have not been seen within this timeout is removed from memory.
+  # Set this to 0 to never reset (nor remove) the filter state.
+  state_timeout="{{ .GeoServer.Smoothing.StateTimeout }}"
+
+
+  # Plausibility check.
+  #
+  # When enabled, each resolved location is compared to the previous
+  # accepted location of the device. Locations implying a speed above the
+  # configured max. speed or locations outside the allowed region are
+  # considered implausible.
+  [geo_server.plausibility]
+  # Enable the plausibility check.
+  enabled={{ .GeoServer.Plausibility.Enabled }}
+
+  # Action.
+  #
+  # The action to take on an implausible location. Valid options are:
+  #  * reject:        return an error
+  #  * last_location: return the last accepted location instead
+  #  * flag:          log a warning, but return the location
+  action="{{ .GeoServer.Plausibility.Action }}"
+
+  # Max. speed (m/s).
+  #
+  # This defines the (default) max. plausible speed between two successive
+  # locations. The accuracy of both locations is taken into account.
+  # This value can be overridden per device profile. Set to 0 to disable.
+  max_speed={{ .GeoServer.Plausibility.MaxSpeed }}
+
+  # State timeout.
+  #
+  # When the last accepted location of a device is older than the configured
+  # timeout, it is removed from memory and the next location of the device
+  # is only checked against the allowed region. Set this to 0 to keep the
+  # last accepted locations.
+  state_timeout="{{ .GeoServer.Plausibility.StateTimeout }}"
+
+    # Allowed region.
+    #
+    # Locations outside this bounding-box are considered implausible. When
+    # all values are 0, this check is disabled.
+    [geo_server.plausibility.allowed_region]
+    min_latitude={{ .GeoServer.Plausibility.AllowedRegion.MinLatitude }}
+    min_longitude={{ .GeoServer.Plausibility.AllowedRegion.MinLongitude }}
+    max_latitude={{ .GeoServer.Plausibility.AllowedRegion.MaxLatitude }}
+    max_longitude={{ .GeoServer.Plausibility.AllowedRegion.MaxLongitude }}
+
+
+  # Geofences.
+  #
+  # When configured, each resolved location is evaluated against the
+  # geofences. Enter, exit and dwell events are sent to the enabled
+  # integrations.
+  [geo_server.geofence]
+  # Geofence source.
+  #
+  # Path to a GeoJSON file or http(s) URL returning a GeoJSON
+  # FeatureCollection. Polygon features are used as polygon geofences,
+  # Point features with a 'radius' property (meters) as circle geofences.
+  # The following feature properties are supported:
+  #  * name:     name of the geofence
+  #  * radius:   radius in meters (Point features only)
+  #  * dev_euis: list of DevEUIs to which the geofence applies (optional)
+  #  * clip:     clip the locations of devices known to be inside the
+  #              geofence to the geofence, e.g. for indoor sites (optional)
+  #
+  # When left blank, geofencing is disabled.
+  source="{{ .GeoServer.Geofence.Source }}"
+
+  # Refresh interval.
+  #
+  # The interval in which the geofences are re-loaded from the source.
+  refresh_interval="{{ .GeoServer.Geofence.RefreshInterval }}"
+
+  # Dwell time.
+  #
+  # When set, a dwell event is sent once a device has been inside a geofence
+  # for the configured duration. Set to 0 to disable dwell events.
+  dwell_time="{{ .GeoServer.Geofence.DwellTime }}"
+
+  # State timeout.
+  #
+  # The geofence state of devices which have not been seen within this
+  # duration is removed from memory. When such a device is seen again, its
+  # state is unknown, e.g. it is not assumed to be inside any geofence.
+  # Set this to 0 to keep the state of all devices.
+  state_timeout="{{ .GeoServer.Geofence.StateTimeout }}"
+
+
+  # Integration configuration.
+  [geo_server.integration]
+  # Enabled integrations.
+  #
+  # Enabled integrations are enabled for all events. Multiple integrations
+  # can be enabled. Valid options are:
+  #  * log:  log events
+  #  * http: HTTP (webhook) integration
+  #  * mqtt: MQTT integration
+  #
+  # Location events are sent for each resolved location, geofence events
+  # when geofencing has been configured.
+  enabled=[{{ range $index, $elm := .GeoServer.Integration.Enabled }}{{ if $index }}, {{ end }}"{{ $elm }}"{{ end }}]
+
+  # Payload marshaler.
+  #
+  # This defines how the event payloads are encoded. Valid options are:
+  #  * json:     Protobuf JSON mapping
+  #  * protobuf: Protobuf binary encoding
+  marshaler="{{ .GeoServer.Integration.Marshaler }}"
+
+  # Queue size.
+  #
+  # Events are sent asynchronously, so that sending events never blocks
+  # the geolocation API. This defines the max. number of queued events.
+  # When the queue is full, new events are dropped.
+  queue_size={{ .GeoServer.Integration.QueueSize }}
+
+    # HTTP integration.
+    #
+    # Events are POSTed to the configured endpoints. The event type
+    # is added as 'event' query parameter.
+    [geo_server.integration.http]
+    # Endpoint URLs.
+    endpoints=[{{ range $index, $elm := .GeoServer.Integration.HTTP.Endpoints }}{{ if $index }}, {{ end }}"{{ $elm }}"{{ end }}]
+
+    # HMAC secret.
+    #
+    # When set, the payload is signed using HMAC-SHA256 with the given
+    # secret. The hex encoded signature is added as X-Signature-256 header,
+    # prefixed by 'sha256='.
+    hmac_secret="{{ .GeoServer.Integration.HTTP.HMACSecret }}"
+
+    # HMAC secret file.
+    #
+    # Path of the file containing the HMAC secret. This can't be used in
+    # combination with hmac_secret.
+    hmac_secret_file="{{ .GeoServer.Integration.HTTP.HMACSecretFile }}"
+
+    # Request timeout.
+    #
+    # An endpoint which can't be reached within this timeout is backed off
+    # (1s, doubling up to 5m). While backing off, events for the endpoint
+    # are queued directly (or fail when no retry queue is configured).
+    timeout="{{ .GeoServer.Integration.HTTP.Timeout }}"
+
+    # Retry queue directory.
+    #
+    # Failed deliveries are stored in this directory and are retried
+    # periodically. As the queue is stored on disk, pending deliveries
+    # survive a restart. When left blank, failed deliveries are not retried.
+    retry_queue_dir="{{ .GeoServer.Integration.HTTP.RetryQueueDir }}"
+
+    # Retry queue size.
+    #
+    # The max. number of deliveries in the retry queue. When the queue is
+    # full, failed deliveries are dropped.
+    retry_queue_size={{ .GeoServer.Integration.HTTP.RetryQueueSize }}
+
+    # Retry interval.
+    retry_interval="{{ .GeoServer.Integration.HTTP.RetryInterval }}"
+
+    # Max. retries.
+    #
+    # After the given number of retries, the delivery is dropped. Set to 0
+    # to retry forever.
+    max_retries={{ .GeoServer.Integration.HTTP.MaxRetries }}
+
+      # Custom headers.
+      #
+      # Custom headers to add to each request, e.g.:
+      # Authorization="Bearer secret-token"
+      # Authorization="Bearer ${HTTP_INTEGRATION_TOKEN}"
+      [geo_server.integration.http.headers]
+{{ range $k, $v := .GeoServer.Integration.HTTP.Headers }}      {{ $k }}="{{ $v }}"
+{{ end }}
+
+    # MQTT integration.
+    [geo_server.integration.mqtt]
+    # MQTT server (e.g. scheme://host:port where scheme is tcp, ssl or ws)
+    server="{{ .GeoServer.Integration.MQTT.Server }}"
+
+    # Connect with the given username (optional)
+    username="{{ .GeoServer.Integration.MQTT.Username }}"
+
+    # Connect with the given password (optional)
+    password="{{ .GeoServer.Integration.MQTT.Password }}"
+
+    # Password file (optional)
+    #
+    # Path of the file containing the password. This can't be used in
+    # combination with password.
+    password_file="{{ .GeoServer.Integration.MQTT.PasswordFile }}"
+
+    # Client ID (optional)
+    #
+    # Set this to an unique value. When left blank, a random ID will be
+    # generated.
+    client_id="{{ .GeoServer.Integration.MQTT.ClientID }}"
+
+    # Quality of service level
+    #
+    # 0: at most once
+    # 1: at least once
+    # 2: exactly once
+    #
+    # Note: an increase of this value will decrease the performance.
+    # For more information: https://www.hivemq.com/blog/mqtt-essentials-part-6-mqtt-quality-of-service-levels
+    qos={{ .GeoServer.Integration.MQTT.QOS }}
+
+    # Clean session
+    #
+    # Set the "clean session" flag in the connect message when this client
+    # connects to an MQTT broker. By setting this flag you are indicating
+    # that no messages saved by the broker for this client should be delivered.
+    clean_session={{ .GeoServer.Integration.MQTT.CleanSession }}
+
+    # CA certificate file (optional)
+    #
+    # Use this when setting up a secure connection (when server uses ssl://...)
+    # but the certificate used by the server is not trusted by any CA certificate
+    # on the server (e.g. when self generated).
+    ca_cert="{{ .GeoServer.Integration.MQTT.CACert }}"
+
+    # TLS certificate file (optional)
+    tls_cert="{{ .GeoServer.Integration.MQTT.TLSCert }}"
+
+    # TLS key file (optional)
+    tls_key="{{ .GeoServer.Integration.MQTT.TLSKey }}"
+
+    # Location event topic template.
+    #
+    # The template is rendered with the DevEUI of the device (.DevEUI).
+    location_topic_template="{{ .GeoServer.Integration.MQTT.LocationTopicTemplate }}"
+
+    # Geofence event topic template.
+    geofence_topic_template="{{ .GeoServer.Integration.MQTT.GeofenceTopicTemplate }}"
+
+
+  # API authentication.
+  #
+  # When enabled, clients of the geolocation, location history and REST
+  # APIs must authenticate using a token or a client certificate. Tokens
+  # are sent as 'authorization: Bearer <token>' or 'x-api-key: <token>'
+  # gRPC metadata (or HTTP headers in case of the REST API). Client
+  # certificates require the api server client_auth to be set to optional
+  # or required. The gRPC health service does not require authentication.
+  [geo_server.auth]
+  # Enable authentication.
+  enabled={{ .GeoServer.Auth.Enabled }}
+
+  # Clients.
+  #
+  # Example:
+  # [[geo_server.auth.clients]]
+  # # Name of the client.
+  # #
+  # # This name is used in the logs and metrics.
+  # name="network-server"
+  #
+  # # Tokens.
+  # #
+  # # Tokens can be configured as plain-text or as SHA256 hash, prefixed by
+  # # 'sha256:'. The hash can be generated using:
+  # #   echo -n "secret-token" | sha256sum
+  # tokens=["sha256:930bbdc51b6aed5c2a5678fd6e28dee7a05e8a4b643cfc0b4427c3efb86c0d94"]
+  #
+  # # Client certificate subjects.
+  # #
+  # # Matched against the common name or the full subject (e.g.
+  # # 'CN=network-server,O=Example') of the verified client certificate.
+  # cert_subjects=["network-server"]
+  #
+  # # Allowed methods (e.g. ResolveTDOA, GetTrack). All methods are allowed
+  # # when left blank.
+  # methods=["ResolveTDOA", "ResolveMultiFrameTDOA"]
+  #
+  # # Allowed backends (e.g. lora_cloud). All backends are allowed when
+  # # left blank.
+  # backends=["lora_cloud"]
+  #
+  # # Allowed DevEUI ranges (inclusive). All DevEUIs are allowed when left
+  # # blank. When set, methods without DevEUI in the request (e.g.
+  # # ListDevicesInBoundingBox) are denied.
+  # dev_eui_ranges=["0102030405060000-010203040506ffff"]
+  #
+  # # Request quota (per minute).
+  # #
+  # # Requests exceeding the quota are rejected with RESOURCE_EXHAUSTED.
+  # # Set this to 0 to disable the quota.
+  # requests_per_minute=600
+{{ range $index, $client := .GeoServer.Auth.Clients }}
+  [[geo_server.auth.clients]]
+  name="{{ $client.Name }}"
+  tokens=[{{ range $i, $e := $client.Tokens }}{{ if $i }}, {{ end }}"{{ $e }}"{{ end }}]
+  cert_subjects=[{{ range $i, $e := $client.CertSubjects }}{{ if $i }}, {{ end }}"{{ $e }}"{{ end }}]
+  methods=[{{ range $i, $e := $client.Methods }}{{ if $i }}, {{ end }}"{{ $e }}"{{ end }}]
+  backends=[{{ range $i, $e := $client.Backends }}{{ if $i }}, {{ end }}"{{ $e }}"{{ end }}]
+  dev_eui_ranges=[{{ range $i, $e := $client.DevEUIRanges }}{{ if $i }}, {{ end }}"{{ $e }}"{{ end }}]
+  requests_per_minute={{ $client.RequestsPerMinute }}
+{{ end }}
+
+  # Device profiles.
+  #
+  # Device profiles can be used to override the post-processing settings
+  # for a set of devices, e.g. for stationary assets vs. vehicles.
+  # Settings that are not set fall back to the defaults.
+  #
+  # Example:
+  # [[geo_server.device_profiles]]
+  # # Name of the profile.
+  # name="vehicle"
+  #
+  # # DevEUIs of the devices using this profile.
+  # dev_euis=["0102030405060708"]
+  #
+  # # Smoothing process noise (m/s²).
+  # smoothing_process_noise=3.0
+  #
+  # # Max. speed (m/s).
+  # max_speed=50.0
+{{ range $index, $profile := .GeoServer.DeviceProfiles }}
+  [[geo_server.device_profiles]]
+  name="{{ $profile.Name }}"
+  dev_euis=[{{ range $i, $e := $profile.DevEUIs }}{{ if $i }}, {{ end }}"{{ $e }}"{{ end }}]
+{{- with $profile.SmoothingProcessNoise }}
+  smoothing_process_noise={{ . }}
+{{- end }}
+{{- with $profile.MaxSpeed }}
+  max_speed={{ . }}
+{{- end }}
+{{ end }}
+
 # Prometheus metrics settings.
 [metrics.prometheus]
 # Enable Prometheus metrics endpoint.
+#
+# Besides the metrics, this server also exposes the /healthz (liveness)
+# and /readyz (readiness) endpoints.
 endpoint_enabled={{ .Metrics.Prometheus.EndpointEnabled }}
 
 # The ip:port to bind the Prometheus metrics server to for serving the
@@ -96,14 +797,59 @@ bind="{{ .Metrics.Prometheus.Bind }}"
 # By setting this to true, the API request timing histogram will be enabled.
 # See also: https://github.com/grpc-ecosystem/go-grpc-prometheus#histograms
 api_timing_histogram={{ .Metrics.Prometheus.APITimingHistogram }}
-`
+
+
+# Tracing configuration.
+#
+# When enabled, a span is created for each API request, the request
+# pre-processing, the backend call and the outgoing HTTP request to the
+# geolocation service. The trace context is propagated using the W3C
+# traceparent header (gRPC metadata for the gRPC API).
+[tracing]
+# Exporter.
+#
+# Valid options are:
+#   * stdout: write the spans as JSON to stdout
+#   * otlp:   export the spans using OTLP (HTTP / protobuf)
+# When left blank, tracing is disabled.
+exporter="{{ .Tracing.Exporter }}"
+
+# Service name.
+#
+# This is exported as the service.name resource attribute.
+service_name="{{ .Tracing.ServiceName }}"
+
+# Sample ratio.
+#
+# The ratio (0 - 1) of the traces to sample. This only applies to new
+# traces, requests containing a trace context follow the sampling decision
+# of the caller.
+sample_ratio={{ .Tracing.SampleRatio }}
+
+  # OTLP exporter configuration.
+  [tracing.otlp]
+  # Endpoint.
+  #
+  # The URL of the OTLP/HTTP traces endpoint of the collector.
+  endpoint="{{ .Tracing.OTLP.Endpoint }}"
+
+  # Request timeout.
+  timeout="{{ .Tracing.OTLP.Timeout }}"
+
+    # Custom headers.
+    #
+    # Custom headers to add to each request, e.g. for authentication.
+    [tracing.otlp.headers]
+{{ range $k, $v := .Tracing.OTLP.Headers }}    {{ $k }}="{{ $v }}"
+{{ end }}`
 
 var configfileCmd = &cobra.Command{
 	Use:   "configfile",
 	Short: "Print the LoRa Geolocation Server configuration file",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		t := template.Must(template.New("config").Parse(configTemplate))
-		err := t.Execute(os.Stdout, &config.C)
+		c := config.Redact(config.C)
+		err := t.Execute(os.Stdout, &c)
 		if err != nil {
 			return errors.Wrap(err, "execute config template error")
 		}
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -18,6 +19,16 @@ import (
 var cfgFile string
 var version string
 
+// configErr holds the error (if any) of resolving the configuration secrets.
+// This is reported by the commands using the configuration, so that other
+// commands (e.g. version) keep working.
+var configErr error
+
+// flagKeys maps the configuration keys to the flags they are bound to.
+var flagKeys = map[string]string{
+	"general.log_level": "log-level",
+}
+
 var rootCmd = &cobra.Command{
 	Use:   "chirpstack-geolocation-server",
 	Short: "ChirpStack Geolocation Server",
@@ -33,15 +44,56 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "", "path to configuration file (optional)")
 	rootCmd.PersistentFlags().Int("log-level", 4, "debug=5, info=4, error=2, fatal=1, panic=0")
 
-	viper.BindPFlag("general.log_level", rootCmd.PersistentFlags().Lookup("log-level"))
+	for key, flag := range flagKeys {
+		viper.BindPFlag(key, rootCmd.PersistentFlags().Lookup(flag))
+	}
 
+	viper.SetDefault("general.log_format", "text")
 	viper.SetDefault("geo_server.api.bind", "0.0.0.0:8005")
+	viper.SetDefault("geo_server.api.drain_timeout", 30*time.Second)
+	viper.SetDefault("geo_server.api.cert_reload_interval", 10*time.Second)
+	viper.SetDefault("geo_server.rest_api.cert_reload_interval", 10*time.Second)
 	viper.SetDefault("geo_server.backend.type", "collos")
+	viper.SetDefault("geo_server.backend.request_log.mode", "file")
+	viper.SetDefault("geo_server.backend.request_log.ndjson_period", "hourly")
+	viper.SetDefault("geo_server.backend.request_log.max_file_size_mb", 100)
+	viper.SetDefault("geo_server.backend.request_log.compression", "none")
+	viper.SetDefault("geo_server.backend.request_log.queue_size", 1000)
+	viper.SetDefault("geo_server.backend.request_log.sink", "file")
+	viper.SetDefault("geo_server.backend.request_log.s3.region", "us-east-1")
+	viper.SetDefault("geo_server.backend.request_log.s3.batch_size", 1000)
+	viper.SetDefault("geo_server.backend.request_log.s3.batch_interval", time.Minute)
+	viper.SetDefault("geo_server.backend.request_log.s3.request_timeout", 30*time.Second)
+	viper.SetDefault("geo_server.backend.request_log.sampling.percentage", 100)
 	viper.SetDefault("geo_server.backend.collos.request_timeout", time.Second)
 	viper.SetDefault("geo_server.backend.lora_cloud.request_timeout", time.Second)
+	viper.SetDefault("geo_server.backend.upstream_probe.timeout", 5*time.Second)
+	viper.SetDefault("geo_server.backend.upstream_probe.failure_threshold", 3)
+	viper.SetDefault("geo_server.smoothing.process_noise", 0.1)
+	viper.SetDefault("geo_server.smoothing.state_timeout", time.Hour)
+	viper.SetDefault("geo_server.plausibility.action", "reject")
+	viper.SetDefault("geo_server.plausibility.state_timeout", time.Hour)
+	viper.SetDefault("geo_server.geofence.refresh_interval", time.Minute)
+	viper.SetDefault("geo_server.geofence.state_timeout", 24*time.Hour)
+	viper.SetDefault("geo_server.integration.marshaler", "json")
+	viper.SetDefault("geo_server.integration.queue_size", 1000)
+	viper.SetDefault("geo_server.integration.http.timeout", 5*time.Second)
+	viper.SetDefault("geo_server.integration.http.retry_queue_size", 10000)
+	viper.SetDefault("geo_server.integration.http.retry_interval", 30*time.Second)
+	viper.SetDefault("geo_server.integration.http.max_retries", 20)
+	viper.SetDefault("geo_server.integration.mqtt.server", "tcp://localhost:1883")
+	viper.SetDefault("geo_server.integration.mqtt.clean_session", true)
+	viper.SetDefault("geo_server.integration.mqtt.location_topic_template", "geo/{{ .DevEUI }}/location")
+	viper.SetDefault("geo_server.integration.mqtt.geofence_topic_template", "geo/{{ .DevEUI }}/geofence")
+	viper.SetDefault("tracing.service_name", "chirpstack-geolocation-server")
+	viper.SetDefault("tracing.sample_ratio", 1.0)
+	viper.SetDefault("tracing.otlp.endpoint", "http://localhost:4318/v1/traces")
+	viper.SetDefault("tracing.otlp.timeout", 10*time.Second)
 
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(configfileCmd)
+	rootCmd.AddCommand(validateConfigCmd)
+	rootCmd.AddCommand(configCmd)
 	rootCmd.AddCommand(testResolveTDOA)
 	rootCmd.AddCommand(testResolveMultiFrameTDOA)
 }
@@ -99,6 +151,42 @@ func initConfig() {
 	if err := viper.Unmarshal(&config.C); err != nil {
 		log.WithError(err).Fatal("unmarshal config error")
 	}
+
+	if err := config.ResolveSecrets(&config.C); err != nil {
+		configErr = errors.Wrap(err, "resolve secrets error")
+	}
+}
+
+// readConfig re-reads the configuration file (if any) and returns the
+// resulting configuration. Defaults, environment variables and flags are
+// applied as on startup.
+func readConfig() (config.Config, error) {
+	var c config.Config
+
+	if cfgFile != "" {
+		b, err := ioutil.ReadFile(cfgFile)
+		if err != nil {
+			return c, errors.Wrap(err, "read config file error")
+		}
+
+		if err := viper.ReadConfig(bytes.NewBuffer(b)); err != nil {
+			return c, errors.Wrap(err, "load config file error")
+		}
+	} else if viper.ConfigFileUsed() != "" {
+		if err := viper.ReadInConfig(); err != nil {
+			return c, errors.Wrap(err, "read configuration file error")
+		}
+	}
+
+	if err := viper.Unmarshal(&c); err != nil {
+		return c, errors.Wrap(err, "unmarshal config error")
+	}
+
+	if err := config.ResolveSecrets(&c); err != nil {
+		return c, errors.Wrap(err, "resolve secrets error")
+	}
+
+	return c, nil
 }
 
 func viperBindEnvs(iface interface{}, parts ...string) {
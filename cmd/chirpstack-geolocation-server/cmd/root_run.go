@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"os/signal"
+	"reflect"
 	"syscall"
+	"time"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -11,14 +15,24 @@ import (
 
 	"github.com/brocaar/chirpstack-geolocation-server/internal/backend"
 	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/integration"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/logging"
 	"github.com/brocaar/chirpstack-geolocation-server/internal/metrics"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/storage"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/tracing"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/validation"
 )
 
 func run(cmd *cobra.Command, args []string) error {
 	tasks := []func() error{
 		setLogLevel,
+		setLogFormat,
 		printStartMessage,
+		validateConfig,
 		setupMetrics,
+		setupTracing,
+		setupStorage,
+		setupIntegration,
 		setupBackend,
 	}
 
@@ -28,9 +42,91 @@ func run(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	sigChan := make(chan os.Signal)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	log.WithField("signal", <-sigChan).Info("signal received")
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+
+	for sig := range sigChan {
+		log.WithField("signal", sig).Info("signal received")
+
+		if sig != syscall.SIGHUP {
+			break
+		}
+
+		if err := reload(); err != nil {
+			log.WithError(err).Error("reload configuration error, keeping current configuration")
+		}
+	}
+
+	exitChan := make(chan struct{})
+	go func() {
+		log.Warning("stopping chirpstack-geolocation-server")
+
+		shutdownTasks := []func() error{
+			shutdownBackend,
+			closeIntegration,
+			closeStorage,
+			closeTracing,
+			shutdownMetrics,
+		}
+
+		for _, t := range shutdownTasks {
+			if err := t(); err != nil {
+				log.Error(err)
+			}
+		}
+
+		close(exitChan)
+	}()
+
+	for {
+		select {
+		case <-exitChan:
+			return nil
+		case s := <-sigChan:
+			if s == syscall.SIGHUP {
+				continue
+			}
+			log.WithField("signal", s).Info("signal received, stopping immediately")
+			return nil
+		}
+	}
+}
+
+// reload re-reads the configuration and rebuilds the backend chain. Changes
+// to the api listeners, storage, integrations, metrics and tracing require a
+// restart.
+func reload() error {
+	c, err := readConfig()
+	if err != nil {
+		return errors.Wrap(err, "read configuration error")
+	}
+
+	if err := backend.Reload(c); err != nil {
+		return errors.Wrap(err, "reload backend error")
+	}
+
+	for name, changed := range map[string]bool{
+		"geo_server.api":         !reflect.DeepEqual(c.GeoServer.API, config.C.GeoServer.API),
+		"geo_server.rest_api":    !reflect.DeepEqual(c.GeoServer.RESTAPI, config.C.GeoServer.RESTAPI),
+		"geo_server.history":     !reflect.DeepEqual(c.GeoServer.History, config.C.GeoServer.History),
+		"geo_server.integration": !reflect.DeepEqual(c.GeoServer.Integration, config.C.GeoServer.Integration),
+		"metrics":                !reflect.DeepEqual(c.Metrics, config.C.Metrics),
+		"tracing":                !reflect.DeepEqual(c.Tracing, config.C.Tracing),
+	} {
+		if changed {
+			log.WithField("section", name).Warning("configuration changes in this section require a restart")
+		}
+	}
+
+	config.C = c
+	if err := setLogLevel(); err != nil {
+		return err
+	}
+	if err := setLogFormat(); err != nil {
+		return err
+	}
+
+	log.Info("configuration reloaded")
 
 	return nil
 }
@@ -40,6 +136,28 @@ func setLogLevel() error {
 	return nil
 }
 
+func setLogFormat() error {
+	if err := logging.SetFormat(config.C.General.LogFormat); err != nil {
+		return errors.Wrap(err, "set log format error")
+	}
+	return nil
+}
+
+func validateConfig() error {
+	if configErr != nil {
+		return configErr
+	}
+
+	err := validation.Validate(config.C)
+	if errs, ok := err.(validation.Errors); ok {
+		for _, e := range errs {
+			log.WithError(e).Error("invalid configuration")
+		}
+		return fmt.Errorf("invalid configuration (%d errors), see also the validate-config command", len(errs))
+	}
+	return err
+}
+
 func printStartMessage() error {
 	log.WithFields(log.Fields{
 		"version": version,
@@ -55,6 +173,68 @@ func setupBackend() error {
 	return nil
 }
 
+func setupStorage() error {
+	if err := storage.Setup(config.C); err != nil {
+		return errors.Wrap(err, "setup storage error")
+	}
+	return nil
+}
+
+func setupIntegration() error {
+	if err := integration.Setup(config.C); err != nil {
+		return errors.Wrap(err, "setup integration error")
+	}
+	return nil
+}
+
+func shutdownBackend() error {
+	ctx, cancel := context.WithTimeout(context.Background(), config.C.GeoServer.API.DrainTimeout)
+	defer cancel()
+
+	if err := backend.Shutdown(ctx); err != nil {
+		return errors.Wrap(err, "shutdown backend error")
+	}
+	return nil
+}
+
+func closeIntegration() error {
+	if err := integration.Close(); err != nil {
+		return errors.Wrap(err, "close integration error")
+	}
+	return nil
+}
+
+func closeStorage() error {
+	if err := storage.Close(); err != nil {
+		return errors.Wrap(err, "close storage error")
+	}
+	return nil
+}
+
+func shutdownMetrics() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := metrics.Shutdown(ctx); err != nil {
+		return errors.Wrap(err, "shutdown metrics error")
+	}
+	return nil
+}
+
+func setupTracing() error {
+	if err := tracing.Setup(config.C); err != nil {
+		return errors.Wrap(err, "setup tracing error")
+	}
+	return nil
+}
+
+func closeTracing() error {
+	if err := tracing.Close(); err != nil {
+		return errors.Wrap(err, "close tracing error")
+	}
+	return nil
+}
+
 func setupMetrics() error {
 	if err := metrics.Setup(config.C); err != nil {
 		return errors.Wrap(err, "setup metrics error")
@@ -16,6 +16,10 @@ var testResolveMultiFrameTDOA = &cobra.Command{
 			return errors.New("location to a file must be given as an argument")
 		}
 
-		return test.ResolveMultiFrameTDOA(args[0])
+		return test.ResolveMultiFrameTDOA(args[0], testGroundTruthFile)
 	},
 }
+
+func init() {
+	testResolveMultiFrameTDOA.Flags().StringVarP(&testGroundTruthFile, "ground-truth", "g", "", "path to ground-truth CSV file, for evaluating the resolved locations (optional)")
+}
@@ -7,6 +7,10 @@ import (
 	"github.com/brocaar/chirpstack-geolocation-server/internal/test"
 )
 
+// testGroundTruthFile holds the ground-truth file used by the test-resolve
+// commands.
+var testGroundTruthFile string
+
 var testResolveTDOA = &cobra.Command{
 	Use:     "test-resolve-tdoa",
 	Short:   "Runs the resolve TDOA request from the given directory",
@@ -16,6 +20,10 @@ var testResolveTDOA = &cobra.Command{
 			return errors.New("location to a file must be given as an argument")
 		}
 
-		return test.ResolveTDOA(args[0])
+		return test.ResolveTDOA(args[0], testGroundTruthFile)
 	},
 }
+
+func init() {
+	testResolveTDOA.Flags().StringVarP(&testGroundTruthFile, "ground-truth", "g", "", "path to ground-truth CSV file, for evaluating the resolved locations (optional)")
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/validation"
+)
+
+var validateConfigCmd = &cobra.Command{
+	Use:   "validate-config",
+	Short: "Validate the ChirpStack Geolocation Server configuration",
+	// the errors are printed by the command itself
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := configErr
+		if err == nil {
+			err = validation.Validate(config.C)
+		}
+		if err == nil {
+			fmt.Println("configuration is valid")
+			return nil
+		}
+
+		fmt.Fprintln(os.Stderr, "configuration is invalid:")
+		printValidationErrors(err)
+
+		return errors.New("invalid configuration")
+	},
+}
+
+func printValidationErrors(err error) {
+	if errs, ok := err.(validation.Errors); ok {
+		for _, e := range errs {
+			fmt.Fprintf(os.Stderr, "  * %s\n", e)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "  * %s\n", err)
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/brocaar/chirpstack-api/go/v3/geo"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/auth"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/logging"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/tracing"
+)
+
+// maxRequestSize defines the max. size of a REST API request body.
+const maxRequestSize = 1 << 20
+
+// GeolocationRESTAPI implements a REST/JSON gateway for the geolocation API.
+// Requests and responses are encoded using the Protobuf JSON mapping, which
+// is the same format as used by the request log.
+type GeolocationRESTAPI struct {
+	backend geo.GeolocationServerServiceServer
+	mux     *http.ServeMux
+}
+
+// NewGeolocationRESTAPI creates a new GeolocationRESTAPI, calling the given
+// backend.
+func NewGeolocationRESTAPI(b geo.GeolocationServerServiceServer) *GeolocationRESTAPI {
+	a := GeolocationRESTAPI{
+		backend: b,
+		mux:     http.NewServeMux(),
+	}
+
+	a.mux.HandleFunc("/api/v1/resolve/tdoa", a.handle("ResolveTDOA", func() proto.Message {
+		return &geo.ResolveTDOARequest{}
+	}, func(ctx context.Context, req proto.Message) (proto.Message, error) {
+		return a.backend.ResolveTDOA(ctx, req.(*geo.ResolveTDOARequest))
+	}))
+
+	a.mux.HandleFunc("/api/v1/resolve/multi-frame-tdoa", a.handle("ResolveMultiFrameTDOA", func() proto.Message {
+		return &geo.ResolveMultiFrameTDOARequest{}
+	}, func(ctx context.Context, req proto.Message) (proto.Message, error) {
+		return a.backend.ResolveMultiFrameTDOA(ctx, req.(*geo.ResolveMultiFrameTDOARequest))
+	}))
+
+	return &a
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (a *GeolocationRESTAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mux.ServeHTTP(w, r)
+}
+
+func (a *GeolocationRESTAPI) handle(method string, newReq func() proto.Message, call func(context.Context, proto.Message) (proto.Message, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := logging.RequestID(r.Header.Get(logging.RequestIDHeader))
+		w.Header().Set(logging.RequestIDHeader, requestID)
+		r = r.WithContext(logging.NewContext(r.Context(), requestID))
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeRESTError(w, http.StatusMethodNotAllowed, status.New(codes.Unimplemented, "method not allowed"))
+			return
+		}
+
+		req := newReq()
+		u := jsonpb.Unmarshaler{AllowUnknownFields: true}
+		if err := u.Unmarshal(http.MaxBytesReader(w, r.Body, maxRequestSize), req); err != nil {
+			writeRESTError(w, http.StatusBadRequest, status.Newf(codes.InvalidArgument, "unmarshal request error: %s", err))
+			return
+		}
+
+		ctx, err := auth.AuthorizeHTTP(r, "/geo.GeolocationServerService/"+method, req)
+		if err != nil {
+			s := status.Convert(err)
+			writeRESTError(w, httpStatusFromCode(s.Code()), s)
+			return
+		}
+
+		ctx = tracing.Extract(ctx, r.Header)
+		ctx, span := tracing.Start(ctx, "/geo.GeolocationServerService/"+method, trace.SpanKindServer,
+			attribute.String("http.method", r.Method),
+			attribute.String("http.target", r.URL.Path),
+		)
+		if req, ok := req.(interface{ GetDevEui() []byte }); ok {
+			span.SetAttributes(tracing.DevEUI(req.GetDevEui()))
+		}
+
+		resp, err := call(ctx, req)
+		s := status.Convert(err)
+		span.SetAttributes(attribute.Int("http.status_code", httpStatusFromCode(s.Code())))
+		tracing.SetError(span, err)
+		span.End()
+
+		fields := log.Fields{
+			"method":   method,
+			"code":     s.Code(),
+			"duration": time.Since(start),
+		}
+		if sc := span.SpanContext(); sc.IsValid() {
+			fields["trace_id"] = sc.TraceID().String()
+		}
+		if client, ok := auth.FromContext(ctx); ok {
+			fields["auth.client"] = client.Name
+		}
+		logging.FromContext(ctx).WithFields(fields).Info("api/rest: finished call")
+
+		if err != nil {
+			writeRESTError(w, httpStatusFromCode(s.Code()), s)
+			return
+		}
+
+		bb := bytes.NewBuffer(nil)
+		m := jsonpb.Marshaler{
+			EnumsAsInts:  false,
+			EmitDefaults: true,
+		}
+		if err := m.Marshal(bb, resp); err != nil {
+			writeRESTError(w, http.StatusInternalServerError, status.Newf(codes.Internal, "marshal response error: %s", err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(bb.Bytes())
+	}
+}
+
+// writeRESTError writes the given gRPC status as JSON error response.
+func writeRESTError(w http.ResponseWriter, httpStatus int, s *status.Status) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+		Code  uint32 `json:"code"`
+	}{
+		Error: s.Message(),
+		Code:  uint32(s.Code()),
+	})
+}
+
+// httpStatusFromCode maps the gRPC code to the corresponding HTTP status.
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/geo"
+)
+
+type testBackend struct {
+	err               error
+	tdoaReq           *geo.ResolveTDOARequest
+	multiFrameTDOAReq *geo.ResolveMultiFrameTDOARequest
+}
+
+func (b *testBackend) ResolveTDOA(ctx context.Context, req *geo.ResolveTDOARequest) (*geo.ResolveTDOAResponse, error) {
+	b.tdoaReq = req
+	if b.err != nil {
+		return nil, b.err
+	}
+	return &geo.ResolveTDOAResponse{
+		Result: &geo.ResolveResult{
+			Location: &common.Location{Latitude: 1.123, Longitude: 2.123, Accuracy: 10},
+		},
+	}, nil
+}
+
+func (b *testBackend) ResolveMultiFrameTDOA(ctx context.Context, req *geo.ResolveMultiFrameTDOARequest) (*geo.ResolveMultiFrameTDOAResponse, error) {
+	b.multiFrameTDOAReq = req
+	if b.err != nil {
+		return nil, b.err
+	}
+	return &geo.ResolveMultiFrameTDOAResponse{
+		Result: &geo.ResolveResult{
+			Location: &common.Location{Latitude: 3.123, Longitude: 4.123, Accuracy: 20},
+		},
+	}, nil
+}
+
+func TestGeolocationRESTAPI(t *testing.T) {
+	b := testBackend{}
+	server := httptest.NewServer(NewGeolocationRESTAPI(&b))
+	defer server.Close()
+
+	t.Run("ResolveTDOA", func(t *testing.T) {
+		assert := require.New(t)
+
+		resp, err := http.Post(server.URL+"/api/v1/resolve/tdoa", "application/json", bytes.NewBufferString(`{"devEUI": "AQIDBAUGBwg=", "frameRXInfo": {"rxInfo": []}}`))
+		assert.NoError(err)
+		defer resp.Body.Close()
+		assert.Equal(http.StatusOK, resp.StatusCode)
+		assert.Equal([]byte{1, 2, 3, 4, 5, 6, 7, 8}, b.tdoaReq.DevEui)
+
+		var out geo.ResolveTDOAResponse
+		assert.NoError(jsonpb.Unmarshal(resp.Body, &out))
+		assert.EqualValues(1.123, out.Result.Location.Latitude)
+		assert.EqualValues(2.123, out.Result.Location.Longitude)
+	})
+
+	t.Run("ResolveMultiFrameTDOA", func(t *testing.T) {
+		assert := require.New(t)
+
+		resp, err := http.Post(server.URL+"/api/v1/resolve/multi-frame-tdoa", "application/json", bytes.NewBufferString(`{"devEUI": "AQIDBAUGBwg=", "frameRXInfoSet": [{"rxInfo": []}, {"rxInfo": []}]}`))
+		assert.NoError(err)
+		defer resp.Body.Close()
+		assert.Equal(http.StatusOK, resp.StatusCode)
+		assert.Len(b.multiFrameTDOAReq.FrameRxInfoSet, 2)
+
+		var out geo.ResolveMultiFrameTDOAResponse
+		assert.NoError(jsonpb.Unmarshal(resp.Body, &out))
+		assert.EqualValues(3.123, out.Result.Location.Latitude)
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		assert := require.New(t)
+
+		resp, err := http.Post(server.URL+"/api/v1/resolve/tdoa", "application/json", bytes.NewBufferString(`{`))
+		assert.NoError(err)
+		defer resp.Body.Close()
+		assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		assert := require.New(t)
+
+		resp, err := http.Get(server.URL + "/api/v1/resolve/tdoa")
+		assert.NoError(err)
+		defer resp.Body.Close()
+		assert.Equal(http.StatusMethodNotAllowed, resp.StatusCode)
+	})
+
+	t.Run("backend error", func(t *testing.T) {
+		assert := require.New(t)
+		b.err = grpc.Errorf(codes.FailedPrecondition, "implausible location (max_speed)")
+		defer func() { b.err = nil }()
+
+		resp, err := http.Post(server.URL+"/api/v1/resolve/tdoa", "application/json", bytes.NewBufferString(`{}`))
+		assert.NoError(err)
+		defer resp.Body.Close()
+		assert.Equal(http.StatusBadRequest, resp.StatusCode)
+
+		var out struct {
+			Error string `json:"error"`
+			Code  int    `json:"code"`
+		}
+		assert.NoError(json.NewDecoder(resp.Body).Decode(&out))
+		assert.Equal("implausible location (max_speed)", out.Error)
+		assert.Equal(int(codes.FailedPrecondition), out.Code)
+	})
+}
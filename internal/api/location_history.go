@@ -0,0 +1,205 @@
+package api
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/brocaar/chirpstack-geolocation-server/api/history"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/storage"
+	"github.com/brocaar/lorawan"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+// LocationHistoryAPI implements the location history API.
+type LocationHistoryAPI struct {
+	db *bolt.DB
+}
+
+// NewLocationHistoryAPI creates a new LocationHistoryAPI.
+func NewLocationHistoryAPI(db *bolt.DB) *LocationHistoryAPI {
+	return &LocationHistoryAPI{
+		db: db,
+	}
+}
+
+// GetTrack returns the locations of a device within the given time-range.
+func (a *LocationHistoryAPI) GetTrack(ctx context.Context, req *history.GetTrackRequest) (*history.GetTrackResponse, error) {
+	devEUI, err := devEUIFromBytes(req.DevEui)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, err.Error())
+	}
+
+	// default to the full history
+	start := time.Unix(0, 0)
+	end := time.Unix(0, math.MaxInt64)
+
+	if req.Start != nil {
+		if start, err = ptypes.Timestamp(req.Start); err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "start: %s", err)
+		}
+	}
+
+	if req.End != nil {
+		if end, err = ptypes.Timestamp(req.End); err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "end: %s", err)
+		}
+	}
+
+	count, err := storage.GetLocationCount(a.db, devEUI, start, end)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, err.Error())
+	}
+
+	locs, err := storage.GetLocations(a.db, devEUI, start, end, limit(req.Limit), int(req.Offset))
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, err.Error())
+	}
+
+	resp := history.GetTrackResponse{
+		TotalCount: uint32(count),
+	}
+
+	for _, loc := range locs {
+		rec, err := locationToRecord(loc)
+		if err != nil {
+			return nil, grpc.Errorf(codes.Internal, err.Error())
+		}
+		resp.Result = append(resp.Result, rec)
+	}
+
+	return &resp, nil
+}
+
+// GetLastLocation returns the last resolved location of a device.
+func (a *LocationHistoryAPI) GetLastLocation(ctx context.Context, req *history.GetLastLocationRequest) (*history.GetLastLocationResponse, error) {
+	devEUI, err := devEUIFromBytes(req.DevEui)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, err.Error())
+	}
+
+	loc, err := storage.GetLastLocation(a.db, devEUI)
+	if err != nil {
+		if err == storage.ErrDoesNotExist {
+			return nil, grpc.Errorf(codes.NotFound, err.Error())
+		}
+		return nil, grpc.Errorf(codes.Internal, err.Error())
+	}
+
+	rec, err := locationToRecord(loc)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, err.Error())
+	}
+
+	return &history.GetLastLocationResponse{
+		Location: rec,
+	}, nil
+}
+
+// ListDevicesInBoundingBox returns the devices of which the last resolved
+// location is within the given bounding-box.
+func (a *LocationHistoryAPI) ListDevicesInBoundingBox(ctx context.Context, req *history.ListDevicesInBoundingBoxRequest) (*history.ListDevicesResponse, error) {
+	if req.MinLatitude > req.MaxLatitude || req.MinLongitude > req.MaxLongitude {
+		return nil, grpc.Errorf(codes.InvalidArgument, "min_latitude and min_longitude must be less than max_latitude and max_longitude")
+	}
+
+	bbox := storage.BoundingBox{
+		MinLatitude:  req.MinLatitude,
+		MinLongitude: req.MinLongitude,
+		MaxLatitude:  req.MaxLatitude,
+		MaxLongitude: req.MaxLongitude,
+	}
+
+	count, err := storage.GetLastLocationCountInBoundingBox(a.db, bbox)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, err.Error())
+	}
+
+	locs, err := storage.GetLastLocationsInBoundingBox(a.db, bbox, limit(req.Limit), int(req.Offset))
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, err.Error())
+	}
+
+	return listDevicesResponse(count, locs)
+}
+
+// ListDevicesInRadius returns the devices of which the last resolved
+// location is within the given radius.
+func (a *LocationHistoryAPI) ListDevicesInRadius(ctx context.Context, req *history.ListDevicesInRadiusRequest) (*history.ListDevicesResponse, error) {
+	if req.Radius <= 0 {
+		return nil, grpc.Errorf(codes.InvalidArgument, "radius must be greater than 0")
+	}
+
+	count, err := storage.GetLastLocationCountInRadius(a.db, req.Latitude, req.Longitude, req.Radius)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, err.Error())
+	}
+
+	locs, err := storage.GetLastLocationsInRadius(a.db, req.Latitude, req.Longitude, req.Radius, limit(req.Limit), int(req.Offset))
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, err.Error())
+	}
+
+	return listDevicesResponse(count, locs)
+}
+
+func listDevicesResponse(count int, locs []storage.Location) (*history.ListDevicesResponse, error) {
+	resp := history.ListDevicesResponse{
+		TotalCount: uint32(count),
+	}
+
+	for _, loc := range locs {
+		rec, err := locationToRecord(loc)
+		if err != nil {
+			return nil, grpc.Errorf(codes.Internal, err.Error())
+		}
+		resp.Result = append(resp.Result, rec)
+	}
+
+	return &resp, nil
+}
+
+func locationToRecord(loc storage.Location) (*history.LocationRecord, error) {
+	ts, err := ptypes.TimestampProto(loc.Time)
+	if err != nil {
+		return nil, errors.Wrap(err, "timestamp proto error")
+	}
+
+	return &history.LocationRecord{
+		DevEui:    loc.DevEUI[:],
+		Time:      ts,
+		Latitude:  loc.Latitude,
+		Longitude: loc.Longitude,
+		Altitude:  loc.Altitude,
+		Accuracy:  loc.Accuracy,
+	}, nil
+}
+
+func devEUIFromBytes(b []byte) (lorawan.EUI64, error) {
+	var devEUI lorawan.EUI64
+	if len(b) != len(devEUI) {
+		return devEUI, errors.New("dev_eui must be exactly 8 bytes")
+	}
+	copy(devEUI[:], b)
+	return devEUI, nil
+}
+
+func limit(l uint32) int {
+	if l == 0 {
+		return defaultLimit
+	}
+	if l > maxLimit {
+		return maxLimit
+	}
+	return int(l)
+}
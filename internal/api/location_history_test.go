@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/brocaar/chirpstack-geolocation-server/api/history"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/storage"
+	"github.com/brocaar/lorawan"
+)
+
+type LocationHistoryAPITestSuite struct {
+	suite.Suite
+
+	tempDir string
+	db      *bolt.DB
+	api     history.LocationHistoryServiceServer
+}
+
+func (ts *LocationHistoryAPITestSuite) SetupSuite() {
+	assert := require.New(ts.T())
+
+	var err error
+	ts.tempDir, err = ioutil.TempDir("", "api")
+	assert.NoError(err)
+
+	ts.db, err = storage.Open(filepath.Join(ts.tempDir, "history.db"))
+	assert.NoError(err)
+
+	ts.api = NewLocationHistoryAPI(ts.db)
+}
+
+func (ts *LocationHistoryAPITestSuite) TearDownSuite() {
+	ts.db.Close()
+	os.RemoveAll(ts.tempDir)
+}
+
+func (ts *LocationHistoryAPITestSuite) TestLocationHistory() {
+	assert := require.New(ts.T())
+
+	devEUI := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	now := time.Now().UTC().Truncate(time.Second)
+	nowPB, _ := ptypes.TimestampProto(now)
+	endPB, _ := ptypes.TimestampProto(now.Add(time.Minute))
+
+	ts.T().Run("GetLastLocation does not exist", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := ts.api.GetLastLocation(context.Background(), &history.GetLastLocationRequest{
+			DevEui: devEUI[:],
+		})
+		assert.Equal(codes.NotFound, grpc.Code(err))
+	})
+
+	ts.T().Run("GetTrack invalid DevEUI", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := ts.api.GetTrack(context.Background(), &history.GetTrackRequest{
+			DevEui: []byte{1, 2, 3},
+		})
+		assert.Equal(codes.InvalidArgument, grpc.Code(err))
+	})
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(storage.CreateLocation(ts.db, storage.Location{
+			DevEUI:    devEUI,
+			Time:      now.Add(time.Duration(i) * time.Minute),
+			Latitude:  1.1,
+			Longitude: 2.2,
+			Altitude:  3.3,
+			Accuracy:  uint32(i),
+		}))
+	}
+
+	ts.T().Run("GetTrack", func(t *testing.T) {
+		assert := require.New(t)
+
+		resp, err := ts.api.GetTrack(context.Background(), &history.GetTrackRequest{
+			DevEui: devEUI[:],
+			Start:  nowPB,
+			End:    endPB,
+		})
+		assert.NoError(err)
+		assert.Equal(&history.GetTrackResponse{
+			TotalCount: 1,
+			Result: []*history.LocationRecord{
+				{
+					DevEui:    devEUI[:],
+					Time:      nowPB,
+					Latitude:  1.1,
+					Longitude: 2.2,
+					Altitude:  3.3,
+					Accuracy:  0,
+				},
+			},
+		}, resp)
+
+		resp, err = ts.api.GetTrack(context.Background(), &history.GetTrackRequest{
+			DevEui: devEUI[:],
+			Limit:  1,
+			Offset: 1,
+		})
+		assert.NoError(err)
+		assert.EqualValues(3, resp.TotalCount)
+		assert.Len(resp.Result, 1)
+		assert.EqualValues(1, resp.Result[0].Accuracy)
+	})
+
+	ts.T().Run("GetLastLocation", func(t *testing.T) {
+		assert := require.New(t)
+
+		resp, err := ts.api.GetLastLocation(context.Background(), &history.GetLastLocationRequest{
+			DevEui: devEUI[:],
+		})
+		assert.NoError(err)
+		assert.EqualValues(2, resp.Location.Accuracy)
+	})
+
+	ts.T().Run("ListDevicesInRadius", func(t *testing.T) {
+		assert := require.New(t)
+
+		resp, err := ts.api.ListDevicesInRadius(context.Background(), &history.ListDevicesInRadiusRequest{
+			Latitude:  1.1,
+			Longitude: 2.2,
+			Radius:    10,
+		})
+		assert.NoError(err)
+		assert.EqualValues(1, resp.TotalCount)
+		assert.Equal(devEUI[:], resp.Result[0].DevEui)
+
+		_, err = ts.api.ListDevicesInRadius(context.Background(), &history.ListDevicesInRadiusRequest{})
+		assert.Equal(codes.InvalidArgument, grpc.Code(err))
+	})
+
+	ts.T().Run("ListDevicesInBoundingBox", func(t *testing.T) {
+		assert := require.New(t)
+
+		resp, err := ts.api.ListDevicesInBoundingBox(context.Background(), &history.ListDevicesInBoundingBoxRequest{
+			MinLatitude:  2,
+			MinLongitude: 2,
+			MaxLatitude:  3,
+			MaxLongitude: 3,
+		})
+		assert.NoError(err)
+		assert.EqualValues(0, resp.TotalCount)
+		assert.Len(resp.Result, 0)
+	})
+}
+
+func TestLocationHistoryAPI(t *testing.T) {
+	suite.Run(t, new(LocationHistoryAPITestSuite))
+}
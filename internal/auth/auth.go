@@ -0,0 +1,493 @@
+// Package auth implements the authentication and authorization of API
+// clients.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+// hashPrefix defines the prefix of hashed tokens.
+const hashPrefix = "sha256:"
+
+// geoServicePrefix defines the prefix of the geolocation service methods,
+// to which the backend permissions apply.
+const geoServicePrefix = "/geo.GeolocationServerService/"
+
+// publicServicePrefixes defines the services which don't require
+// authentication.
+var publicServicePrefixes = []string{
+	"/grpc.health.v1.",
+}
+
+type contextKey int
+
+const clientKey contextKey = iota
+
+var current atomic.Value
+
+type devEUIRange struct {
+	min uint64
+	max uint64
+}
+
+// quota implements a per-minute request quota.
+type quota struct {
+	sync.Mutex
+
+	limit  int
+	window time.Time
+	count  int
+}
+
+// allow returns true when the request fits within the quota of the
+// current minute.
+func (q *quota) allow(now time.Time) bool {
+	q.Lock()
+	defer q.Unlock()
+
+	if w := now.Truncate(time.Minute); !w.Equal(q.window) {
+		q.window = w
+		q.count = 0
+	}
+
+	if q.count >= q.limit {
+		return false
+	}
+	q.count++
+	return true
+}
+
+// Client defines an authenticated API client.
+type Client struct {
+	Name string
+
+	methods      map[string]struct{}
+	backends     map[string]struct{}
+	devEUIRanges []devEUIRange
+	quota        *quota
+}
+
+// Authenticator authenticates and authorizes API clients.
+type Authenticator struct {
+	backend  string
+	tokens   map[string]*Client
+	subjects map[string]*Client
+}
+
+// Set sets the global authenticator. When nil, authentication is disabled.
+func Set(a *Authenticator) {
+	current.Store(a)
+}
+
+// Get returns the global authenticator. This returns nil when
+// authentication is disabled.
+func Get() *Authenticator {
+	a, _ := current.Load().(*Authenticator)
+	return a
+}
+
+// New creates a new Authenticator. This returns nil when authentication
+// is disabled.
+func New(c config.Config) (*Authenticator, error) {
+	if !c.GeoServer.Auth.Enabled {
+		return nil, nil
+	}
+
+	a := Authenticator{
+		backend:  c.GeoServer.Backend.Type,
+		tokens:   make(map[string]*Client),
+		subjects: make(map[string]*Client),
+	}
+
+	for i, cc := range c.GeoServer.Auth.Clients {
+		if cc.Name == "" {
+			return nil, fmt.Errorf("client %d: name must be set", i)
+		}
+
+		client := Client{
+			Name:     cc.Name,
+			methods:  toSet(cc.Methods),
+			backends: toSet(cc.Backends),
+		}
+
+		if cc.RequestsPerMinute < 0 {
+			return nil, fmt.Errorf("client %s: requests_per_minute must not be negative", cc.Name)
+		}
+		if cc.RequestsPerMinute > 0 {
+			client.quota = &quota{limit: cc.RequestsPerMinute}
+		}
+
+		for _, r := range cc.DevEUIRanges {
+			rr, err := parseDevEUIRange(r)
+			if err != nil {
+				return nil, errors.Wrapf(err, "client %s: parse dev_eui range error", cc.Name)
+			}
+			client.devEUIRanges = append(client.devEUIRanges, rr)
+		}
+
+		for _, t := range cc.Tokens {
+			h, err := tokenHash(t)
+			if err != nil {
+				return nil, errors.Wrapf(err, "client %s", cc.Name)
+			}
+			if _, ok := a.tokens[h]; ok {
+				return nil, fmt.Errorf("client %s: token is used by multiple clients", cc.Name)
+			}
+			a.tokens[h] = &client
+		}
+
+		for _, s := range cc.CertSubjects {
+			if _, ok := a.subjects[s]; ok {
+				return nil, fmt.Errorf("client %s: cert subject %s is used by multiple clients", cc.Name, s)
+			}
+			a.subjects[s] = &client
+		}
+	}
+
+	return &a, nil
+}
+
+// Authenticate returns the client for the given token or TLS connection
+// state. The token takes precedence over the client certificate.
+func (a *Authenticator) Authenticate(token string, state *tls.ConnectionState) (*Client, error) {
+	if token != "" {
+		sum := sha256.Sum256([]byte(token))
+		if client, ok := a.tokens[hex.EncodeToString(sum[:])]; ok {
+			return client, nil
+		}
+		return nil, errors.New("invalid token")
+	}
+
+	if state != nil && len(state.VerifiedChains) != 0 && len(state.VerifiedChains[0]) != 0 {
+		subject := state.VerifiedChains[0][0].Subject
+		for _, s := range []string{subject.String(), subject.CommonName} {
+			if client, ok := a.subjects[s]; ok {
+				return client, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown client certificate subject: %s", subject)
+	}
+
+	return nil, errors.New("no credentials provided")
+}
+
+// Authorize returns an error when the client is not allowed to call the
+// given method (full gRPC method name) with the given request.
+func (a *Authenticator) Authorize(client *Client, fullMethod string, req interface{}) error {
+	if err := a.authorizeMethod(client, fullMethod); err != nil {
+		return err
+	}
+	return client.authorizeRequest(req)
+}
+
+func (a *Authenticator) authorizeMethod(client *Client, fullMethod string) error {
+	if len(client.methods) != 0 {
+		method := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+		if _, ok := client.methods[method]; !ok {
+			return fmt.Errorf("method %s is not allowed", method)
+		}
+	}
+
+	if len(client.backends) != 0 && strings.HasPrefix(fullMethod, geoServicePrefix) {
+		if _, ok := client.backends[a.backend]; !ok {
+			return fmt.Errorf("backend %s is not allowed", a.backend)
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) authorizeRequest(req interface{}) error {
+	if len(c.devEUIRanges) != 0 {
+		r, ok := req.(interface{ GetDevEui() []byte })
+		if !ok || len(r.GetDevEui()) != 8 {
+			return errors.New("request without dev_eui is not allowed")
+		}
+
+		var devEUI lorawan.EUI64
+		copy(devEUI[:], r.GetDevEui())
+
+		if !c.allowsDevEUI(devEUI) {
+			return fmt.Errorf("dev_eui %s is not allowed", devEUI)
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) allowsDevEUI(devEUI lorawan.EUI64) bool {
+	v := binary.BigEndian.Uint64(devEUI[:])
+	for _, r := range c.devEUIRanges {
+		if v >= r.min && v <= r.max {
+			return true
+		}
+	}
+	return false
+}
+
+// NewContext returns a new context containing the given client.
+func NewContext(ctx context.Context, c *Client) context.Context {
+	return context.WithValue(ctx, clientKey, c)
+}
+
+// FromContext returns the client from the context (if any).
+func FromContext(ctx context.Context) (*Client, bool) {
+	c, ok := ctx.Value(clientKey).(*Client)
+	return c, ok
+}
+
+// UnaryServerInterceptor returns a gRPC interceptor which authenticates
+// and authorizes each call, using the global authenticator. The client
+// is added to the context and to the request tags (for logging).
+func UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	a := Get()
+	if a == nil || isPublic(info.FullMethod) {
+		return handler(ctx, req)
+	}
+
+	var state *tls.ConnectionState
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			state = &tlsInfo.State
+		}
+	}
+
+	ctx, err := a.authorizeCall(ctx, tokenFromMetadata(ctx), state, info.FullMethod, req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := handler(ctx, req)
+
+	client, _ := FromContext(ctx)
+	requestCounter(client.Name, info.FullMethod, status.Code(err)).Inc()
+
+	return resp, err
+}
+
+// StreamServerInterceptor returns a gRPC interceptor which authenticates
+// and authorizes each stream, using the global authenticator. As the
+// requests are only known after the stream has been opened, the DevEUI
+// ranges are checked for each received message.
+func StreamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	a := Get()
+	if a == nil || isPublic(info.FullMethod) {
+		return handler(srv, ss)
+	}
+
+	ctx := ss.Context()
+
+	var state *tls.ConnectionState
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			state = &tlsInfo.State
+		}
+	}
+
+	client, err := a.authenticate(ctx, tokenFromMetadata(ctx), state, info.FullMethod)
+	if err != nil {
+		return err
+	}
+
+	if err := a.authorizeMethod(client, info.FullMethod); err != nil {
+		requestCounter(client.Name, info.FullMethod, codes.PermissionDenied).Inc()
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	if err := checkQuota(client, info.FullMethod); err != nil {
+		return err
+	}
+
+	err = handler(srv, &serverStream{ServerStream: ss, ctx: NewContext(ctx, client), client: client})
+	requestCounter(client.Name, info.FullMethod, status.Code(err)).Inc()
+
+	return err
+}
+
+// serverStream wraps a grpc.ServerStream, adding the client to the context
+// and authorizing each received message.
+type serverStream struct {
+	grpc.ServerStream
+
+	ctx    context.Context
+	client *Client
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	if err := s.client.authorizeRequest(m); err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	return nil
+}
+
+// AuthorizeHTTP authenticates and authorizes a HTTP request for the given
+// method (full gRPC method name), using the global authenticator. It
+// returns the request context, containing the client.
+func AuthorizeHTTP(r *http.Request, fullMethod string, req interface{}) (context.Context, error) {
+	a := Get()
+	if a == nil {
+		return r.Context(), nil
+	}
+
+	return a.authorizeCall(r.Context(), tokenFromHeader(r.Header), r.TLS, fullMethod, req)
+}
+
+func (a *Authenticator) authorizeCall(ctx context.Context, token string, state *tls.ConnectionState, fullMethod string, req interface{}) (context.Context, error) {
+	client, err := a.authenticate(ctx, token, state, fullMethod)
+	if err != nil {
+		return ctx, err
+	}
+
+	if err := a.Authorize(client, fullMethod, req); err != nil {
+		requestCounter(client.Name, fullMethod, codes.PermissionDenied).Inc()
+		return ctx, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	if err := checkQuota(client, fullMethod); err != nil {
+		return ctx, err
+	}
+
+	return NewContext(ctx, client), nil
+}
+
+func (a *Authenticator) authenticate(ctx context.Context, token string, state *tls.ConnectionState, fullMethod string) (*Client, error) {
+	client, err := a.Authenticate(token, state)
+	if err != nil {
+		requestCounter("", fullMethod, codes.Unauthenticated).Inc()
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	grpc_ctxtags.Extract(ctx).Set("auth.client", client.Name)
+
+	return client, nil
+}
+
+// checkQuota returns an error when the client exceeded its request quota.
+func checkQuota(client *Client, fullMethod string) error {
+	if client.quota == nil || client.quota.allow(time.Now()) {
+		return nil
+	}
+
+	requestCounter(client.Name, fullMethod, codes.ResourceExhausted).Inc()
+	return status.Error(codes.ResourceExhausted, "request quota exceeded")
+}
+
+func isPublic(fullMethod string) bool {
+	for _, p := range publicServicePrefixes {
+		if strings.HasPrefix(fullMethod, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func tokenFromMetadata(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	for _, v := range md.Get("authorization") {
+		if t := bearerToken(v); t != "" {
+			return t
+		}
+	}
+
+	if v := md.Get("x-api-key"); len(v) != 0 {
+		return v[0]
+	}
+
+	return ""
+}
+
+func tokenFromHeader(h http.Header) string {
+	if t := bearerToken(h.Get("Authorization")); t != "" {
+		return t
+	}
+	return h.Get("X-API-Key")
+}
+
+func bearerToken(v string) string {
+	if len(v) > 7 && strings.EqualFold(v[:7], "bearer ") {
+		return strings.TrimSpace(v[7:])
+	}
+	return ""
+}
+
+func tokenHash(token string) (string, error) {
+	if !strings.HasPrefix(token, hashPrefix) {
+		sum := sha256.Sum256([]byte(token))
+		return hex.EncodeToString(sum[:]), nil
+	}
+
+	h := strings.ToLower(strings.TrimPrefix(token, hashPrefix))
+	if b, err := hex.DecodeString(h); err != nil || len(b) != sha256.Size {
+		return "", errors.New("token hash must be a hex encoded sha256 hash")
+	}
+	return h, nil
+}
+
+func parseDevEUIRange(s string) (devEUIRange, error) {
+	var out devEUIRange
+	var min, max lorawan.EUI64
+
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return out, fmt.Errorf("expected <min>-<max>, got: %s", s)
+	}
+
+	if err := min.UnmarshalText([]byte(strings.TrimSpace(parts[0]))); err != nil {
+		return out, errors.Wrap(err, "parse min error")
+	}
+	if err := max.UnmarshalText([]byte(strings.TrimSpace(parts[1]))); err != nil {
+		return out, errors.Wrap(err, "parse max error")
+	}
+
+	out.min = binary.BigEndian.Uint64(min[:])
+	out.max = binary.BigEndian.Uint64(max[:])
+
+	if out.min > out.max {
+		return out, fmt.Errorf("min must be <= max, got: %s", s)
+	}
+
+	return out, nil
+}
+
+func toSet(items []string) map[string]struct{} {
+	out := make(map[string]struct{})
+	for _, i := range items {
+		out[i] = struct{}{}
+	}
+	return out
+}
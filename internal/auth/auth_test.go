@@ -0,0 +1,319 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/brocaar/chirpstack-api/go/v3/geo"
+	"github.com/brocaar/chirpstack-geolocation-server/api/history"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+)
+
+func testConfig() config.Config {
+	var c config.Config
+	c.GeoServer.Backend.Type = "lora_cloud"
+	c.GeoServer.Auth.Enabled = true
+	c.GeoServer.Auth.Clients = []config.AuthClient{
+		{
+			Name:   "admin",
+			Tokens: []string{"admin-token"},
+		},
+		{
+			Name: "network-server",
+			// echo -n "ns-token" | sha256sum
+			Tokens:       []string{"sha256:1f175e87ad48ab75a5c2fe8b89e8869ca8996c2416945d8cd67415a30301df87"},
+			CertSubjects: []string{"network-server"},
+			Methods:      []string{"ResolveTDOA", "ResolveMultiFrameTDOA"},
+			Backends:     []string{"collos"},
+		},
+		{
+			Name:         "dashboard",
+			Tokens:       []string{"dashboard-token"},
+			DevEUIRanges: []string{"0102030405060000-010203040506ffff"},
+		},
+		{
+			Name:              "limited",
+			Tokens:            []string{"limited-token"},
+			RequestsPerMinute: 2,
+		},
+	}
+	return c
+}
+
+func TestNew(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		assert := require.New(t)
+
+		a, err := New(config.Config{})
+		assert.NoError(err)
+		assert.Nil(a)
+	})
+
+	tests := []struct {
+		Name    string
+		Clients []config.AuthClient
+		Error   string
+	}{
+		{
+			Name:    "missing name",
+			Clients: []config.AuthClient{{Tokens: []string{"foo"}}},
+			Error:   "client 0: name must be set",
+		},
+		{
+			Name:    "invalid hash",
+			Clients: []config.AuthClient{{Name: "foo", Tokens: []string{"sha256:abc"}}},
+			Error:   "client foo: token hash must be a hex encoded sha256 hash",
+		},
+		{
+			Name:    "duplicate token",
+			Clients: []config.AuthClient{{Name: "foo", Tokens: []string{"foo"}}, {Name: "bar", Tokens: []string{"foo"}}},
+			Error:   "client bar: token is used by multiple clients",
+		},
+		{
+			Name:    "invalid range",
+			Clients: []config.AuthClient{{Name: "foo", DevEUIRanges: []string{"0102030405060708-0102030405060700"}}},
+			Error:   "client foo: parse dev_eui range error: min must be <= max, got: 0102030405060708-0102030405060700",
+		},
+		{
+			Name:    "negative quota",
+			Clients: []config.AuthClient{{Name: "foo", RequestsPerMinute: -1}},
+			Error:   "client foo: requests_per_minute must not be negative",
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			var c config.Config
+			c.GeoServer.Auth.Enabled = true
+			c.GeoServer.Auth.Clients = tst.Clients
+
+			_, err := New(c)
+			assert.EqualError(err, tst.Error)
+		})
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	assert := require.New(t)
+
+	a, err := New(testConfig())
+	assert.NoError(err)
+
+	certState := func(cn string) *tls.ConnectionState {
+		return &tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{
+				{{Subject: pkix.Name{CommonName: cn}}},
+			},
+		}
+	}
+
+	t.Run("Authenticate", func(t *testing.T) {
+		tests := []struct {
+			Name     string
+			Token    string
+			State    *tls.ConnectionState
+			Expected string
+			Error    string
+		}{
+			{Name: "plain token", Token: "admin-token", Expected: "admin"},
+			{Name: "hashed token", Token: "ns-token", Expected: "network-server"},
+			{Name: "invalid token", Token: "foo", Error: "invalid token"},
+			{Name: "cert subject", State: certState("network-server"), Expected: "network-server"},
+			{Name: "unknown cert subject", State: certState("foo"), Error: "unknown client certificate subject: CN=foo"},
+			{Name: "token precedes cert", Token: "admin-token", State: certState("network-server"), Expected: "admin"},
+			{Name: "no credentials", State: &tls.ConnectionState{}, Error: "no credentials provided"},
+		}
+
+		for _, tst := range tests {
+			t.Run(tst.Name, func(t *testing.T) {
+				assert := require.New(t)
+
+				c, err := a.Authenticate(tst.Token, tst.State)
+				if tst.Error != "" {
+					assert.EqualError(err, tst.Error)
+					return
+				}
+				assert.NoError(err)
+				assert.Equal(tst.Expected, c.Name)
+			})
+		}
+	})
+
+	t.Run("Authorize", func(t *testing.T) {
+		tests := []struct {
+			Name   string
+			Token  string
+			Method string
+			Req    interface{}
+			Error  string
+		}{
+			{Name: "admin", Token: "admin-token", Method: "/history.LocationHistoryService/ListDevicesInRadius", Req: &history.ListDevicesInRadiusRequest{}},
+			{Name: "method not allowed", Token: "ns-token", Method: "/history.LocationHistoryService/GetTrack", Req: &history.GetTrackRequest{}, Error: "method GetTrack is not allowed"},
+			{Name: "backend not allowed", Token: "ns-token", Method: "/geo.GeolocationServerService/ResolveTDOA", Req: &geo.ResolveTDOARequest{}, Error: "backend lora_cloud is not allowed"},
+			{Name: "dev_eui allowed", Token: "dashboard-token", Method: "/history.LocationHistoryService/GetTrack", Req: &history.GetTrackRequest{DevEui: []byte{1, 2, 3, 4, 5, 6, 255, 255}}},
+			{Name: "dev_eui not allowed", Token: "dashboard-token", Method: "/history.LocationHistoryService/GetTrack", Req: &history.GetTrackRequest{DevEui: []byte{1, 2, 3, 4, 5, 7, 0, 0}}, Error: "dev_eui 0102030405070000 is not allowed"},
+			{Name: "request without dev_eui", Token: "dashboard-token", Method: "/history.LocationHistoryService/ListDevicesInRadius", Req: &history.ListDevicesInRadiusRequest{}, Error: "request without dev_eui is not allowed"},
+		}
+
+		for _, tst := range tests {
+			t.Run(tst.Name, func(t *testing.T) {
+				assert := require.New(t)
+
+				c, err := a.Authenticate(tst.Token, nil)
+				assert.NoError(err)
+
+				err = a.Authorize(c, tst.Method, tst.Req)
+				if tst.Error != "" {
+					assert.EqualError(err, tst.Error)
+				} else {
+					assert.NoError(err)
+				}
+			})
+		}
+	})
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	a, err := New(testConfig())
+	require.NoError(t, err)
+	Set(a)
+	defer Set(nil)
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		c, ok := FromContext(ctx)
+		if !ok {
+			return "", nil
+		}
+		return c.Name, nil
+	}
+
+	tests := []struct {
+		Name     string
+		MD       metadata.MD
+		Method   string
+		Expected string
+		Code     codes.Code
+	}{
+		{Name: "bearer token", MD: metadata.Pairs("authorization", "Bearer admin-token"), Method: "/geo.GeolocationServerService/ResolveTDOA", Expected: "admin"},
+		{Name: "api key", MD: metadata.Pairs("x-api-key", "admin-token"), Method: "/geo.GeolocationServerService/ResolveTDOA", Expected: "admin"},
+		{Name: "no credentials", MD: metadata.MD{}, Method: "/geo.GeolocationServerService/ResolveTDOA", Code: codes.Unauthenticated},
+		{Name: "permission denied", MD: metadata.Pairs("x-api-key", "ns-token"), Method: "/history.LocationHistoryService/GetTrack", Code: codes.PermissionDenied},
+		{Name: "health check", MD: metadata.MD{}, Method: "/grpc.health.v1.Health/Check", Expected: ""},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			ctx := metadata.NewIncomingContext(context.Background(), tst.MD)
+			resp, err := UnaryServerInterceptor(ctx, &geo.ResolveTDOARequest{}, &grpc.UnaryServerInfo{FullMethod: tst.Method}, handler)
+			if tst.Code != codes.OK {
+				assert.Equal(tst.Code, status.Code(err))
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tst.Expected, resp)
+		})
+	}
+
+	t.Run("quota", func(t *testing.T) {
+		assert := require.New(t)
+
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", "limited-token"))
+		info := &grpc.UnaryServerInfo{FullMethod: "/geo.GeolocationServerService/ResolveTDOA"}
+
+		var err error
+		for i := 0; i < 3; i++ {
+			_, err = UnaryServerInterceptor(ctx, &geo.ResolveTDOARequest{}, info, handler)
+		}
+		assert.Equal(codes.ResourceExhausted, status.Code(err))
+	})
+
+	t.Run("AuthorizeHTTP", func(t *testing.T) {
+		assert := require.New(t)
+
+		r := httptest.NewRequest("POST", "/api/v1/resolve/tdoa", nil)
+		r.Header.Set("Authorization", "Bearer admin-token")
+		ctx, err := AuthorizeHTTP(r, "/geo.GeolocationServerService/ResolveTDOA", &geo.ResolveTDOARequest{})
+		assert.NoError(err)
+		c, ok := FromContext(ctx)
+		assert.True(ok)
+		assert.Equal("admin", c.Name)
+
+		r.Header.Del("Authorization")
+		_, err = AuthorizeHTTP(r, "/geo.GeolocationServerService/ResolveTDOA", &geo.ResolveTDOARequest{})
+		assert.Equal(codes.Unauthenticated, status.Code(err))
+	})
+}
+
+type testServerStream struct {
+	grpc.ServerStream
+
+	ctx context.Context
+	req *history.GetTrackRequest
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *testServerStream) RecvMsg(m interface{}) error {
+	*m.(*history.GetTrackRequest) = *s.req
+	return nil
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	a, err := New(testConfig())
+	require.NoError(t, err)
+	Set(a)
+	defer Set(nil)
+
+	var client string
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		c, _ := FromContext(ss.Context())
+		client = c.Name
+		return ss.RecvMsg(&history.GetTrackRequest{})
+	}
+
+	tests := []struct {
+		Name     string
+		MD       metadata.MD
+		Method   string
+		DevEUI   []byte
+		Expected string
+		Code     codes.Code
+	}{
+		{Name: "bearer token", MD: metadata.Pairs("authorization", "Bearer admin-token"), Method: "/history.LocationHistoryService/GetTrack", Expected: "admin"},
+		{Name: "no credentials", MD: metadata.MD{}, Method: "/history.LocationHistoryService/GetTrack", Code: codes.Unauthenticated},
+		{Name: "method not allowed", MD: metadata.Pairs("x-api-key", "ns-token"), Method: "/history.LocationHistoryService/GetTrack", Code: codes.PermissionDenied},
+		{Name: "dev_eui allowed", MD: metadata.Pairs("x-api-key", "dashboard-token"), Method: "/history.LocationHistoryService/GetTrack", DevEUI: []byte{1, 2, 3, 4, 5, 6, 0, 1}, Expected: "dashboard"},
+		{Name: "dev_eui not allowed", MD: metadata.Pairs("x-api-key", "dashboard-token"), Method: "/history.LocationHistoryService/GetTrack", DevEUI: []byte{1, 2, 3, 4, 5, 7, 0, 1}, Expected: "dashboard", Code: codes.PermissionDenied},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+			client = ""
+
+			ss := testServerStream{
+				ctx: metadata.NewIncomingContext(context.Background(), tst.MD),
+				req: &history.GetTrackRequest{DevEui: tst.DevEUI},
+			}
+			err := StreamServerInterceptor(nil, &ss, &grpc.StreamServerInfo{FullMethod: tst.Method}, handler)
+			assert.Equal(tst.Code, status.Code(err))
+			assert.Equal(tst.Expected, client)
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package auth
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc/codes"
+)
+
+var rc = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "api_client_request_count",
+	Help: "The number of API requests (per client, method and code).",
+}, []string{"client", "method", "code"})
+
+func requestCounter(client, method string, code codes.Code) prometheus.Counter {
+	return rc.With(prometheus.Labels{"client": client, "method": method, "code": code.String()})
+}
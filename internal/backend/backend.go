@@ -1,11 +1,11 @@
 package backend
 
 import (
-	"crypto/tls"
-	"crypto/x509"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"net"
+	"net/http"
+	"sync"
 
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpc_logrus "github.com/grpc-ecosystem/go-grpc-middleware/logging/logrus"
@@ -15,15 +15,129 @@ import (
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health/grpc_health_v1"
 
+	"github.com/brocaar/chirpstack-geolocation-server/api/history"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/api"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/auth"
 	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/collos"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/geofence"
+	historybackend "github.com/brocaar/chirpstack-geolocation-server/internal/backend/history"
 	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/logger"
 	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/loracloud"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/plausibility"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/publisher"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/smoothing"
 	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/health"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/integration"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/logging"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/storage"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/tlsconfig"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/tracing"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/validation"
 	"github.com/brocaar/chirpstack-api/go/v3/geo"
 )
 
+var (
+	grpcServer *grpc.Server
+	restServer *http.Server
+
+	// backend forwards all calls to the current backend chain.
+	backend = &proxy{}
+
+	// retiring tracks the replaced chains which are closed once their
+	// in-flight calls have completed.
+	retiring sync.WaitGroup
+
+	// The per-device state of the stateful backends is kept across reloads,
+	// e.g. a reload does not reset the smoothing filters or cause geofence
+	// enter events for devices which are already inside a geofence.
+	smoothingState    = smoothing.NewState()
+	plausibilityState = plausibility.NewState()
+	geofenceState     = geofence.NewState()
+
+	// The request log files opened by the logging backend of a retiring
+	// chain are kept open (and thus not compressed or removed) until it has
+	// been closed.
+	requestLogState = logger.NewState()
+)
+
+// Setup sets up the backend chain and starts the API servers.
 func Setup(c config.Config) error {
+	a, err := auth.New(c)
+	if err != nil {
+		health.SetCheck(health.CheckBackend, err)
+		return errors.Wrap(err, "setup auth error")
+	}
+
+	ch, err := newChain(c)
+	if err != nil {
+		health.SetCheck(health.CheckBackend, err)
+		return err
+	}
+
+	auth.Set(a)
+	setChainHealth(c, ch)
+	backend.swap(ch)
+
+	log.WithFields(log.Fields{
+		"backend":     c.GeoServer.Backend.Type,
+		"bind":        c.GeoServer.API.Bind,
+		"ca_cert":     c.GeoServer.API.CACert,
+		"tls_cert":    c.GeoServer.API.TLSCert,
+		"tls_key":     c.GeoServer.API.TLSKey,
+		"client_auth": c.GeoServer.API.ClientAuth,
+	}).Info("starting api server")
+
+	if err := serveBackend(backend); err != nil {
+		return errors.Wrap(err, "serve backend error")
+	}
+
+	return nil
+}
+
+// Reload rebuilds the backend chain using the given configuration and
+// atomically replaces the current chain. In-flight requests are completed
+// by the previous chain, which is closed once these have completed. When
+// the new chain can't be created, the current chain is kept and an error
+// is returned.
+//
+// Note that the API listeners, storage, integrations, the per-device
+// state (smoothing, plausibility and geofence) and the open request log
+// files are not affected by a reload.
+func Reload(c config.Config) error {
+	if err := validation.Validate(c); err != nil {
+		reloadCounter("error").Inc()
+		return errors.Wrap(err, "validate config error")
+	}
+
+	a, err := auth.New(c)
+	if err != nil {
+		reloadCounter("error").Inc()
+		return errors.Wrap(err, "setup auth error")
+	}
+
+	ch, err := newChain(c)
+	if err != nil {
+		reloadCounter("error").Inc()
+		return err
+	}
+
+	auth.Set(a)
+	setChainHealth(c, ch)
+	if prev := backend.swap(ch); prev != nil {
+		retireChain(prev)
+	}
+
+	reloadCounter("success").Inc()
+	log.WithField("backend", c.GeoServer.Backend.Type).Info("backend: backend chain reloaded")
+
+	return nil
+}
+
+// newChain creates a new backend chain.
+func newChain(c config.Config) (*chain, error) {
 	var b geo.GeolocationServerServiceServer
 	var err error
 
@@ -33,52 +147,217 @@ func Setup(c config.Config) error {
 	case "lora_cloud":
 		b, err = loracloud.NewBackend(c)
 	default:
-		return fmt.Errorf("unknown backend: %s", c.GeoServer.Backend.Type)
+		return nil, fmt.Errorf("unknown backend: %s", c.GeoServer.Backend.Type)
 	}
 
 	if err != nil {
-		return errors.Wrap(err, "setup backend error")
+		return nil, errors.Wrap(err, "setup backend error")
+	}
+
+	ch := chain{
+		upstream: b,
+	}
+	ch.addCloser(b)
+
+	if c.GeoServer.Plausibility.Enabled {
+		b, err = plausibility.NewBackendWithState(b, c, plausibilityState)
+		if err != nil {
+			ch.close()
+			return nil, errors.Wrap(err, "setup plausibility backend error")
+		}
+	}
+
+	if c.GeoServer.Smoothing.Enabled {
+		b, err = smoothing.NewBackendWithState(b, c, smoothingState)
+		if err != nil {
+			ch.close()
+			return nil, errors.Wrap(err, "setup smoothing backend error")
+		}
+	}
+
+	if c.GeoServer.Geofence.Source != "" {
+		b, err = geofence.NewBackendWithState(b, integration.Integration(), c, geofenceState)
+		if err != nil {
+			ch.close()
+			return nil, errors.Wrap(err, "setup geofence backend error")
+		}
+		ch.addCloser(b)
+	}
+
+	if db := storage.DB(); db != nil {
+		b, err = historybackend.NewBackend(b, db)
+		if err != nil {
+			ch.close()
+			return nil, errors.Wrap(err, "setup history backend error")
+		}
 	}
 
-	b, err = logger.NewBackend(b, c)
+	if len(c.GeoServer.Integration.Enabled) != 0 {
+		b, err = publisher.NewBackend(b, integration.Integration(), c)
+		if err != nil {
+			ch.close()
+			return nil, errors.Wrap(err, "setup publisher backend error")
+		}
+	}
+
+	b, err = logger.NewBackendWithState(b, c, requestLogState)
 	if err != nil {
-		return errors.Wrap(err, "setup logging backend error")
+		ch.close()
+		return nil, errors.Wrap(err, "setup logging backend error")
 	}
+	ch.addCloser(b)
 
-	log.WithFields(log.Fields{
-		"backend":  c.GeoServer.Backend.Type,
-		"bind":     c.GeoServer.API.Bind,
-		"ca_cert":  c.GeoServer.API.CACert,
-		"tls_cert": c.GeoServer.API.TLSCert,
-		"tls_key":  c.GeoServer.API.TLSKey,
-	}).Info("starting api server")
+	ch.backend = b
 
-	if err := serveBackend(b); err != nil {
-		return errors.Wrap(err, "serve backend error")
+	return &ch, nil
+}
+
+// setChainHealth updates the health checks for the given chain.
+func setChainHealth(c config.Config, ch *chain) {
+	health.SetCheck(health.CheckBackend, validation.Backend(c))
+
+	if p, ok := ch.upstream.(health.Prober); ok && c.GeoServer.Backend.UpstreamProbe.Interval != 0 {
+		probeConf := c.GeoServer.Backend.UpstreamProbe
+		health.SetUpstreamProbe(p, probeConf.Interval, probeConf.Timeout, probeConf.FailureThreshold)
+	} else {
+		health.SetUpstreamProbe(nil, 0, 0, 0)
+	}
+}
+
+// Shutdown gracefully stops the API servers and closes the backend chain.
+// In-flight requests are given until the context deadline to complete,
+// after which the remaining requests are cancelled.
+func Shutdown(ctx context.Context) error {
+	health.SetCheck(health.CheckShutdown, errors.New("shutting down"))
+
+	if restServer != nil {
+		log.Info("backend: stopping rest api server")
+		if err := restServer.Shutdown(ctx); err != nil {
+			log.WithError(err).Warning("backend: drain timeout exceeded, closing rest api server")
+			restServer.Close()
+		}
+	}
+
+	if grpcServer != nil {
+		log.Info("backend: stopping api server")
+
+		done := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			log.Warning("backend: drain timeout exceeded, closing api server")
+			grpcServer.Stop()
+			<-done
+		}
+	}
+
+	health.Close()
+
+	if ch := backend.swap(nil); ch != nil {
+		retireChain(ch)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		retiring.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warning("backend: drain timeout exceeded, backend chain is closed in the background")
 	}
 
 	return nil
 }
 
+// retireChain closes the given (replaced) chain, once its in-flight calls
+// have completed.
+func retireChain(ch *chain) {
+	retiring.Add(1)
+	go func() {
+		defer retiring.Done()
+
+		<-ch.retire()
+		ch.close()
+	}()
+}
+
 func serveBackend(b geo.GeolocationServerServiceServer) error {
 	opts := gRPCLoggingServerOptions()
 	if apiConf := config.C.GeoServer.API; apiConf.CACert != "" || apiConf.TLSCert != "" || apiConf.TLSKey != "" {
-		creds, err := getTransportCredentials(apiConf.CACert, apiConf.TLSCert, apiConf.TLSKey, true)
+		r, err := tlsconfig.NewReloader(apiConf.TLSCert, apiConf.TLSKey, apiConf.CACert, apiConf.ClientAuth, apiConf.CertReloadInterval)
 		if err != nil {
-			return errors.Wrap(err, "get transport credentials error")
+			return errors.Wrap(err, "load tls certificates error")
 		}
-		opts = append(opts, grpc.Creds(creds))
+		opts = append(opts, grpc.Creds(credentials.NewTLS(r.TLSConfig("h2"))))
 	}
 
 	gs := grpc.NewServer(opts...)
 	geo.RegisterGeolocationServerServiceServer(gs, b)
+	health.RegisterService("geo.GeolocationServerService")
+	if db := storage.DB(); db != nil {
+		history.RegisterLocationHistoryServiceServer(gs, api.NewLocationHistoryAPI(db))
+		health.RegisterService("history.LocationHistoryService")
+	}
+	grpc_health_v1.RegisterHealthServer(gs, health.GRPCServer())
 
 	ln, err := net.Listen("tcp", config.C.GeoServer.API.Bind)
 	if err != nil {
 		return errors.Wrap(err, "start api listener error")
 	}
 
-	go gs.Serve(ln)
+	grpcServer = gs
+	go func() {
+		if err := gs.Serve(ln); err != nil {
+			log.WithError(err).Fatal("backend: api server error")
+		}
+	}()
+
+	if restConf := config.C.GeoServer.RESTAPI; restConf.Bind != "" {
+		log.WithFields(log.Fields{
+			"bind":     restConf.Bind,
+			"tls_cert": restConf.TLSCert,
+			"tls_key":  restConf.TLSKey,
+		}).Info("starting rest api server")
+
+		server := http.Server{
+			Handler: api.NewGeolocationRESTAPI(b),
+			Addr:    restConf.Bind,
+		}
+
+		if restConf.TLSCert != "" || restConf.TLSKey != "" {
+			r, err := tlsconfig.NewReloader(restConf.TLSCert, restConf.TLSKey, "", tlsconfig.ClientAuthNone, restConf.CertReloadInterval)
+			if err != nil {
+				return errors.Wrap(err, "load rest api tls certificates error")
+			}
+			server.TLSConfig = r.TLSConfig("h2", "http/1.1")
+		}
+
+		restLn, err := net.Listen("tcp", restConf.Bind)
+		if err != nil {
+			return errors.Wrap(err, "start rest api listener error")
+		}
+
+		restServer = &server
+		go func() {
+			var err error
+			if server.TLSConfig != nil {
+				err = server.ServeTLS(restLn, "", "")
+			} else {
+				err = server.Serve(restLn)
+			}
+			if err != nil && err != http.ErrServerClosed {
+				log.WithError(err).Fatal("backend: rest api server error")
+			}
+		}()
+	}
 
 	return nil
 }
@@ -90,45 +369,22 @@ func gRPCLoggingServerOptions() []grpc.ServerOption {
 	}
 
 	return []grpc.ServerOption{
+		tracing.ServerOption(),
 		grpc_middleware.WithUnaryServerChain(
 			grpc_ctxtags.UnaryServerInterceptor(grpc_ctxtags.WithFieldExtractor(grpc_ctxtags.CodeGenRequestFieldExtractor)),
+			logging.UnaryServerInterceptor,
+			tracing.UnaryServerInterceptor,
 			grpc_logrus.UnaryServerInterceptor(logrusEntry, logrusOpts...),
 			grpc_prometheus.UnaryServerInterceptor,
+			auth.UnaryServerInterceptor,
 		),
 		grpc_middleware.WithStreamServerChain(
 			grpc_ctxtags.StreamServerInterceptor(grpc_ctxtags.WithFieldExtractor(grpc_ctxtags.CodeGenRequestFieldExtractor)),
+			logging.StreamServerInterceptor,
+			tracing.StreamServerInterceptor,
 			grpc_logrus.StreamServerInterceptor(logrusEntry, logrusOpts...),
 			grpc_prometheus.StreamServerInterceptor,
+			auth.StreamServerInterceptor,
 		),
 	}
 }
-
-func getTransportCredentials(caCert, tlsCert, tlsKey string, verifyClientCert bool) (credentials.TransportCredentials, error) {
-	cert, err := tls.LoadX509KeyPair(tlsCert, tlsKey)
-	if err != nil {
-		return nil, errors.Wrap(err, "load key-pair error")
-	}
-
-	rawCaCert, err := ioutil.ReadFile(caCert)
-	if err != nil {
-		return nil, errors.Wrap(err, "load ca cert error")
-	}
-
-	caCertPool := x509.NewCertPool()
-	if !caCertPool.AppendCertsFromPEM(rawCaCert) {
-		return nil, errors.Wrap(err, "append ca certificate error")
-	}
-
-	if verifyClientCert {
-		return credentials.NewTLS(&tls.Config{
-			Certificates: []tls.Certificate{cert},
-			ClientCAs:    caCertPool,
-			ClientAuth:   tls.RequireAndVerifyClientCert,
-		}), nil
-	}
-
-	return credentials.NewTLS(&tls.Config{
-		Certificates: []tls.Certificate{cert},
-		RootCAs:      caCertPool,
-	}), nil
-}
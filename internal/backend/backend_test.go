@@ -0,0 +1,239 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/geo"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/logger"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+)
+
+func newTestServer(latitude float64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"result": {"latitude": %f, "longitude": 5.0, "accuracy": 10}}`, latitude)
+	}))
+}
+
+func TestReload(t *testing.T) {
+	assert := require.New(t)
+	log.SetLevel(log.ErrorLevel)
+
+	serverA := newTestServer(1)
+	defer serverA.Close()
+	serverB := newTestServer(2)
+	defer serverB.Close()
+
+	getConfig := func(uri string) config.Config {
+		var c config.Config
+		c.GeoServer.API.Bind = "127.0.0.1:8005"
+		c.GeoServer.API.DrainTimeout = time.Second
+		c.GeoServer.Backend.Type = "lora_cloud"
+		c.GeoServer.Backend.LoRaCloud.URI = uri
+		c.GeoServer.Backend.LoRaCloud.Token = "token"
+		c.GeoServer.Backend.LoRaCloud.RequestTimeout = time.Second
+		return c
+	}
+
+	resolve := func() float64 {
+		resp, err := backend.ResolveTDOA(context.Background(), &geo.ResolveTDOARequest{
+			FrameRxInfo: &geo.FrameRXInfo{},
+		})
+		assert.NoError(err)
+		return resp.Result.Location.Latitude
+	}
+
+	t.Run("no backend", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := backend.ResolveTDOA(context.Background(), &geo.ResolveTDOARequest{})
+		assert.Error(err)
+	})
+
+	t.Run("initial backend", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(Reload(getConfig(serverA.URL)))
+		assert.EqualValues(1, resolve())
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(Reload(getConfig(serverB.URL)))
+		assert.EqualValues(2, resolve())
+	})
+
+	t.Run("invalid config is rejected", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := getConfig(serverA.URL)
+		c.GeoServer.Backend.Type = "foo"
+		err := Reload(c)
+		assert.Error(err)
+		assert.Contains(err.Error(), "unknown backend: 'foo'")
+
+		c = getConfig(serverA.URL)
+		c.GeoServer.Backend.LoRaCloud.Token = ""
+		assert.Error(Reload(c))
+
+		c = getConfig(serverA.URL)
+		c.GeoServer.Geofence.Source = "/does/not/exist.geojson"
+		assert.Error(Reload(c))
+
+		assert.EqualValues(2, resolve())
+	})
+
+	t.Run("smoothing state is kept", func(t *testing.T) {
+		assert := require.New(t)
+
+		getSmoothingConfig := func(uri string) config.Config {
+			c := getConfig(uri)
+			c.GeoServer.Smoothing.Enabled = true
+			c.GeoServer.Smoothing.ProcessNoise = 0.1
+			c.GeoServer.Smoothing.StateTimeout = time.Hour
+			return c
+		}
+
+		assert.NoError(Reload(getSmoothingConfig(serverA.URL)))
+		assert.EqualValues(1, resolve())
+
+		// the filter of the device is not reset by the reload, therefore
+		// the location is smoothed
+		assert.NoError(Reload(getSmoothingConfig(serverB.URL)))
+		lat := resolve()
+		assert.True(lat > 1 && lat < 2, "latitude: %f", lat)
+	})
+
+	t.Run("in-flight calls are completed", func(t *testing.T) {
+		assert := require.New(t)
+
+		received := make(chan struct{})
+		release := make(chan struct{})
+		slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(received)
+			<-release
+			fmt.Fprint(w, `{"result": {"latitude": 3, "longitude": 5.0, "accuracy": 10}}`)
+		}))
+		defer slowServer.Close()
+
+		assert.NoError(Reload(getConfig(slowServer.URL)))
+		prev, _ := backend.chain.Load().(*chain)
+
+		result := make(chan float64)
+		go func() {
+			result <- resolve()
+		}()
+		<-received
+
+		assert.NoError(Reload(getConfig(serverA.URL)))
+		assert.EqualValues(1, resolve())
+
+		drained := prev.retire()
+		select {
+		case <-drained:
+			t.Fatal("chain drained while a call is in-flight")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(release)
+		assert.EqualValues(3, <-result)
+
+		select {
+		case <-drained:
+		case <-time.After(time.Second):
+			t.Fatal("chain not drained")
+		}
+	})
+
+	t.Run("request log files written by a retiring chain stay open", func(t *testing.T) {
+		assert := require.New(t)
+
+		dir, err := ioutil.TempDir("", "request-log")
+		assert.NoError(err)
+		defer os.RemoveAll(dir)
+
+		getLogConfig := func(uri string) config.Config {
+			c := getConfig(uri)
+			c.GeoServer.Backend.RequestLogDir = dir
+			c.GeoServer.Backend.RequestLog.Mode = logger.ModeNDJSON
+			c.GeoServer.Backend.RequestLog.NDJSONPeriod = logger.PeriodHourly
+			c.GeoServer.Backend.RequestLog.Compression = logger.CompressionGzip
+			c.GeoServer.Backend.RequestLog.QueueSize = 10
+			return c
+		}
+
+		received := make(chan struct{})
+		release := make(chan struct{})
+		slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(received)
+			<-release
+			fmt.Fprint(w, `{"result": {"latitude": 3, "longitude": 5.0, "accuracy": 10}}`)
+		}))
+		defer slowServer.Close()
+
+		assert.NoError(Reload(getLogConfig(slowServer.URL)))
+
+		result := make(chan float64)
+		go func() {
+			result <- resolve()
+		}()
+		<-received
+
+		// the new chain logs while the previous chain is still in-flight
+		assert.NoError(Reload(getLogConfig(serverA.URL)))
+		assert.EqualValues(1, resolve())
+
+		logDir := filepath.Join(dir, "ResolveTDOA")
+		waitRecords := func(n int) {
+			for i := 0; i < 100; i++ {
+				var count int
+				err := logger.WalkDir(logDir, func(e logger.Entry) error {
+					count++
+					return nil
+				})
+				if err == nil && count == n {
+					return
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			t.Fatalf("expected %d records", n)
+		}
+		waitRecords(1)
+
+		// the maintenance of the next chain must not compress the part
+		assert.NoError(Reload(getLogConfig(serverA.URL)))
+		time.Sleep(50 * time.Millisecond)
+
+		close(release)
+		assert.EqualValues(3, <-result)
+		assert.EqualValues(1, resolve())
+
+		if ch := backend.swap(nil); ch != nil {
+			ch.close()
+		}
+		retiring.Wait()
+
+		files, err := ioutil.ReadDir(logDir)
+		assert.NoError(err)
+		assert.Len(files, 1)
+		assert.True(strings.HasSuffix(files[0].Name(), ".0000"+logger.NDJSONFileSuffix), files[0].Name())
+		waitRecords(3)
+	})
+
+	if ch := backend.swap(nil); ch != nil {
+		ch.close()
+	}
+	retiring.Wait()
+}
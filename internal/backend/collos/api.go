@@ -11,15 +11,26 @@ import (
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 
+	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/quality"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/upstream"
 	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/helpers"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/logging"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/tracing"
 	"github.com/brocaar/chirpstack-api/go/v3/common"
 	"github.com/brocaar/chirpstack-api/go/v3/geo"
 	"github.com/brocaar/lorawan"
 )
 
+// backendName is the name of the backend, as used in the metrics and
+// traces.
+const backendName = "collos"
+
 // Backend implements the Collos geolocation backend.
 type Backend struct {
 	subscriptionKey string
@@ -35,8 +46,22 @@ func NewBackend(c config.Config) (geo.GeolocationServerServiceServer, error) {
 }
 
 // ResolveTDOA resolves the location based on TDOA.
-func (b *Backend) ResolveTDOA(ctx context.Context, req *geo.ResolveTDOARequest) (*geo.ResolveTDOAResponse, error) {
-	collosReq, err := resolveTDOARequestToCollosRequest(req)
+func (b *Backend) ResolveTDOA(ctx context.Context, req *geo.ResolveTDOARequest) (resp *geo.ResolveTDOAResponse, err error) {
+	ctx, span := tracing.Start(ctx, "collos.ResolveTDOA", trace.SpanKindInternal,
+		attribute.String("geo.backend", backendName),
+		tracing.DevEUI(req.DevEui),
+		attribute.Int("geo.gateway_count", len(req.GetFrameRxInfo().GetRxInfo())),
+	)
+	defer func() {
+		tracing.SetError(span, err)
+		span.End()
+	}()
+
+	_, preSpan := tracing.Start(ctx, "collos.preprocess", trace.SpanKindInternal)
+	collosReq, err := resolveTDOARequestToCollosRequest(ctx, req)
+	preSpan.SetAttributes(attribute.Int("geo.gateway_count_used", len(collosReq.LoRaWAN)))
+	tracing.SetError(preSpan, err)
+	preSpan.End()
 	if err != nil {
 		return nil, grpc.Errorf(codes.InvalidArgument, err.Error())
 	}
@@ -49,15 +74,18 @@ func (b *Backend) ResolveTDOA(ctx context.Context, req *geo.ResolveTDOARequest)
 	var devEUI lorawan.EUI64
 	copy(devEUI[:], req.DevEui)
 
+	quality.ObserveMessages(backendName, quality.MessageWarning, tdoaResp.Warnings)
+	quality.ObserveMessages(backendName, quality.MessageError, tdoaResp.Errors)
+
 	if len(tdoaResp.Warnings) != 0 {
-		log.WithFields(log.Fields{
+		logging.FromContext(ctx).WithFields(log.Fields{
 			"dev_eui":  devEUI,
 			"warnings": tdoaResp.Warnings,
 		}).Warning("backend/collos: backend returned warnings")
 	}
 
 	if len(tdoaResp.Errors) != 0 {
-		log.WithFields(log.Fields{
+		logging.FromContext(ctx).WithFields(log.Fields{
 			"dev_eui": devEUI,
 			"errors":  tdoaResp.Errors,
 		}).Error("backend/collos: backend returned errors")
@@ -65,6 +93,9 @@ func (b *Backend) ResolveTDOA(ctx context.Context, req *geo.ResolveTDOARequest)
 		return nil, grpc.Errorf(codes.Internal, "backend returned errors: %v", tdoaResp.Errors)
 	}
 
+	quality.ObserveAccuracy(backendName, tdoaResp.Result.Accuracy)
+	quality.ObserveGateways(backendName, len(req.GetFrameRxInfo().GetRxInfo()), len(collosReq.LoRaWAN), tdoaResp.Result.NumberOfGatewaysUsed)
+
 	return &geo.ResolveTDOAResponse{
 		Result: &geo.ResolveResult{
 			Location: &common.Location{
@@ -80,8 +111,23 @@ func (b *Backend) ResolveTDOA(ctx context.Context, req *geo.ResolveTDOARequest)
 
 // ResolveMultiFrameTDOA resolves the location using TDOA, based on
 // multiple frames.
-func (b *Backend) ResolveMultiFrameTDOA(ctx context.Context, req *geo.ResolveMultiFrameTDOARequest) (*geo.ResolveMultiFrameTDOAResponse, error) {
-	collosReq, err := resolveMutiFrameTDOARequestToCollosRequest(req)
+func (b *Backend) ResolveMultiFrameTDOA(ctx context.Context, req *geo.ResolveMultiFrameTDOARequest) (resp *geo.ResolveMultiFrameTDOAResponse, err error) {
+	ctx, span := tracing.Start(ctx, "collos.ResolveMultiFrameTDOA", trace.SpanKindInternal,
+		attribute.String("geo.backend", backendName),
+		tracing.DevEUI(req.DevEui),
+		attribute.Int("geo.frame_count", len(req.FrameRxInfoSet)),
+		attribute.Int("geo.gateway_count", helpers.GetGatewayCount(req.FrameRxInfoSet)),
+	)
+	defer func() {
+		tracing.SetError(span, err)
+		span.End()
+	}()
+
+	_, preSpan := tracing.Start(ctx, "collos.preprocess", trace.SpanKindInternal)
+	collosReq, err := resolveMutiFrameTDOARequestToCollosRequest(ctx, req)
+	preSpan.SetAttributes(attribute.Int("geo.gateway_count_used", collosReq.gatewayCount()))
+	tracing.SetError(preSpan, err)
+	preSpan.End()
 	if err != nil {
 		return nil, grpc.Errorf(codes.InvalidArgument, err.Error())
 	}
@@ -94,15 +140,18 @@ func (b *Backend) ResolveMultiFrameTDOA(ctx context.Context, req *geo.ResolveMul
 	var devEUI lorawan.EUI64
 	copy(devEUI[:], req.DevEui)
 
+	quality.ObserveMessages(backendName, quality.MessageWarning, tdoaResp.Warnings)
+	quality.ObserveMessages(backendName, quality.MessageError, tdoaResp.Errors)
+
 	if len(tdoaResp.Warnings) != 0 {
-		log.WithFields(log.Fields{
+		logging.FromContext(ctx).WithFields(log.Fields{
 			"dev_eui":  devEUI,
 			"warnings": tdoaResp.Warnings,
 		}).Warning("backend/collos: backend returned warnings")
 	}
 
 	if len(tdoaResp.Errors) != 0 {
-		log.WithFields(log.Fields{
+		logging.FromContext(ctx).WithFields(log.Fields{
 			"dev_eui": devEUI,
 			"errors":  tdoaResp.Errors,
 		}).Error("backend/collos: backend returned errors")
@@ -110,6 +159,9 @@ func (b *Backend) ResolveMultiFrameTDOA(ctx context.Context, req *geo.ResolveMul
 		return nil, grpc.Errorf(codes.Internal, "backend returned errors: %v", tdoaResp.Errors)
 	}
 
+	quality.ObserveAccuracy(backendName, tdoaResp.Result.Accuracy)
+	quality.ObserveGateways(backendName, helpers.GetGatewayCount(req.FrameRxInfoSet), collosReq.gatewayCount(), tdoaResp.Result.NumberOfGatewaysUsed)
+
 	return &geo.ResolveMultiFrameTDOAResponse{
 		Result: &geo.ResolveResult{
 			Location: &common.Location{
@@ -139,20 +191,36 @@ func (b *Backend) resolveTDOAMultiFrame(ctx context.Context, tdoaMultiFrameReq t
 	return resp, err
 }
 
-func (b *Backend) collosAPIRequest(ctx context.Context, endpoint string, v interface{}) (response, error) {
-	var resolveResp response
+func (b *Backend) collosAPIRequest(ctx context.Context, endpoint string, v interface{}) (resolveResp response, err error) {
+	ctx, span := tracing.Start(ctx, "HTTP POST", trace.SpanKindClient,
+		attribute.String("http.method", "POST"),
+		attribute.String("http.url", endpoint),
+	)
+	defer func() {
+		tracing.SetError(span, err)
+		span.End()
+	}()
 
 	bb, err := json.Marshal(v)
 	if err != nil {
 		return resolveResp, errors.Wrap(err, "marshal request error")
 	}
 
+	exchange := upstream.Exchange{URL: endpoint, RequestBody: bb}
+	defer func() {
+		upstream.Record(ctx, exchange)
+	}()
+
 	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(bb))
 	if err != nil {
 		return resolveResp, errors.Wrap(err, "new request error")
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	tracing.Inject(ctx, req.Header)
+	if id, ok := logging.RequestIDFromContext(ctx); ok {
+		req.Header.Set(logging.RequestIDHeader, id)
+	}
 	req.Header.Set("Ocp-Apim-Subscription-Key", b.subscriptionKey)
 
 	reqCTX, cancel := context.WithTimeout(ctx, b.requestTimeout)
@@ -166,14 +234,49 @@ func (b *Backend) collosAPIRequest(ctx context.Context, endpoint string, v inter
 
 	defer resp.Body.Close()
 
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	exchange.StatusCode = resp.StatusCode
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resolveResp, errors.Wrap(err, "read response error")
+	}
+	exchange.ResponseBody = body
+
 	if resp.StatusCode != http.StatusOK {
-		bb, _ := ioutil.ReadAll(resp.Body)
-		return resolveResp, fmt.Errorf("expected 200, got: %d (%s)", resp.StatusCode, string(bb))
+		return resolveResp, fmt.Errorf("expected 200, got: %d (%s)", resp.StatusCode, string(body))
 	}
 
-	if err = json.NewDecoder(resp.Body).Decode(&resolveResp); err != nil {
+	if err = json.Unmarshal(body, &resolveResp); err != nil {
 		return resolveResp, errors.Wrap(err, "unmarshal response error")
 	}
 
 	return resolveResp, nil
 }
+
+// Probe checks if the Collos API is reachable and accepts the configured
+// credentials. As the probe does not send a valid request, any HTTP response
+// below 500 is considered healthy, except for 401 and 403 (e.g. a revoked or
+// invalid token).
+func (b *Backend) Probe(ctx context.Context) error {
+	req, err := http.NewRequest("GET", tdoaEndpoint, nil)
+	if err != nil {
+		return errors.Wrap(err, "new request error")
+	}
+	req.Header.Set("Ocp-Apim-Subscription-Key", b.subscriptionKey)
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "http request error")
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("unauthorized, status: %d", resp.StatusCode)
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -551,6 +551,43 @@ func (ts *CollosTestSuite) apiHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(ts.apiResponse))
 }
 
+func TestProbe(t *testing.T) {
+	testTable := []struct {
+		Status        int
+		ExpectedError string
+	}{
+		{Status: http.StatusBadRequest},
+		{Status: http.StatusMethodNotAllowed},
+		{Status: http.StatusUnauthorized, ExpectedError: "unauthorized, status: 401"},
+		{Status: http.StatusForbidden, ExpectedError: "unauthorized, status: 403"},
+		{Status: http.StatusServiceUnavailable, ExpectedError: "unexpected status: 503"},
+	}
+
+	for _, tst := range testTable {
+		t.Run(http.StatusText(tst.Status), func(t *testing.T) {
+			assert := require.New(t)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tst.Status)
+			}))
+			defer server.Close()
+
+			endpoint := tdoaEndpoint
+			tdoaEndpoint = server.URL
+			defer func() { tdoaEndpoint = endpoint }()
+
+			b := Backend{subscriptionKey: "key"}
+
+			err := b.Probe(context.Background())
+			if tst.ExpectedError == "" {
+				assert.NoError(err)
+			} else {
+				assert.EqualError(err, tst.ExpectedError)
+			}
+		})
+	}
+}
+
 func TestCollos(t *testing.T) {
 	suite.Run(t, new(CollosTestSuite))
 }
@@ -1,6 +1,7 @@
 package collos
 
 import (
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -10,6 +11,8 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 
+	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/quality"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/logging"
 	"github.com/brocaar/chirpstack-api/go/v3/geo"
 	"github.com/brocaar/chirpstack-api/go/v3/gw"
 	"github.com/brocaar/lorawan"
@@ -23,6 +26,15 @@ type tdoaMultiFrameRequest struct {
 	LoRaWAN [][]loRaWANRX `json:"lorawan"`
 }
 
+// gatewayCount returns the total number of gateway receptions.
+func (r tdoaMultiFrameRequest) gatewayCount() int {
+	var out int
+	for _, lw := range r.LoRaWAN {
+		out += len(lw)
+	}
+	return out
+}
+
 type loRaWANRX struct {
 	GatewayID       string          `json:"gatewayId"`
 	AntennaID       int             `json:"antennaId"`
@@ -59,7 +71,7 @@ type result struct {
 var tdoaEndpoint = "https://api.preview.collos.org/semtech-localization-algorithms/v2/tdoa"
 var tdoaMultiFrameEndpoint = "https://api.preview.collos.org/semtech-localization-algorithms/v2/tdoaMultiframe"
 
-func resolveTDOARequestToCollosRequest(req *geo.ResolveTDOARequest) (tdoaRequest, error) {
+func resolveTDOARequestToCollosRequest(ctx context.Context, req *geo.ResolveTDOARequest) (tdoaRequest, error) {
 	var tdoaReq tdoaRequest
 	var err error
 
@@ -70,7 +82,7 @@ func resolveTDOARequestToCollosRequest(req *geo.ResolveTDOARequest) (tdoaRequest
 	var devEUI lorawan.EUI64
 	copy(devEUI[:], req.DevEui)
 
-	tdoaReq.LoRaWAN, err = rxInfoToCollos(devEUI, req.FrameRxInfo.RxInfo)
+	tdoaReq.LoRaWAN, err = rxInfoToCollos(ctx, devEUI, req.FrameRxInfo.RxInfo)
 	if err != nil {
 		return tdoaReq, err
 	}
@@ -78,14 +90,14 @@ func resolveTDOARequestToCollosRequest(req *geo.ResolveTDOARequest) (tdoaRequest
 	return tdoaReq, nil
 }
 
-func resolveMutiFrameTDOARequestToCollosRequest(req *geo.ResolveMultiFrameTDOARequest) (tdoaMultiFrameRequest, error) {
+func resolveMutiFrameTDOARequestToCollosRequest(ctx context.Context, req *geo.ResolveMultiFrameTDOARequest) (tdoaMultiFrameRequest, error) {
 	var tdoaReq tdoaMultiFrameRequest
 
 	var devEUI lorawan.EUI64
 	copy(devEUI[:], req.DevEui)
 
 	for _, frame := range req.FrameRxInfoSet {
-		lw, err := rxInfoToCollos(devEUI, frame.RxInfo)
+		lw, err := rxInfoToCollos(ctx, devEUI, frame.RxInfo)
 		if err != nil {
 			return tdoaReq, err
 		}
@@ -96,7 +108,7 @@ func resolveMutiFrameTDOARequestToCollosRequest(req *geo.ResolveMultiFrameTDOARe
 	return tdoaReq, nil
 }
 
-func rxInfoToCollos(devEUI lorawan.EUI64, rxInfo []*gw.UplinkRXInfo) ([]loRaWANRX, error) {
+func rxInfoToCollos(ctx context.Context, devEUI lorawan.EUI64, rxInfo []*gw.UplinkRXInfo) ([]loRaWANRX, error) {
 	var out []loRaWANRX
 
 	for _, rxInfo := range rxInfo {
@@ -104,19 +116,21 @@ func rxInfoToCollos(devEUI lorawan.EUI64, rxInfo []*gw.UplinkRXInfo) ([]loRaWANR
 		copy(gatewayID[:], rxInfo.GatewayId)
 
 		if rxInfo.Location == nil {
-			log.WithFields(log.Fields{
+			logging.FromContext(ctx).WithFields(log.Fields{
 				"dev_eui":    devEUI,
 				"gateway_id": gatewayID,
 			}).Warning("location is nil, ignoring gateway")
+			quality.GatewaySkipped(backendName, quality.ReasonNoLocation)
 			continue
 		}
 
 		if rxInfo.FineTimestampType == gw.FineTimestampType_NONE {
-			log.WithFields(log.Fields{
+			logging.FromContext(ctx).WithFields(log.Fields{
 				"dev_eui":             devEUI,
 				"fine_timestamp_type": rxInfo.FineTimestampType,
 				"gateway_id":          gatewayID,
 			}).Warning("unsupported fine-typestamp type")
+			quality.GatewaySkipped(backendName, quality.ReasonNoFineTimestamp)
 			continue
 		}
 
@@ -134,10 +148,11 @@ func rxInfoToCollos(devEUI lorawan.EUI64, rxInfo []*gw.UplinkRXInfo) ([]loRaWANR
 		if rxInfo.FineTimestampType == gw.FineTimestampType_PLAIN {
 			plainTS := rxInfo.GetPlainFineTimestamp()
 			if plainTS == nil {
-				log.WithFields(log.Fields{
+				logging.FromContext(ctx).WithFields(log.Fields{
 					"dev_eui":    devEUI,
 					"gateway_id": gatewayID,
 				}).Warning("plain_fine_timestamp must not be nil")
+				quality.GatewaySkipped(backendName, quality.ReasonNilTimestamp)
 				continue
 			}
 
@@ -153,18 +168,20 @@ func rxInfoToCollos(devEUI lorawan.EUI64, rxInfo []*gw.UplinkRXInfo) ([]loRaWANR
 		if rxInfo.FineTimestampType == gw.FineTimestampType_ENCRYPTED {
 			encryptedTS := rxInfo.GetEncryptedFineTimestamp()
 			if encryptedTS == nil {
-				log.WithFields(log.Fields{
+				logging.FromContext(ctx).WithFields(log.Fields{
 					"dev_eui":    devEUI,
 					"gateway_id": gatewayID,
 				}).Warning("encrypted_fine_timestamp must not be nil")
+				quality.GatewaySkipped(backendName, quality.ReasonNilTimestamp)
 				continue
 			}
 
 			if len(encryptedTS.FpgaId) == 0 {
-				log.WithFields(log.Fields{
+				logging.FromContext(ctx).WithFields(log.Fields{
 					"dev_eui":    devEUI,
 					"gateway_id": gatewayID,
 				}).Warning("fpga_id must not be nil")
+				quality.GatewaySkipped(backendName, quality.ReasonNoFPGAID)
 				continue
 			}
 
@@ -0,0 +1,337 @@
+package geofence
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-api/go/v3/geo"
+	"github.com/brocaar/chirpstack-geolocation-server/api/integration"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/geofence"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/helpers"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/integration/models"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/logging"
+	"github.com/brocaar/lorawan"
+)
+
+// state holds the state of a device for a single geofence.
+type state struct {
+	inside    bool
+	enteredAt time.Time
+	dwellSent bool
+}
+
+// deviceState holds the geofence states of a device and the time at which
+// the device was last seen.
+type deviceState struct {
+	fences map[string]*state
+	seen   time.Time
+}
+
+// State holds the geofence state of the devices. A State can be shared by
+// subsequent backends, such that the state is kept when the backend is
+// re-created on a configuration reload.
+type State struct {
+	mu        sync.Mutex
+	devices   map[lorawan.EUI64]*deviceState
+	lastSweep time.Time
+}
+
+// NewState creates a new (empty) State.
+func NewState() *State {
+	return &State{
+		devices: make(map[lorawan.EUI64]*deviceState),
+	}
+}
+
+// Backend implements a backend which evaluates the resolved locations
+// against the configured geofences.
+type Backend struct {
+	backend      geo.GeolocationServerServiceServer
+	integration  models.Integrator
+	dwellTime    time.Duration
+	stateTimeout time.Duration
+	state        *State
+
+	fencesMu sync.RWMutex
+	fences   []geofence.Geofence
+
+	closed chan struct{}
+	done   chan struct{}
+}
+
+// NewBackend creates a new geofence backend, wrapping the given backend.
+// Geofence events are sent to the given integration, which must not block.
+func NewBackend(b geo.GeolocationServerServiceServer, i models.Integrator, c config.Config) (geo.GeolocationServerServiceServer, error) {
+	return NewBackendWithState(b, i, c, NewState())
+}
+
+// NewBackendWithState creates a new geofence backend, wrapping the given
+// backend and using the given State.
+func NewBackendWithState(b geo.GeolocationServerServiceServer, i models.Integrator, c config.Config, s *State) (geo.GeolocationServerServiceServer, error) {
+	if b == nil {
+		return nil, errors.New("the given backend must not be nil")
+	}
+
+	if s == nil {
+		return nil, errors.New("the given state must not be nil")
+	}
+
+	if i == nil {
+		return nil, errors.New("the given integration must not be nil")
+	}
+
+	conf := c.GeoServer.Geofence
+
+	fences, err := geofence.Load(conf.Source)
+	if err != nil {
+		return nil, errors.Wrap(err, "load geofences error")
+	}
+
+	log.WithFields(log.Fields{
+		"source":    conf.Source,
+		"geofences": len(fences),
+	}).Info("backend/geofence: geofences loaded")
+
+	backend := Backend{
+		backend:      b,
+		integration:  i,
+		dwellTime:    conf.DwellTime,
+		stateTimeout: conf.StateTimeout,
+		state:        s,
+		fences:       fences,
+		closed:       make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+
+	if conf.RefreshInterval != 0 {
+		go backend.refreshLoop(conf.Source, conf.RefreshInterval)
+	} else {
+		close(backend.done)
+	}
+
+	return &backend, nil
+}
+
+// ResolveTDOA resolves the location based on TDOA.
+func (b *Backend) ResolveTDOA(ctx context.Context, req *geo.ResolveTDOARequest) (*geo.ResolveTDOAResponse, error) {
+	resp, err := b.backend.ResolveTDOA(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &geo.ResolveTDOAResponse{
+		Result: b.evaluate(ctx, req.DevEui, []*geo.FrameRXInfo{req.FrameRxInfo}, resp.Result),
+	}, nil
+}
+
+// ResolveMultiFrameTDOA resolves the location using TDOA, based on
+// multiple frames.
+func (b *Backend) ResolveMultiFrameTDOA(ctx context.Context, req *geo.ResolveMultiFrameTDOARequest) (*geo.ResolveMultiFrameTDOAResponse, error) {
+	resp, err := b.backend.ResolveMultiFrameTDOA(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &geo.ResolveMultiFrameTDOAResponse{
+		Result: b.evaluate(ctx, req.DevEui, req.FrameRxInfoSet, resp.Result),
+	}, nil
+}
+
+// Close stops refreshing the geofences.
+func (b *Backend) Close() error {
+	close(b.closed)
+	<-b.done
+	return nil
+}
+
+func (b *Backend) refreshLoop(source string, interval time.Duration) {
+	defer close(b.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.closed:
+			return
+		case <-ticker.C:
+		}
+
+		fences, err := geofence.Load(source)
+		if err != nil {
+			log.WithError(err).WithField("source", source).Error("backend/geofence: reload geofences error")
+			continue
+		}
+
+		b.fencesMu.Lock()
+		b.fences = fences
+		b.fencesMu.Unlock()
+
+		log.WithFields(log.Fields{
+			"source":    source,
+			"geofences": len(fences),
+		}).Debug("backend/geofence: geofences reloaded")
+	}
+}
+
+// evaluate updates the geofence state of the device and sends the
+// geofence events. It returns the (clipped) result.
+func (b *Backend) evaluate(ctx context.Context, devEUIB []byte, frames []*geo.FrameRXInfo, res *geo.ResolveResult) *geo.ResolveResult {
+	if res == nil || res.Location == nil {
+		return res
+	}
+
+	var devEUI lorawan.EUI64
+	copy(devEUI[:], devEUIB)
+
+	t := helpers.GetFrameTime(frames)
+	now := time.Now()
+
+	b.fencesMu.RLock()
+	fences := b.fences
+	b.fencesMu.RUnlock()
+
+	b.state.mu.Lock()
+	defer b.state.mu.Unlock()
+
+	b.sweep(now)
+
+	// the state of a device which has not been seen within the state
+	// timeout is unknown, e.g. the device is not assumed to be inside a
+	// (clipping) geofence anymore
+	ds, ok := b.state.devices[devEUI]
+	if !ok || b.expired(ds, now) {
+		ds = &deviceState{
+			fences: make(map[string]*state),
+		}
+		b.state.devices[devEUI] = ds
+	}
+	ds.seen = now
+	states := ds.fences
+
+	p := geofence.Point{
+		Latitude:  res.Location.Latitude,
+		Longitude: res.Location.Longitude,
+	}
+
+	// clip the location when the device is known to be inside a clipping
+	// geofence and the location is within its accuracy
+	var clippedID string
+	for _, f := range fences {
+		if !f.Clip || !f.AppliesTo(devEUI) {
+			continue
+		}
+
+		if s, ok := states[f.ID]; !ok || !s.inside || f.Contains(p) {
+			continue
+		}
+
+		if nearest, dist := f.Nearest(p); dist <= float64(res.Location.Accuracy) {
+			logging.FromContext(ctx).WithFields(log.Fields{
+				"dev_eui":     devEUI,
+				"geofence_id": f.ID,
+				"distance":    dist,
+			}).Debug("backend/geofence: location clipped to geofence")
+
+			res = proto.Clone(res).(*geo.ResolveResult)
+			res.Location.Latitude = nearest.Latitude
+			res.Location.Longitude = nearest.Longitude
+			p = nearest
+			clippedID = f.ID
+			break
+		}
+	}
+
+	for _, f := range fences {
+		if !f.AppliesTo(devEUI) {
+			continue
+		}
+
+		s, ok := states[f.ID]
+		if !ok {
+			s = &state{}
+			states[f.ID] = s
+		}
+
+		// a clipped location is on the geofence boundary, which is
+		// considered inside
+		inside := f.ID == clippedID || f.Contains(p)
+
+		switch {
+		case inside && !s.inside:
+			s.inside = true
+			s.enteredAt = t
+			s.dwellSent = false
+			b.sendEvent(ctx, devEUI, t, integration.GeofenceEventType_ENTER, f, res, 0)
+		case !inside && s.inside:
+			s.inside = false
+			b.sendEvent(ctx, devEUI, t, integration.GeofenceEventType_EXIT, f, res, t.Sub(s.enteredAt))
+		case inside && b.dwellTime != 0 && !s.dwellSent && t.Sub(s.enteredAt) >= b.dwellTime:
+			s.dwellSent = true
+			b.sendEvent(ctx, devEUI, t, integration.GeofenceEventType_DWELL, f, res, t.Sub(s.enteredAt))
+		}
+	}
+
+	return res
+}
+
+// expired returns true when the device has not been seen within the state
+// timeout.
+func (b *Backend) expired(ds *deviceState, now time.Time) bool {
+	return b.stateTimeout != 0 && now.Sub(ds.seen) > b.stateTimeout
+}
+
+// sweep removes the states of the devices which have not been seen within
+// the state timeout. To keep the cost per request low, this is done at most
+// once per state timeout. It must be called with the state lock held.
+func (b *Backend) sweep(now time.Time) {
+	if b.stateTimeout == 0 || now.Sub(b.state.lastSweep) < b.stateTimeout {
+		return
+	}
+	b.state.lastSweep = now
+
+	for devEUI, ds := range b.state.devices {
+		if b.expired(ds, now) {
+			delete(b.state.devices, devEUI)
+		}
+	}
+}
+
+// sendEvent sends the geofence event to the integration.
+func (b *Backend) sendEvent(ctx context.Context, devEUI lorawan.EUI64, t time.Time, typ integration.GeofenceEventType, f geofence.Geofence, res *geo.ResolveResult, dwellTime time.Duration) {
+	pl := integration.GeofenceEvent{
+		DevEui:       devEUI[:],
+		Type:         typ,
+		GeofenceId:   f.ID,
+		GeofenceName: f.Name,
+		Location: &integration.Location{
+			Latitude:  res.Location.Latitude,
+			Longitude: res.Location.Longitude,
+			Altitude:  res.Location.Altitude,
+			Accuracy:  res.Location.Accuracy,
+		},
+	}
+
+	var err error
+	if pl.Time, err = ptypes.TimestampProto(t); err != nil {
+		logging.FromContext(ctx).WithError(err).Error("backend/geofence: timestamp proto error")
+	}
+
+	if dwellTime != 0 {
+		pl.DwellTime = ptypes.DurationProto(dwellTime)
+	}
+
+	if err := b.integration.SendGeofenceEvent(context.Background(), pl); err != nil {
+		logging.FromContext(ctx).WithError(err).WithFields(log.Fields{
+			"dev_eui":     devEUI,
+			"geofence_id": f.ID,
+		}).Error("backend/geofence: send geofence event error")
+	}
+}
@@ -0,0 +1,234 @@
+package geofence
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/geo"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-geolocation-server/api/integration"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+type testBackend struct {
+	location common.Location
+}
+
+func (b *testBackend) ResolveTDOA(ctx context.Context, req *geo.ResolveTDOARequest) (*geo.ResolveTDOAResponse, error) {
+	loc := b.location
+	return &geo.ResolveTDOAResponse{
+		Result: &geo.ResolveResult{
+			Location: &loc,
+		},
+	}, nil
+}
+
+func (b *testBackend) ResolveMultiFrameTDOA(ctx context.Context, req *geo.ResolveMultiFrameTDOARequest) (*geo.ResolveMultiFrameTDOAResponse, error) {
+	loc := b.location
+	return &geo.ResolveMultiFrameTDOAResponse{
+		Result: &geo.ResolveResult{
+			Location: &loc,
+		},
+	}, nil
+}
+
+type testIntegration struct {
+	events chan integration.GeofenceEvent
+}
+
+func (i *testIntegration) SendLocationEvent(ctx context.Context, pl integration.LocationEvent) error {
+	return nil
+}
+
+func (i *testIntegration) SendGeofenceEvent(ctx context.Context, pl integration.GeofenceEvent) error {
+	i.events <- pl
+	return nil
+}
+
+func (i *testIntegration) Close() error {
+	return nil
+}
+
+const testGeoJSON = `
+{
+	"type": "FeatureCollection",
+	"features": [
+		{
+			"type": "Feature",
+			"id": "site",
+			"properties": {
+				"name": "Site",
+				"clip": true
+			},
+			"geometry": {
+				"type": "Polygon",
+				"coordinates": [
+					[[5.0, 52.0], [5.01, 52.0], [5.01, 52.01], [5.0, 52.01], [5.0, 52.0]]
+				]
+			}
+		}
+	]
+}
+`
+
+func TestBackend(t *testing.T) {
+	assert := require.New(t)
+	log.SetLevel(log.ErrorLevel)
+
+	f, err := ioutil.TempFile("", "geofences")
+	assert.NoError(err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(testGeoJSON)
+	assert.NoError(err)
+	assert.NoError(f.Close())
+
+	var c config.Config
+	c.GeoServer.Geofence.Source = f.Name()
+	c.GeoServer.Geofence.DwellTime = 10 * time.Minute
+	c.GeoServer.Geofence.RefreshInterval = time.Hour
+
+	tb := testBackend{}
+	ti := testIntegration{
+		events: make(chan integration.GeofenceEvent, 10),
+	}
+
+	b, err := NewBackend(&tb, &ti, c)
+	assert.NoError(err)
+	defer func() {
+		assert.NoError(b.(*Backend).Close())
+	}()
+
+	start := time.Now().UTC()
+
+	testTable := []struct {
+		Name          string
+		Location      common.Location
+		Time          time.Time
+		Expected      common.Location
+		ExpectedEvent string
+	}{
+		{
+			Name:     "outside",
+			Location: common.Location{Latitude: 51.9, Longitude: 5.005, Accuracy: 10},
+			Time:     start,
+			Expected: common.Location{Latitude: 51.9, Longitude: 5.005, Accuracy: 10},
+		},
+		{
+			Name:          "enter",
+			Location:      common.Location{Latitude: 52.005, Longitude: 5.005, Accuracy: 10},
+			Time:          start.Add(time.Minute),
+			Expected:      common.Location{Latitude: 52.005, Longitude: 5.005, Accuracy: 10},
+			ExpectedEvent: "ENTER",
+		},
+		{
+			Name:          "dwell",
+			Location:      common.Location{Latitude: 52.006, Longitude: 5.005, Accuracy: 10},
+			Time:          start.Add(11 * time.Minute),
+			Expected:      common.Location{Latitude: 52.006, Longitude: 5.005, Accuracy: 10},
+			ExpectedEvent: "DWELL",
+		},
+		{
+			Name:     "clipped",
+			Location: common.Location{Latitude: 52.0105, Longitude: 5.005, Accuracy: 100},
+			Time:     start.Add(12 * time.Minute),
+			Expected: common.Location{Latitude: 52.01, Longitude: 5.005, Accuracy: 100},
+		},
+		{
+			Name:          "exit",
+			Location:      common.Location{Latitude: 52.02, Longitude: 5.005, Accuracy: 100},
+			Time:          start.Add(13 * time.Minute),
+			Expected:      common.Location{Latitude: 52.02, Longitude: 5.005, Accuracy: 100},
+			ExpectedEvent: "EXIT",
+		},
+	}
+
+	for _, tst := range testTable {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			tb.location = tst.Location
+			ts, _ := ptypes.TimestampProto(tst.Time)
+
+			resp, err := b.ResolveTDOA(context.Background(), &geo.ResolveTDOARequest{
+				DevEui: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+				FrameRxInfo: &geo.FrameRXInfo{
+					RxInfo: []*gw.UplinkRXInfo{
+						{Time: ts},
+					},
+				},
+			})
+			assert.NoError(err)
+			assert.InDelta(tst.Expected.Latitude, resp.Result.Location.Latitude, 0.00001)
+			assert.InDelta(tst.Expected.Longitude, resp.Result.Location.Longitude, 0.00001)
+
+			if tst.ExpectedEvent != "" {
+				select {
+				case pl := <-ti.events:
+					assert.Equal(tst.ExpectedEvent, pl.Type.String())
+					assert.Equal("site", pl.GeofenceId)
+					assert.Equal("Site", pl.GeofenceName)
+				case <-time.After(time.Second):
+					t.Fatal("expected geofence event")
+				}
+			} else {
+				select {
+				case pl := <-ti.events:
+					t.Fatalf("unexpected geofence event: %s", pl.Type)
+				case <-time.After(50 * time.Millisecond):
+				}
+			}
+		})
+	}
+
+	t.Run("state timeout", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := c
+		c.GeoServer.Geofence.StateTimeout = time.Hour
+
+		bi, err := NewBackend(&tb, &ti, c)
+		assert.NoError(err)
+		b := bi.(*Backend)
+		defer func() {
+			assert.NoError(b.Close())
+		}()
+
+		resolve := func(devEUI []byte, loc common.Location) *common.Location {
+			tb.location = loc
+			resp, err := b.ResolveTDOA(context.Background(), &geo.ResolveTDOARequest{DevEui: devEUI})
+			assert.NoError(err)
+			return resp.Result.Location
+		}
+
+		resolve([]byte{1, 2, 3, 4, 5, 6, 7, 8}, common.Location{Latitude: 52.005, Longitude: 5.005, Accuracy: 10})
+		assert.Equal("ENTER", (<-ti.events).Type.String())
+
+		// the device has not been seen within the state timeout and is
+		// removed by the sweep
+		b.state.devices[lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}].seen = time.Now().Add(-2 * time.Hour)
+		b.state.lastSweep = time.Now().Add(-2 * time.Hour)
+
+		resolve([]byte{8, 7, 6, 5, 4, 3, 2, 1}, common.Location{Latitude: 51.9, Longitude: 5.005, Accuracy: 10})
+		assert.Len(b.state.devices, 1)
+
+		// as the state is unknown, the location is not clipped and no exit
+		// event is sent
+		loc := resolve([]byte{1, 2, 3, 4, 5, 6, 7, 8}, common.Location{Latitude: 52.0105, Longitude: 5.005, Accuracy: 100})
+		assert.Equal(52.0105, loc.Latitude)
+
+		select {
+		case pl := <-ti.events:
+			t.Fatalf("unexpected geofence event: %s", pl.Type)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package history
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/brocaar/chirpstack-api/go/v3/geo"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/helpers"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/logging"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/storage"
+	"github.com/brocaar/lorawan"
+)
+
+// Backend implements a backend which stores the resolved locations.
+type Backend struct {
+	backend geo.GeolocationServerServiceServer
+	db      *bolt.DB
+}
+
+// NewBackend creates a new history backend, wrapping the given backend.
+func NewBackend(b geo.GeolocationServerServiceServer, db *bolt.DB) (geo.GeolocationServerServiceServer, error) {
+	if b == nil {
+		return nil, errors.New("the given backend must not be nil")
+	}
+
+	if db == nil {
+		return nil, errors.New("the given database must not be nil")
+	}
+
+	return &Backend{
+		backend: b,
+		db:      db,
+	}, nil
+}
+
+// ResolveTDOA resolves the location based on TDOA.
+func (b *Backend) ResolveTDOA(ctx context.Context, req *geo.ResolveTDOARequest) (*geo.ResolveTDOAResponse, error) {
+	resp, err := b.backend.ResolveTDOA(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	b.storeResult(ctx, req.DevEui, []*geo.FrameRXInfo{req.FrameRxInfo}, resp.Result)
+
+	return resp, nil
+}
+
+// ResolveMultiFrameTDOA resolves the location using TDOA, based on
+// multiple frames.
+func (b *Backend) ResolveMultiFrameTDOA(ctx context.Context, req *geo.ResolveMultiFrameTDOARequest) (*geo.ResolveMultiFrameTDOAResponse, error) {
+	resp, err := b.backend.ResolveMultiFrameTDOA(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	b.storeResult(ctx, req.DevEui, req.FrameRxInfoSet, resp.Result)
+
+	return resp, nil
+}
+
+func (b *Backend) storeResult(ctx context.Context, devEUIB []byte, frames []*geo.FrameRXInfo, res *geo.ResolveResult) {
+	if res == nil || res.Location == nil {
+		return
+	}
+
+	var devEUI lorawan.EUI64
+	copy(devEUI[:], devEUIB)
+
+	loc := storage.Location{
+		DevEUI:    devEUI,
+		Time:      helpers.GetFrameTime(frames),
+		Latitude:  res.Location.Latitude,
+		Longitude: res.Location.Longitude,
+		Altitude:  res.Location.Altitude,
+		Accuracy:  res.Location.Accuracy,
+	}
+
+	if err := storage.CreateLocation(b.db, loc); err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("dev_eui", devEUI).Error("backend/history: store location error")
+	}
+}
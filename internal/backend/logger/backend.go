@@ -1,84 +1,341 @@
 package logger
 
 import (
-	"bytes"
 	"context"
-	"io/ioutil"
-	"os"
-	"path/filepath"
+	"encoding/json"
+	"fmt"
+	"sync"
 	"time"
 
-	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/upstream"
 	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/logging"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/privacy"
 	"github.com/brocaar/chirpstack-api/go/v3/geo"
 )
 
-// Backend implements a logging backend.
+// defaultQueueSize is the queue size used when no queue size is configured.
+const defaultQueueSize = 1000
+
+// Backend implements a logging backend. Records are queued and written by a
+// background worker, such that logging never blocks the API call. When the
+// queue is full, records are dropped.
 type Backend struct {
-	backend geo.GeolocationServerServiceServer
-	logDir  string
+	backend        geo.GeolocationServerServiceServer
+	backendType    string
+	sink           Sink
+	sampler        *sampler
+	privacy        *privacy.Privacy
+	upstreamBodies bool
+
+	queue       chan Record
+	queueDone   chan struct{}
+	closed      chan struct{}
+	done        chan struct{}
+	queueMu     sync.RWMutex
+	queueClosed bool
 }
 
-// NewBackend creates a new logging backend, wrapping the given backend.
+// NewBackend creates a new logging backend, wrapping the given backend. The
+// records are written to the configured sink.
 func NewBackend(b geo.GeolocationServerServiceServer, c config.Config) (geo.GeolocationServerServiceServer, error) {
+	return NewBackendWithState(b, c, NewState())
+}
+
+// NewBackendWithState creates a new logging backend, wrapping the given
+// backend and using the given State for the request log directory.
+func NewBackendWithState(b geo.GeolocationServerServiceServer, c config.Config, s *State) (geo.GeolocationServerServiceServer, error) {
+	conf := c.GeoServer.Backend.RequestLog
+
+	switch conf.Mode {
+	case "", ModeFile, ModeNDJSON:
+	default:
+		return nil, fmt.Errorf("invalid request log mode: %s", conf.Mode)
+	}
+
+	switch conf.NDJSONPeriod {
+	case "", PeriodHourly, PeriodDaily:
+	default:
+		return nil, fmt.Errorf("invalid request log ndjson period: %s", conf.NDJSONPeriod)
+	}
+
+	switch conf.Compression {
+	case "":
+		conf.Compression = CompressionNone
+	case CompressionNone, CompressionGzip, CompressionZstd:
+	default:
+		return nil, fmt.Errorf("invalid request log compression: %s", conf.Compression)
+	}
+
+	var sink Sink
+	var m *maintainer
+
+	switch conf.Sink {
+	case "", SinkFile:
+		if c.GeoServer.Backend.RequestLogDir != "" {
+			fs := fileSink{
+				dir:         c.GeoServer.Backend.RequestLogDir,
+				mode:        conf.Mode,
+				period:      conf.NDJSONPeriod,
+				maxFileSize: int64(conf.MaxFileSizeMB) * 1024 * 1024,
+				state:       s,
+			}
+			sink = &fs
+			m = &maintainer{
+				dir:          c.GeoServer.Backend.RequestLogDir,
+				state:        s,
+				compression:  conf.Compression,
+				maxAge:       conf.MaxAge,
+				maxTotalSize: int64(conf.MaxTotalSizeMB) * 1024 * 1024,
+			}
+		}
+	case SinkS3:
+		var err error
+		if sink, err = newS3Sink(c); err != nil {
+			return nil, err
+		}
+	default:
+		f, ok := registeredSink(conf.Sink)
+		if !ok {
+			return nil, fmt.Errorf("invalid request log sink: %s", conf.Sink)
+		}
+
+		var err error
+		if sink, err = f(c); err != nil {
+			return nil, errors.Wrapf(err, "create request log sink %s error", conf.Sink)
+		}
+	}
+
+	return newBackend(b, c, sink, m)
+}
+
+func newBackend(b geo.GeolocationServerServiceServer, c config.Config, sink Sink, m *maintainer) (*Backend, error) {
 	if b == nil {
 		return nil, errors.New("the given backend must not be nil")
 	}
 
-	return &Backend{
-		backend: b,
-		logDir:  c.GeoServer.Backend.RequestLogDir,
-	}, nil
+	conf := c.GeoServer.Backend.RequestLog
+
+	if conf.QueueSize < 0 {
+		return nil, fmt.Errorf("invalid request log queue size: %d", conf.QueueSize)
+	}
+	queueSize := conf.QueueSize
+	if queueSize == 0 {
+		queueSize = defaultQueueSize
+	}
+
+	s, err := newSampler(c)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := privacy.New(c)
+	if err != nil {
+		return nil, errors.Wrap(err, "request log privacy error")
+	}
+
+	// the upstream bodies use backend specific formats and can't be redacted
+	if conf.UpstreamBodies && p.Redacts() {
+		log.Warning("backend/logger: upstream bodies are not logged as pseudonymization or coordinate rounding is enabled")
+	}
+
+	backend := Backend{
+		backend:        b,
+		backendType:    c.GeoServer.Backend.Type,
+		sink:           sink,
+		sampler:        s,
+		privacy:        p,
+		upstreamBodies: conf.UpstreamBodies && !p.Redacts(),
+	}
+
+	if sink != nil {
+		backend.queue = make(chan Record, queueSize)
+		backend.queueDone = make(chan struct{})
+		go backend.writeLoop()
+	}
+
+	if m != nil {
+		backend.closed = make(chan struct{})
+		backend.done = make(chan struct{})
+		go backend.maintenanceLoop(m)
+	}
+
+	return &backend, nil
+}
+
+// Close writes the queued records, closes the sink and stops the
+// maintenance of the request log directory. Records logged after Close are
+// dropped.
+func (b *Backend) Close() error {
+	if b.sink == nil {
+		return nil
+	}
+
+	b.queueMu.Lock()
+	b.queueClosed = true
+	close(b.queue)
+	b.queueMu.Unlock()
+	<-b.queueDone
+
+	err := b.sink.Close()
+
+	if b.closed != nil {
+		close(b.closed)
+		<-b.done
+	}
+
+	return errors.Wrap(err, "close sink error")
+}
+
+func (b *Backend) enqueue(ctx context.Context, r Record) {
+	b.queueMu.RLock()
+	defer b.queueMu.RUnlock()
+
+	if b.queueClosed {
+		recordDroppedCounter(r.Method).Inc()
+		logging.FromContext(ctx).Warning("backend/logger: backend is closed, record dropped")
+		return
+	}
+
+	select {
+	case b.queue <- r:
+	default:
+		recordDroppedCounter(r.Method).Inc()
+		logging.FromContext(ctx).Warning("backend/logger: queue is full, record dropped")
+	}
+}
+
+func (b *Backend) writeLoop() {
+	defer close(b.queueDone)
+
+	for r := range b.queue {
+		if err := b.sink.Write(r); err != nil {
+			log.WithError(err).WithField("request_id", r.RequestID).Error("backend/logger: log request error")
+		}
+	}
+}
+
+func (b *Backend) maintenanceLoop(m *maintainer) {
+	defer close(b.done)
+
+	ticker := time.NewTicker(maintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.run(time.Now()); err != nil {
+			log.WithError(err).Error("backend/logger: maintain request log directory error")
+		}
+
+		select {
+		case <-b.closed:
+			return
+		case <-ticker.C:
+		}
+	}
 }
 
 // ResolveTDOA resolves the location based on TDOA.
 func (b *Backend) ResolveTDOA(ctx context.Context, req *geo.ResolveTDOARequest) (*geo.ResolveTDOAResponse, error) {
-	if err := b.logRequest("ResolveTDOA", req); err != nil {
-		log.WithError(err).Error("backend/logger: log request error")
+	if b.sink == nil || !b.sampler.sampleRequest(req.DevEui, gatewayCount(req.FrameRxInfo)) {
+		return b.backend.ResolveTDOA(ctx, req)
 	}
 
-	return b.backend.ResolveTDOA(ctx, req)
+	ctx, rec := b.newRecorder(ctx)
+	start := time.Now()
+	resp, err := b.backend.ResolveTDOA(ctx, req)
+
+	var respMsg proto.Message
+	if resp != nil {
+		respMsg = resp
+	}
+	b.logCall(ctx, "ResolveTDOA", start, req, respMsg, err, rec)
+
+	return resp, err
 }
 
 // ResolveMultiFrameTDOA resolves the location using TDOA, based on
 // multiple frames.
 func (b *Backend) ResolveMultiFrameTDOA(ctx context.Context, req *geo.ResolveMultiFrameTDOARequest) (*geo.ResolveMultiFrameTDOAResponse, error) {
-	if err := b.logRequest("ResolveMultiFrameTDOA", req); err != nil {
-		log.WithError(err).Error("backend/logger: log request error")
+	if b.sink == nil || !b.sampler.sampleRequest(req.DevEui, gatewayCount(req.FrameRxInfoSet...)) {
+		return b.backend.ResolveMultiFrameTDOA(ctx, req)
+	}
+
+	ctx, rec := b.newRecorder(ctx)
+	start := time.Now()
+	resp, err := b.backend.ResolveMultiFrameTDOA(ctx, req)
+
+	var respMsg proto.Message
+	if resp != nil {
+		respMsg = resp
 	}
+	b.logCall(ctx, "ResolveMultiFrameTDOA", start, req, respMsg, err, rec)
 
-	return b.backend.ResolveMultiFrameTDOA(ctx, req)
+	return resp, err
 }
 
-func (b *Backend) logRequest(prefix string, msg proto.Message) error {
-	if b.logDir == "" {
-		return nil
+// newRecorder returns a context recording the upstream exchanges, when
+// logging the upstream bodies is enabled.
+func (b *Backend) newRecorder(ctx context.Context) (context.Context, *upstream.Recorder) {
+	if !b.upstreamBodies {
+		return ctx, nil
 	}
+	return upstream.NewContext(ctx)
+}
 
-	// in case it already exists, this does nothing
-	if err := os.MkdirAll(filepath.Join(b.logDir, prefix), os.ModePerm); err != nil {
-		return errors.Wrap(err, "make log directory error")
+func (b *Backend) logCall(ctx context.Context, method string, start time.Time, req, resp proto.Message, callErr error, rec *upstream.Recorder) {
+	latency := time.Since(start)
+	if !b.sampler.sampleResult(callErr) {
+		return
 	}
 
-	bb := bytes.NewBuffer(nil)
-	m := jsonpb.Marshaler{
-		EnumsAsInts:  false,
-		EmitDefaults: true,
+	req = b.privacy.Apply(req)
+	if resp != nil {
+		resp = b.privacy.Apply(resp)
 	}
-	if err := m.Marshal(bb, msg); err != nil {
-		return errors.Wrap(err, "marshal json error")
+
+	r, err := NewRecord(method, b.backendType, start, latency, req, resp, callErr)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("backend/logger: log request error")
+		return
 	}
 
-	filePath := filepath.Join(b.logDir, prefix, time.Now().UTC().Format(time.RFC3339)+".request.json")
-	if err := ioutil.WriteFile(filePath, bb.Bytes(), 0644); err != nil {
-		return errors.Wrap(err, "write file error")
+	r.RequestID, _ = logging.RequestIDFromContext(ctx)
+	r.KeyID = b.privacy.KeyID()
+	if rec != nil {
+		r.Upstream = rec.Exchanges()
 	}
 
-	log.WithField("path", filePath).Info("backend/logger: log file created")
+	if r, err = b.dropFields(r); err != nil {
+		logging.FromContext(ctx).WithError(err).Error("backend/logger: log request error")
+		return
+	}
+
+	b.enqueue(ctx, r)
+}
+
+// dropFields removes the fields configured in the privacy settings from the
+// given record.
+func (b *Backend) dropFields(r Record) (Record, error) {
+	if !b.privacy.DropsFields() {
+		return r, nil
+	}
 
-	return nil
+	bb, err := json.Marshal(r)
+	if err != nil {
+		return r, errors.Wrap(err, "marshal json error")
+	}
+
+	out, err := b.privacy.DropFields(bb)
+	if err != nil {
+		return r, errors.Wrap(err, "drop fields error")
+	}
+	var redacted Record
+	if err := json.Unmarshal(out, &redacted); err != nil {
+		return r, errors.Wrap(err, "unmarshal json error")
+	}
+	return redacted, nil
 }
@@ -0,0 +1,286 @@
+package logger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/geo"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/upstream"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/logging"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/privacy"
+)
+
+type testBackend struct {
+	err error
+}
+
+func (b *testBackend) ResolveTDOA(ctx context.Context, req *geo.ResolveTDOARequest) (*geo.ResolveTDOAResponse, error) {
+	upstream.Record(ctx, upstream.Exchange{
+		URL:          "http://localhost/tdoa",
+		StatusCode:   200,
+		RequestBody:  []byte(`{"lorawan":[]}`),
+		ResponseBody: []byte(`not json`),
+	})
+
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	return &geo.ResolveTDOAResponse{
+		Result: &geo.ResolveResult{
+			Location: &common.Location{Latitude: 1.1, Longitude: 1.2, Accuracy: 10},
+		},
+	}, nil
+}
+
+func (b *testBackend) ResolveMultiFrameTDOA(ctx context.Context, req *geo.ResolveMultiFrameTDOARequest) (*geo.ResolveMultiFrameTDOAResponse, error) {
+	return nil, b.err
+}
+
+func TestBackend(t *testing.T) {
+	tests := []struct {
+		Name           string
+		Err            error
+		UpstreamBodies bool
+
+		ExpectedError    *Error
+		ExpectedResponse bool
+		ExpectedUpstream []upstream.Exchange
+	}{
+		{
+			Name:             "response",
+			ExpectedResponse: true,
+		},
+		{
+			Name:          "error",
+			Err:           status.Error(codes.Unavailable, "upstream unavailable"),
+			ExpectedError: &Error{Code: "Unavailable", Message: "upstream unavailable"},
+		},
+		{
+			Name:             "upstream bodies",
+			UpstreamBodies:   true,
+			ExpectedResponse: true,
+			ExpectedUpstream: []upstream.Exchange{
+				{
+					URL:          "http://localhost/tdoa",
+					StatusCode:   200,
+					RequestBody:  json.RawMessage(`{"lorawan":[]}`),
+					ResponseBody: json.RawMessage(`"not json"`),
+				},
+			},
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			dir, err := ioutil.TempDir("", "request-log")
+			assert.NoError(err)
+			defer os.RemoveAll(dir)
+
+			var c config.Config
+			c.GeoServer.Backend.Type = "lora_cloud"
+			c.GeoServer.Backend.RequestLogDir = dir
+			c.GeoServer.Backend.RequestLog.UpstreamBodies = tst.UpstreamBodies
+			c.GeoServer.Backend.RequestLog.Sampling.Percentage = 100
+
+			b, err := NewBackend(&testBackend{err: tst.Err}, c)
+			assert.NoError(err)
+
+			req := geo.ResolveTDOARequest{DevEui: []byte{1, 2, 3, 4, 5, 6, 7, 8}}
+			ctx := logging.NewContext(context.Background(), "req/1")
+			_, err = b.ResolveTDOA(ctx, &req)
+			assert.Equal(tst.Err, err)
+
+			// writes the queued records
+			assert.NoError(b.(*Backend).Close())
+
+			files, err := ioutil.ReadDir(filepath.Join(dir, "ResolveTDOA"))
+			assert.NoError(err)
+			assert.Len(files, 1)
+			assert.Regexp(`^\d{8}T\d{6}\.\d{9}Z\.0102030405060708\.[0-9a-f]{8}\.record\.json$`, files[0].Name())
+
+			bb, err := ioutil.ReadFile(filepath.Join(dir, "ResolveTDOA", files[0].Name()))
+			assert.NoError(err)
+
+			var r Record
+			assert.NoError(json.Unmarshal(bb, &r))
+			assert.Equal("ResolveTDOA", r.Method)
+			assert.Equal("req/1", r.RequestID)
+			assert.Equal("0102030405060708", r.DevEUI)
+			assert.Equal("lora_cloud", r.Backend)
+			assert.True(r.LatencyMS >= 0)
+			assert.Equal(tst.ExpectedError, r.Error)
+			assert.Equal(tst.ExpectedResponse, len(r.Response) != 0)
+			assert.Equal(tst.ExpectedUpstream, r.Upstream)
+		})
+	}
+}
+
+func TestBackendNDJSON(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "request-log")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	var c config.Config
+	c.GeoServer.Backend.RequestLogDir = dir
+	c.GeoServer.Backend.RequestLog.Mode = ModeNDJSON
+	c.GeoServer.Backend.RequestLog.NDJSONPeriod = PeriodDaily
+	c.GeoServer.Backend.RequestLog.Sampling.Percentage = 100
+
+	b, err := NewBackend(&testBackend{}, c)
+	assert.NoError(err)
+
+	for i := 0; i < 3; i++ {
+		_, err = b.ResolveTDOA(context.Background(), &geo.ResolveTDOARequest{DevEui: []byte{1, 2, 3, 4, 5, 6, 7, byte(i)}})
+		assert.NoError(err)
+	}
+	assert.NoError(b.(*Backend).Close())
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, "ResolveTDOA"))
+	assert.NoError(err)
+	assert.Len(files, 1)
+	assert.Regexp(`^\d{8}\.0000\.ndjson$`, files[0].Name())
+
+	var devEUIs [][]byte
+	assert.NoError(WalkDir(filepath.Join(dir, "ResolveTDOA"), func(e Entry) error {
+		var req geo.ResolveTDOARequest
+		assert.NoError(e.UnmarshalRequest(&req))
+		assert.Equal("ResolveTDOA", e.Method)
+		devEUIs = append(devEUIs, req.DevEui)
+		return nil
+	}))
+	assert.Equal([][]byte{{1, 2, 3, 4, 5, 6, 7, 0}, {1, 2, 3, 4, 5, 6, 7, 1}, {1, 2, 3, 4, 5, 6, 7, 2}}, devEUIs)
+
+	c.GeoServer.Backend.RequestLog.Mode = "csv"
+	_, err = NewBackend(&testBackend{}, c)
+	assert.EqualError(err, "invalid request log mode: csv")
+}
+
+func TestBackendPrivacy(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "request-log")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	var c config.Config
+	c.GeoServer.Backend.RequestLogDir = dir
+	c.GeoServer.Backend.RequestLog.UpstreamBodies = true
+	c.GeoServer.Backend.RequestLog.Sampling.Percentage = 100
+	c.GeoServer.Backend.RequestLog.Privacy.HMACKey = "secret"
+	c.GeoServer.Backend.RequestLog.Privacy.CoordinateDecimals = 3
+	c.GeoServer.Backend.RequestLog.Privacy.DropFields = []string{"request_id"}
+
+	p, err := privacy.New(c)
+	assert.NoError(err)
+
+	b, err := NewBackend(&testBackend{}, c)
+	assert.NoError(err)
+
+	req := geo.ResolveTDOARequest{DevEui: []byte{1, 2, 3, 4, 5, 6, 7, 8}}
+	ctx := logging.NewContext(context.Background(), "req/1")
+	_, err = b.ResolveTDOA(ctx, &req)
+	assert.NoError(err)
+	assert.NoError(b.(*Backend).Close())
+
+	devEUI := hex.EncodeToString(p.DevEUI(req.DevEui))
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, "ResolveTDOA"))
+	assert.NoError(err)
+	assert.Len(files, 1)
+	assert.Contains(files[0].Name(), "."+devEUI+".")
+
+	bb, err := ioutil.ReadFile(filepath.Join(dir, "ResolveTDOA", files[0].Name()))
+	assert.NoError(err)
+
+	var r Record
+	assert.NoError(json.Unmarshal(bb, &r))
+	assert.Equal(devEUI, r.DevEUI)
+	assert.Equal(p.KeyID(), r.KeyID)
+	assert.Equal("", r.RequestID)
+	assert.Nil(r.Upstream)
+
+	var resp geo.ResolveTDOAResponse
+	assert.NoError(jsonpb.UnmarshalString(string(r.Response), &resp))
+	assert.Equal(1.1, resp.Result.Location.Latitude)
+
+	assert.NoError(WalkDir(filepath.Join(dir, "ResolveTDOA"), func(e Entry) error {
+		var req geo.ResolveTDOARequest
+		assert.NoError(e.UnmarshalRequest(&req))
+		assert.Equal(p.DevEUI([]byte{1, 2, 3, 4, 5, 6, 7, 8}), req.DevEui)
+		assert.Equal(p.KeyID(), e.KeyID)
+		return nil
+	}))
+}
+
+func TestWalkDir(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "request-log")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		// request file, as written by older versions
+		"2020-01-01T00:00:00Z.request.json": `{"devEUI": "AQIDBAUGBwg="}`,
+		// record file
+		"20200101T000001.000000000Z.0807060504030201.01020304.record.json": `{"method": "ResolveTDOA", "request": {"devEUI": "CAcGBQQDAgE="}}`,
+		// NDJSON file, with a partially written last line
+		"20200101T01.ndjson": `{"method": "ResolveTDOA", "request": {"devEUI": "AQEBAQEBAQE="}}` + "\n\n" + `{"method": "ResolveMultiFrameTDOA", "request": {"devEUI": "AgICAgICAgI="}}` + "\n" + `{"method": "Reso`,
+		// compressed record file
+		"20200101T000002.000000000Z.0807060504030202.01020304.record.json.gz": gzipString(`{"method": "ResolveTDOA", "request": {"devEUI": "CAcGBQQDAgI="}}`),
+		// output of the replay tool
+		"2020-01-01T00:00:00Z.lora_cloud.response.json": `{}`,
+	}
+	for name, content := range files {
+		assert.NoError(ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	type entry struct {
+		ID     string
+		Method string
+		DevEUI []byte
+	}
+	var entries []entry
+
+	assert.NoError(WalkDir(dir, func(e Entry) error {
+		var req geo.ResolveTDOARequest
+		assert.NoError(e.UnmarshalRequest(&req))
+		entries = append(entries, entry{ID: e.ID, Method: e.Method, DevEUI: req.DevEui})
+		return nil
+	}))
+
+	assert.Equal([]entry{
+		{ID: "2020-01-01T00:00:00Z", DevEUI: []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+		{ID: "20200101T000001.000000000Z.0807060504030201.01020304", Method: "ResolveTDOA", DevEUI: []byte{8, 7, 6, 5, 4, 3, 2, 1}},
+		{ID: "20200101T000002.000000000Z.0807060504030202.01020304", Method: "ResolveTDOA", DevEUI: []byte{8, 7, 6, 5, 4, 3, 2, 2}},
+		{ID: "20200101T01.1", Method: "ResolveTDOA", DevEUI: []byte{1, 1, 1, 1, 1, 1, 1, 1}},
+		{ID: "20200101T01.3", Method: "ResolveMultiFrameTDOA", DevEUI: []byte{2, 2, 2, 2, 2, 2, 2, 2}},
+	}, entries)
+}
+
+func gzipString(s string) string {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(s))
+	w.Close()
+	return buf.String()
+}
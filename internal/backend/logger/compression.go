@@ -0,0 +1,178 @@
+package logger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// Compression types.
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// Compressed file suffixes.
+const (
+	gzipSuffix = ".gz"
+	zstdSuffix = ".zst"
+)
+
+// compressionSuffix returns the file suffix for the given compression.
+func compressionSuffix(compression string) string {
+	switch compression {
+	case CompressionGzip:
+		return gzipSuffix
+	case CompressionZstd:
+		return zstdSuffix
+	default:
+		return ""
+	}
+}
+
+// trimCompressionSuffix returns the file name without compression suffix
+// and true when the file is compressed.
+func trimCompressionSuffix(name string) (string, bool) {
+	for _, suffix := range []string{gzipSuffix, zstdSuffix} {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix), true
+		}
+	}
+	return name, false
+}
+
+// compressFile compresses the given file and removes the original file. It
+// returns the path of the compressed file.
+func compressFile(filePath, compression string) (string, error) {
+	outPath := filePath + compressionSuffix(compression)
+	tmpPath := outPath + ".tmp"
+
+	if err := compressToFile(filePath, tmpPath, compression); err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+
+	if err := os.Rename(tmpPath, outPath); err != nil {
+		os.Remove(tmpPath)
+		return "", errors.Wrap(err, "rename file error")
+	}
+
+	if err := os.Remove(filePath); err != nil {
+		return "", errors.Wrap(err, "remove file error")
+	}
+
+	return outPath, nil
+}
+
+func compressToFile(inPath, outPath, compression string) error {
+	in, err := os.Open(inPath)
+	if err != nil {
+		return errors.Wrap(err, "open file error")
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(outPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.Wrap(err, "create file error")
+	}
+	defer out.Close()
+
+	w, err := newCompressWriter(out, compression)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, in); err != nil {
+		w.Close()
+		return errors.Wrap(err, "compress error")
+	}
+
+	if err := w.Close(); err != nil {
+		return errors.Wrap(err, "compress error")
+	}
+
+	return errors.Wrap(out.Close(), "close file error")
+}
+
+// compressBytes returns the compressed b. When compression is none, b is
+// returned as-is.
+func compressBytes(b []byte, compression string) ([]byte, error) {
+	if compression == "" || compression == CompressionNone {
+		return b, nil
+	}
+
+	var buf bytes.Buffer
+	w, err := newCompressWriter(&buf, compression)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(b); err != nil {
+		w.Close()
+		return nil, errors.Wrap(err, "compress error")
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, errors.Wrap(err, "compress error")
+	}
+
+	return buf.Bytes(), nil
+}
+
+func newCompressWriter(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, errors.Wrap(err, "new zstd writer error")
+		}
+		return zw, nil
+	default:
+		return nil, errors.Errorf("unknown compression: %s", compression)
+	}
+}
+
+// openFile opens the given (optionally compressed) file.
+func openFile(filePath string) (io.ReadCloser, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "open file error")
+	}
+
+	switch {
+	case strings.HasSuffix(filePath, gzipSuffix):
+		r, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, errors.Wrap(err, "new gzip reader error")
+		}
+		return &readCloser{Reader: r, close: func() { r.Close(); f.Close() }}, nil
+	case strings.HasSuffix(filePath, zstdSuffix):
+		r, err := zstd.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, errors.Wrap(err, "new zstd reader error")
+		}
+		return &readCloser{Reader: r, close: func() { r.Close(); f.Close() }}, nil
+	default:
+		return f, nil
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	close func()
+}
+
+func (r *readCloser) Close() error {
+	r.close()
+	return nil
+}
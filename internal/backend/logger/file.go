@@ -0,0 +1,307 @@
+package logger
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Request log modes.
+const (
+	// ModeFile writes each record to a separate file.
+	ModeFile = "file"
+
+	// ModeNDJSON appends the records to hourly or daily NDJSON files.
+	ModeNDJSON = "ndjson"
+)
+
+// NDJSON periods.
+const (
+	PeriodHourly = "hourly"
+	PeriodDaily  = "daily"
+)
+
+// Period time formats, used within the NDJSON file names.
+const (
+	hourlyTimeFormat = "20060102T15"
+	dailyTimeFormat  = "20060102"
+)
+
+// fileTimeFormat is the time format used within file names. Unlike RFC3339,
+// it does not contain colons as these are not allowed on some filesystems.
+const fileTimeFormat = "20060102T150405.000000000Z"
+
+// State holds the request log files which are open for writing. A State
+// can be shared by the backends of successive backend chains (e.g. on a
+// reload), such that the files which the previous backend is still writing
+// to are not compressed or removed by the maintenance of the new backend,
+// and such that both backends append to the same NDJSON part.
+type State struct {
+	// mu serializes the NDJSON appends and guards the open files
+	mu      sync.Mutex
+	parts   map[string]*ndjsonPart
+	writing map[string]struct{}
+
+	// maintenanceMu serializes the maintenance of the request log directory
+	maintenanceMu sync.Mutex
+}
+
+// NewState creates a new (empty) State.
+func NewState() *State {
+	return &State{
+		parts:   make(map[string]*ndjsonPart),
+		writing: make(map[string]struct{}),
+	}
+}
+
+// fileSink writes the records to the log directory, using a directory per
+// method. It keeps track of the files it has open in its State, as only
+// closed files may be compressed or removed by the maintainer.
+type fileSink struct {
+	dir         string
+	mode        string
+	period      string
+	maxFileSize int64
+	state       *State
+}
+
+// ndjsonPart holds the NDJSON file currently written to, for a single
+// method directory and period.
+type ndjsonPart struct {
+	path string
+	size int64
+}
+
+// Write writes the given record.
+func (w *fileSink) Write(r Record) error {
+	filePath, err := w.write(r)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"request_id": r.RequestID,
+		"path":       filePath,
+	}).Debug("backend/logger: request logged")
+	return nil
+}
+
+// Close implements the Sink interface. As records are written directly,
+// there is nothing to flush.
+func (w *fileSink) Close() error {
+	return nil
+}
+
+// write writes the given record and returns the path of the file it was
+// written to.
+func (w *fileSink) write(r Record) (string, error) {
+	dir := filepath.Join(w.dir, r.Method)
+
+	// in case it already exists, this does nothing
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", errors.Wrap(err, "make log directory error")
+	}
+
+	bb, err := json.Marshal(r)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal json error")
+	}
+
+	if w.mode == ModeNDJSON {
+		return w.appendNDJSON(dir, ndjsonPeriod(r.Time, w.period), append(bb, '\n'))
+	}
+
+	filePath := filepath.Join(dir, recordFileName(r))
+
+	w.state.setWriting(filePath, true)
+	defer w.state.setWriting(filePath, false)
+
+	// O_EXCL guarantees that an existing record is never overwritten
+	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", errors.Wrap(err, "create file error")
+	}
+
+	if _, err := f.Write(bb); err != nil {
+		f.Close()
+		return "", errors.Wrap(err, "write file error")
+	}
+
+	return filePath, errors.Wrap(f.Close(), "close file error")
+}
+
+func (s *State) setWriting(filePath string, writing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if writing {
+		s.writing[filePath] = struct{}{}
+	} else {
+		delete(s.writing, filePath)
+	}
+}
+
+// isOpen returns true when the given file is open, i.e. records are (or
+// might be) written to it.
+func (s *State) isOpen(filePath string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.writing[filePath]; ok {
+		return true
+	}
+
+	for _, p := range s.parts {
+		if p.path == filePath {
+			return true
+		}
+	}
+
+	return false
+}
+
+// closeParts closes the NDJSON parts of the periods which ended more than
+// closeGrace ago. Records of these periods which are written afterwards
+// (e.g. as they were still queued) are written to a new part.
+func (s *State) closeParts(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.parts {
+		if end, ok := ndjsonPeriodEnd(filepath.Base(key)); ok && now.Sub(end) > closeGrace {
+			delete(s.parts, key)
+		}
+	}
+}
+
+// appendNDJSON appends b to the current NDJSON part of the given directory
+// and period. A new part is started when the file would exceed the max.
+// file size. Closed parts are never re-opened.
+func (w *fileSink) appendNDJSON(dir, period string, b []byte) (string, error) {
+	w.state.mu.Lock()
+	defer w.state.mu.Unlock()
+
+	key := filepath.Join(dir, period)
+	p, ok := w.state.parts[key]
+	if !ok || (w.maxFileSize > 0 && p.size > 0 && p.size+int64(len(b)) > w.maxFileSize) {
+		part, err := nextNDJSONPart(dir, period)
+		if err != nil {
+			return "", err
+		}
+
+		p = &ndjsonPart{path: filepath.Join(dir, ndjsonFileName(period, part))}
+		w.state.parts[key] = p
+	}
+
+	if err := appendFile(p.path, b); err != nil {
+		return "", err
+	}
+	p.size += int64(len(b))
+
+	return p.path, nil
+}
+
+// nextNDJSONPart returns the part number following the last (compressed or
+// uncompressed) NDJSON part of the given directory and period.
+func nextNDJSONPart(dir, period string) (int, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return 0, errors.Wrap(err, "read directory error")
+	}
+
+	var next int
+	for _, f := range files {
+		name, _ := trimCompressionSuffix(f.Name())
+		filePeriod, part, ok := parseNDJSONFileName(name)
+		if ok && filePeriod == period && part >= next {
+			next = part + 1
+		}
+	}
+
+	return next, nil
+}
+
+// recordFileName returns an unique file name for the given record. It
+// contains the time (with nanosecond precision), the DevEUI and a random
+// suffix.
+func recordFileName(r Record) string {
+	var suffix [4]byte
+	rand.Read(suffix[:])
+
+	name := r.Time.UTC().Format(fileTimeFormat)
+	if r.DevEUI != "" {
+		name += "." + r.DevEUI
+	}
+
+	return name + "." + hex.EncodeToString(suffix[:]) + RecordFileSuffix
+}
+
+// ndjsonPeriod returns the NDJSON period of the given time.
+func ndjsonPeriod(t time.Time, period string) string {
+	if period == PeriodDaily {
+		return t.UTC().Format(dailyTimeFormat)
+	}
+	return t.UTC().Format(hourlyTimeFormat)
+}
+
+// ndjsonPeriodEnd returns the end time of the given NDJSON period.
+func ndjsonPeriodEnd(period string) (time.Time, bool) {
+	if t, err := time.Parse(hourlyTimeFormat, period); err == nil {
+		return t.Add(time.Hour), true
+	}
+	if t, err := time.Parse(dailyTimeFormat, period); err == nil {
+		return t.AddDate(0, 0, 1), true
+	}
+	return time.Time{}, false
+}
+
+// ndjsonFileName returns the NDJSON file name for the given period and
+// part. The part is zero-padded, such that the files sort in write order.
+func ndjsonFileName(period string, part int) string {
+	return fmt.Sprintf("%s.%04d%s", period, part, NDJSONFileSuffix)
+}
+
+// parseNDJSONFileName returns the period and part of the given NDJSON file
+// name.
+func parseNDJSONFileName(name string) (string, int, bool) {
+	if !strings.HasSuffix(name, NDJSONFileSuffix) {
+		return "", 0, false
+	}
+
+	parts := strings.Split(strings.TrimSuffix(name, NDJSONFileSuffix), ".")
+	if len(parts) != 2 {
+		return "", 0, false
+	}
+
+	part, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return "", 0, false
+	}
+
+	return parts[0], part, true
+}
+
+func appendFile(filePath string, b []byte) error {
+	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrap(err, "open file error")
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return errors.Wrap(err, "write file error")
+	}
+
+	return errors.Wrap(f.Close(), "close file error")
+}
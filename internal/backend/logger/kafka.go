@@ -0,0 +1,151 @@
+package logger
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Kafka sink defaults, used when not configured.
+const (
+	defaultKafkaBatchSize     = 100
+	defaultKafkaBatchInterval = time.Second
+)
+
+// Message defines a message published to a Kafka-style topic.
+type Message struct {
+	Key   []byte
+	Value []byte
+}
+
+// Producer defines the interface of a Kafka-style producer, publishing
+// messages to a partitioned topic. Messages with the same key must be
+// published to the same partition.
+type Producer interface {
+	// Produce publishes the given batch of messages, in order. Retrying
+	// failed messages is left to the producer.
+	Produce(topic string, messages []Message) error
+
+	// Close flushes the pending messages and closes the producer.
+	Close() error
+}
+
+// KafkaSink publishes each record as JSON message to a Kafka-style topic.
+// Messages are keyed by DevEUI, such that the records of a single device
+// are kept in order. The messages are published in batches of batch size
+// messages, or after the batch interval. The sink can be selected using
+// RegisterSink.
+type KafkaSink struct {
+	producer      Producer
+	topic         string
+	batchSize     int
+	batchInterval time.Duration
+
+	mu    sync.Mutex
+	batch []Message
+
+	// flushMu keeps the batches in order when published concurrently by
+	// Write and the flush loop
+	flushMu sync.Mutex
+
+	closed chan struct{}
+	done   chan struct{}
+}
+
+// NewKafkaSink creates a new KafkaSink, publishing to the given topic. When
+// the batch size or interval is 0, the default is used.
+func NewKafkaSink(p Producer, topic string, batchSize int, batchInterval time.Duration) *KafkaSink {
+	s := KafkaSink{
+		producer:      p,
+		topic:         topic,
+		batchSize:     batchSize,
+		batchInterval: batchInterval,
+		closed:        make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	if s.batchSize == 0 {
+		s.batchSize = defaultKafkaBatchSize
+	}
+	if s.batchInterval == 0 {
+		s.batchInterval = defaultKafkaBatchInterval
+	}
+
+	go s.flushLoop()
+
+	return &s
+}
+
+// Write adds the given record to the batch. The batch is published when it
+// contains batch size messages.
+func (s *KafkaSink) Write(r Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "marshal json error")
+	}
+
+	s.mu.Lock()
+	s.batch = append(s.batch, Message{Key: []byte(r.DevEUI), Value: b})
+	full := len(s.batch) >= s.batchSize
+	s.mu.Unlock()
+
+	if !full {
+		return nil
+	}
+
+	return s.flush()
+}
+
+// Close publishes the pending batch and closes the producer.
+func (s *KafkaSink) Close() error {
+	close(s.closed)
+	<-s.done
+
+	err := s.flush()
+	if cerr := s.producer.Close(); cerr != nil && err == nil {
+		err = errors.Wrap(cerr, "close producer error")
+	}
+	return err
+}
+
+func (s *KafkaSink) flushLoop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.batchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-ticker.C:
+			if err := s.flush(); err != nil {
+				log.WithError(err).Error("backend/logger: publish request log batch error")
+			}
+		}
+	}
+}
+
+// flush publishes the pending batch. On error, the batch is dropped.
+func (s *KafkaSink) flush() error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	batch := s.batch
+	s.batch = nil
+	s.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if err := s.producer.Produce(s.topic, batch); err != nil {
+		return errors.Wrap(err, "produce messages error")
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// maintenanceInterval defines the interval in which the request log
+// directory is maintained.
+const maintenanceInterval = time.Minute
+
+// closeGrace is the time after the end of a period, after which the NDJSON
+// part of this period is closed. This way the records of calls which
+// started within the period (and ended after) are still written to it.
+const closeGrace = time.Minute
+
+// maintainer compresses the closed request log files and removes the files
+// exceeding the retention limits. Files are closed when they are not open
+// according to the State (if any) of the sinks writing to the directory.
+type maintainer struct {
+	dir          string
+	state        *State
+	compression  string
+	maxAge       time.Duration
+	maxTotalSize int64
+}
+
+type logFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+	closed  bool
+}
+
+// run maintains the request log directory once.
+func (m *maintainer) run(now time.Time) error {
+	if m.state != nil {
+		m.state.maintenanceMu.Lock()
+		defer m.state.maintenanceMu.Unlock()
+
+		m.state.closeParts(now)
+	}
+
+	files, err := m.listFiles()
+	if err != nil {
+		return err
+	}
+
+	if m.compression != "" && m.compression != CompressionNone {
+		for i, f := range files {
+			if !f.closed {
+				continue
+			}
+			if _, compressed := trimCompressionSuffix(f.path); compressed {
+				continue
+			}
+
+			outPath, err := compressFile(f.path, m.compression)
+			if err != nil {
+				log.WithError(err).WithField("path", f.path).Error("backend/logger: compress file error")
+				continue
+			}
+			fileCompressedCounter().Inc()
+
+			if fi, err := os.Stat(outPath); err == nil {
+				files[i].path = outPath
+				files[i].size = fi.Size()
+			}
+		}
+	}
+
+	// oldest first
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	var totalSize int64
+	for _, f := range files {
+		totalSize += f.size
+	}
+
+	for _, f := range files {
+		var reason string
+		switch {
+		case !f.closed:
+			continue
+		case m.maxAge != 0 && now.Sub(f.modTime) > m.maxAge:
+			reason = "max_age"
+		case m.maxTotalSize != 0 && totalSize > m.maxTotalSize:
+			reason = "max_total_size"
+		default:
+			continue
+		}
+
+		if err := os.Remove(f.path); err != nil {
+			log.WithError(err).WithField("path", f.path).Error("backend/logger: remove file error")
+			continue
+		}
+
+		totalSize -= f.size
+		fileRemovedCounter(reason).Inc()
+		log.WithFields(log.Fields{
+			"path":   f.path,
+			"reason": reason,
+		}).Info("backend/logger: request log file removed")
+	}
+
+	directorySizeGauge().Set(float64(totalSize))
+
+	return nil
+}
+
+// listFiles returns the request log files.
+func (m *maintainer) listFiles() ([]logFile, error) {
+	var out []logFile
+
+	err := filepath.Walk(m.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// the file might have been removed in the meantime
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		name, _ := trimCompressionSuffix(info.Name())
+		if !strings.HasSuffix(name, RecordFileSuffix) && !strings.HasSuffix(name, RequestFileSuffix) && !strings.HasSuffix(name, NDJSONFileSuffix) {
+			return nil
+		}
+
+		out = append(out, logFile{
+			path:    path,
+			size:    info.Size(),
+			modTime: info.ModTime(),
+			closed:  m.state == nil || !m.state.isOpen(path),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "walk directory error")
+	}
+
+	return out, nil
+}
@@ -0,0 +1,241 @@
+package logger
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNDJSONRotation(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "request-log")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2020, 1, 1, 10, 30, 0, 0, time.UTC)
+	r := Record{Method: "ResolveTDOA", Time: now, Request: []byte(`{"devEUI":"AQIDBAUGBwg="}`)}
+	b, err := json.Marshal(r)
+	assert.NoError(err)
+
+	// two records per file
+	w := fileSink{
+		dir:         dir,
+		mode:        ModeNDJSON,
+		period:      PeriodHourly,
+		maxFileSize: int64(2*(len(b)+1) + 1),
+		state:       NewState(),
+	}
+
+	for i := 0; i < 4; i++ {
+		_, err := w.write(r)
+		assert.NoError(err)
+	}
+
+	assert.Equal([]string{"20200101T10.0000.ndjson", "20200101T10.0001.ndjson"}, listDir(t, filepath.Join(dir, "ResolveTDOA")))
+
+	// only the current part is open
+	assert.False(w.state.isOpen(filepath.Join(dir, "ResolveTDOA", "20200101T10.0000.ndjson")))
+	assert.True(w.state.isOpen(filepath.Join(dir, "ResolveTDOA", "20200101T10.0001.ndjson")))
+
+	// the part is closed after the end of the period, queued records of this
+	// period are written to a new part
+	w.state.closeParts(now.Add(time.Hour))
+	assert.False(w.state.isOpen(filepath.Join(dir, "ResolveTDOA", "20200101T10.0001.ndjson")))
+
+	_, err = compressFile(filepath.Join(dir, "ResolveTDOA", "20200101T10.0001.ndjson"), CompressionGzip)
+	assert.NoError(err)
+
+	_, err = w.write(Record{Method: "ResolveTDOA", Time: now, Request: []byte(`{}`)})
+	assert.NoError(err)
+
+	// existing parts are never re-opened, also not after a restart
+	w = fileSink{dir: dir, mode: ModeNDJSON, period: PeriodHourly, state: NewState()}
+	_, err = w.write(Record{Method: "ResolveTDOA", Time: now, Request: []byte(`{}`)})
+	assert.NoError(err)
+
+	assert.Equal([]string{"20200101T10.0000.ndjson", "20200101T10.0001.ndjson.gz", "20200101T10.0002.ndjson", "20200101T10.0003.ndjson"}, listDir(t, filepath.Join(dir, "ResolveTDOA")))
+
+	var count int
+	assert.NoError(WalkDir(filepath.Join(dir, "ResolveTDOA"), func(e Entry) error {
+		count++
+		return nil
+	}))
+	assert.Equal(6, count)
+}
+
+func TestSharedState(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "request-log")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	// the sinks of the previous and the new backend (e.g. on a reload)
+	// write concurrently, while the directory is maintained
+	s := NewState()
+	sinks := []*fileSink{
+		{dir: dir, mode: ModeNDJSON, period: PeriodHourly, state: s},
+		{dir: dir, mode: ModeNDJSON, period: PeriodHourly, state: s},
+	}
+	m := maintainer{dir: dir, state: s, compression: CompressionGzip}
+
+	now := time.Now()
+	var wg sync.WaitGroup
+	for _, w := range sinks {
+		wg.Add(1)
+		go func(w *fileSink) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				_, err := w.write(Record{Method: "ResolveTDOA", Time: now, Request: []byte(`{}`)})
+				assert.NoError(err)
+			}
+		}(w)
+	}
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(m.run(now))
+	}
+	wg.Wait()
+	assert.NoError(m.run(now))
+
+	// the open part is not compressed
+	assert.Equal([]string{ndjsonFileName(ndjsonPeriod(now, PeriodHourly), 0)}, listDir(t, filepath.Join(dir, "ResolveTDOA")))
+
+	var count int
+	assert.NoError(WalkDir(filepath.Join(dir, "ResolveTDOA"), func(e Entry) error {
+		count++
+		return nil
+	}))
+	assert.Equal(200, count)
+}
+
+func TestMaintainer(t *testing.T) {
+	now := time.Date(2020, 1, 1, 10, 30, 0, 0, time.UTC)
+
+	files := map[string]time.Time{
+		// closed
+		"20200101T08.0000.ndjson": now.Add(-2 * time.Hour),
+		"20200101T09.0000.ndjson": now.Add(-30 * time.Minute),
+		"20200101T10.0000.ndjson": now.Add(-10 * time.Minute),
+		// current part
+		"20200101T10.0001.ndjson": now,
+		// closed record file
+		"20200101T102000.000000000Z.0102030405060708.01020304.record.json": now.Add(-10 * time.Minute),
+		// record file which is being written
+		"20200101T103000.000000000Z.0102030405060708.01020304.record.json": now,
+		// not a request log file
+		"report.csv": now.Add(-24 * time.Hour),
+	}
+
+	setup := func(t *testing.T) string {
+		dir, err := ioutil.TempDir("", "request-log")
+		require.NoError(t, err)
+
+		for name, modTime := range files {
+			p := filepath.Join(dir, name)
+			require.NoError(t, ioutil.WriteFile(p, []byte(strings.Repeat("a", 100)), 0644))
+			require.NoError(t, os.Chtimes(p, modTime, modTime))
+		}
+		return dir
+	}
+
+	// state returns the state of the sink writing to the current part and
+	// record file
+	state := func(dir string) *State {
+		s := NewState()
+		s.parts[filepath.Join(dir, "20200101T10")] = &ndjsonPart{path: filepath.Join(dir, "20200101T10.0001.ndjson")}
+		s.writing[filepath.Join(dir, "20200101T103000.000000000Z.0102030405060708.01020304.record.json")] = struct{}{}
+		return s
+	}
+
+	t.Run("compression", func(t *testing.T) {
+		for _, compression := range []string{CompressionGzip, CompressionZstd} {
+			t.Run(compression, func(t *testing.T) {
+				assert := require.New(t)
+
+				dir := setup(t)
+				defer os.RemoveAll(dir)
+
+				m := maintainer{dir: dir, state: state(dir), compression: compression}
+				assert.NoError(m.run(now))
+
+				suffix := compressionSuffix(compression)
+				assert.Equal([]string{
+					"20200101T08.0000.ndjson" + suffix,
+					"20200101T09.0000.ndjson" + suffix,
+					"20200101T10.0000.ndjson" + suffix,
+					"20200101T10.0001.ndjson",
+					"20200101T102000.000000000Z.0102030405060708.01020304.record.json" + suffix,
+					"20200101T103000.000000000Z.0102030405060708.01020304.record.json",
+					"report.csv",
+				}, listDir(t, dir))
+
+				b, err := readFile(filepath.Join(dir, "20200101T08.0000.ndjson"+suffix))
+				assert.NoError(err)
+				assert.Equal(strings.Repeat("a", 100), string(b))
+			})
+		}
+	})
+
+	t.Run("max age", func(t *testing.T) {
+		assert := require.New(t)
+
+		dir := setup(t)
+		defer os.RemoveAll(dir)
+
+		m := maintainer{dir: dir, state: state(dir), maxAge: time.Hour}
+		assert.NoError(m.run(now))
+
+		assert.Equal([]string{
+			"20200101T09.0000.ndjson",
+			"20200101T10.0000.ndjson",
+			"20200101T10.0001.ndjson",
+			"20200101T102000.000000000Z.0102030405060708.01020304.record.json",
+			"20200101T103000.000000000Z.0102030405060708.01020304.record.json",
+			"report.csv",
+		}, listDir(t, dir))
+		assert.Equal(500.0, testutil.ToFloat64(directorySizeGauge()))
+	})
+
+	t.Run("max total size", func(t *testing.T) {
+		assert := require.New(t)
+
+		dir := setup(t)
+		defer os.RemoveAll(dir)
+
+		// the oldest closed files are removed first, open files are never
+		// removed
+		m := maintainer{dir: dir, state: state(dir), maxTotalSize: 300}
+		assert.NoError(m.run(now))
+
+		assert.Equal([]string{
+			"20200101T10.0001.ndjson",
+			"20200101T102000.000000000Z.0102030405060708.01020304.record.json",
+			"20200101T103000.000000000Z.0102030405060708.01020304.record.json",
+			"report.csv",
+		}, listDir(t, dir))
+		assert.Equal(300.0, testutil.ToFloat64(directorySizeGauge()))
+	})
+}
+
+func listDir(t *testing.T, dir string) []string {
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+
+	var out []string
+	for _, f := range files {
+		out = append(out, f.Name())
+	}
+	sort.Strings(out)
+	return out
+}
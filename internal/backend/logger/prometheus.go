@@ -0,0 +1,53 @@
+package logger
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ds = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "backend_request_log_directory_size_bytes",
+		Help: "The total size of the request log files (in bytes).",
+	})
+
+	fc = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "backend_request_log_file_compressed_count",
+		Help: "The number of compressed request log files.",
+	})
+
+	fr = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_request_log_file_removed_count",
+		Help: "The number of removed request log files (per reason).",
+	}, []string{"reason"})
+
+	rd = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_request_log_record_dropped_count",
+		Help: "The number of records dropped because the queue was full (per method).",
+	}, []string{"method"})
+
+	ou = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_request_log_object_upload_count",
+		Help: "The number of request log object uploads (per status).",
+	}, []string{"status"})
+)
+
+func directorySizeGauge() prometheus.Gauge {
+	return ds
+}
+
+func fileCompressedCounter() prometheus.Counter {
+	return fc
+}
+
+func fileRemovedCounter(reason string) prometheus.Counter {
+	return fr.With(prometheus.Labels{"reason": reason})
+}
+
+func recordDroppedCounter(method string) prometheus.Counter {
+	return rd.With(prometheus.Labels{"method": method})
+}
+
+func uploadCounter(status string) prometheus.Counter {
+	return ou.With(prometheus.Labels{"status": status})
+}
@@ -0,0 +1,156 @@
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxLineSize is the max. size of a single NDJSON line.
+const maxLineSize = 64 * 1024 * 1024
+
+// Entry holds a logged request, read from a request log directory.
+type Entry struct {
+	// ID identifies the entry within the directory. For request and record
+	// files, this is the file name without suffix. For NDJSON files, this is
+	// the file name without suffix, followed by the line number.
+	ID string
+
+	// Method holds the logged method. It is empty for request files.
+	Method string
+
+	// KeyID identifies the HMAC key with which the DevEUI and gateway IDs
+	// have been pseudonymized. It is empty when these are not pseudonymized.
+	KeyID string
+
+	request json.RawMessage
+}
+
+// UnmarshalRequest unmarshals the logged request into msg.
+func (e Entry) UnmarshalRequest(msg proto.Message) error {
+	m := jsonpb.Unmarshaler{
+		AllowUnknownFields: true,
+	}
+	if err := m.Unmarshal(bytes.NewReader(e.request), msg); err != nil {
+		return errors.Wrap(err, "unmarshal error")
+	}
+	return nil
+}
+
+// WalkDir calls fn for each logged request within the given directory, in
+// file name order. It reads request, record and NDJSON files, which are
+// optionally gzip or zstd compressed. Invalid NDJSON lines (e.g. a partially
+// written last line) are skipped.
+func WalkDir(dir string, fn func(Entry) error) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return errors.Wrap(err, "read directory error")
+	}
+
+	for _, f := range files {
+		filePath := filepath.Join(dir, f.Name())
+		name, _ := trimCompressionSuffix(f.Name())
+
+		switch {
+		case strings.HasSuffix(name, RecordFileSuffix), strings.HasSuffix(name, RequestFileSuffix):
+			b, err := readFile(filePath)
+			if err != nil {
+				return err
+			}
+
+			e, err := parseEntry(b)
+			if err != nil {
+				return errors.Wrapf(err, "parse file %s error", f.Name())
+			}
+			e.ID = strings.TrimSuffix(strings.TrimSuffix(name, RecordFileSuffix), RequestFileSuffix)
+
+			if err := fn(e); err != nil {
+				return err
+			}
+		case strings.HasSuffix(name, NDJSONFileSuffix):
+			if err := walkNDJSON(filePath, strings.TrimSuffix(name, NDJSONFileSuffix), fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func readFile(filePath string) ([]byte, error) {
+	f, err := openFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "read file error")
+	}
+	return b, nil
+}
+
+func walkNDJSON(filePath, id string, fn func(Entry) error) error {
+	f, err := openFile(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxLineSize)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		e, err := parseEntry(scanner.Bytes())
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"file": filePath,
+				"line": line,
+			}).Warning("backend/logger: skipping invalid record")
+			continue
+		}
+		e.ID = id + "." + strconv.Itoa(line)
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return errors.Wrap(scanner.Err(), "read file error")
+}
+
+// parseEntry parses a record, or a request as written by older versions.
+func parseEntry(b []byte) (Entry, error) {
+	var rec struct {
+		Method  string          `json:"method"`
+		KeyID   string          `json:"key_id"`
+		Request json.RawMessage `json:"request"`
+	}
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return Entry{}, errors.Wrap(err, "unmarshal error")
+	}
+
+	if len(rec.Request) == 0 {
+		return Entry{request: append([]byte(nil), b...)}, nil
+	}
+
+	return Entry{
+		Method:  rec.Method,
+		KeyID:   rec.KeyID,
+		request: rec.Request,
+	}, nil
+}
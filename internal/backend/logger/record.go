@@ -0,0 +1,93 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/status"
+
+	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/upstream"
+)
+
+// Request log file suffixes. Request files are written by older versions
+// and only contain the request, record files contain a single Record and
+// NDJSON files contain a Record per line.
+const (
+	RequestFileSuffix = ".request.json"
+	RecordFileSuffix  = ".record.json"
+	NDJSONFileSuffix  = ".ndjson"
+)
+
+// Record holds a single logged API call.
+type Record struct {
+	Method    string              `json:"method"`
+	RequestID string              `json:"request_id,omitempty"`
+	KeyID     string              `json:"key_id,omitempty"`
+	DevEUI    string              `json:"dev_eui"`
+	Time      time.Time           `json:"time"`
+	Backend   string              `json:"backend"`
+	LatencyMS float64             `json:"latency_ms"`
+	Request   json.RawMessage     `json:"request"`
+	Response  json.RawMessage     `json:"response,omitempty"`
+	Error     *Error              `json:"error,omitempty"`
+	Upstream  []upstream.Exchange `json:"upstream,omitempty"`
+}
+
+// Error holds the gRPC error of a logged API call.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewRecord creates a new record for the given API call. The response is
+// ignored when nil.
+func NewRecord(method, backend string, start time.Time, latency time.Duration, req, resp proto.Message, callErr error) (Record, error) {
+	r := Record{
+		Method:    method,
+		Time:      start.UTC(),
+		Backend:   backend,
+		LatencyMS: float64(latency) / float64(time.Millisecond),
+	}
+
+	if d, ok := req.(interface{ GetDevEui() []byte }); ok {
+		r.DevEUI = hex.EncodeToString(d.GetDevEui())
+	}
+
+	var err error
+	if r.Request, err = marshalMessage(req); err != nil {
+		return r, errors.Wrap(err, "marshal request error")
+	}
+
+	if resp != nil {
+		if r.Response, err = marshalMessage(resp); err != nil {
+			return r, errors.Wrap(err, "marshal response error")
+		}
+	}
+
+	if callErr != nil {
+		s, _ := status.FromError(callErr)
+		r.Error = &Error{
+			Code:    s.Code().String(),
+			Message: s.Message(),
+		}
+	}
+
+	return r, nil
+}
+
+func marshalMessage(msg proto.Message) (json.RawMessage, error) {
+	var bb bytes.Buffer
+	m := jsonpb.Marshaler{
+		EnumsAsInts:  false,
+		EmitDefaults: true,
+	}
+	if err := m.Marshal(&bb, msg); err != nil {
+		return nil, err
+	}
+	return bb.Bytes(), nil
+}
@@ -0,0 +1,379 @@
+package logger
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+)
+
+// S3 sink defaults, used when not configured.
+const (
+	defaultS3BatchSize      = 1000
+	defaultS3BatchInterval  = time.Minute
+	defaultS3RequestTimeout = 30 * time.Second
+)
+
+// Retry of the batches which could not be uploaded because of a connection
+// or server error. The backoff doubles with each failed attempt. A batch is
+// dropped after s3MaxAttempts attempts, or when more than s3MaxRetryBatches
+// batches are waiting to be retried (oldest first). On close, the failed
+// batches are retried s3CloseRetries times.
+const (
+	s3MinBackoff      = time.Second
+	s3MaxBackoff      = 5 * time.Minute
+	s3MaxAttempts     = 12
+	s3MaxRetryBatches = 100
+	s3CloseRetries    = 3
+)
+
+// s3Sink uploads batches of records as NDJSON objects to S3-compatible
+// object storage. Objects are stored under a prefix per method, using the
+// same layout as the request log directory, such that a synced copy of the
+// bucket can be read using WalkDir.
+type s3Sink struct {
+	client        *http.Client
+	signer        sigV4Signer
+	endpoint      *url.URL
+	bucket        string
+	prefix        string
+	pathStyle     bool
+	compression   string
+	batchSize     int
+	batchInterval time.Duration
+
+	// closeBackoff is the backoff between the retries on close
+	closeBackoff time.Duration
+
+	mu      sync.Mutex
+	batches map[string]*s3Batch
+	retries []*s3Batch
+
+	closed chan struct{}
+	done   chan struct{}
+}
+
+// s3Batch holds the records of a single method, to be uploaded as a single
+// object.
+type s3Batch struct {
+	method string
+	start  time.Time
+	buf    bytes.Buffer
+	count  int
+
+	// key is set on the first upload attempt, such that a retried batch
+	// overwrites the object when an earlier attempt did succeed
+	key      string
+	attempts int
+	retryAt  time.Time
+}
+
+// statusError is returned when the object storage responds with a non-2xx
+// status.
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("expected 2xx response, got: %d (%s)", e.code, e.body)
+}
+
+// retryable returns true when the upload failed because of a connection
+// error, a timeout or a server error.
+func retryable(err error) bool {
+	if e, ok := errors.Cause(err).(*statusError); ok {
+		return e.code >= 500 || e.code == http.StatusTooManyRequests || e.code == http.StatusRequestTimeout
+	}
+	return true
+}
+
+func newS3Sink(c config.Config) (*s3Sink, error) {
+	conf := c.GeoServer.Backend.RequestLog.S3
+
+	if conf.Bucket == "" {
+		return nil, errors.New("request log s3 bucket must be set")
+	}
+
+	endpoint, err := url.Parse(conf.Endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse request log s3 endpoint error")
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("invalid request log s3 endpoint: %s", conf.Endpoint)
+	}
+
+	s := s3Sink{
+		client: &http.Client{
+			Timeout: conf.RequestTimeout,
+		},
+		signer: sigV4Signer{
+			accessKeyID:     conf.AccessKeyID,
+			secretAccessKey: conf.SecretAccessKey,
+			region:          conf.Region,
+			service:         "s3",
+		},
+		endpoint:      endpoint,
+		bucket:        conf.Bucket,
+		prefix:        conf.Prefix,
+		pathStyle:     conf.PathStyle,
+		compression:   c.GeoServer.Backend.RequestLog.Compression,
+		batchSize:     conf.BatchSize,
+		batchInterval: conf.BatchInterval,
+		closeBackoff:  s3MinBackoff,
+		batches:       make(map[string]*s3Batch),
+		closed:        make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	if s.client.Timeout == 0 {
+		s.client.Timeout = defaultS3RequestTimeout
+	}
+	if s.batchSize == 0 {
+		s.batchSize = defaultS3BatchSize
+	}
+	if s.batchInterval == 0 {
+		s.batchInterval = defaultS3BatchInterval
+	}
+	if s.signer.region == "" {
+		s.signer.region = "us-east-1"
+	}
+
+	go s.flushLoop()
+
+	return &s, nil
+}
+
+// Write adds the given record to the batch of its method. The batch is
+// uploaded when it contains batch_size records, or after batch_interval.
+func (s *s3Sink) Write(r Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "marshal json error")
+	}
+
+	s.mu.Lock()
+	batch, ok := s.batches[r.Method]
+	if !ok {
+		batch = &s3Batch{method: r.Method, start: r.Time}
+		s.batches[r.Method] = batch
+	}
+	batch.buf.Write(b)
+	batch.buf.WriteByte('\n')
+	batch.count++
+
+	if batch.count < s.batchSize {
+		s.mu.Unlock()
+		return nil
+	}
+
+	delete(s.batches, r.Method)
+	s.mu.Unlock()
+
+	return s.upload(batch, time.Now())
+}
+
+// Close uploads the pending batches. The batches which can't be uploaded
+// are retried s3CloseRetries times, before they are dropped.
+func (s *s3Sink) Close() error {
+	close(s.closed)
+	<-s.done
+
+	err := s.flush(time.Now(), true)
+	for i := 0; i < s3CloseRetries && s.retryCount() != 0; i++ {
+		time.Sleep(s.closeBackoff << uint(i))
+		err = s.flush(time.Now(), true)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n := len(s.retries); n != 0 {
+		uploadCounter("dropped").Add(float64(n))
+		s.retries = nil
+		return errors.Wrapf(err, "%d request log batches dropped", n)
+	}
+
+	return err
+}
+
+func (s *s3Sink) flushLoop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.batchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-ticker.C:
+			if err := s.flush(time.Now(), false); err != nil {
+				log.WithError(err).Error("backend/logger: upload request log batch error")
+			}
+		}
+	}
+}
+
+// flush uploads all pending batches and the failed batches of which the
+// backoff has expired. When all is set, all failed batches are retried.
+func (s *s3Sink) flush(now time.Time, all bool) error {
+	s.mu.Lock()
+	var batches []*s3Batch
+	for _, batch := range s.batches {
+		batches = append(batches, batch)
+	}
+	s.batches = make(map[string]*s3Batch)
+
+	var retries []*s3Batch
+	for _, batch := range s.retries {
+		if all || !now.Before(batch.retryAt) {
+			batches = append(batches, batch)
+		} else {
+			retries = append(retries, batch)
+		}
+	}
+	s.retries = retries
+	s.mu.Unlock()
+
+	var out error
+	for _, batch := range batches {
+		if err := s.upload(batch, now); err != nil {
+			out = err
+		}
+	}
+	return out
+}
+
+// retryCount returns the number of failed batches waiting to be retried.
+func (s *s3Sink) retryCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.retries)
+}
+
+// upload uploads the given batch as a single object. On a connection or
+// server error, the batch is kept to be retried.
+func (s *s3Sink) upload(batch *s3Batch, now time.Time) error {
+	if batch.key == "" {
+		batch.key = s.objectKey(batch.method, batch.start)
+	}
+
+	b, err := compressBytes(batch.buf.Bytes(), s.compression)
+	if err != nil {
+		uploadCounter("error").Inc()
+		return err
+	}
+
+	if err := s.putObject(batch.key, b); err != nil {
+		uploadCounter("error").Inc()
+		if retryable(err) {
+			s.retry(batch, now)
+		}
+		return errors.Wrapf(err, "upload object %s error", batch.key)
+	}
+
+	uploadCounter("success").Inc()
+	log.WithFields(log.Fields{
+		"key":     batch.key,
+		"records": batch.count,
+	}).Debug("backend/logger: request log batch uploaded")
+
+	return nil
+}
+
+// retry keeps the given batch to be retried after the backoff. A batch
+// which has reached s3MaxAttempts attempts is dropped, as is the oldest
+// batch when s3MaxRetryBatches batches are waiting to be retried.
+func (s *s3Sink) retry(batch *s3Batch, now time.Time) {
+	batch.attempts++
+	if batch.attempts >= s3MaxAttempts {
+		uploadCounter("dropped").Inc()
+		log.WithFields(log.Fields{
+			"key":      batch.key,
+			"records":  batch.count,
+			"attempts": batch.attempts,
+		}).Error("backend/logger: request log batch dropped")
+		return
+	}
+
+	d := s3MaxBackoff
+	if dd := s3MinBackoff << uint(batch.attempts-1); dd < s3MaxBackoff {
+		d = dd
+	}
+	batch.retryAt = now.Add(d)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.retries = append(s.retries, batch)
+	if len(s.retries) > s3MaxRetryBatches {
+		dropped := s.retries[0]
+		s.retries = s.retries[1:]
+
+		uploadCounter("dropped").Inc()
+		log.WithFields(log.Fields{
+			"key":     dropped.key,
+			"records": dropped.count,
+		}).Error("backend/logger: request log retry queue is full, batch dropped")
+	}
+}
+
+// objectKey returns an unique object key for a batch of the given method,
+// starting at the given time.
+func (s *s3Sink) objectKey(method string, start time.Time) string {
+	var suffix [4]byte
+	rand.Read(suffix[:])
+
+	name := start.UTC().Format(fileTimeFormat) + "." + hex.EncodeToString(suffix[:]) + NDJSONFileSuffix + compressionSuffix(s.compression)
+	return path.Join(s.prefix, method, name)
+}
+
+// objectURL returns the URL of the given object key, using path-style or
+// virtual-hosted-style addressing.
+func (s *s3Sink) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = path.Join("/", u.Path, s.bucket, key)
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = path.Join("/", u.Path, key)
+	}
+	return &u
+}
+
+func (s *s3Sink) putObject(key string, b []byte) error {
+	req, err := http.NewRequest(http.MethodPut, s.objectURL(key).String(), bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "new request error")
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	s.signer.sign(req, sha256Hex(b), time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "http request error")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &statusError{code: resp.StatusCode, body: strings.TrimSpace(string(body))}
+	}
+
+	return nil
+}
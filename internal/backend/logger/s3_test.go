@@ -0,0 +1,450 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/geo"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+)
+
+// testObjectStore implements a minimal S3-compatible object store, which
+// verifies the request signatures (like MinIO does).
+type testObjectStore struct {
+	t      *testing.T
+	signer sigV4Signer
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	puts    []string
+
+	// fail is the number of requests to fail with a 503 response
+	fail int
+}
+
+var authorizationRegexp = regexp.MustCompile(`^AWS4-HMAC-SHA256 Credential=[^/]+/\d{8}/[^/]+/s3/aws4_request, SignedHeaders=([^,]+), Signature=[0-9a-f]{64}$`)
+
+func (s *testObjectStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.puts = append(s.puts, r.URL.Path)
+	if s.fail > 0 {
+		s.fail--
+		http.Error(w, "<Error><Code>ServiceUnavailable</Code></Error>", http.StatusServiceUnavailable)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.Header.Get("X-Amz-Content-Sha256") != sha256Hex(body) {
+		http.Error(w, "<Error><Code>XAmzContentSHA256Mismatch</Code></Error>", http.StatusBadRequest)
+		return
+	}
+
+	// re-sign the request using the signed headers only
+	match := authorizationRegexp.FindStringSubmatch(r.Header.Get("Authorization"))
+	if match == nil {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+		return
+	}
+
+	t, err := time.Parse(sigV4TimeFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+		return
+	}
+
+	req, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.EscapedPath(), nil)
+	for _, h := range strings.Split(match[1], ";") {
+		if h != "host" && !strings.HasPrefix(h, "x-amz-") {
+			req.Header.Set(h, r.Header.Get(h))
+		}
+	}
+	s.signer.sign(req, r.Header.Get("X-Amz-Content-Sha256"), t)
+
+	if req.Header.Get("Authorization") != r.Header.Get("Authorization") {
+		http.Error(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>", http.StatusForbidden)
+		return
+	}
+
+	s.objects[r.URL.Path] = body
+}
+
+// download writes the objects of the given bucket to the given directory.
+func (s *testObjectStore) download(bucket, dir string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	for p, b := range s.objects {
+		key := strings.TrimPrefix(p, "/"+bucket+"/")
+		keys = append(keys, key)
+
+		require.NoError(s.t, os.MkdirAll(filepath.Join(dir, filepath.Dir(key)), 0755))
+		require.NoError(s.t, ioutil.WriteFile(filepath.Join(dir, key), b, 0644))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func newTestObjectStore(t *testing.T) (*testObjectStore, *httptest.Server) {
+	store := testObjectStore{
+		t: t,
+		signer: sigV4Signer{
+			accessKeyID:     "minio",
+			secretAccessKey: "minio123",
+			region:          "us-east-1",
+			service:         "s3",
+		},
+		objects: make(map[string][]byte),
+	}
+	return &store, httptest.NewServer(&store)
+}
+
+func s3TestConfig(endpoint string) config.Config {
+	var c config.Config
+	c.GeoServer.Backend.RequestLog.Sink = SinkS3
+	c.GeoServer.Backend.RequestLog.Sampling.Percentage = 100
+	c.GeoServer.Backend.RequestLog.S3.Endpoint = endpoint
+	c.GeoServer.Backend.RequestLog.S3.Bucket = "requests"
+	c.GeoServer.Backend.RequestLog.S3.Prefix = "geo"
+	c.GeoServer.Backend.RequestLog.S3.PathStyle = true
+	c.GeoServer.Backend.RequestLog.S3.AccessKeyID = "minio"
+	c.GeoServer.Backend.RequestLog.S3.SecretAccessKey = "minio123"
+	c.GeoServer.Backend.RequestLog.S3.BatchSize = 2
+	return c
+}
+
+func TestS3Sink(t *testing.T) {
+	for _, compression := range []string{CompressionNone, CompressionGzip, CompressionZstd} {
+		t.Run(compression, func(t *testing.T) {
+			assert := require.New(t)
+
+			store, server := newTestObjectStore(t)
+			defer server.Close()
+
+			dir, err := ioutil.TempDir("", "request-log")
+			assert.NoError(err)
+			defer os.RemoveAll(dir)
+
+			c := s3TestConfig(server.URL)
+			c.GeoServer.Backend.RequestLog.Compression = compression
+
+			b, err := NewBackend(&testBackend{}, c)
+			assert.NoError(err)
+
+			// the first batch is uploaded once full, the second on close
+			for i := 0; i < 3; i++ {
+				_, err = b.ResolveTDOA(context.Background(), &geo.ResolveTDOARequest{DevEui: []byte{1, 2, 3, 4, 5, 6, 7, byte(i)}})
+				assert.NoError(err)
+			}
+			assert.NoError(b.(*Backend).Close())
+
+			keys := store.download("requests", dir)
+			assert.Len(keys, 2)
+			for _, key := range keys {
+				assert.Regexp(`^geo/ResolveTDOA/\d{8}T\d{6}\.\d{9}Z\.[0-9a-f]{8}\.ndjson`+regexp.QuoteMeta(compressionSuffix(compression))+`$`, key)
+			}
+
+			var devEUIs [][]byte
+			assert.NoError(WalkDir(filepath.Join(dir, "geo", "ResolveTDOA"), func(e Entry) error {
+				var req geo.ResolveTDOARequest
+				assert.NoError(e.UnmarshalRequest(&req))
+				devEUIs = append(devEUIs, req.DevEui)
+				return nil
+			}))
+			assert.ElementsMatch([][]byte{{1, 2, 3, 4, 5, 6, 7, 0}, {1, 2, 3, 4, 5, 6, 7, 1}, {1, 2, 3, 4, 5, 6, 7, 2}}, devEUIs)
+		})
+	}
+
+	t.Run("batch interval", func(t *testing.T) {
+		assert := require.New(t)
+
+		store, server := newTestObjectStore(t)
+		defer server.Close()
+
+		c := s3TestConfig(server.URL)
+		c.GeoServer.Backend.RequestLog.S3.BatchInterval = 10 * time.Millisecond
+
+		s, err := newS3Sink(c)
+		assert.NoError(err)
+		defer s.Close()
+
+		assert.NoError(s.Write(Record{Method: "ResolveTDOA", Time: time.Now()}))
+
+		var count int
+		for i := 0; i < 100 && count == 0; i++ {
+			time.Sleep(10 * time.Millisecond)
+
+			store.mu.Lock()
+			count = len(store.objects)
+			store.mu.Unlock()
+		}
+		assert.Equal(1, count)
+	})
+
+	t.Run("invalid signature", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, server := newTestObjectStore(t)
+		defer server.Close()
+
+		c := s3TestConfig(server.URL)
+		c.GeoServer.Backend.RequestLog.S3.SecretAccessKey = "invalid"
+
+		s, err := newS3Sink(c)
+		assert.NoError(err)
+
+		assert.NoError(s.Write(Record{Method: "ResolveTDOA"}))
+		err = s.Write(Record{Method: "ResolveTDOA"})
+		assert.Error(err)
+		assert.Contains(err.Error(), "expected 2xx response, got: 403 (<Error><Code>SignatureDoesNotMatch</Code></Error>)")
+		assert.NoError(s.Close())
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		assert := require.New(t)
+
+		store, server := newTestObjectStore(t)
+		defer server.Close()
+		store.fail = 1
+
+		s, err := newS3Sink(s3TestConfig(server.URL))
+		assert.NoError(err)
+
+		now := time.Now()
+		assert.NoError(s.Write(Record{Method: "ResolveTDOA"}))
+		err = s.Write(Record{Method: "ResolveTDOA"})
+		assert.Error(err)
+		assert.Contains(err.Error(), "expected 2xx response, got: 503")
+		assert.Equal(1, s.retryCount())
+
+		// the batch is retried once the backoff has expired
+		assert.NoError(s.flush(now, false))
+		assert.Equal(1, s.retryCount())
+		assert.NoError(s.flush(now.Add(2*s3MinBackoff), false))
+		assert.Equal(0, s.retryCount())
+		assert.NoError(s.Close())
+
+		// the retry overwrites the same object
+		assert.Len(store.puts, 2)
+		assert.Equal(store.puts[0], store.puts[1])
+		assert.Len(store.objects, 1)
+	})
+
+	t.Run("retry on close", func(t *testing.T) {
+		assert := require.New(t)
+
+		store, server := newTestObjectStore(t)
+		defer server.Close()
+		store.fail = 2
+
+		s, err := newS3Sink(s3TestConfig(server.URL))
+		assert.NoError(err)
+		s.closeBackoff = time.Millisecond
+
+		assert.NoError(s.Write(Record{Method: "ResolveTDOA"}))
+		assert.NoError(s.Close())
+		assert.Len(store.puts, 3)
+		assert.Len(store.objects, 1)
+	})
+
+	t.Run("dropped on close", func(t *testing.T) {
+		assert := require.New(t)
+
+		store, server := newTestObjectStore(t)
+		defer server.Close()
+		store.fail = s3CloseRetries + 1
+
+		s, err := newS3Sink(s3TestConfig(server.URL))
+		assert.NoError(err)
+		s.closeBackoff = time.Millisecond
+
+		assert.NoError(s.Write(Record{Method: "ResolveTDOA"}))
+		err = s.Close()
+		assert.Error(err)
+		assert.Contains(err.Error(), "1 request log batches dropped")
+		assert.Equal(0, s.retryCount())
+		assert.Len(store.objects, 0)
+	})
+
+	t.Run("retry limits", func(t *testing.T) {
+		assert := require.New(t)
+
+		s, err := newS3Sink(s3TestConfig("http://localhost:9000"))
+		assert.NoError(err)
+		defer s.Close()
+
+		now := time.Now()
+		batch := s3Batch{attempts: s3MaxAttempts - 2}
+		s.retry(&batch, now)
+		assert.Equal(now.Add(s3MaxBackoff), batch.retryAt)
+		assert.Equal(1, s.retryCount())
+
+		// the max. number of attempts has been reached
+		s.retry(&batch, now)
+		assert.Equal(1, s.retryCount())
+
+		// the oldest batch is dropped when the retry queue is full
+		for i := 0; i < s3MaxRetryBatches; i++ {
+			s.retry(&s3Batch{}, now)
+		}
+		assert.Equal(s3MaxRetryBatches, s.retryCount())
+		assert.NotContains(s.retries, &batch)
+		s.retries = nil
+	})
+
+	t.Run("object url", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := s3TestConfig("https://s3.eu-west-1.amazonaws.com")
+		s, err := newS3Sink(c)
+		assert.NoError(err)
+		defer s.Close()
+
+		assert.Equal("https://s3.eu-west-1.amazonaws.com/requests/geo/ResolveTDOA/a.ndjson", s.objectURL("geo/ResolveTDOA/a.ndjson").String())
+
+		s.pathStyle = false
+		assert.Equal("https://requests.s3.eu-west-1.amazonaws.com/geo/ResolveTDOA/a.ndjson", s.objectURL("geo/ResolveTDOA/a.ndjson").String())
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := s3TestConfig("localhost:9000")
+		_, err := newS3Sink(c)
+		assert.EqualError(err, "invalid request log s3 endpoint: localhost:9000")
+
+		c = s3TestConfig("http://localhost:9000")
+		c.GeoServer.Backend.RequestLog.S3.Bucket = ""
+		_, err = newS3Sink(c)
+		assert.EqualError(err, "request log s3 bucket must be set")
+	})
+}
+
+type testProducer struct {
+	mu       sync.Mutex
+	messages []testMessage
+	batches  int
+	err      error
+	closed   bool
+}
+
+type testMessage struct {
+	Topic string
+	Key   string
+}
+
+func (p *testProducer) Produce(topic string, messages []Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+	p.batches++
+	for _, m := range messages {
+		p.messages = append(p.messages, testMessage{Topic: topic, Key: string(m.Key)})
+	}
+	return nil
+}
+
+func (p *testProducer) Close() error {
+	p.closed = true
+	return nil
+}
+
+func TestKafkaSink(t *testing.T) {
+	t.Run("registered", func(t *testing.T) {
+		assert := require.New(t)
+
+		p := testProducer{}
+		RegisterSink("test-kafka", func(c config.Config) (Sink, error) {
+			return NewKafkaSink(&p, "geolocation-requests", 2, time.Hour), nil
+		})
+		assert.Contains(Sinks(), "test-kafka")
+		assert.Panics(func() { RegisterSink("test-kafka", nil) })
+
+		var c config.Config
+		c.GeoServer.Backend.RequestLog.Sink = "test-kafka"
+
+		b, err := NewBackend(&testBackend{}, c)
+		assert.NoError(err)
+
+		// the first batch is published once full, the second on close
+		for i := 0; i < 3; i++ {
+			_, err = b.ResolveTDOA(context.Background(), &geo.ResolveTDOARequest{DevEui: []byte{1, 2, 3, 4, 5, 6, 7, byte(i)}})
+			assert.NoError(err)
+		}
+		assert.NoError(b.(*Backend).Close())
+
+		assert.True(p.closed)
+		assert.Equal(2, p.batches)
+		assert.Equal([]testMessage{
+			{Topic: "geolocation-requests", Key: "0102030405060700"},
+			{Topic: "geolocation-requests", Key: "0102030405060701"},
+			{Topic: "geolocation-requests", Key: "0102030405060702"},
+		}, p.messages)
+	})
+
+	t.Run("batch interval", func(t *testing.T) {
+		assert := require.New(t)
+
+		p := testProducer{}
+		s := NewKafkaSink(&p, "geolocation-requests", 0, 10*time.Millisecond)
+		defer s.Close()
+
+		assert.NoError(s.Write(Record{DevEUI: "0102030405060708"}))
+
+		var count int
+		for i := 0; i < 100 && count == 0; i++ {
+			time.Sleep(10 * time.Millisecond)
+
+			p.mu.Lock()
+			count = len(p.messages)
+			p.mu.Unlock()
+		}
+		assert.Equal(1, count)
+	})
+
+	t.Run("produce error", func(t *testing.T) {
+		assert := require.New(t)
+
+		p := testProducer{err: errors.New("broker unavailable")}
+		s := NewKafkaSink(&p, "geolocation-requests", 1, time.Hour)
+		assert.EqualError(s.Write(Record{}), "produce messages error: broker unavailable")
+		assert.NoError(s.Close())
+	})
+
+	t.Run("unknown sink", func(t *testing.T) {
+		assert := require.New(t)
+
+		var c config.Config
+		c.GeoServer.Backend.RequestLog.Sink = "kafka"
+		_, err := NewBackend(&testBackend{}, c)
+		assert.EqualError(err, "invalid request log sink: kafka")
+	})
+}
@@ -0,0 +1,100 @@
+package logger
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/brocaar/lorawan"
+	"github.com/pkg/errors"
+
+	"github.com/brocaar/chirpstack-api/go/v3/geo"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+)
+
+// sampler decides which calls are logged. All configured conditions must be
+// met for a call to be logged.
+type sampler struct {
+	percentage   float64
+	devEUIs      map[lorawan.EUI64]struct{}
+	onlyFailures bool
+	minGateways  int
+
+	// random returns a random number in [0.0, 100.0)
+	random func() float64
+}
+
+func newSampler(c config.Config) (*sampler, error) {
+	conf := c.GeoServer.Backend.RequestLog.Sampling
+
+	if conf.Percentage < 0 || conf.Percentage > 100 {
+		return nil, fmt.Errorf("invalid request log sampling percentage: %f", conf.Percentage)
+	}
+
+	// 0 means not set, e.g. when the config is not loaded through viper
+	percentage := conf.Percentage
+	if percentage == 0 {
+		percentage = 100
+	}
+
+	s := sampler{
+		percentage:   percentage,
+		onlyFailures: conf.OnlyFailures,
+		minGateways:  conf.MinGatewayCount,
+		random: func() float64 {
+			return rand.Float64() * 100
+		},
+	}
+
+	if len(conf.DevEUIs) != 0 {
+		s.devEUIs = make(map[lorawan.EUI64]struct{})
+		for _, str := range conf.DevEUIs {
+			var devEUI lorawan.EUI64
+			if err := devEUI.UnmarshalText([]byte(str)); err != nil {
+				return nil, errors.Wrapf(err, "decode request log sampling dev_eui %s error", str)
+			}
+			s.devEUIs[devEUI] = struct{}{}
+		}
+	}
+
+	return &s, nil
+}
+
+// sampleRequest returns true when the call for the given device and
+// gateway count must be logged. As the outcome of the call is not known
+// yet, sampleResult must be used once the call has completed.
+func (s *sampler) sampleRequest(devEUI []byte, gatewayCount int) bool {
+	if s.devEUIs != nil {
+		var eui lorawan.EUI64
+		copy(eui[:], devEUI)
+		if _, ok := s.devEUIs[eui]; !ok || len(devEUI) != len(eui) {
+			return false
+		}
+	}
+
+	if gatewayCount < s.minGateways {
+		return false
+	}
+
+	if s.percentage < 100 && s.random() >= s.percentage {
+		return false
+	}
+
+	return true
+}
+
+// sampleResult returns true when the completed call must be logged.
+func (s *sampler) sampleResult(callErr error) bool {
+	return !s.onlyFailures || callErr != nil
+}
+
+// gatewayCount returns the number of unique gateways which received the
+// given frames.
+func gatewayCount(frames ...*geo.FrameRXInfo) int {
+	gateways := make(map[string]struct{})
+	for _, frame := range frames {
+		for _, rxInfo := range frame.GetRxInfo() {
+			gateways[string(rxInfo.GetGatewayId())] = struct{}{}
+		}
+	}
+	return len(gateways)
+}
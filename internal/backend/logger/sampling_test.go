@@ -0,0 +1,176 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/geo"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+)
+
+func TestSampler(t *testing.T) {
+	devEUI := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	tests := []struct {
+		Name         string
+		Percentage   float64
+		DevEUIs      []string
+		OnlyFailures bool
+		MinGateways  int
+
+		DevEUI       []byte
+		GatewayCount int
+		Random       float64
+		Err          error
+
+		Expected bool
+	}{
+		{
+			Name:         "all",
+			Percentage:   100,
+			DevEUI:       devEUI,
+			GatewayCount: 1,
+			Random:       99.9,
+			Expected:     true,
+		},
+		{
+			Name:         "percentage not set",
+			DevEUI:       devEUI,
+			GatewayCount: 1,
+			Random:       99.9,
+			Expected:     true,
+		},
+		{
+			Name:         "percentage sampled",
+			Percentage:   10,
+			DevEUI:       devEUI,
+			GatewayCount: 1,
+			Random:       9.9,
+			Expected:     true,
+		},
+		{
+			Name:         "percentage not sampled",
+			Percentage:   10,
+			DevEUI:       devEUI,
+			GatewayCount: 1,
+			Random:       10,
+		},
+		{
+			Name:         "dev_eui allowed",
+			Percentage:   100,
+			DevEUIs:      []string{"0807060504030201", "0102030405060708"},
+			DevEUI:       devEUI,
+			GatewayCount: 1,
+			Expected:     true,
+		},
+		{
+			Name:         "dev_eui not allowed",
+			Percentage:   100,
+			DevEUIs:      []string{"0807060504030201"},
+			DevEUI:       devEUI,
+			GatewayCount: 1,
+		},
+		{
+			Name:         "only failures, failure",
+			Percentage:   100,
+			OnlyFailures: true,
+			DevEUI:       devEUI,
+			GatewayCount: 1,
+			Err:          errors.New("failure"),
+			Expected:     true,
+		},
+		{
+			Name:         "only failures, success",
+			Percentage:   100,
+			OnlyFailures: true,
+			DevEUI:       devEUI,
+			GatewayCount: 1,
+		},
+		{
+			Name:         "min gateways",
+			Percentage:   100,
+			MinGateways:  3,
+			DevEUI:       devEUI,
+			GatewayCount: 3,
+			Expected:     true,
+		},
+		{
+			Name:         "less than min gateways",
+			Percentage:   100,
+			MinGateways:  3,
+			DevEUI:       devEUI,
+			GatewayCount: 2,
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			var c config.Config
+			c.GeoServer.Backend.RequestLog.Sampling.Percentage = tst.Percentage
+			c.GeoServer.Backend.RequestLog.Sampling.DevEUIs = tst.DevEUIs
+			c.GeoServer.Backend.RequestLog.Sampling.OnlyFailures = tst.OnlyFailures
+			c.GeoServer.Backend.RequestLog.Sampling.MinGatewayCount = tst.MinGateways
+
+			s, err := newSampler(c)
+			assert.NoError(err)
+			s.random = func() float64 { return tst.Random }
+
+			assert.Equal(tst.Expected, s.sampleRequest(tst.DevEUI, tst.GatewayCount) && s.sampleResult(tst.Err))
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		assert := require.New(t)
+
+		var c config.Config
+		c.GeoServer.Backend.RequestLog.Sampling.Percentage = 101
+		_, err := newSampler(c)
+		assert.EqualError(err, "invalid request log sampling percentage: 101.000000")
+
+		c.GeoServer.Backend.RequestLog.Sampling.Percentage = 100
+		c.GeoServer.Backend.RequestLog.Sampling.DevEUIs = []string{"foo"}
+		_, err = newSampler(c)
+		assert.EqualError(err, "decode request log sampling dev_eui foo error: encoding/hex: invalid byte: U+006F 'o'")
+	})
+}
+
+func TestGatewayCount(t *testing.T) {
+	assert := require.New(t)
+
+	frames := []*geo.FrameRXInfo{
+		{RxInfo: []*gw.UplinkRXInfo{{GatewayId: []byte{1}}, {GatewayId: []byte{2}}}},
+		{RxInfo: []*gw.UplinkRXInfo{{GatewayId: []byte{2}}, {GatewayId: []byte{3}}}},
+	}
+
+	assert.Equal(0, gatewayCount(nil))
+	assert.Equal(2, gatewayCount(frames[0]))
+	assert.Equal(3, gatewayCount(frames...))
+}
+
+func TestEnqueue(t *testing.T) {
+	assert := require.New(t)
+
+	b := Backend{
+		queue: make(chan Record, 1),
+	}
+
+	dropped := testutil.ToFloat64(recordDroppedCounter("ResolveTDOA"))
+
+	// the second record is dropped, as there is no worker
+	b.enqueue(context.Background(), Record{Method: "ResolveTDOA"})
+	b.enqueue(context.Background(), Record{Method: "ResolveTDOA"})
+	assert.Len(b.queue, 1)
+	assert.Equal(dropped+1, testutil.ToFloat64(recordDroppedCounter("ResolveTDOA")))
+
+	// records are dropped after closing the queue
+	b.queueClosed = true
+	b.enqueue(context.Background(), Record{Method: "ResolveTDOA"})
+	assert.Equal(dropped+2, testutil.ToFloat64(recordDroppedCounter("ResolveTDOA")))
+}
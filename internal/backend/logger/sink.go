@@ -0,0 +1,73 @@
+package logger
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+)
+
+// Request log sinks.
+const (
+	// SinkFile writes the records to the request log directory.
+	SinkFile = "file"
+
+	// SinkS3 uploads batches of records to S3-compatible object storage.
+	SinkS3 = "s3"
+)
+
+// Sink defines the interface of a request log sink. Write is called by a
+// single background worker, implementations may buffer records until they
+// are closed.
+type Sink interface {
+	// Write writes the given record.
+	Write(r Record) error
+
+	// Close writes the buffered records (if any) and closes the sink.
+	Close() error
+}
+
+// SinkFunc creates a sink, based on the given configuration.
+type SinkFunc func(c config.Config) (Sink, error)
+
+var (
+	sinksMu sync.RWMutex
+	sinks   = make(map[string]SinkFunc)
+)
+
+// RegisterSink registers a sink under the given name, which can then be
+// selected using the request_log sink setting. This can be used to write
+// the records to a sink which is not built in, e.g. a KafkaSink using the
+// producer of the application. It must be called before the backend is
+// set up and panics when the name is already in use.
+func RegisterSink(name string, f SinkFunc) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+
+	if _, ok := sinks[name]; ok || name == "" || name == SinkFile || name == SinkS3 {
+		panic(fmt.Sprintf("backend/logger: sink %s is already registered", name))
+	}
+	sinks[name] = f
+}
+
+// Sinks returns the names of the available sinks.
+func Sinks() []string {
+	sinksMu.RLock()
+	defer sinksMu.RUnlock()
+
+	out := []string{SinkFile, SinkS3}
+	for name := range sinks {
+		out = append(out, name)
+	}
+	sort.Strings(out[2:])
+	return out
+}
+
+func registeredSink(name string) (SinkFunc, bool) {
+	sinksMu.RLock()
+	defer sinksMu.RUnlock()
+
+	f, ok := sinks[name]
+	return f, ok
+}
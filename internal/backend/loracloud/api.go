@@ -11,15 +11,26 @@ import (
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 
+	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/quality"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/upstream"
 	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/helpers"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/logging"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/tracing"
 	"github.com/brocaar/chirpstack-api/go/v3/common"
 	"github.com/brocaar/chirpstack-api/go/v3/geo"
 	"github.com/brocaar/lorawan"
 )
 
+// backendName is the name of the backend, as used in the metrics and
+// traces.
+const backendName = "lora_cloud"
+
 // Backend implements the LoRa Cloud geolocation backend.
 type Backend struct {
 	uri            string
@@ -37,8 +48,22 @@ func NewBackend(c config.Config) (geo.GeolocationServerServiceServer, error) {
 }
 
 // ResolveTDOA resolves the location based on TDOA.
-func (b *Backend) ResolveTDOA(ctx context.Context, req *geo.ResolveTDOARequest) (*geo.ResolveTDOAResponse, error) {
-	lcReq, err := resolveTDOARequestToLoRaCloudRequest(req)
+func (b *Backend) ResolveTDOA(ctx context.Context, req *geo.ResolveTDOARequest) (resp *geo.ResolveTDOAResponse, err error) {
+	ctx, span := tracing.Start(ctx, "lora_cloud.ResolveTDOA", trace.SpanKindInternal,
+		attribute.String("geo.backend", backendName),
+		tracing.DevEUI(req.DevEui),
+		attribute.Int("geo.gateway_count", len(req.GetFrameRxInfo().GetRxInfo())),
+	)
+	defer func() {
+		tracing.SetError(span, err)
+		span.End()
+	}()
+
+	_, preSpan := tracing.Start(ctx, "lora_cloud.preprocess", trace.SpanKindInternal)
+	lcReq, err := resolveTDOARequestToLoRaCloudRequest(ctx, req)
+	preSpan.SetAttributes(attribute.Int("geo.gateway_count_used", len(lcReq.LoRaWAN)))
+	tracing.SetError(preSpan, err)
+	preSpan.End()
 	if err != nil {
 		return nil, grpc.Errorf(codes.InvalidArgument, err.Error())
 	}
@@ -51,15 +76,18 @@ func (b *Backend) ResolveTDOA(ctx context.Context, req *geo.ResolveTDOARequest)
 	var devEUI lorawan.EUI64
 	copy(devEUI[:], req.DevEui)
 
+	quality.ObserveMessages(backendName, quality.MessageWarning, tdoaResp.Warnings)
+	quality.ObserveMessages(backendName, quality.MessageError, tdoaResp.Errors)
+
 	if len(tdoaResp.Warnings) != 0 {
-		log.WithFields(log.Fields{
+		logging.FromContext(ctx).WithFields(log.Fields{
 			"dev_eui":  devEUI,
 			"warnings": tdoaResp.Warnings,
 		}).Warning("backend/lora_cloud: backend returned warnings")
 	}
 
 	if len(tdoaResp.Errors) != 0 {
-		log.WithFields(log.Fields{
+		logging.FromContext(ctx).WithFields(log.Fields{
 			"dev_eui": devEUI,
 			"errors":  tdoaResp.Errors,
 		}).Error("backend/lora_cloud: backend returned errors")
@@ -67,6 +95,9 @@ func (b *Backend) ResolveTDOA(ctx context.Context, req *geo.ResolveTDOARequest)
 		return nil, grpc.Errorf(codes.Internal, "backend returned errors: %v", tdoaResp.Errors)
 	}
 
+	quality.ObserveAccuracy(backendName, tdoaResp.Result.Accuracy)
+	quality.ObserveGateways(backendName, len(req.GetFrameRxInfo().GetRxInfo()), len(lcReq.LoRaWAN), tdoaResp.Result.NumberOfGatewaysUsed)
+
 	return &geo.ResolveTDOAResponse{
 		Result: &geo.ResolveResult{
 			Location: &common.Location{
@@ -82,8 +113,23 @@ func (b *Backend) ResolveTDOA(ctx context.Context, req *geo.ResolveTDOARequest)
 
 // ResolveMultiFrameTDOA resolves the location using TDOA, based on
 // multiple frames.
-func (b *Backend) ResolveMultiFrameTDOA(ctx context.Context, req *geo.ResolveMultiFrameTDOARequest) (*geo.ResolveMultiFrameTDOAResponse, error) {
-	lcReq, err := resolveMutiFrameTDOARequestToLoRaCloudRequest(req)
+func (b *Backend) ResolveMultiFrameTDOA(ctx context.Context, req *geo.ResolveMultiFrameTDOARequest) (resp *geo.ResolveMultiFrameTDOAResponse, err error) {
+	ctx, span := tracing.Start(ctx, "lora_cloud.ResolveMultiFrameTDOA", trace.SpanKindInternal,
+		attribute.String("geo.backend", backendName),
+		tracing.DevEUI(req.DevEui),
+		attribute.Int("geo.frame_count", len(req.FrameRxInfoSet)),
+		attribute.Int("geo.gateway_count", helpers.GetGatewayCount(req.FrameRxInfoSet)),
+	)
+	defer func() {
+		tracing.SetError(span, err)
+		span.End()
+	}()
+
+	_, preSpan := tracing.Start(ctx, "lora_cloud.preprocess", trace.SpanKindInternal)
+	lcReq, err := resolveMutiFrameTDOARequestToLoRaCloudRequest(ctx, req)
+	preSpan.SetAttributes(attribute.Int("geo.gateway_count_used", lcReq.gatewayCount()))
+	tracing.SetError(preSpan, err)
+	preSpan.End()
 	if err != nil {
 		return nil, grpc.Errorf(codes.InvalidArgument, err.Error())
 	}
@@ -96,15 +142,18 @@ func (b *Backend) ResolveMultiFrameTDOA(ctx context.Context, req *geo.ResolveMul
 	var devEUI lorawan.EUI64
 	copy(devEUI[:], req.DevEui)
 
+	quality.ObserveMessages(backendName, quality.MessageWarning, tdoaResp.Warnings)
+	quality.ObserveMessages(backendName, quality.MessageError, tdoaResp.Errors)
+
 	if len(tdoaResp.Warnings) != 0 {
-		log.WithFields(log.Fields{
+		logging.FromContext(ctx).WithFields(log.Fields{
 			"dev_eui":  devEUI,
 			"warnings": tdoaResp.Warnings,
 		}).Warning("backend/lora_cloud: backend returned warnings")
 	}
 
 	if len(tdoaResp.Errors) != 0 {
-		log.WithFields(log.Fields{
+		logging.FromContext(ctx).WithFields(log.Fields{
 			"dev_eui": devEUI,
 			"errors":  tdoaResp.Errors,
 		}).Error("backend/lora_cloud: backend returned errors")
@@ -112,6 +161,9 @@ func (b *Backend) ResolveMultiFrameTDOA(ctx context.Context, req *geo.ResolveMul
 		return nil, grpc.Errorf(codes.Internal, "backend returned errors: %v", tdoaResp.Errors)
 	}
 
+	quality.ObserveAccuracy(backendName, tdoaResp.Result.Accuracy)
+	quality.ObserveGateways(backendName, helpers.GetGatewayCount(req.FrameRxInfoSet), lcReq.gatewayCount(), tdoaResp.Result.NumberOfGatewaysUsed)
+
 	return &geo.ResolveMultiFrameTDOAResponse{
 		Result: &geo.ResolveResult{
 			Location: &common.Location{
@@ -141,21 +193,38 @@ func (b *Backend) resolveTDOAMultiFrame(ctx context.Context, tdoaMultiFrameReq t
 	return resp, err
 }
 
-func (b *Backend) loRaCloudAPIRequest(ctx context.Context, endpoint string, v interface{}) (response, error) {
+func (b *Backend) loRaCloudAPIRequest(ctx context.Context, endpoint string, v interface{}) (resolveResp response, err error) {
 	endpoint = fmt.Sprintf(endpoint, b.uri)
-	var resolveResp response
+
+	ctx, span := tracing.Start(ctx, "HTTP POST", trace.SpanKindClient,
+		attribute.String("http.method", "POST"),
+		attribute.String("http.url", endpoint),
+	)
+	defer func() {
+		tracing.SetError(span, err)
+		span.End()
+	}()
 
 	bb, err := json.Marshal(v)
 	if err != nil {
 		return resolveResp, errors.Wrap(err, "marshal request error")
 	}
 
+	exchange := upstream.Exchange{URL: endpoint, RequestBody: bb}
+	defer func() {
+		upstream.Record(ctx, exchange)
+	}()
+
 	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(bb))
 	if err != nil {
 		return resolveResp, errors.Wrap(err, "new request error")
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	tracing.Inject(ctx, req.Header)
+	if id, ok := logging.RequestIDFromContext(ctx); ok {
+		req.Header.Set(logging.RequestIDHeader, id)
+	}
 	req.Header.Set("Ocp-Apim-Subscription-Key", b.token)
 
 	reqCTX, cancel := context.WithTimeout(ctx, b.requestTimeout)
@@ -169,14 +238,49 @@ func (b *Backend) loRaCloudAPIRequest(ctx context.Context, endpoint string, v in
 
 	defer resp.Body.Close()
 
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	exchange.StatusCode = resp.StatusCode
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resolveResp, errors.Wrap(err, "read response error")
+	}
+	exchange.ResponseBody = body
+
 	if resp.StatusCode != http.StatusOK {
-		bb, _ := ioutil.ReadAll(resp.Body)
-		return resolveResp, fmt.Errorf("expected 200, got: %d (%s)", resp.StatusCode, string(bb))
+		return resolveResp, fmt.Errorf("expected 200, got: %d (%s)", resp.StatusCode, string(body))
 	}
 
-	if err = json.NewDecoder(resp.Body).Decode(&resolveResp); err != nil {
+	if err = json.Unmarshal(body, &resolveResp); err != nil {
 		return resolveResp, errors.Wrap(err, "unmarshal response error")
 	}
 
 	return resolveResp, nil
 }
+
+// Probe checks if the LoRa Cloud API is reachable and accepts the configured
+// credentials. As the probe does not send a valid request, any HTTP response
+// below 500 is considered healthy, except for 401 and 403 (e.g. a revoked or
+// invalid token).
+func (b *Backend) Probe(ctx context.Context) error {
+	req, err := http.NewRequest("GET", fmt.Sprintf(tdoaEndpoint, b.uri), nil)
+	if err != nil {
+		return errors.Wrap(err, "new request error")
+	}
+	req.Header.Set("Ocp-Apim-Subscription-Key", b.token)
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "http request error")
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("unauthorized, status: %d", resp.StatusCode)
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+
+	return nil
+}
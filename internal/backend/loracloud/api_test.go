@@ -13,7 +13,12 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
+	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/upstream"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/logging"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/tracing"
 	"github.com/brocaar/chirpstack-api/go/v3/common"
 	"github.com/brocaar/chirpstack-api/go/v3/geo"
 	"github.com/brocaar/chirpstack-api/go/v3/gw"
@@ -24,6 +29,7 @@ type LoRaCloudTestSuite struct {
 
 	apiResponse string
 	apiRequest  string
+	apiHeader   http.Header
 	apiServer   *httptest.Server
 
 	client geo.GeolocationServerServiceServer
@@ -342,15 +348,149 @@ func (ts *LoRaCloudTestSuite) TestResolveMultiFrameTDOA() {
 	}
 }
 
+func (ts *LoRaCloudTestSuite) TestTracing() {
+	assert := require.New(ts.T())
+
+	ts.apiResponse = `{"result": {"latitude": 1.1, "longitude": 1.2, "altitude": 1.3, "accuracy": 4.5}}`
+
+	sr := tracetest.NewSpanRecorder()
+	tracing.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+
+	nowPB := ptypes.TimestampNow()
+	rxInfo := gw.UplinkRXInfo{
+		GatewayId:         []byte{1, 1, 1, 1, 1, 1, 1, 1},
+		Location:          &common.Location{Latitude: 1.1, Longitude: 1.2},
+		FineTimestampType: gw.FineTimestampType_PLAIN,
+		FineTimestamp: &gw.UplinkRXInfo_PlainFineTimestamp{
+			PlainFineTimestamp: &gw.PlainFineTimestamp{Time: nowPB},
+		},
+	}
+
+	h := make(http.Header)
+	h.Set(tracing.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := tracing.Extract(context.Background(), h)
+	_, err := ts.client.ResolveTDOA(ctx, &geo.ResolveTDOARequest{
+		DevEui: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		FrameRxInfo: &geo.FrameRXInfo{
+			// the second gateway is ignored as it has no location
+			RxInfo: []*gw.UplinkRXInfo{&rxInfo, {GatewayId: []byte{2, 2, 2, 2, 2, 2, 2, 2}}},
+		},
+	})
+	assert.NoError(err)
+
+	traceparent := ts.apiHeader.Get(tracing.TraceparentHeader)
+	assert.Regexp("^00-4bf92f3577b34da6a3ce929d0e0e4736-[0-9a-f]{16}-01$", traceparent)
+
+	assert.NoError(tracing.Close())
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range sr.Ended() {
+		spans[s.Name()] = s
+	}
+	assert.Len(spans, 3)
+
+	attrs := func(s sdktrace.ReadOnlySpan) map[string]interface{} {
+		out := make(map[string]interface{})
+		for _, a := range s.Attributes() {
+			out[string(a.Key)] = a.Value.AsInterface()
+		}
+		return out
+	}
+
+	assert.Equal(map[string]interface{}{
+		"geo.backend":       "lora_cloud",
+		"geo.dev_eui":       "0102030405060708",
+		"geo.gateway_count": int64(2),
+	}, attrs(spans["lora_cloud.ResolveTDOA"]))
+	assert.Equal(map[string]interface{}{
+		"geo.gateway_count_used": int64(1),
+	}, attrs(spans["lora_cloud.preprocess"]))
+	assert.Equal(int64(http.StatusOK), attrs(spans["HTTP POST"])["http.status_code"])
+	assert.Equal("00-4bf92f3577b34da6a3ce929d0e0e4736-"+spans["HTTP POST"].SpanContext().SpanID().String()+"-01", traceparent)
+	assert.Equal(spans["lora_cloud.ResolveTDOA"].SpanContext().SpanID(), spans["HTTP POST"].Parent().SpanID())
+}
+
+func (ts *LoRaCloudTestSuite) TestRequestID() {
+	assert := require.New(ts.T())
+
+	ts.apiResponse = `{"result": {"latitude": 1.1, "longitude": 1.2, "altitude": 1.3, "accuracy": 4.5}}`
+
+	ctx := logging.NewContext(context.Background(), "req-123")
+	_, err := ts.client.ResolveTDOA(ctx, &geo.ResolveTDOARequest{
+		DevEui: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		FrameRxInfo: &geo.FrameRXInfo{
+			RxInfo: []*gw.UplinkRXInfo{},
+		},
+	})
+	assert.NoError(err)
+	assert.Equal("req-123", ts.apiHeader.Get(logging.RequestIDHeader))
+}
+
+func (ts *LoRaCloudTestSuite) TestUpstreamRecord() {
+	assert := require.New(ts.T())
+
+	ts.apiResponse = `{"result": {"latitude": 1.1, "longitude": 1.2, "altitude": 1.3, "accuracy": 4.5}}`
+
+	ctx, rec := upstream.NewContext(context.Background())
+	_, err := ts.client.ResolveTDOA(ctx, &geo.ResolveTDOARequest{
+		DevEui: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		FrameRxInfo: &geo.FrameRXInfo{
+			RxInfo: []*gw.UplinkRXInfo{},
+		},
+	})
+	assert.NoError(err)
+
+	exchanges := rec.Exchanges()
+	assert.Len(exchanges, 1)
+	assert.Equal(ts.apiServer.URL+"/api/v2/tdoa", exchanges[0].URL)
+	assert.Equal(http.StatusOK, exchanges[0].StatusCode)
+	assert.JSONEq(`{"lorawan": null}`, string(exchanges[0].RequestBody))
+	assert.JSONEq(ts.apiResponse, string(exchanges[0].ResponseBody))
+}
+
 func (ts *LoRaCloudTestSuite) apiHandler(w http.ResponseWriter, r *http.Request) {
 	b, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		panic(err)
 	}
 	ts.apiRequest = string(b)
+	ts.apiHeader = r.Header
 	w.Write([]byte(ts.apiResponse))
 }
 
+func TestProbe(t *testing.T) {
+	testTable := []struct {
+		Status        int
+		ExpectedError string
+	}{
+		{Status: http.StatusBadRequest},
+		{Status: http.StatusMethodNotAllowed},
+		{Status: http.StatusUnauthorized, ExpectedError: "unauthorized, status: 401"},
+		{Status: http.StatusForbidden, ExpectedError: "unauthorized, status: 403"},
+		{Status: http.StatusServiceUnavailable, ExpectedError: "unexpected status: 503"},
+	}
+
+	for _, tst := range testTable {
+		t.Run(http.StatusText(tst.Status), func(t *testing.T) {
+			assert := require.New(t)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tst.Status)
+			}))
+			defer server.Close()
+
+			b := Backend{uri: server.URL, token: "token"}
+
+			err := b.Probe(context.Background())
+			if tst.ExpectedError == "" {
+				assert.NoError(err)
+			} else {
+				assert.EqualError(err, tst.ExpectedError)
+			}
+		})
+	}
+}
+
 func TestLoRaCloud(t *testing.T) {
 	suite.Run(t, new(LoRaCloudTestSuite))
 }
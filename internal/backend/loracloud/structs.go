@@ -1,6 +1,7 @@
 package loracloud
 
 import (
+	"context"
 	"errors"
 
 	"github.com/golang/protobuf/ptypes"
@@ -8,6 +9,8 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 
+	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/quality"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/logging"
 	"github.com/brocaar/chirpstack-api/go/v3/geo"
 	"github.com/brocaar/chirpstack-api/go/v3/gw"
 	"github.com/brocaar/lorawan"
@@ -21,6 +24,15 @@ type tdoaMultiFrameRequest struct {
 	LoRaWAN [][]loRaWANRX `json:"lorawan"`
 }
 
+// gatewayCount returns the total number of gateway receptions.
+func (r tdoaMultiFrameRequest) gatewayCount() int {
+	var out int
+	for _, lw := range r.LoRaWAN {
+		out += len(lw)
+	}
+	return out
+}
+
 type loRaWANRX struct {
 	GatewayID       string          `json:"gatewayId"`
 	AntennaID       int             `json:"antennaId"`
@@ -55,7 +67,7 @@ type result struct {
 const tdoaEndpoint = `%s/api/v2/tdoa`
 const tdoaMultiFrameEndpoint = `%s/api/v2/tdoaMultiframe`
 
-func resolveTDOARequestToLoRaCloudRequest(req *geo.ResolveTDOARequest) (tdoaRequest, error) {
+func resolveTDOARequestToLoRaCloudRequest(ctx context.Context, req *geo.ResolveTDOARequest) (tdoaRequest, error) {
 	var tdoaReq tdoaRequest
 	var err error
 
@@ -66,7 +78,7 @@ func resolveTDOARequestToLoRaCloudRequest(req *geo.ResolveTDOARequest) (tdoaRequ
 	var devEUI lorawan.EUI64
 	copy(devEUI[:], req.DevEui)
 
-	tdoaReq.LoRaWAN, err = rxInfoToLoRaCloud(devEUI, req.FrameRxInfo.RxInfo)
+	tdoaReq.LoRaWAN, err = rxInfoToLoRaCloud(ctx, devEUI, req.FrameRxInfo.RxInfo)
 	if err != nil {
 		return tdoaReq, err
 	}
@@ -74,14 +86,14 @@ func resolveTDOARequestToLoRaCloudRequest(req *geo.ResolveTDOARequest) (tdoaRequ
 	return tdoaReq, nil
 }
 
-func resolveMutiFrameTDOARequestToLoRaCloudRequest(req *geo.ResolveMultiFrameTDOARequest) (tdoaMultiFrameRequest, error) {
+func resolveMutiFrameTDOARequestToLoRaCloudRequest(ctx context.Context, req *geo.ResolveMultiFrameTDOARequest) (tdoaMultiFrameRequest, error) {
 	var tdoaReq tdoaMultiFrameRequest
 
 	var devEUI lorawan.EUI64
 	copy(devEUI[:], req.DevEui)
 
 	for _, frame := range req.FrameRxInfoSet {
-		lw, err := rxInfoToLoRaCloud(devEUI, frame.RxInfo)
+		lw, err := rxInfoToLoRaCloud(ctx, devEUI, frame.RxInfo)
 		if err != nil {
 			return tdoaReq, err
 		}
@@ -92,7 +104,7 @@ func resolveMutiFrameTDOARequestToLoRaCloudRequest(req *geo.ResolveMultiFrameTDO
 	return tdoaReq, nil
 }
 
-func rxInfoToLoRaCloud(devEUI lorawan.EUI64, rxInfo []*gw.UplinkRXInfo) ([]loRaWANRX, error) {
+func rxInfoToLoRaCloud(ctx context.Context, devEUI lorawan.EUI64, rxInfo []*gw.UplinkRXInfo) ([]loRaWANRX, error) {
 	var out []loRaWANRX
 
 	for _, rxInfo := range rxInfo {
@@ -100,19 +112,21 @@ func rxInfoToLoRaCloud(devEUI lorawan.EUI64, rxInfo []*gw.UplinkRXInfo) ([]loRaW
 		copy(gatewayID[:], rxInfo.GatewayId)
 
 		if rxInfo.Location == nil {
-			log.WithFields(log.Fields{
+			logging.FromContext(ctx).WithFields(log.Fields{
 				"dev_eui":    devEUI,
 				"gateway_id": gatewayID,
 			}).Warning("location is nil, ignoring gateway")
+			quality.GatewaySkipped(backendName, quality.ReasonNoLocation)
 			continue
 		}
 
 		if rxInfo.FineTimestampType == gw.FineTimestampType_NONE {
-			log.WithFields(log.Fields{
+			logging.FromContext(ctx).WithFields(log.Fields{
 				"dev_eui":             devEUI,
 				"fine_timestamp_type": rxInfo.FineTimestampType,
 				"gateway_id":          gatewayID,
 			}).Warning("unsupported fine-typestamp type")
+			quality.GatewaySkipped(backendName, quality.ReasonNoFineTimestamp)
 			continue
 		}
 
@@ -130,10 +144,11 @@ func rxInfoToLoRaCloud(devEUI lorawan.EUI64, rxInfo []*gw.UplinkRXInfo) ([]loRaW
 		if rxInfo.FineTimestampType == gw.FineTimestampType_PLAIN {
 			plainTS := rxInfo.GetPlainFineTimestamp()
 			if plainTS == nil {
-				log.WithFields(log.Fields{
+				logging.FromContext(ctx).WithFields(log.Fields{
 					"dev_eui":    devEUI,
 					"gateway_id": gatewayID,
 				}).Warning("plain_fine_timestamp must not be nil")
+				quality.GatewaySkipped(backendName, quality.ReasonNilTimestamp)
 				continue
 			}
 
@@ -146,6 +161,13 @@ func rxInfoToLoRaCloud(devEUI lorawan.EUI64, rxInfo []*gw.UplinkRXInfo) ([]loRaW
 			rx.GatewayID = gatewayID.String()
 
 			out = append(out, rx)
+		} else {
+			logging.FromContext(ctx).WithFields(log.Fields{
+				"dev_eui":             devEUI,
+				"fine_timestamp_type": rxInfo.FineTimestampType,
+				"gateway_id":          gatewayID,
+			}).Warning("unsupported fine-typestamp type")
+			quality.GatewaySkipped(backendName, quality.ReasonUnsupportedFineTimestamp)
 		}
 	}
 
@@ -0,0 +1,273 @@
+package plausibility
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/brocaar/chirpstack-api/go/v3/geo"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/helpers"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/logging"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/profile"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/storage"
+	"github.com/brocaar/lorawan"
+)
+
+// Actions.
+const (
+	ActionReject       = "reject"
+	ActionLastLocation = "last_location"
+	ActionFlag         = "flag"
+)
+
+// Reasons.
+const (
+	reasonMaxSpeed = "max_speed"
+	reasonRegion   = "region"
+)
+
+// fix holds the last accepted location of a device and the time at which
+// it was accepted.
+type fix struct {
+	time   time.Time
+	seen   time.Time
+	result *geo.ResolveResult
+}
+
+// State holds the last accepted location of the devices. A State can be
+// shared by subsequent backends, such that the state is kept when the
+// backend is re-created on a configuration reload.
+type State struct {
+	mu        sync.Mutex
+	fixes     map[lorawan.EUI64]fix
+	lastSweep time.Time
+}
+
+// NewState creates a new (empty) State.
+func NewState() *State {
+	return &State{
+		fixes: make(map[lorawan.EUI64]fix),
+	}
+}
+
+// Backend implements a backend which checks the plausibility of each
+// resolved location against the previous accepted location.
+type Backend struct {
+	backend      geo.GeolocationServerServiceServer
+	profiles     *profile.Profiles
+	action       string
+	region       *storage.BoundingBox
+	stateTimeout time.Duration
+	state        *State
+}
+
+// NewBackend creates a new plausibility backend, wrapping the given backend.
+func NewBackend(b geo.GeolocationServerServiceServer, c config.Config) (geo.GeolocationServerServiceServer, error) {
+	return NewBackendWithState(b, c, NewState())
+}
+
+// NewBackendWithState creates a new plausibility backend, wrapping the
+// given backend and using the given State.
+func NewBackendWithState(b geo.GeolocationServerServiceServer, c config.Config, s *State) (geo.GeolocationServerServiceServer, error) {
+	if b == nil {
+		return nil, errors.New("the given backend must not be nil")
+	}
+
+	if s == nil {
+		return nil, errors.New("the given state must not be nil")
+	}
+
+	conf := c.GeoServer.Plausibility
+
+	switch conf.Action {
+	case ActionReject, ActionLastLocation, ActionFlag:
+	default:
+		return nil, fmt.Errorf("invalid action: %s", conf.Action)
+	}
+
+	profiles, err := profile.New(c)
+	if err != nil {
+		return nil, errors.Wrap(err, "load device profiles error")
+	}
+
+	backend := Backend{
+		backend:      b,
+		profiles:     profiles,
+		action:       conf.Action,
+		stateTimeout: conf.StateTimeout,
+		state:        s,
+	}
+
+	if r := conf.AllowedRegion; r.MinLatitude != 0 || r.MinLongitude != 0 || r.MaxLatitude != 0 || r.MaxLongitude != 0 {
+		backend.region = &storage.BoundingBox{
+			MinLatitude:  r.MinLatitude,
+			MinLongitude: r.MinLongitude,
+			MaxLatitude:  r.MaxLatitude,
+			MaxLongitude: r.MaxLongitude,
+		}
+	}
+
+	return &backend, nil
+}
+
+// ResolveTDOA resolves the location based on TDOA.
+func (b *Backend) ResolveTDOA(ctx context.Context, req *geo.ResolveTDOARequest) (*geo.ResolveTDOAResponse, error) {
+	resp, err := b.backend.ResolveTDOA(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := b.check(ctx, req.DevEui, []*geo.FrameRXInfo{req.FrameRxInfo}, resp.Result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &geo.ResolveTDOAResponse{
+		Result: res,
+	}, nil
+}
+
+// ResolveMultiFrameTDOA resolves the location using TDOA, based on
+// multiple frames.
+func (b *Backend) ResolveMultiFrameTDOA(ctx context.Context, req *geo.ResolveMultiFrameTDOARequest) (*geo.ResolveMultiFrameTDOAResponse, error) {
+	resp, err := b.backend.ResolveMultiFrameTDOA(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := b.check(ctx, req.DevEui, req.FrameRxInfoSet, resp.Result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &geo.ResolveMultiFrameTDOAResponse{
+		Result: res,
+	}, nil
+}
+
+// check validates the given result against the previous accepted location
+// and returns the result to use, based on the configured action.
+func (b *Backend) check(ctx context.Context, devEUIB []byte, frames []*geo.FrameRXInfo, res *geo.ResolveResult) (*geo.ResolveResult, error) {
+	if res == nil || res.Location == nil {
+		return res, nil
+	}
+
+	var devEUI lorawan.EUI64
+	copy(devEUI[:], devEUIB)
+
+	t := helpers.GetFrameTime(frames)
+	now := time.Now()
+
+	b.state.mu.Lock()
+	defer b.state.mu.Unlock()
+
+	b.sweep(now)
+
+	// a fix which has expired is not used, as the device might have moved
+	// anywhere in the meantime
+	prev, hasPrev := b.state.fixes[devEUI]
+	if hasPrev && b.expired(prev, now) {
+		delete(b.state.fixes, devEUI)
+		prev, hasPrev = fix{}, false
+	}
+
+	reason, details := b.validate(devEUI, t, prev, hasPrev, res)
+
+	if reason == "" {
+		b.state.fixes[devEUI] = fix{time: t, seen: now, result: res}
+		return res, nil
+	}
+
+	implausibleCounter(reason, b.action).Inc()
+
+	logFields := log.Fields{
+		"dev_eui":   devEUI,
+		"reason":    reason,
+		"action":    b.action,
+		"latitude":  res.Location.Latitude,
+		"longitude": res.Location.Longitude,
+		"accuracy":  res.Location.Accuracy,
+	}
+	for k, v := range details {
+		logFields[k] = v
+	}
+	logging.FromContext(ctx).WithFields(logFields).Warning("backend/plausibility: implausible location")
+
+	switch b.action {
+	case ActionLastLocation:
+		if !hasPrev {
+			return nil, grpc.Errorf(codes.FailedPrecondition, "implausible location (%s) and no previous location available", reason)
+		}
+		return proto.Clone(prev.result).(*geo.ResolveResult), nil
+	case ActionFlag:
+		return res, nil
+	default:
+		return nil, grpc.Errorf(codes.FailedPrecondition, "implausible location (%s)", reason)
+	}
+}
+
+// validate returns the reason why the given result is implausible, or an
+// empty string when the result is plausible.
+func (b *Backend) validate(devEUI lorawan.EUI64, t time.Time, prev fix, hasPrev bool, res *geo.ResolveResult) (string, log.Fields) {
+	loc := res.Location
+
+	if b.region != nil && !b.region.Contains(storage.Location{Latitude: loc.Latitude, Longitude: loc.Longitude}) {
+		return reasonRegion, nil
+	}
+
+	maxSpeed := b.profiles.Get(devEUI).MaxSpeed
+	if !hasPrev || maxSpeed == 0 {
+		return "", nil
+	}
+
+	dt := t.Sub(prev.time).Seconds()
+	if dt <= 0 {
+		return "", nil
+	}
+
+	// the accuracy of both locations is subtracted from the distance, so
+	// that the jitter of a (nearly) stationary device is not considered
+	// as movement
+	prevLoc := prev.result.Location
+	dist := storage.Distance(prevLoc.Latitude, prevLoc.Longitude, loc.Latitude, loc.Longitude)
+	dist = math.Max(0, dist-float64(prevLoc.Accuracy)-float64(loc.Accuracy))
+
+	if speed := dist / dt; speed > maxSpeed {
+		return reasonMaxSpeed, log.Fields{
+			"speed":     speed,
+			"max_speed": maxSpeed,
+		}
+	}
+
+	return "", nil
+}
+
+// expired returns true when the given fix is older than the state timeout.
+func (b *Backend) expired(f fix, now time.Time) bool {
+	return b.stateTimeout != 0 && now.Sub(f.seen) > b.stateTimeout
+}
+
+// sweep removes the expired fixes. To keep the cost per request low, this
+// is done at most once per state timeout. It must be called with the lock
+// held.
+func (b *Backend) sweep(now time.Time) {
+	if b.stateTimeout == 0 || now.Sub(b.state.lastSweep) < b.stateTimeout {
+		return
+	}
+	b.state.lastSweep = now
+
+	for devEUI, f := range b.state.fixes {
+		if b.expired(f, now) {
+			delete(b.state.fixes, devEUI)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package plausibility
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/geo"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+type testBackend struct {
+	location common.Location
+}
+
+func (b *testBackend) ResolveTDOA(ctx context.Context, req *geo.ResolveTDOARequest) (*geo.ResolveTDOAResponse, error) {
+	loc := b.location
+	return &geo.ResolveTDOAResponse{
+		Result: &geo.ResolveResult{
+			Location: &loc,
+		},
+	}, nil
+}
+
+func (b *testBackend) ResolveMultiFrameTDOA(ctx context.Context, req *geo.ResolveMultiFrameTDOARequest) (*geo.ResolveMultiFrameTDOAResponse, error) {
+	loc := b.location
+	return &geo.ResolveMultiFrameTDOAResponse{
+		Result: &geo.ResolveResult{
+			Location: &loc,
+		},
+	}, nil
+}
+
+func float64Ptr(f float64) *float64 {
+	return &f
+}
+
+func TestBackend(t *testing.T) {
+	log.SetLevel(log.ErrorLevel)
+
+	start := time.Now().UTC()
+
+	// ~1112m north of the first location
+	first := common.Location{Latitude: 52.0, Longitude: 5.0, Accuracy: 50}
+	second := common.Location{Latitude: 52.01, Longitude: 5.0, Accuracy: 50}
+
+	testTable := []struct {
+		Name          string
+		Action        string
+		MaxSpeed      float64
+		ProfileSpeed  *float64
+		Interval      time.Duration
+		Second        common.Location
+		ExpectedError error
+		Expected      *common.Location
+	}{
+		{
+			Name:     "plausible speed",
+			Action:   ActionReject,
+			MaxSpeed: 10,
+			Interval: 2 * time.Minute,
+			Second:   second,
+			Expected: &second,
+		},
+		{
+			Name:          "implausible speed - reject",
+			Action:        ActionReject,
+			MaxSpeed:      10,
+			Interval:      time.Minute,
+			Second:        second,
+			ExpectedError: grpc.Errorf(codes.FailedPrecondition, "implausible location (max_speed)"),
+		},
+		{
+			Name:     "implausible speed - last location",
+			Action:   ActionLastLocation,
+			MaxSpeed: 10,
+			Interval: time.Minute,
+			Second:   second,
+			Expected: &first,
+		},
+		{
+			Name:     "implausible speed - flag",
+			Action:   ActionFlag,
+			MaxSpeed: 10,
+			Interval: time.Minute,
+			Second:   second,
+			Expected: &second,
+		},
+		{
+			Name:         "plausible speed using profile",
+			Action:       ActionReject,
+			MaxSpeed:     10,
+			ProfileSpeed: float64Ptr(50),
+			Interval:     time.Minute,
+			Second:       second,
+			Expected:     &second,
+		},
+		{
+			Name:         "max_speed disabled by profile",
+			Action:       ActionReject,
+			MaxSpeed:     10,
+			ProfileSpeed: float64Ptr(0),
+			Interval:     time.Minute,
+			Second:       second,
+			Expected:     &second,
+		},
+		{
+			Name:          "outside allowed region",
+			Action:        ActionReject,
+			Interval:      time.Minute,
+			Second:        common.Location{Latitude: 60, Longitude: 5},
+			ExpectedError: grpc.Errorf(codes.FailedPrecondition, "implausible location (region)"),
+		},
+	}
+
+	for _, tst := range testTable {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			var c config.Config
+			c.GeoServer.Plausibility.Action = tst.Action
+			c.GeoServer.Plausibility.MaxSpeed = tst.MaxSpeed
+			c.GeoServer.Plausibility.AllowedRegion.MinLatitude = 50
+			c.GeoServer.Plausibility.AllowedRegion.MinLongitude = 3
+			c.GeoServer.Plausibility.AllowedRegion.MaxLatitude = 54
+			c.GeoServer.Plausibility.AllowedRegion.MaxLongitude = 7
+			c.GeoServer.DeviceProfiles = []config.DeviceProfile{
+				{
+					Name:     "vehicle",
+					DevEUIs:  []string{"0102030405060708"},
+					MaxSpeed: tst.ProfileSpeed,
+				},
+			}
+
+			tb := testBackend{}
+			b, err := NewBackend(&tb, c)
+			assert.NoError(err)
+
+			var resp *geo.ResolveTDOAResponse
+			for i, loc := range []common.Location{first, tst.Second} {
+				ts, _ := ptypes.TimestampProto(start.Add(time.Duration(i) * tst.Interval))
+				tb.location = loc
+
+				resp, err = b.ResolveTDOA(context.Background(), &geo.ResolveTDOARequest{
+					DevEui: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+					FrameRxInfo: &geo.FrameRXInfo{
+						RxInfo: []*gw.UplinkRXInfo{
+							{Time: ts},
+						},
+					},
+				})
+			}
+
+			assert.Equal(tst.ExpectedError, err)
+			if tst.Expected != nil {
+				assert.Equal(tst.Expected, resp.Result.Location)
+			}
+		})
+	}
+
+	t.Run("state timeout", func(t *testing.T) {
+		assert := require.New(t)
+
+		var c config.Config
+		c.GeoServer.Plausibility.Action = ActionReject
+		c.GeoServer.Plausibility.MaxSpeed = 10
+		c.GeoServer.Plausibility.StateTimeout = time.Hour
+
+		req := func(devEUI []byte, t time.Time) *geo.ResolveTDOARequest {
+			ts, _ := ptypes.TimestampProto(t)
+			return &geo.ResolveTDOARequest{
+				DevEui: devEUI,
+				FrameRxInfo: &geo.FrameRXInfo{
+					RxInfo: []*gw.UplinkRXInfo{
+						{Time: ts},
+					},
+				},
+			}
+		}
+
+		tb := testBackend{location: first}
+		bi, err := NewBackend(&tb, c)
+		assert.NoError(err)
+		b := bi.(*Backend)
+
+		for _, devEUI := range [][]byte{{1, 2, 3, 4, 5, 6, 7, 8}, {8, 7, 6, 5, 4, 3, 2, 1}} {
+			_, err := b.ResolveTDOA(context.Background(), req(devEUI, start))
+			assert.NoError(err)
+		}
+		assert.Len(b.state.fixes, 2)
+
+		// the expired fix is not used for the max. speed check
+		devEUI := lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 1}
+		f := b.state.fixes[devEUI]
+		f.seen = time.Now().Add(-2 * time.Hour)
+		b.state.fixes[devEUI] = f
+
+		tb.location = second
+		resp, err := b.ResolveTDOA(context.Background(), req(devEUI[:], start.Add(time.Minute)))
+		assert.NoError(err)
+		assert.Equal(&second, resp.Result.Location)
+		assert.Len(b.state.fixes, 2)
+
+		// the sweep removes the expired fix of the first device
+		devEUI = lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+		f = b.state.fixes[devEUI]
+		f.seen = time.Now().Add(-2 * time.Hour)
+		b.state.fixes[devEUI] = f
+		b.state.lastSweep = time.Now().Add(-2 * time.Hour)
+
+		_, err = b.ResolveTDOA(context.Background(), req([]byte{8, 7, 6, 5, 4, 3, 2, 1}, start.Add(time.Hour)))
+		assert.NoError(err)
+		assert.Len(b.state.fixes, 1)
+		assert.NotContains(b.state.fixes, devEUI)
+	})
+}
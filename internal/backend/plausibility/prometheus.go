@@ -0,0 +1,17 @@
+package plausibility
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ic = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_plausibility_implausible_count",
+		Help: "The number of implausible locations (per reason and action).",
+	}, []string{"reason", "action"})
+)
+
+func implausibleCounter(reason, action string) prometheus.Counter {
+	return ic.With(prometheus.Labels{"reason": reason, "action": action})
+}
@@ -0,0 +1,30 @@
+package backend
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	rc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_reload_count",
+		Help: "The number of backend chain reloads (per result).",
+	}, []string{"result"})
+
+	resc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_resolve_count",
+		Help: "The number of resolve requests (per method and result: success or error). Use this to calculate the success ratio per method.",
+	}, []string{"method", "result"})
+)
+
+func reloadCounter(result string) prometheus.Counter {
+	return rc.With(prometheus.Labels{"result": result})
+}
+
+func resolveCounter(method string, err error) prometheus.Counter {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	return resc.With(prometheus.Labels{"method": method, "result": result})
+}
@@ -0,0 +1,145 @@
+package backend
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/brocaar/chirpstack-api/go/v3/geo"
+)
+
+// chain holds a backend chain and the backends within the chain that
+// must be closed when the chain is no longer used. It counts the in-flight
+// calls, such that a replaced chain is only closed once these have
+// completed.
+type chain struct {
+	backend  geo.GeolocationServerServiceServer
+	upstream geo.GeolocationServerServiceServer
+	closers  []io.Closer
+
+	mu       sync.Mutex
+	inFlight int
+	retired  bool
+	drained  chan struct{}
+}
+
+// acquire registers an in-flight call. It returns false when the chain has
+// been retired, in which case the call must not use the chain.
+func (c *chain) acquire() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.retired {
+		return false
+	}
+	c.inFlight++
+	return true
+}
+
+// release de-registers an in-flight call.
+func (c *chain) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.inFlight--
+	if c.retired && c.inFlight == 0 {
+		close(c.drained)
+	}
+}
+
+// retire marks the chain as replaced. It returns a channel which is closed
+// once all in-flight calls have completed.
+func (c *chain) retire() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.retired {
+		c.retired = true
+		c.drained = make(chan struct{})
+		if c.inFlight == 0 {
+			close(c.drained)
+		}
+	}
+	return c.drained
+}
+
+func (c *chain) addCloser(b geo.GeolocationServerServiceServer) {
+	if cl, ok := b.(io.Closer); ok {
+		c.closers = append(c.closers, cl)
+	}
+}
+
+// close closes the backends, in the reverse order in which they were
+// created.
+func (c *chain) close() {
+	for i := len(c.closers) - 1; i >= 0; i-- {
+		if err := c.closers[i].Close(); err != nil {
+			log.WithError(err).Error("backend: close backend error")
+		}
+	}
+}
+
+// proxy implements a backend which forwards all calls to the current
+// backend chain. This makes it possible to replace the chain, without
+// re-registering the gRPC service.
+type proxy struct {
+	chain atomic.Value
+}
+
+// swap sets the current chain and returns the previous one.
+func (p *proxy) swap(ch *chain) *chain {
+	prev, _ := p.chain.Load().(*chain)
+	p.chain.Store(ch)
+	return prev
+}
+
+// get returns the current chain, with the call registered as in-flight.
+// The caller must release the chain when the call has completed.
+func (p *proxy) get() (*chain, error) {
+	for {
+		ch, _ := p.chain.Load().(*chain)
+		if ch == nil {
+			return nil, grpc.Errorf(codes.Unavailable, "backend is not available")
+		}
+
+		// when the chain was retired in the meantime, the new chain has
+		// already been stored
+		if ch.acquire() {
+			return ch, nil
+		}
+	}
+}
+
+// ResolveTDOA resolves the location based on TDOA.
+func (p *proxy) ResolveTDOA(ctx context.Context, req *geo.ResolveTDOARequest) (*geo.ResolveTDOAResponse, error) {
+	ch, err := p.get()
+	if err != nil {
+		resolveCounter("ResolveTDOA", err).Inc()
+		return nil, err
+	}
+	defer ch.release()
+
+	resp, err := ch.backend.ResolveTDOA(ctx, req)
+	resolveCounter("ResolveTDOA", err).Inc()
+	return resp, err
+}
+
+// ResolveMultiFrameTDOA resolves the location using TDOA, based on
+// multiple frames.
+func (p *proxy) ResolveMultiFrameTDOA(ctx context.Context, req *geo.ResolveMultiFrameTDOARequest) (*geo.ResolveMultiFrameTDOAResponse, error) {
+	ch, err := p.get()
+	if err != nil {
+		resolveCounter("ResolveMultiFrameTDOA", err).Inc()
+		return nil, err
+	}
+	defer ch.release()
+
+	resp, err := ch.backend.ResolveMultiFrameTDOA(ctx, req)
+	resolveCounter("ResolveMultiFrameTDOA", err).Inc()
+	return resp, err
+}
@@ -0,0 +1,125 @@
+package publisher
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
+
+	"github.com/brocaar/chirpstack-api/go/v3/geo"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-geolocation-server/api/integration"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/helpers"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/integration/models"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/logging"
+	"github.com/brocaar/lorawan"
+)
+
+// Backend implements a backend which publishes each resolved location
+// as LocationEvent to the integration.
+type Backend struct {
+	backend     geo.GeolocationServerServiceServer
+	integration models.Integrator
+	backendType string
+}
+
+// NewBackend creates a new publisher backend, wrapping the given backend.
+// Location events are sent to the given integration, which must not block.
+func NewBackend(b geo.GeolocationServerServiceServer, i models.Integrator, c config.Config) (geo.GeolocationServerServiceServer, error) {
+	if b == nil {
+		return nil, errors.New("the given backend must not be nil")
+	}
+
+	if i == nil {
+		return nil, errors.New("the given integration must not be nil")
+	}
+
+	return &Backend{
+		backend:     b,
+		integration: i,
+		backendType: c.GeoServer.Backend.Type,
+	}, nil
+}
+
+// ResolveTDOA resolves the location based on TDOA.
+func (b *Backend) ResolveTDOA(ctx context.Context, req *geo.ResolveTDOARequest) (*geo.ResolveTDOAResponse, error) {
+	resp, err := b.backend.ResolveTDOA(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	b.publish(ctx, req.DevEui, []*geo.FrameRXInfo{req.FrameRxInfo}, resp.Result)
+
+	return resp, nil
+}
+
+// ResolveMultiFrameTDOA resolves the location using TDOA, based on
+// multiple frames.
+func (b *Backend) ResolveMultiFrameTDOA(ctx context.Context, req *geo.ResolveMultiFrameTDOARequest) (*geo.ResolveMultiFrameTDOAResponse, error) {
+	resp, err := b.backend.ResolveMultiFrameTDOA(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	b.publish(ctx, req.DevEui, req.FrameRxInfoSet, resp.Result)
+
+	return resp, nil
+}
+
+func (b *Backend) publish(ctx context.Context, devEUIB []byte, frames []*geo.FrameRXInfo, res *geo.ResolveResult) {
+	if res == nil || res.Location == nil {
+		return
+	}
+
+	var devEUI lorawan.EUI64
+	copy(devEUI[:], devEUIB)
+
+	pl := integration.LocationEvent{
+		DevEui:     devEUI[:],
+		Backend:    b.backendType,
+		FrameCount: uint32(len(frames)),
+		Location: &integration.Location{
+			Latitude:  res.Location.Latitude,
+			Longitude: res.Location.Longitude,
+			Altitude:  res.Location.Altitude,
+			Accuracy:  res.Location.Accuracy,
+		},
+	}
+
+	var err error
+	if pl.Time, err = ptypes.TimestampProto(helpers.GetFrameTime(frames)); err != nil {
+		logging.FromContext(ctx).WithError(err).Error("backend/publisher: timestamp proto error")
+	}
+
+	for i, frame := range frames {
+		if frame == nil {
+			continue
+		}
+
+		for _, rxInfo := range frame.RxInfo {
+			gwRX := integration.GatewayRXInfo{
+				GatewayId:     rxInfo.GatewayId,
+				Frame:         uint32(i),
+				Rssi:          rxInfo.Rssi,
+				LoraSnr:       rxInfo.LoraSnr,
+				FineTimestamp: rxInfo.FineTimestampType != gw.FineTimestampType_NONE,
+			}
+
+			if rxInfo.Location != nil {
+				gwRX.Location = &integration.Location{
+					Latitude:  rxInfo.Location.Latitude,
+					Longitude: rxInfo.Location.Longitude,
+					Altitude:  rxInfo.Location.Altitude,
+					Accuracy:  rxInfo.Location.Accuracy,
+				}
+			}
+
+			pl.RxInfo = append(pl.RxInfo, &gwRX)
+		}
+	}
+
+	if err := b.integration.SendLocationEvent(ctx, pl); err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("dev_eui", devEUI).Error("backend/publisher: send location event error")
+	}
+}
@@ -0,0 +1,46 @@
+package quality
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ah = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "backend_location_accuracy_meters",
+		Help:    "The accuracy of the resolved locations (per backend).",
+		Buckets: []float64{10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000},
+	}, []string{"backend"})
+
+	gh = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "backend_gateway_count",
+		Help:    "The number of gateways per request (per backend and stage: offered, usable or used).",
+		Buckets: []float64{0, 1, 2, 3, 4, 5, 6, 8, 10, 15, 20, 30},
+	}, []string{"backend", "stage"})
+
+	sc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_gateway_skipped_count",
+		Help: "The number of gateways skipped during pre-processing (per backend and reason).",
+	}, []string{"backend", "reason"})
+
+	mc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_upstream_message_count",
+		Help: "The number of warnings and errors returned by the upstream service (per backend, type and class).",
+	}, []string{"backend", "type", "class"})
+)
+
+func accuracyHistogram(backend string) prometheus.Observer {
+	return ah.With(prometheus.Labels{"backend": backend})
+}
+
+func gatewayHistogram(backend, stage string) prometheus.Observer {
+	return gh.With(prometheus.Labels{"backend": backend, "stage": stage})
+}
+
+func skippedCounter(backend, reason string) prometheus.Counter {
+	return sc.With(prometheus.Labels{"backend": backend, "reason": reason})
+}
+
+func messageCounter(backend, typ, class string) prometheus.Counter {
+	return mc.With(prometheus.Labels{"backend": backend, "type": typ, "class": class})
+}
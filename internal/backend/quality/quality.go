@@ -0,0 +1,83 @@
+// Package quality exports the metrics about the geolocation quality of the
+// upstream backends, e.g. the reported accuracy and the number of gateways
+// used to resolve the location.
+package quality
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Gateway skip reasons.
+const (
+	ReasonNoLocation               = "no_location"
+	ReasonNoFineTimestamp          = "no_fine_timestamp"
+	ReasonNilTimestamp             = "nil_timestamp"
+	ReasonNoFPGAID                 = "no_fpga_id"
+	ReasonUnsupportedFineTimestamp = "unsupported_fine_timestamp"
+)
+
+// Upstream message types.
+const (
+	MessageWarning = "warning"
+	MessageError   = "error"
+)
+
+// maxClassLength limits the length of the message class, to limit the
+// cardinality of the message metric.
+const maxClassLength = 64
+
+var (
+	variableRegexp   = regexp.MustCompile(`\b(0x[0-9a-f]+|[0-9a-f]*[0-9][0-9a-f.]*)\b`)
+	quotedRegexp     = regexp.MustCompile(`'[^']*'|"[^"]*"`)
+	whitespaceRegexp = regexp.MustCompile(`\s+`)
+)
+
+// Class returns the class of the given upstream warning or error message.
+// Variable parts (numbers, IDs and quoted values) are replaced by '#',
+// such that messages of the same kind share the same class.
+func Class(msg string) string {
+	s := strings.ToLower(msg)
+	s = quotedRegexp.ReplaceAllString(s, "#")
+	s = variableRegexp.ReplaceAllString(s, "#")
+	s = strings.TrimSpace(whitespaceRegexp.ReplaceAllString(s, " "))
+
+	if len(s) > maxClassLength {
+		s = s[:maxClassLength]
+	}
+
+	if s == "" {
+		return "unknown"
+	}
+
+	return s
+}
+
+// ObserveAccuracy observes the accuracy (in meters) of a location resolved
+// by the given backend.
+func ObserveAccuracy(backend string, accuracy float64) {
+	accuracyHistogram(backend).Observe(accuracy)
+}
+
+// ObserveGateways observes the number of gateways offered (part of the
+// request), usable (after pre-processing) and used (reported by the
+// upstream service) for a single request.
+func ObserveGateways(backend string, offered, usable, used int) {
+	gatewayHistogram(backend, "offered").Observe(float64(offered))
+	gatewayHistogram(backend, "usable").Observe(float64(usable))
+	gatewayHistogram(backend, "used").Observe(float64(used))
+}
+
+// GatewaySkipped counts a gateway which was skipped during pre-processing
+// for the given reason.
+func GatewaySkipped(backend, reason string) {
+	skippedCounter(backend, reason).Inc()
+}
+
+// ObserveMessages counts the given upstream warning or error messages by
+// their class.
+func ObserveMessages(backend, typ string, messages []string) {
+	for _, msg := range messages {
+		messageCounter(backend, typ, Class(msg)).Inc()
+	}
+}
@@ -0,0 +1,74 @@
+package quality
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClass(t *testing.T) {
+	tests := []struct {
+		Message  string
+		Expected string
+	}{
+		{
+			Message:  "Gateway 0102030405060708 has no location",
+			Expected: "gateway # has no location",
+		},
+		{
+			Message:  "Only 2 gateways   received the frame, at least 3 required",
+			Expected: "only # gateways received the frame, at least # required",
+		},
+		{
+			Message:  "TOA of 'gw-1' is 1.5 seconds off",
+			Expected: "toa of # is # seconds off",
+		},
+		{
+			Message:  "Antenna 0xdeadbeef is invalid",
+			Expected: "antenna # is invalid",
+		},
+		{
+			Message:  "",
+			Expected: "unknown",
+		},
+		{
+			Message:  "This is a very long message which exceeds the max. length of the message class",
+			Expected: "this is a very long message which exceeds the max. length of the",
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Message, func(t *testing.T) {
+			assert := require.New(t)
+			assert.Equal(tst.Expected, Class(tst.Message))
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	assert := require.New(t)
+
+	GatewaySkipped("test", ReasonNoLocation)
+	GatewaySkipped("test", ReasonNoLocation)
+	assert.Equal(2.0, testutil.ToFloat64(skippedCounter("test", ReasonNoLocation)))
+
+	ObserveMessages("test", MessageWarning, []string{"Gateway 01 is bad", "Gateway 02 is bad"})
+	assert.Equal(2.0, testutil.ToFloat64(messageCounter("test", MessageWarning, "gateway # is bad")))
+
+	ObserveGateways("test", 5, 4, 3)
+	for stage, expected := range map[string]float64{"offered": 5, "usable": 4, "used": 3} {
+		assert.Equal(expected, histogramSum(t, gatewayHistogram("test", stage)), stage)
+	}
+
+	ObserveAccuracy("test", 25)
+	assert.Equal(25.0, histogramSum(t, accuracyHistogram("test")))
+}
+
+func histogramSum(t *testing.T, o prometheus.Observer) float64 {
+	var m dto.Metric
+	require.NoError(t, o.(prometheus.Histogram).Write(&m))
+	return m.GetHistogram().GetSampleSum()
+}
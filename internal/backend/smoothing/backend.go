@@ -0,0 +1,161 @@
+package smoothing
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+
+	"github.com/brocaar/chirpstack-api/go/v3/geo"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/helpers"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/profile"
+	"github.com/brocaar/lorawan"
+)
+
+// deviceFilter holds the filter of a device and the time at which the
+// device was last seen.
+type deviceFilter struct {
+	filter *filter
+	seen   time.Time
+}
+
+// State holds the filter state of the devices. A State can be shared by
+// subsequent backends, such that the state is kept when the backend is
+// re-created on a configuration reload.
+type State struct {
+	mu        sync.Mutex
+	filters   map[lorawan.EUI64]*deviceFilter
+	lastSweep time.Time
+}
+
+// NewState creates a new (empty) State.
+func NewState() *State {
+	return &State{
+		filters: make(map[lorawan.EUI64]*deviceFilter),
+	}
+}
+
+// Backend implements a backend which smooths the resolved locations of
+// each device using a Kalman filter.
+type Backend struct {
+	backend      geo.GeolocationServerServiceServer
+	profiles     *profile.Profiles
+	stateTimeout time.Duration
+	state        *State
+}
+
+// NewBackend creates a new smoothing backend, wrapping the given backend.
+func NewBackend(b geo.GeolocationServerServiceServer, c config.Config) (geo.GeolocationServerServiceServer, error) {
+	return NewBackendWithState(b, c, NewState())
+}
+
+// NewBackendWithState creates a new smoothing backend, wrapping the given
+// backend and using the given State.
+func NewBackendWithState(b geo.GeolocationServerServiceServer, c config.Config, s *State) (geo.GeolocationServerServiceServer, error) {
+	if b == nil {
+		return nil, errors.New("the given backend must not be nil")
+	}
+
+	if s == nil {
+		return nil, errors.New("the given state must not be nil")
+	}
+
+	profiles, err := profile.New(c)
+	if err != nil {
+		return nil, errors.Wrap(err, "load device profiles error")
+	}
+
+	return &Backend{
+		backend:      b,
+		profiles:     profiles,
+		stateTimeout: c.GeoServer.Smoothing.StateTimeout,
+		state:        s,
+	}, nil
+}
+
+// ResolveTDOA resolves the location based on TDOA.
+func (b *Backend) ResolveTDOA(ctx context.Context, req *geo.ResolveTDOARequest) (*geo.ResolveTDOAResponse, error) {
+	resp, err := b.backend.ResolveTDOA(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &geo.ResolveTDOAResponse{
+		Result: b.smooth(req.DevEui, []*geo.FrameRXInfo{req.FrameRxInfo}, resp.Result),
+	}, nil
+}
+
+// ResolveMultiFrameTDOA resolves the location using TDOA, based on
+// multiple frames.
+func (b *Backend) ResolveMultiFrameTDOA(ctx context.Context, req *geo.ResolveMultiFrameTDOARequest) (*geo.ResolveMultiFrameTDOAResponse, error) {
+	resp, err := b.backend.ResolveMultiFrameTDOA(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &geo.ResolveMultiFrameTDOAResponse{
+		Result: b.smooth(req.DevEui, req.FrameRxInfoSet, resp.Result),
+	}, nil
+}
+
+// smooth applies the given result to the filter of the device and returns
+// the smoothed result.
+func (b *Backend) smooth(devEUIB []byte, frames []*geo.FrameRXInfo, res *geo.ResolveResult) *geo.ResolveResult {
+	if res == nil || res.Location == nil {
+		return res
+	}
+
+	var devEUI lorawan.EUI64
+	copy(devEUI[:], devEUIB)
+
+	t := helpers.GetFrameTime(frames)
+	loc := res.Location
+	prof := b.profiles.Get(devEUI)
+
+	now := time.Now()
+
+	b.state.mu.Lock()
+	defer b.state.mu.Unlock()
+
+	b.sweep(now)
+
+	df, ok := b.state.filters[devEUI]
+	if !ok || (b.stateTimeout != 0 && t.Sub(df.filter.time) > b.stateTimeout) {
+		df = &deviceFilter{
+			filter: newFilter(t, loc.Latitude, loc.Longitude, float64(loc.Accuracy)),
+		}
+		b.state.filters[devEUI] = df
+	} else {
+		df.filter.update(t, loc.Latitude, loc.Longitude, float64(loc.Accuracy), prof.SmoothingProcessNoise)
+	}
+	df.seen = now
+	f := df.filter
+
+	out := proto.Clone(res).(*geo.ResolveResult)
+	out.Location.Latitude = f.latitude
+	out.Location.Longitude = f.longitude
+	out.Location.Accuracy = uint32(math.Round(f.accuracy()))
+
+	return out
+}
+
+// sweep removes the filters of the devices which have not been seen within
+// the state timeout, as these would be reset anyway. To keep the cost per
+// request low, this is done at most once per state timeout. It must be
+// called with the lock held.
+func (b *Backend) sweep(now time.Time) {
+	if b.stateTimeout == 0 || now.Sub(b.state.lastSweep) < b.stateTimeout {
+		return
+	}
+	b.state.lastSweep = now
+
+	for devEUI, df := range b.state.filters {
+		if now.Sub(df.seen) > b.stateTimeout {
+			delete(b.state.filters, devEUI)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package smoothing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/geo"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/storage"
+	"github.com/brocaar/lorawan"
+)
+
+type testBackend struct {
+	location common.Location
+}
+
+func (b *testBackend) ResolveTDOA(ctx context.Context, req *geo.ResolveTDOARequest) (*geo.ResolveTDOAResponse, error) {
+	loc := b.location
+	return &geo.ResolveTDOAResponse{
+		Result: &geo.ResolveResult{
+			Location: &loc,
+		},
+	}, nil
+}
+
+func (b *testBackend) ResolveMultiFrameTDOA(ctx context.Context, req *geo.ResolveMultiFrameTDOARequest) (*geo.ResolveMultiFrameTDOAResponse, error) {
+	loc := b.location
+	return &geo.ResolveMultiFrameTDOAResponse{
+		Result: &geo.ResolveResult{
+			Location: &loc,
+		},
+	}, nil
+}
+
+func TestBackend(t *testing.T) {
+	processNoise := 0.001
+
+	var c config.Config
+	c.GeoServer.Smoothing.ProcessNoise = 0.01
+	c.GeoServer.Smoothing.StateTimeout = time.Hour
+	c.GeoServer.DeviceProfiles = []config.DeviceProfile{
+		{
+			Name:                  "stationary",
+			DevEUIs:               []string{"0807060504030201"},
+			SmoothingProcessNoise: &processNoise,
+		},
+	}
+
+	start := time.Now().UTC()
+
+	testTable := []struct {
+		Name   string
+		DevEUI []byte
+	}{
+		{
+			Name:   "default profile",
+			DevEUI: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		},
+		{
+			Name:   "stationary profile",
+			DevEUI: []byte{8, 7, 6, 5, 4, 3, 2, 1},
+		},
+	}
+
+	for _, tst := range testTable {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			tb := testBackend{}
+			b, err := NewBackend(&tb, c)
+			assert.NoError(err)
+
+			// alternate the location around a fixed point, 100m accuracy
+			var resp *geo.ResolveTDOAResponse
+			for i := 0; i < 20; i++ {
+				ts, _ := ptypes.TimestampProto(start.Add(time.Duration(i) * time.Minute))
+
+				tb.location = common.Location{
+					Latitude:  52.0 + float64(i%2)*0.001,
+					Longitude: 5.0,
+					Accuracy:  100,
+				}
+
+				resp, err = b.ResolveTDOA(context.Background(), &geo.ResolveTDOARequest{
+					DevEui: tst.DevEUI,
+					FrameRxInfo: &geo.FrameRXInfo{
+						RxInfo: []*gw.UplinkRXInfo{
+							{Time: ts},
+						},
+					},
+				})
+				assert.NoError(err)
+
+				if i == 0 {
+					assert.EqualValues(100, resp.Result.Location.Accuracy)
+				}
+			}
+
+			// the smoothed location must be close to the center and the
+			// accuracy must be tighter than the reported accuracy
+			dist := storage.Distance(52.0005, 5.0, resp.Result.Location.Latitude, resp.Result.Location.Longitude)
+			assert.True(dist < 50, "distance: %f", dist)
+			assert.True(resp.Result.Location.Accuracy < 100, "accuracy: %d", resp.Result.Location.Accuracy)
+		})
+	}
+
+	t.Run("state timeout", func(t *testing.T) {
+		assert := require.New(t)
+
+		tb := testBackend{}
+		b, err := NewBackend(&tb, c)
+		assert.NoError(err)
+
+		for i, lat := range []float64{52.0, 53.0} {
+			ts, _ := ptypes.TimestampProto(start.Add(time.Duration(i) * 2 * time.Hour))
+			tb.location = common.Location{
+				Latitude:  lat,
+				Longitude: 5.0,
+				Accuracy:  20,
+			}
+
+			resp, err := b.ResolveTDOA(context.Background(), &geo.ResolveTDOARequest{
+				DevEui: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+				FrameRxInfo: &geo.FrameRXInfo{
+					RxInfo: []*gw.UplinkRXInfo{
+						{Time: ts},
+					},
+				},
+			})
+			assert.NoError(err)
+			assert.Equal(&tb.location, resp.Result.Location)
+		}
+	})
+
+	t.Run("sweep", func(t *testing.T) {
+		assert := require.New(t)
+
+		tb := testBackend{location: common.Location{Latitude: 52.0, Longitude: 5.0, Accuracy: 20}}
+		bi, err := NewBackend(&tb, c)
+		assert.NoError(err)
+		b := bi.(*Backend)
+
+		for _, devEUI := range [][]byte{{1, 2, 3, 4, 5, 6, 7, 8}, {8, 7, 6, 5, 4, 3, 2, 1}} {
+			_, err := b.ResolveTDOA(context.Background(), &geo.ResolveTDOARequest{DevEui: devEUI})
+			assert.NoError(err)
+		}
+		assert.Len(b.state.filters, 2)
+
+		// the first device has not been seen within the state timeout
+		b.state.filters[lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}].seen = time.Now().Add(-2 * time.Hour)
+		b.state.lastSweep = time.Now().Add(-2 * time.Hour)
+
+		_, err = b.ResolveTDOA(context.Background(), &geo.ResolveTDOARequest{DevEui: []byte{8, 7, 6, 5, 4, 3, 2, 1}})
+		assert.NoError(err)
+		assert.Len(b.state.filters, 1)
+		assert.Contains(b.state.filters, lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 1})
+	})
+}
@@ -0,0 +1,147 @@
+package smoothing
+
+import (
+	"math"
+	"time"
+)
+
+// earthRadius defines the mean earth radius in meters.
+const earthRadius = 6371000
+
+// defaultMeasurementNoise is the measurement noise (in meters) used when the
+// backend did not report an accuracy.
+const defaultMeasurementNoise = 100
+
+// axis holds the constant-velocity Kalman filter state of a single axis.
+// As the process and measurement noise of both axes are independent, the
+// 2D filter can be split into two 1D (position, velocity) filters.
+type axis struct {
+	// velocity in m/s (the position is tracked by the filter state)
+	v float64
+
+	// covariance matrix
+	p [2][2]float64
+}
+
+// predict advances the axis state by dt seconds, applying the given process
+// noise (acceleration in m/s²). It returns the predicted position offset.
+func (a *axis) predict(dt, q float64) float64 {
+	offset := a.v * dt
+
+	dt2 := dt * dt
+	dt3 := dt2 * dt
+	dt4 := dt3 * dt
+	q2 := q * q
+
+	p00 := a.p[0][0] + dt*(a.p[1][0]+a.p[0][1]) + dt2*a.p[1][1] + q2*dt4/4
+	p01 := a.p[0][1] + dt*a.p[1][1] + q2*dt3/2
+	p10 := a.p[1][0] + dt*a.p[1][1] + q2*dt3/2
+	p11 := a.p[1][1] + q2*dt2
+
+	a.p = [2][2]float64{{p00, p01}, {p10, p11}}
+
+	return offset
+}
+
+// update applies the measurement z (position offset relative to the
+// predicted position) with variance r. It returns the corrected position
+// offset.
+func (a *axis) update(z, r float64) float64 {
+	s := a.p[0][0] + r
+	k0 := a.p[0][0] / s
+	k1 := a.p[1][0] / s
+
+	a.v += k1 * z
+
+	p00 := (1 - k0) * a.p[0][0]
+	p01 := (1 - k0) * a.p[0][1]
+	p10 := a.p[1][0] - k1*a.p[0][0]
+	p11 := a.p[1][1] - k1*a.p[0][1]
+
+	a.p = [2][2]float64{{p00, p01}, {p10, p11}}
+
+	return k0 * z
+}
+
+// filter implements a 2D constant-velocity Kalman filter. Positions are
+// tracked as latitude / longitude, the filter itself operates on a local
+// east / north plane centered at the last estimated position.
+type filter struct {
+	latitude  float64
+	longitude float64
+	time      time.Time
+
+	east  axis
+	north axis
+}
+
+// newFilter creates a new filter, initialized with the given measurement.
+func newFilter(t time.Time, lat, lng, accuracy float64) *filter {
+	r := measurementVariance(accuracy)
+
+	// the initial velocity is unknown, this is reflected by using a large
+	// velocity variance
+	initial := axis{
+		p: [2][2]float64{{r, 0}, {0, 1e4}},
+	}
+
+	return &filter{
+		latitude:  lat,
+		longitude: lng,
+		time:      t,
+		east:      initial,
+		north:     initial,
+	}
+}
+
+// update applies the given measurement, using q as process noise. Out of
+// order measurements (t before the previous measurement) are applied
+// without advancing the filter state in time.
+func (f *filter) update(t time.Time, lat, lng, accuracy, q float64) {
+	dt := t.Sub(f.time).Seconds()
+	if dt < 0 {
+		dt = 0
+	} else {
+		f.time = t
+	}
+
+	// predict
+	dx := f.east.predict(dt, q)
+	dy := f.north.predict(dt, q)
+	f.latitude, f.longitude = offset(f.latitude, f.longitude, dx, dy)
+
+	// update
+	r := measurementVariance(accuracy)
+	zx, zy := project(f.latitude, f.longitude, lat, lng)
+	dx = f.east.update(zx, r)
+	dy = f.north.update(zy, r)
+	f.latitude, f.longitude = offset(f.latitude, f.longitude, dx, dy)
+}
+
+// accuracy returns the estimated position accuracy (in meters).
+func (f *filter) accuracy() float64 {
+	return math.Sqrt(math.Max(f.east.p[0][0], f.north.p[0][0]))
+}
+
+func measurementVariance(accuracy float64) float64 {
+	if accuracy <= 0 {
+		accuracy = defaultMeasurementNoise
+	}
+	return accuracy * accuracy
+}
+
+// project returns the east / north offset (in meters) of the given point
+// relative to the given reference point.
+func project(refLat, refLng, lat, lng float64) (float64, float64) {
+	x := (lng - refLng) * math.Pi / 180 * earthRadius * math.Cos(refLat*math.Pi/180)
+	y := (lat - refLat) * math.Pi / 180 * earthRadius
+	return x, y
+}
+
+// offset returns the given point, moved by the given east / north offset
+// (in meters).
+func offset(lat, lng, x, y float64) (float64, float64) {
+	lat2 := lat + y/earthRadius*180/math.Pi
+	lng2 := lng + x/(earthRadius*math.Cos(lat*math.Pi/180))*180/math.Pi
+	return lat2, lng2
+}
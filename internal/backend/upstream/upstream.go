@@ -0,0 +1,66 @@
+// Package upstream records the raw HTTP exchanges with the upstream
+// geolocation services, such that these can be included in the request log.
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// Exchange holds a single HTTP request to the upstream geolocation service
+// and its response.
+type Exchange struct {
+	URL          string          `json:"url"`
+	StatusCode   int             `json:"status_code,omitempty"`
+	RequestBody  json.RawMessage `json:"request_body,omitempty"`
+	ResponseBody json.RawMessage `json:"response_body,omitempty"`
+}
+
+// Recorder records the upstream exchanges of a single API call.
+type Recorder struct {
+	mu        sync.Mutex
+	exchanges []Exchange
+}
+
+// Exchanges returns the recorded exchanges.
+func (r *Recorder) Exchanges() []Exchange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Exchange(nil), r.exchanges...)
+}
+
+type recorderKey struct{}
+
+// NewContext returns a new context containing a new recorder.
+func NewContext(ctx context.Context) (context.Context, *Recorder) {
+	var r Recorder
+	return context.WithValue(ctx, recorderKey{}, &r), &r
+}
+
+// Record records the given exchange when the context contains a recorder.
+// Bodies which are not valid JSON are recorded as JSON string.
+func Record(ctx context.Context, e Exchange) {
+	r, ok := ctx.Value(recorderKey{}).(*Recorder)
+	if !ok {
+		return
+	}
+
+	e.RequestBody = rawJSON(e.RequestBody)
+	e.ResponseBody = rawJSON(e.ResponseBody)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.exchanges = append(r.exchanges, e)
+}
+
+func rawJSON(b []byte) json.RawMessage {
+	if len(b) == 0 || json.Valid(b) {
+		return b
+	}
+
+	out, _ := json.Marshal(string(b))
+	return out
+}
@@ -8,7 +8,8 @@ var Version string
 // Config defines the configuration structure.
 type Config struct {
 	General struct {
-		LogLevel int `mapstructure:"log_level"`
+		LogLevel  int    `mapstructure:"log_level"`
+		LogFormat string `mapstructure:"log_format"`
 	} `mapstructure:"general"`
 
 	GeoServer struct {
@@ -17,24 +18,156 @@ type Config struct {
 			CACert  string `mapstructure:"ca_cert"`
 			TLSCert string `mapstructure:"tls_cert"`
 			TLSKey  string `mapstructure:"tls_key"`
+
+			ClientAuth         string        `mapstructure:"client_auth"`
+			CertReloadInterval time.Duration `mapstructure:"cert_reload_interval"`
+			DrainTimeout       time.Duration `mapstructure:"drain_timeout"`
 		} `mapstructure:"api"`
 
+		RESTAPI struct {
+			Bind    string `mapstructure:"bind"`
+			TLSCert string `mapstructure:"tls_cert"`
+			TLSKey  string `mapstructure:"tls_key"`
+
+			CertReloadInterval time.Duration `mapstructure:"cert_reload_interval"`
+		} `mapstructure:"rest_api"`
+
 		Backend struct {
 			Type string `mapstructure:"type"`
 
 			RequestLogDir string `mapstructure:"request_log_dir"`
 
+			RequestLog struct {
+				Mode           string        `mapstructure:"mode"`
+				NDJSONPeriod   string        `mapstructure:"ndjson_period"`
+				MaxFileSizeMB  int           `mapstructure:"max_file_size_mb"`
+				Compression    string        `mapstructure:"compression"`
+				MaxAge         time.Duration `mapstructure:"max_age"`
+				MaxTotalSizeMB int           `mapstructure:"max_total_size_mb"`
+				UpstreamBodies bool          `mapstructure:"upstream_bodies"`
+				QueueSize      int           `mapstructure:"queue_size"`
+
+				Sink string `mapstructure:"sink"`
+
+				S3 struct {
+					Endpoint            string        `mapstructure:"endpoint"`
+					Region              string        `mapstructure:"region"`
+					Bucket              string        `mapstructure:"bucket"`
+					Prefix              string        `mapstructure:"prefix"`
+					PathStyle           bool          `mapstructure:"path_style"`
+					AccessKeyID         string        `mapstructure:"access_key_id"`
+					SecretAccessKey     string        `mapstructure:"secret_access_key" secret:"true"`
+					SecretAccessKeyFile string        `mapstructure:"secret_access_key_file"`
+					BatchSize           int           `mapstructure:"batch_size"`
+					BatchInterval       time.Duration `mapstructure:"batch_interval"`
+					RequestTimeout      time.Duration `mapstructure:"request_timeout"`
+				} `mapstructure:"s3"`
+
+				Privacy struct {
+					HMACKey            string   `mapstructure:"hmac_key" secret:"true"`
+					HMACKeyFile        string   `mapstructure:"hmac_key_file"`
+					CoordinateDecimals int      `mapstructure:"coordinate_decimals"`
+					DropFields         []string `mapstructure:"drop_fields"`
+				} `mapstructure:"privacy"`
+
+				Sampling struct {
+					Percentage      float64  `mapstructure:"percentage"`
+					DevEUIs         []string `mapstructure:"dev_euis"`
+					OnlyFailures    bool     `mapstructure:"only_failures"`
+					MinGatewayCount int      `mapstructure:"min_gateway_count"`
+				} `mapstructure:"sampling"`
+			} `mapstructure:"request_log"`
+
 			Collos struct {
-				SubscriptionKey string        `mapstructure:"subscription_key"`
-				RequestTimeout  time.Duration `mapstructure:"request_timeout"`
+				SubscriptionKey     string        `mapstructure:"subscription_key" secret:"true"`
+				SubscriptionKeyFile string        `mapstructure:"subscription_key_file"`
+				RequestTimeout      time.Duration `mapstructure:"request_timeout"`
 			} `mapstructure:"collos"`
 
 			LoRaCloud struct {
 				URI            string        `mapstructure:"uri"`
-				Token          string        `mapstructure:"token"`
+				Token          string        `mapstructure:"token" secret:"true"`
+				TokenFile      string        `mapstructure:"token_file"`
 				RequestTimeout time.Duration `mapstructure:"request_timeout"`
 			} `mapstructure:"lora_cloud"`
+
+			UpstreamProbe struct {
+				Interval         time.Duration `mapstructure:"interval"`
+				Timeout          time.Duration `mapstructure:"timeout"`
+				FailureThreshold int           `mapstructure:"failure_threshold"`
+			} `mapstructure:"upstream_probe"`
 		} `mapstructure:"backend"`
+
+		History struct {
+			Path   string        `mapstructure:"path"`
+			MaxAge time.Duration `mapstructure:"max_age"`
+		} `mapstructure:"history"`
+
+		Smoothing struct {
+			Enabled      bool          `mapstructure:"enabled"`
+			ProcessNoise float64       `mapstructure:"process_noise"`
+			StateTimeout time.Duration `mapstructure:"state_timeout"`
+		} `mapstructure:"smoothing"`
+
+		Plausibility struct {
+			Enabled       bool          `mapstructure:"enabled"`
+			Action        string        `mapstructure:"action"`
+			MaxSpeed      float64       `mapstructure:"max_speed"`
+			StateTimeout  time.Duration `mapstructure:"state_timeout"`
+			AllowedRegion struct {
+				MinLatitude  float64 `mapstructure:"min_latitude"`
+				MinLongitude float64 `mapstructure:"min_longitude"`
+				MaxLatitude  float64 `mapstructure:"max_latitude"`
+				MaxLongitude float64 `mapstructure:"max_longitude"`
+			} `mapstructure:"allowed_region"`
+		} `mapstructure:"plausibility"`
+
+		Geofence struct {
+			Source          string        `mapstructure:"source"`
+			RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+			DwellTime       time.Duration `mapstructure:"dwell_time"`
+			StateTimeout    time.Duration `mapstructure:"state_timeout"`
+		} `mapstructure:"geofence"`
+
+		Integration struct {
+			Enabled   []string `mapstructure:"enabled"`
+			Marshaler string   `mapstructure:"marshaler"`
+			QueueSize int      `mapstructure:"queue_size"`
+
+			HTTP struct {
+				Endpoints      []string          `mapstructure:"endpoints"`
+				Headers        map[string]string `mapstructure:"headers" secret:"true"`
+				HMACSecret     string            `mapstructure:"hmac_secret" secret:"true"`
+				HMACSecretFile string            `mapstructure:"hmac_secret_file"`
+				Timeout        time.Duration     `mapstructure:"timeout"`
+				RetryQueueDir  string            `mapstructure:"retry_queue_dir"`
+				RetryQueueSize int               `mapstructure:"retry_queue_size"`
+				RetryInterval  time.Duration     `mapstructure:"retry_interval"`
+				MaxRetries     int               `mapstructure:"max_retries"`
+			} `mapstructure:"http"`
+
+			MQTT struct {
+				Server                string `mapstructure:"server"`
+				Username              string `mapstructure:"username"`
+				Password              string `mapstructure:"password" secret:"true"`
+				PasswordFile          string `mapstructure:"password_file"`
+				ClientID              string `mapstructure:"client_id"`
+				QOS                   uint8  `mapstructure:"qos"`
+				CleanSession          bool   `mapstructure:"clean_session"`
+				CACert                string `mapstructure:"ca_cert"`
+				TLSCert               string `mapstructure:"tls_cert"`
+				TLSKey                string `mapstructure:"tls_key"`
+				LocationTopicTemplate string `mapstructure:"location_topic_template"`
+				GeofenceTopicTemplate string `mapstructure:"geofence_topic_template"`
+			} `mapstructure:"mqtt"`
+		} `mapstructure:"integration"`
+
+		Auth struct {
+			Enabled bool         `mapstructure:"enabled"`
+			Clients []AuthClient `mapstructure:"clients"`
+		} `mapstructure:"auth"`
+
+		DeviceProfiles []DeviceProfile `mapstructure:"device_profiles"`
 	} `mapstructure:"geo_server"`
 
 	Metrics struct {
@@ -44,6 +177,39 @@ type Config struct {
 			APITimingHistogram bool   `mapstructure:"api_timing_histogram"`
 		} `mapstructure:"prometheus"`
 	} `mapstructure:"metrics"`
+
+	Tracing struct {
+		Exporter    string  `mapstructure:"exporter"`
+		ServiceName string  `mapstructure:"service_name"`
+		SampleRatio float64 `mapstructure:"sample_ratio"`
+
+		OTLP struct {
+			Endpoint string            `mapstructure:"endpoint"`
+			Headers  map[string]string `mapstructure:"headers" secret:"true"`
+			Timeout  time.Duration     `mapstructure:"timeout"`
+		} `mapstructure:"otlp"`
+	} `mapstructure:"tracing"`
+}
+
+// DeviceProfile defines the post-processing settings for a set of devices.
+// Settings that are nil are not set and inherit the defaults.
+type DeviceProfile struct {
+	Name                  string   `mapstructure:"name"`
+	DevEUIs               []string `mapstructure:"dev_euis"`
+	SmoothingProcessNoise *float64 `mapstructure:"smoothing_process_noise"`
+	MaxSpeed              *float64 `mapstructure:"max_speed"`
+}
+
+// AuthClient defines an API client and its permissions.
+type AuthClient struct {
+	Name         string   `mapstructure:"name"`
+	Tokens       []string `mapstructure:"tokens" secret:"true"`
+	CertSubjects []string `mapstructure:"cert_subjects"`
+	Methods      []string `mapstructure:"methods"`
+	Backends     []string `mapstructure:"backends"`
+	DevEUIRanges []string `mapstructure:"dev_eui_ranges"`
+
+	RequestsPerMinute int `mapstructure:"requests_per_minute"`
 }
 
 // C holds the global configufation.
@@ -0,0 +1,264 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dump formats.
+const (
+	DumpFormatTOML = "toml"
+	DumpFormatJSON = "json"
+)
+
+// SourceFunc returns the source (e.g. default, file, env or flag) of the
+// configuration value with the given key.
+type SourceFunc func(key string) string
+
+// node is a configuration value. It is either a leaf value, a table
+// (children) or an array of tables (items).
+type node struct {
+	name     string
+	key      string
+	value    interface{}
+	children []*node
+	items    [][]*node
+	isArray  bool
+}
+
+// Dump writes the given configuration, with its secrets redacted, to w in
+// the given format. When source is not nil, each value is annotated with
+// its source.
+func Dump(w io.Writer, c Config, format string, source SourceFunc) error {
+	c = Redact(c)
+	nodes := dumpNodes(reflect.ValueOf(c), "")
+
+	switch format {
+	case DumpFormatTOML:
+		return dumpTOML(w, nodes, source)
+	case DumpFormatJSON:
+		b, err := json.MarshalIndent(jsonObject(nodes, source), "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+func dumpNodes(v reflect.Value, path string) []*node {
+	var out []*node
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		f := v.Field(i)
+		name := t.Field(i).Tag.Get("mapstructure")
+		n := node{
+			name: name,
+			key:  joinKey(path, name),
+		}
+
+		switch {
+		case f.Kind() == reflect.Struct:
+			n.children = dumpNodes(f, n.key)
+		case f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.Struct:
+			n.isArray = true
+			for j := 0; j < f.Len(); j++ {
+				n.items = append(n.items, dumpNodes(f.Index(j), n.key))
+			}
+		case f.Kind() == reflect.Ptr:
+			// nil pointers are settings that are not set
+			if f.IsNil() {
+				continue
+			}
+			n.value = dumpValue(f.Elem())
+		case f.Kind() == reflect.Map:
+			m := make(map[string]string, f.Len())
+			for _, k := range f.MapKeys() {
+				m[k.String()] = f.MapIndex(k).String()
+			}
+			n.value = m
+		default:
+			n.value = dumpValue(f)
+		}
+
+		out = append(out, &n)
+	}
+
+	return out
+}
+
+func dumpValue(v reflect.Value) interface{} {
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.Slice:
+		out := make([]string, v.Len())
+		for i := range out {
+			out[i] = v.Index(i).String()
+		}
+		return out
+	default:
+		return v.Interface()
+	}
+}
+
+func isTable(n *node) bool {
+	_, isMap := n.value.(map[string]string)
+	return n.children != nil || n.isArray || isMap
+}
+
+func dumpTOML(w io.Writer, nodes []*node, source SourceFunc) error {
+	var b strings.Builder
+	writeTOMLTable(&b, nodes, source)
+	_, err := io.WriteString(w, strings.TrimLeft(b.String(), "\n"))
+	return err
+}
+
+func writeTOMLTable(b *strings.Builder, nodes []*node, source SourceFunc) {
+	// TOML requires the values of a table to be written before its
+	// sub-tables
+	for _, n := range nodes {
+		if isTable(n) {
+			continue
+		}
+		fmt.Fprintf(b, "%s=%s%s\n", n.name, tomlValue(n.value), tomlAnnotation(source, n.key))
+	}
+
+	for _, n := range nodes {
+		switch {
+		case n.isArray:
+			if len(n.items) == 0 {
+				if source != nil {
+					fmt.Fprintf(b, "\n# [[%s]]%s\n", n.key, tomlAnnotation(source, n.key))
+				}
+				continue
+			}
+			for _, item := range n.items {
+				fmt.Fprintf(b, "\n[[%s]]%s\n", n.key, tomlAnnotation(source, n.key))
+				// the values of an array item are annotated by the array
+				writeTOMLTable(b, item, nil)
+			}
+		case n.children != nil:
+			fmt.Fprintf(b, "\n[%s]\n", n.key)
+			writeTOMLTable(b, n.children, source)
+		default:
+			m, ok := n.value.(map[string]string)
+			if !ok {
+				continue
+			}
+			fmt.Fprintf(b, "\n[%s]%s\n", n.key, tomlAnnotation(source, n.key))
+			keys := make([]string, 0, len(m))
+			for k := range m {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				fmt.Fprintf(b, "%s=%s\n", tomlString(k), tomlString(m[k]))
+			}
+		}
+	}
+}
+
+func tomlAnnotation(source SourceFunc, key string) string {
+	if source == nil {
+		return ""
+	}
+	return " # " + source(key)
+}
+
+func tomlValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return tomlString(v)
+	case float64:
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eEn") {
+			s += ".0"
+		}
+		return s
+	case []string:
+		out := make([]string, len(v))
+		for i := range v {
+			out[i] = tomlString(v[i])
+		}
+		return "[" + strings.Join(out, ", ") + "]"
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// tomlString returns the given string as TOML basic string.
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func jsonObject(nodes []*node, source SourceFunc) map[string]interface{} {
+	out := make(map[string]interface{}, len(nodes))
+
+	for _, n := range nodes {
+		if n.children != nil {
+			out[n.name] = jsonObject(n.children, source)
+			continue
+		}
+
+		var v interface{}
+		if n.isArray {
+			items := make([]interface{}, 0, len(n.items))
+			for _, item := range n.items {
+				// the values of an array item are annotated by the array
+				items = append(items, jsonObject(item, nil))
+			}
+			v = items
+		} else {
+			v = n.value
+		}
+
+		if source != nil {
+			v = map[string]interface{}{
+				"value":  v,
+				"source": source(n.key),
+			}
+		}
+
+		out[n.name] = v
+	}
+
+	return out
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func dumpTestConfig() Config {
+	var c Config
+	c.General.LogLevel = 4
+	c.GeoServer.API.Bind = "0.0.0.0:8005"
+	c.GeoServer.API.DrainTimeout = 30 * time.Second
+	c.GeoServer.Backend.Type = "lora_cloud"
+	c.GeoServer.Backend.LoRaCloud.URI = "https://gls.loracloud.com"
+	c.GeoServer.Backend.LoRaCloud.Token = "s3cr3t"
+	c.GeoServer.Smoothing.ProcessNoise = 0.5
+	c.GeoServer.Plausibility.AllowedRegion.MaxLatitude = 52
+	c.GeoServer.Integration.Enabled = []string{"http"}
+	c.GeoServer.Integration.HTTP.Endpoints = []string{"http://localhost:8080/events"}
+	c.GeoServer.Integration.HTTP.Headers = map[string]string{"authorization": "Bearer s3cr3t"}
+	c.GeoServer.Integration.MQTT.QOS = 1
+	c.GeoServer.Integration.MQTT.LocationTopicTemplate = "geo/{{ .DevEUI }}/\"location\""
+	c.GeoServer.Auth.Clients = []AuthClient{
+		{Name: "a", Tokens: []string{"s3cr3t"}, Methods: []string{"ResolveTDOA"}},
+		{Name: "b", CertSubjects: []string{"CN=b"}},
+	}
+	return c
+}
+
+func TestDump(t *testing.T) {
+	t.Run("toml", func(t *testing.T) {
+		assert := require.New(t)
+		c := dumpTestConfig()
+
+		maxSpeed := 0.0
+		c.GeoServer.DeviceProfiles = []DeviceProfile{
+			{Name: "stationary", DevEUIs: []string{"0102030405060708"}, MaxSpeed: &maxSpeed},
+			{Name: "vehicle", DevEUIs: []string{"0807060504030201"}},
+		}
+
+		var b bytes.Buffer
+		assert.NoError(Dump(&b, c, DumpFormatTOML, nil))
+		assert.NotContains(b.String(), "s3cr3t")
+
+		// the output must be a valid configuration file
+		v := viper.New()
+		v.SetConfigType("toml")
+		assert.NoError(v.ReadConfig(&b))
+
+		var out Config
+		assert.NoError(v.Unmarshal(&out))
+		assert.Equal(Redact(c), out)
+	})
+
+	t.Run("toml annotated", func(t *testing.T) {
+		assert := require.New(t)
+
+		var b bytes.Buffer
+		assert.NoError(Dump(&b, dumpTestConfig(), DumpFormatTOML, func(key string) string {
+			return "src:" + key
+		}))
+
+		assert.Contains(b.String(), "bind=\"0.0.0.0:8005\" # src:geo_server.api.bind\n")
+		assert.Contains(b.String(), "[geo_server.integration.http.headers] # src:geo_server.integration.http.headers\n")
+		assert.Contains(b.String(), "[[geo_server.auth.clients]] # src:geo_server.auth.clients\nname=\"a\"\n")
+		assert.Contains(b.String(), "# [[geo_server.device_profiles]] # src:geo_server.device_profiles\n")
+
+		v := viper.New()
+		v.SetConfigType("toml")
+		assert.NoError(v.ReadConfig(&b))
+	})
+
+	t.Run("json annotated", func(t *testing.T) {
+		assert := require.New(t)
+
+		var b bytes.Buffer
+		assert.NoError(Dump(&b, dumpTestConfig(), DumpFormatJSON, func(key string) string {
+			return "default"
+		}))
+		assert.NotContains(b.String(), "s3cr3t")
+
+		var out struct {
+			GeoServer struct {
+				API struct {
+					DrainTimeout struct {
+						Value  string `json:"value"`
+						Source string `json:"source"`
+					} `json:"drain_timeout"`
+				} `json:"api"`
+				Auth struct {
+					Clients struct {
+						Value []struct {
+							Name   string   `json:"name"`
+							Tokens []string `json:"tokens"`
+						} `json:"value"`
+					} `json:"clients"`
+				} `json:"auth"`
+			} `json:"geo_server"`
+		}
+		assert.NoError(json.Unmarshal(b.Bytes(), &out))
+		assert.Equal("30s", out.GeoServer.API.DrainTimeout.Value)
+		assert.Equal("default", out.GeoServer.API.DrainTimeout.Source)
+		assert.Len(out.GeoServer.Auth.Clients.Value, 2)
+		assert.Equal([]string{Redacted}, out.GeoServer.Auth.Clients.Value[0].Tokens)
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		assert := require.New(t)
+		assert.EqualError(Dump(&bytes.Buffer{}, Config{}, "yaml", nil), "unknown format: yaml")
+	})
+}
@@ -0,0 +1,215 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Redacted replaces the secret values when printing the configuration.
+const Redacted = "<redacted>"
+
+const fileRefPrefix = "file://"
+
+var envRefRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ResolveSecrets resolves the secrets of the given configuration. Secrets
+// are the fields tagged with `secret:"true"`. A secret is:
+//   - read from the file set in the <name>_file variant (when set)
+//   - read from the file when its value is a file://<path> reference
+//   - expanded when it contains ${ENV} references
+func ResolveSecrets(c *Config) error {
+	return resolveSecrets(reflect.ValueOf(c).Elem(), "")
+}
+
+// Redact returns a copy of the given configuration, in which all (non-empty)
+// secrets have been replaced by Redacted. Secrets which are read from a
+// <name>_file variant are cleared, so that the output remains a valid
+// configuration.
+func Redact(c Config) Config {
+	redact(reflect.ValueOf(&c).Elem())
+	return c
+}
+
+// RedactURL removes the password (if any) from the given URL.
+func RedactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), Redacted)
+	}
+
+	return u.String()
+}
+
+func resolveSecrets(v reflect.Value, path string) error {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		f := v.Field(i)
+		ft := t.Field(i)
+		key := joinKey(path, ft.Tag.Get("mapstructure"))
+
+		switch f.Kind() {
+		case reflect.Struct:
+			if err := resolveSecrets(f, key); err != nil {
+				return err
+			}
+			continue
+		case reflect.Slice:
+			if f.Type().Elem().Kind() == reflect.Struct {
+				for j := 0; j < f.Len(); j++ {
+					if err := resolveSecrets(f.Index(j), fmt.Sprintf("%s[%d]", key, j)); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+		}
+
+		if ft.Tag.Get("secret") != "true" {
+			continue
+		}
+
+		switch f.Kind() {
+		case reflect.String:
+			if fileField := v.FieldByName(ft.Name + "File"); fileField.IsValid() && fileField.String() != "" {
+				if f.String() != "" {
+					return fmt.Errorf("%s: %s and %s_file can't be set both", key, key, key)
+				}
+				f.SetString(fileRefPrefix + fileField.String())
+			}
+
+			s, err := resolveSecret(f.String())
+			if err != nil {
+				return errors.Wrap(err, key)
+			}
+			f.SetString(s)
+		case reflect.Slice:
+			out := make([]string, f.Len())
+			for j := 0; j < f.Len(); j++ {
+				s, err := resolveSecret(f.Index(j).String())
+				if err != nil {
+					return errors.Wrapf(err, "%s[%d]", key, j)
+				}
+				out[j] = s
+			}
+			f.Set(reflect.ValueOf(out))
+		case reflect.Map:
+			out := make(map[string]string, f.Len())
+			for _, k := range f.MapKeys() {
+				s, err := resolveSecret(f.MapIndex(k).String())
+				if err != nil {
+					return errors.Wrapf(err, "%s.%s", key, k.String())
+				}
+				out[k.String()] = s
+			}
+			f.Set(reflect.ValueOf(out))
+		}
+	}
+
+	return nil
+}
+
+// resolveSecret resolves the file:// or ${ENV} references of the given
+// value.
+func resolveSecret(s string) (string, error) {
+	if strings.HasPrefix(s, fileRefPrefix) {
+		b, err := ioutil.ReadFile(strings.TrimPrefix(s, fileRefPrefix))
+		if err != nil {
+			return "", errors.Wrap(err, "read secret file error")
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+
+	var err error
+	out := envRefRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envRefRegexp.FindStringSubmatch(ref)[1]
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return v
+	})
+
+	return out, err
+}
+
+func redact(v reflect.Value) {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		f := v.Field(i)
+		ft := t.Field(i)
+
+		switch f.Kind() {
+		case reflect.Struct:
+			redact(f)
+			continue
+		case reflect.Slice:
+			if f.Type().Elem().Kind() == reflect.Struct {
+				if f.IsNil() {
+					continue
+				}
+
+				// copy the slice, so that the original is not modified
+				out := reflect.MakeSlice(f.Type(), f.Len(), f.Len())
+				reflect.Copy(out, f)
+				for j := 0; j < out.Len(); j++ {
+					redact(out.Index(j))
+				}
+				f.Set(out)
+				continue
+			}
+		}
+
+		if ft.Tag.Get("secret") != "true" {
+			continue
+		}
+
+		if (f.Kind() == reflect.Slice || f.Kind() == reflect.Map) && f.IsNil() {
+			continue
+		}
+
+		switch f.Kind() {
+		case reflect.String:
+			// the secret is (re)read from the <name>_file variant
+			if fileField := v.FieldByName(ft.Name + "File"); fileField.IsValid() && fileField.String() != "" {
+				f.SetString("")
+				continue
+			}
+
+			if f.String() != "" {
+				f.SetString(Redacted)
+			}
+		case reflect.Slice:
+			out := make([]string, f.Len())
+			for j := range out {
+				out[j] = Redacted
+			}
+			f.Set(reflect.ValueOf(out))
+		case reflect.Map:
+			out := make(map[string]string, f.Len())
+			for _, k := range f.MapKeys() {
+				out[k.String()] = Redacted
+			}
+			f.Set(reflect.ValueOf(out))
+		}
+	}
+}
+
+func joinKey(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,263 @@
+// Package geofence implements the loading and evaluation of geofences.
+package geofence
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/pkg/errors"
+
+	"github.com/brocaar/chirpstack-geolocation-server/internal/storage"
+	"github.com/brocaar/lorawan"
+)
+
+// earthRadius defines the mean earth radius in meters.
+const earthRadius = 6371000
+
+// Point defines a (latitude, longitude) point.
+type Point struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Geofence defines a polygon or circle geofence.
+type Geofence struct {
+	ID   string
+	Name string
+
+	// Clip indicates that locations of devices known to be inside the
+	// geofence are clipped to the geofence, when the location is outside
+	// the geofence but within its accuracy.
+	Clip bool
+
+	// DevEUIs contains the devices to which this geofence applies. When
+	// empty, the geofence applies to all devices.
+	DevEUIs map[lorawan.EUI64]struct{}
+
+	// Polygon rings (the first ring is the exterior, the others are holes).
+	polygon [][]Point
+
+	// Circle center and radius (meters).
+	center *Point
+	radius float64
+}
+
+// AppliesTo returns true when the geofence applies to the given device.
+func (g Geofence) AppliesTo(devEUI lorawan.EUI64) bool {
+	if len(g.DevEUIs) == 0 {
+		return true
+	}
+	_, ok := g.DevEUIs[devEUI]
+	return ok
+}
+
+// Contains returns true when the given point is inside the geofence.
+func (g Geofence) Contains(p Point) bool {
+	if g.center != nil {
+		return storage.Distance(g.center.Latitude, g.center.Longitude, p.Latitude, p.Longitude) <= g.radius
+	}
+
+	if len(g.polygon) == 0 || !ringContains(g.polygon[0], p) {
+		return false
+	}
+
+	for _, hole := range g.polygon[1:] {
+		if ringContains(hole, p) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Nearest returns the point on the geofence boundary which is nearest to
+// the given point, and the distance (in meters) to this point.
+func (g Geofence) Nearest(p Point) (Point, float64) {
+	if g.center != nil {
+		d := storage.Distance(g.center.Latitude, g.center.Longitude, p.Latitude, p.Longitude)
+		if d == 0 {
+			return p, 0
+		}
+
+		// move from the center towards p, until the radius has been reached
+		x, y := project(*g.center, p)
+		f := g.radius / d
+		return unproject(*g.center, x*f, y*f), math.Max(0, d-g.radius)
+	}
+
+	var nearest Point
+	minDist := math.Inf(1)
+
+	for _, ring := range g.polygon {
+		for i := range ring {
+			a := ring[i]
+			b := ring[(i+1)%len(ring)]
+
+			// project the segment to a local plane, centered at p
+			ax, ay := project(p, a)
+			bx, by := project(p, b)
+			dx, dy := bx-ax, by-ay
+
+			t := 0.0
+			if l := dx*dx + dy*dy; l != 0 {
+				t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/l))
+			}
+
+			cx, cy := ax+t*dx, ay+t*dy
+			if d := math.Sqrt(cx*cx + cy*cy); d < minDist {
+				minDist = d
+				nearest = unproject(p, cx, cy)
+			}
+		}
+	}
+
+	return nearest, minDist
+}
+
+// ringContains implements the ray-casting point-in-polygon algorithm.
+func ringContains(ring []Point, p Point) bool {
+	var inside bool
+
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a := ring[i]
+		b := ring[j]
+
+		if (a.Latitude > p.Latitude) != (b.Latitude > p.Latitude) &&
+			p.Longitude < (b.Longitude-a.Longitude)*(p.Latitude-a.Latitude)/(b.Latitude-a.Latitude)+a.Longitude {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
+
+// project returns the east / north offset (in meters) of p relative to ref.
+func project(ref, p Point) (float64, float64) {
+	x := (p.Longitude - ref.Longitude) * math.Pi / 180 * earthRadius * math.Cos(ref.Latitude*math.Pi/180)
+	y := (p.Latitude - ref.Latitude) * math.Pi / 180 * earthRadius
+	return x, y
+}
+
+// unproject returns the point at the given east / north offset (in meters)
+// relative to ref.
+func unproject(ref Point, x, y float64) Point {
+	return Point{
+		Latitude:  ref.Latitude + y/earthRadius*180/math.Pi,
+		Longitude: ref.Longitude + x/(earthRadius*math.Cos(ref.Latitude*math.Pi/180))*180/math.Pi,
+	}
+}
+
+type featureCollection struct {
+	Type     string    `json:"type"`
+	Features []feature `json:"features"`
+}
+
+type feature struct {
+	Type       string            `json:"type"`
+	ID         interface{}       `json:"id"`
+	Properties featureProperties `json:"properties"`
+	Geometry   geometry          `json:"geometry"`
+}
+
+type featureProperties struct {
+	Name    string   `json:"name"`
+	Radius  float64  `json:"radius"`
+	Clip    bool     `json:"clip"`
+	DevEUIs []string `json:"dev_euis"`
+}
+
+type geometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// Parse parses the given GeoJSON FeatureCollection. Polygon features are
+// used as polygon geofences, Point features with a radius property (in
+// meters) are used as circle geofences. Other features are ignored.
+func Parse(b []byte) ([]Geofence, error) {
+	var fc featureCollection
+	if err := json.Unmarshal(b, &fc); err != nil {
+		return nil, errors.Wrap(err, "unmarshal geojson error")
+	}
+
+	if fc.Type != "FeatureCollection" {
+		return nil, fmt.Errorf("expected FeatureCollection, got: %s", fc.Type)
+	}
+
+	var out []Geofence
+
+	for i, f := range fc.Features {
+		g := Geofence{
+			ID:   fmt.Sprintf("%d", i),
+			Name: f.Properties.Name,
+			Clip: f.Properties.Clip,
+		}
+
+		if f.ID != nil {
+			g.ID = fmt.Sprintf("%v", f.ID)
+		}
+
+		if len(f.Properties.DevEUIs) != 0 {
+			g.DevEUIs = make(map[lorawan.EUI64]struct{})
+			for _, s := range f.Properties.DevEUIs {
+				var devEUI lorawan.EUI64
+				if err := devEUI.UnmarshalText([]byte(s)); err != nil {
+					return nil, errors.Wrapf(err, "feature %s: decode dev_eui error", g.ID)
+				}
+				g.DevEUIs[devEUI] = struct{}{}
+			}
+		}
+
+		switch f.Geometry.Type {
+		case "Polygon":
+			var coords [][][]float64
+			if err := json.Unmarshal(f.Geometry.Coordinates, &coords); err != nil {
+				return nil, errors.Wrapf(err, "feature %s: unmarshal coordinates error", g.ID)
+			}
+
+			for _, ring := range coords {
+				var r []Point
+				for _, c := range ring {
+					if len(c) < 2 {
+						return nil, fmt.Errorf("feature %s: invalid position", g.ID)
+					}
+					// GeoJSON positions are [longitude, latitude]
+					r = append(r, Point{Latitude: c[1], Longitude: c[0]})
+				}
+
+				if len(r) < 3 {
+					return nil, fmt.Errorf("feature %s: polygon ring must have at least 3 positions", g.ID)
+				}
+
+				g.polygon = append(g.polygon, r)
+			}
+
+			if len(g.polygon) == 0 {
+				return nil, fmt.Errorf("feature %s: polygon must have at least one ring", g.ID)
+			}
+		case "Point":
+			var c []float64
+			if err := json.Unmarshal(f.Geometry.Coordinates, &c); err != nil {
+				return nil, errors.Wrapf(err, "feature %s: unmarshal coordinates error", g.ID)
+			}
+
+			if len(c) < 2 {
+				return nil, fmt.Errorf("feature %s: invalid position", g.ID)
+			}
+
+			if f.Properties.Radius <= 0 {
+				return nil, fmt.Errorf("feature %s: point feature must have a radius property", g.ID)
+			}
+
+			g.center = &Point{Latitude: c[1], Longitude: c[0]}
+			g.radius = f.Properties.Radius
+		default:
+			continue
+		}
+
+		out = append(out, g)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,114 @@
+package geofence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-geolocation-server/internal/storage"
+	"github.com/brocaar/lorawan"
+)
+
+const testGeoJSON = `
+{
+	"type": "FeatureCollection",
+	"features": [
+		{
+			"type": "Feature",
+			"id": "site-a",
+			"properties": {
+				"name": "Site A",
+				"clip": true,
+				"dev_euis": ["0102030405060708"]
+			},
+			"geometry": {
+				"type": "Polygon",
+				"coordinates": [
+					[[5.0, 52.0], [5.01, 52.0], [5.01, 52.01], [5.0, 52.01], [5.0, 52.0]],
+					[[5.004, 52.004], [5.006, 52.004], [5.006, 52.006], [5.004, 52.006], [5.004, 52.004]]
+				]
+			}
+		},
+		{
+			"type": "Feature",
+			"properties": {
+				"name": "Circle",
+				"radius": 100
+			},
+			"geometry": {
+				"type": "Point",
+				"coordinates": [4.0, 51.0]
+			}
+		},
+		{
+			"type": "Feature",
+			"properties": {},
+			"geometry": {
+				"type": "LineString",
+				"coordinates": [[4.0, 51.0], [5.0, 52.0]]
+			}
+		}
+	]
+}
+`
+
+func TestGeofence(t *testing.T) {
+	assert := require.New(t)
+
+	fences, err := Parse([]byte(testGeoJSON))
+	assert.NoError(err)
+	assert.Len(fences, 2)
+
+	polygon := fences[0]
+	circle := fences[1]
+
+	t.Run("Properties", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.Equal("site-a", polygon.ID)
+		assert.Equal("Site A", polygon.Name)
+		assert.True(polygon.Clip)
+		assert.True(polygon.AppliesTo(lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}))
+		assert.False(polygon.AppliesTo(lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 1}))
+
+		assert.Equal("1", circle.ID)
+		assert.Equal("Circle", circle.Name)
+		assert.True(circle.AppliesTo(lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 1}))
+	})
+
+	t.Run("Contains", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.True(polygon.Contains(Point{Latitude: 52.002, Longitude: 5.002}))
+		assert.False(polygon.Contains(Point{Latitude: 52.005, Longitude: 5.005}))
+		assert.False(polygon.Contains(Point{Latitude: 52.02, Longitude: 5.002}))
+
+		assert.True(circle.Contains(Point{Latitude: 51.0005, Longitude: 4.0}))
+		assert.False(circle.Contains(Point{Latitude: 51.001, Longitude: 4.0}))
+	})
+
+	t.Run("Nearest", func(t *testing.T) {
+		assert := require.New(t)
+
+		// ~111m north of the polygon
+		p, dist := polygon.Nearest(Point{Latitude: 52.011, Longitude: 5.005})
+		assert.InDelta(111, dist, 1)
+		assert.InDelta(52.01, p.Latitude, 0.00001)
+		assert.InDelta(5.005, p.Longitude, 0.00001)
+
+		// ~111m north of the circle center
+		p, dist = circle.Nearest(Point{Latitude: 51.001, Longitude: 4.0})
+		assert.InDelta(11, dist, 1)
+		assert.InDelta(100, storage.Distance(51.0, 4.0, p.Latitude, p.Longitude), 0.1)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := Parse([]byte(`{"type": "Feature"}`))
+		assert.Error(err)
+
+		_, err = Parse([]byte(`{"type": "FeatureCollection", "features": [{"type": "Feature", "geometry": {"type": "Point", "coordinates": [1, 2]}}]}`))
+		assert.Error(err)
+	})
+}
@@ -0,0 +1,55 @@
+package geofence
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// loadTimeout defines the timeout for loading the geofences from an URL.
+const loadTimeout = 10 * time.Second
+
+// Load loads the geofences from the given source, which is either a path
+// to a GeoJSON file or a http(s) URL.
+func Load(source string) ([]Geofence, error) {
+	var b []byte
+	var err error
+
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		b, err = loadURL(source)
+	} else {
+		b, err = ioutil.ReadFile(source)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read geofences error")
+	}
+
+	return Parse(b)
+}
+
+func loadURL(u string) ([]byte, error) {
+	client := http.Client{
+		Timeout: loadTimeout,
+	}
+
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, errors.Wrap(err, "http request error")
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "read body error")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("expected 200, got: %d (%s)", resp.StatusCode, string(b))
+	}
+
+	return b, nil
+}
@@ -0,0 +1,258 @@
+// Package health implements the health and readiness reporting of the
+// geolocation server, both as gRPC health service (grpc.health.v1) and as
+// HTTP /healthz and /readyz endpoints.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Check names.
+const (
+	CheckBackend  = "backend"
+	CheckUpstream = "upstream"
+	CheckShutdown = "shutdown"
+)
+
+// ErrNotInitialized is returned when the backend has not yet been
+// initialized.
+var ErrNotInitialized = errors.New("not initialized")
+
+// Prober defines the interface for probing the upstream geolocation
+// service. Backends may implement this interface.
+type Prober interface {
+	Probe(ctx context.Context) error
+}
+
+var (
+	mu       sync.RWMutex
+	checks   = map[string]error{CheckBackend: ErrNotInitialized}
+	services []string
+
+	grpcServer = health.NewServer()
+
+	probe *upstreamProbe
+)
+
+func init() {
+	grpcServer.SetServingStatus("", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+}
+
+// GRPCServer returns the gRPC health server.
+func GRPCServer() *health.Server {
+	return grpcServer
+}
+
+// RegisterService registers a gRPC service name, of which the serving status
+// follows the readiness state.
+func RegisterService(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, s := range services {
+		if s == name {
+			return
+		}
+	}
+
+	services = append(services, name)
+	updateServingStatus()
+}
+
+// SetCheck sets the result of the given check. A nil error means the check
+// passed.
+func SetCheck(name string, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	prev, ok := checks[name]
+	checks[name] = err
+
+	if !ok || (prev == nil) != (err == nil) {
+		if err != nil {
+			log.WithError(err).WithField("check", name).Warning("health: check failed")
+		} else {
+			log.WithField("check", name).Info("health: check passed")
+		}
+	}
+
+	updateServingStatus()
+}
+
+// RemoveCheck removes the given check.
+func RemoveCheck(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	delete(checks, name)
+	updateServingStatus()
+}
+
+// Ready returns nil when all checks passed, else it returns an error
+// containing all failed checks.
+func Ready() error {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return ready()
+}
+
+func ready() error {
+	var failed []string
+	for name, err := range checks {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", name, err))
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+
+	sort.Strings(failed)
+	return errors.New(strings.Join(failed, ", "))
+}
+
+func updateServingStatus() {
+	status := grpc_health_v1.HealthCheckResponse_SERVING
+	if ready() != nil {
+		status = grpc_health_v1.HealthCheckResponse_NOT_SERVING
+	}
+
+	grpcServer.SetServingStatus("", status)
+	for _, s := range services {
+		grpcServer.SetServingStatus(s, status)
+	}
+}
+
+// LivenessHandler returns 200 as long as the process is able to serve
+// requests.
+func LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// ReadinessHandler returns 200 when all checks passed, 503 otherwise.
+func ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if err := Ready(); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+
+	w.Write([]byte("ok\n"))
+}
+
+// SetUpstreamProbe starts periodically probing the upstream geolocation
+// service using the given Prober. The upstream check fails (the circuit is
+// open) after the given number of consecutive failed probes, and passes
+// again after the first successful probe. Any previously started probe is
+// stopped. When p is nil, the upstream probe is disabled.
+func SetUpstreamProbe(p Prober, interval, timeout time.Duration, threshold int) {
+	mu.Lock()
+	prev := probe
+	probe = nil
+	mu.Unlock()
+
+	if prev != nil {
+		prev.close()
+	}
+
+	if p == nil {
+		RemoveCheck(CheckUpstream)
+		return
+	}
+
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	up := upstreamProbe{
+		prober:    p,
+		interval:  interval,
+		timeout:   timeout,
+		threshold: threshold,
+		closed:    make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	mu.Lock()
+	probe = &up
+	mu.Unlock()
+
+	// the upstream is assumed to be healthy until proven otherwise
+	SetCheck(CheckUpstream, nil)
+
+	go up.loop()
+}
+
+// Close stops the upstream probe.
+func Close() {
+	SetUpstreamProbe(nil, 0, 0, 0)
+}
+
+type upstreamProbe struct {
+	prober    Prober
+	interval  time.Duration
+	timeout   time.Duration
+	threshold int
+	failures  int
+	closed    chan struct{}
+	done      chan struct{}
+}
+
+func (p *upstreamProbe) loop() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.probe()
+
+		select {
+		case <-p.closed:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *upstreamProbe) probe() {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	err := p.prober.Probe(ctx)
+	if err == nil {
+		p.failures = 0
+		upstreamProbeCounter("success").Inc()
+		SetCheck(CheckUpstream, nil)
+		return
+	}
+
+	p.failures++
+	upstreamProbeCounter("error").Inc()
+	log.WithError(err).WithField("failures", p.failures).Warning("health: upstream probe error")
+
+	if p.failures >= p.threshold {
+		SetCheck(CheckUpstream, fmt.Errorf("circuit open after %d failed probes: %s", p.failures, err))
+	}
+}
+
+func (p *upstreamProbe) close() {
+	close(p.closed)
+	<-p.done
+}
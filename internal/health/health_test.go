@@ -0,0 +1,113 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type testProber struct {
+	mu     sync.Mutex
+	err    error
+	probes chan struct{}
+}
+
+func (p *testProber) Probe(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	select {
+	case p.probes <- struct{}{}:
+	default:
+	}
+
+	return p.err
+}
+
+func (p *testProber) setError(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+func servingStatus(assert *require.Assertions, service string) grpc_health_v1.HealthCheckResponse_ServingStatus {
+	resp, err := GRPCServer().Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: service})
+	assert.NoError(err)
+	return resp.Status
+}
+
+func readyz() int {
+	w := httptest.NewRecorder()
+	ReadinessHandler(w, httptest.NewRequest("GET", "/readyz", nil))
+	return w.Code
+}
+
+func TestHealth(t *testing.T) {
+	log.SetLevel(log.ErrorLevel)
+	SetCheck(CheckBackend, ErrNotInitialized)
+	RegisterService("geo.GeolocationServerService")
+
+	t.Run("liveness", func(t *testing.T) {
+		assert := require.New(t)
+
+		w := httptest.NewRecorder()
+		LivenessHandler(w, httptest.NewRequest("GET", "/healthz", nil))
+		assert.Equal(http.StatusOK, w.Code)
+	})
+
+	t.Run("not initialized", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.Error(Ready())
+		assert.Equal(http.StatusServiceUnavailable, readyz())
+		assert.Equal(grpc_health_v1.HealthCheckResponse_NOT_SERVING, servingStatus(assert, ""))
+		assert.Equal(grpc_health_v1.HealthCheckResponse_NOT_SERVING, servingStatus(assert, "geo.GeolocationServerService"))
+	})
+
+	t.Run("backend ready", func(t *testing.T) {
+		assert := require.New(t)
+
+		SetCheck(CheckBackend, nil)
+		assert.NoError(Ready())
+		assert.Equal(http.StatusOK, readyz())
+		assert.Equal(grpc_health_v1.HealthCheckResponse_SERVING, servingStatus(assert, ""))
+		assert.Equal(grpc_health_v1.HealthCheckResponse_SERVING, servingStatus(assert, "geo.GeolocationServerService"))
+	})
+
+	t.Run("upstream probe", func(t *testing.T) {
+		assert := require.New(t)
+
+		p := testProber{probes: make(chan struct{})}
+		SetUpstreamProbe(&p, time.Millisecond, time.Second, 2)
+		defer Close()
+
+		<-p.probes
+		assert.NoError(Ready())
+
+		p.setError(errors.New("connection refused"))
+		for i := 0; i < 3; i++ {
+			<-p.probes
+		}
+		// the third probe only starts after the second has been processed
+		assert.Error(Ready())
+		assert.Contains(Ready().Error(), "upstream: circuit open after")
+		assert.Equal(grpc_health_v1.HealthCheckResponse_NOT_SERVING, servingStatus(assert, ""))
+
+		p.setError(nil)
+		for i := 0; i < 2; i++ {
+			<-p.probes
+		}
+		assert.NoError(Ready())
+
+		Close()
+		assert.NoError(Ready())
+	})
+}
@@ -0,0 +1,27 @@
+package health
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	pc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "health_upstream_probe_count",
+		Help: "The number of upstream probes (per result).",
+	}, []string{"result"})
+
+	rg = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "health_ready",
+		Help: "Set to 1 when the geolocation server is ready to serve requests.",
+	}, func() float64 {
+		if Ready() == nil {
+			return 1
+		}
+		return 0
+	})
+)
+
+func upstreamProbeCounter(result string) prometheus.Counter {
+	return pc.With(prometheus.Labels{"result": result})
+}
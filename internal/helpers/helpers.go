@@ -0,0 +1,53 @@
+package helpers
+
+import (
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+
+	"github.com/brocaar/chirpstack-api/go/v3/geo"
+)
+
+// GetFrameTime returns the most recent gateway RX time of the given frames.
+// When none of the gateways provided a RX time, the current time is
+// returned.
+func GetFrameTime(frames []*geo.FrameRXInfo) time.Time {
+	var out time.Time
+
+	for _, frame := range frames {
+		if frame == nil {
+			continue
+		}
+
+		for _, rxInfo := range frame.RxInfo {
+			if rxInfo.Time == nil {
+				continue
+			}
+
+			t, err := ptypes.Timestamp(rxInfo.Time)
+			if err != nil {
+				continue
+			}
+
+			if t.After(out) {
+				out = t
+			}
+		}
+	}
+
+	if out.IsZero() {
+		return time.Now()
+	}
+
+	return out
+}
+
+// GetGatewayCount returns the total number of gateway receptions of the
+// given frames.
+func GetGatewayCount(frames []*geo.FrameRXInfo) int {
+	var out int
+	for _, frame := range frames {
+		out += len(frame.GetRxInfo())
+	}
+	return out
+}
@@ -0,0 +1,95 @@
+// Package async implements an asynchronous integration wrapper, which
+// makes sure that sending events never blocks the caller.
+package async
+
+import (
+	"context"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-geolocation-server/api/integration"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/integration/models"
+)
+
+// Integration implements the async integration wrapper. Events are queued
+// and sent by a background worker. When the queue is full, events are
+// dropped.
+type Integration struct {
+	integration models.Integrator
+	queue       chan func(models.Integrator) error
+	done        chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// New creates a new async integration wrapper, using a queue of the given
+// size.
+func New(i models.Integrator, queueSize int) *Integration {
+	a := Integration{
+		integration: i,
+		queue:       make(chan func(models.Integrator) error, queueSize),
+		done:        make(chan struct{}),
+	}
+
+	go a.worker()
+
+	return &a
+}
+
+// SendLocationEvent queues the LocationEvent.
+func (i *Integration) SendLocationEvent(ctx context.Context, pl integration.LocationEvent) error {
+	i.enqueue("location", func(ii models.Integrator) error {
+		return ii.SendLocationEvent(context.Background(), pl)
+	})
+	return nil
+}
+
+// SendGeofenceEvent queues the GeofenceEvent.
+func (i *Integration) SendGeofenceEvent(ctx context.Context, pl integration.GeofenceEvent) error {
+	i.enqueue("geofence", func(ii models.Integrator) error {
+		return ii.SendGeofenceEvent(context.Background(), pl)
+	})
+	return nil
+}
+
+// Close sends the queued events and closes the wrapped integration.
+// Events sent after Close are dropped.
+func (i *Integration) Close() error {
+	i.mu.Lock()
+	i.closed = true
+	close(i.queue)
+	i.mu.Unlock()
+
+	<-i.done
+	return i.integration.Close()
+}
+
+func (i *Integration) enqueue(event string, f func(models.Integrator) error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if i.closed {
+		droppedCounter(event).Inc()
+		log.WithField("event", event).Warning("integration/async: integration is closed, event dropped")
+		return
+	}
+
+	select {
+	case i.queue <- f:
+	default:
+		droppedCounter(event).Inc()
+		log.WithField("event", event).Warning("integration/async: queue is full, event dropped")
+	}
+}
+
+func (i *Integration) worker() {
+	defer close(i.done)
+
+	for f := range i.queue {
+		if err := f(i.integration); err != nil {
+			log.WithError(err).Error("integration/async: send event error")
+		}
+	}
+}
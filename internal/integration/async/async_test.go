@@ -0,0 +1,77 @@
+package async
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-geolocation-server/api/integration"
+)
+
+type blockingIntegration struct {
+	unblock chan struct{}
+	events  chan integration.LocationEvent
+	closed  bool
+}
+
+func (i *blockingIntegration) SendLocationEvent(ctx context.Context, pl integration.LocationEvent) error {
+	<-i.unblock
+	i.events <- pl
+	return nil
+}
+
+func (i *blockingIntegration) SendGeofenceEvent(ctx context.Context, pl integration.GeofenceEvent) error {
+	return nil
+}
+
+func (i *blockingIntegration) Close() error {
+	i.closed = true
+	return nil
+}
+
+func TestAsync(t *testing.T) {
+	assert := require.New(t)
+	log.SetLevel(log.ErrorLevel)
+
+	bi := blockingIntegration{
+		unblock: make(chan struct{}),
+		events:  make(chan integration.LocationEvent, 10),
+	}
+	i := New(&bi, 2)
+
+	// the first event is picked up by the worker (which blocks), the next
+	// two are queued and the last one is dropped
+	done := make(chan struct{})
+	go func() {
+		for j := 0; j < 4; j++ {
+			assert.NoError(i.SendLocationEvent(context.Background(), integration.LocationEvent{FrameCount: uint32(j)}))
+			if j == 0 {
+				time.Sleep(50 * time.Millisecond)
+			}
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("send blocked")
+	}
+
+	close(bi.unblock)
+	assert.NoError(i.Close())
+	assert.True(bi.closed)
+
+	// events sent after close are dropped
+	assert.NoError(i.SendLocationEvent(context.Background(), integration.LocationEvent{FrameCount: 4}))
+
+	close(bi.events)
+	var sent []uint32
+	for pl := range bi.events {
+		sent = append(sent, pl.FrameCount)
+	}
+	assert.Equal([]uint32{0, 1, 2}, sent)
+}
@@ -0,0 +1,17 @@
+package async
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	dc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_async_dropped_count",
+		Help: "The number of events dropped because the queue was full (per event).",
+	}, []string{"event"})
+)
+
+func droppedCounter(e string) prometheus.Counter {
+	return dc.With(prometheus.Labels{"event": e})
+}
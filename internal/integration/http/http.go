@@ -0,0 +1,361 @@
+// Package http implements a HTTP (webhook) integration.
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-geolocation-server/api/integration"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/integration/marshaler"
+)
+
+// SignatureHeader defines the header containing the HMAC-SHA256 signature
+// of the payload (when a HMAC secret has been configured).
+const SignatureHeader = "X-Signature-256"
+
+// Backoff of an endpoint which can't be reached. The backoff doubles with
+// each consecutive connection failure.
+const (
+	minBackoff = time.Second
+	maxBackoff = 5 * time.Minute
+)
+
+// errBackoff is returned when an endpoint is not posted to, because it
+// could not be reached recently.
+var errBackoff = errors.New("endpoint unavailable, backing off")
+
+// connectionError is returned when the endpoint could not be reached, e.g.
+// the connection was refused or timed out.
+type connectionError struct {
+	err error
+}
+
+func (e *connectionError) Error() string {
+	return e.err.Error()
+}
+
+// backoff holds the backoff state of an endpoint.
+type backoff struct {
+	failures int
+	until    time.Time
+}
+
+// Integration implements the HTTP integration. Events are POSTed to each
+// configured endpoint, the event type is added as the event query
+// parameter. Failed deliveries are stored in the retry queue (when
+// configured). An endpoint which can't be reached is backed off, such that
+// it does not block the delivery of other events (and integrations).
+type Integration struct {
+	marshaler  marshaler.Type
+	endpoints  []string
+	headers    map[string]string
+	hmacSecret []byte
+	timeout    time.Duration
+
+	backoffMu sync.Mutex
+	backoff   map[string]*backoff
+
+	queue         *queue
+	retryInterval time.Duration
+	maxRetries    int
+	closed        chan struct{}
+	done          chan struct{}
+}
+
+// New creates a new HTTP integration.
+func New(c config.Config) (*Integration, error) {
+	conf := c.GeoServer.Integration.HTTP
+
+	if err := marshaler.Validate(marshaler.Type(c.GeoServer.Integration.Marshaler)); err != nil {
+		return nil, err
+	}
+
+	for _, e := range conf.Endpoints {
+		if _, err := url.Parse(e); err != nil {
+			return nil, errors.Wrapf(err, "parse endpoint %s error", e)
+		}
+	}
+
+	i := Integration{
+		marshaler:     marshaler.Type(c.GeoServer.Integration.Marshaler),
+		endpoints:     conf.Endpoints,
+		headers:       conf.Headers,
+		hmacSecret:    []byte(conf.HMACSecret),
+		timeout:       conf.Timeout,
+		backoff:       make(map[string]*backoff),
+		retryInterval: conf.RetryInterval,
+		maxRetries:    conf.MaxRetries,
+		closed:        make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	if conf.RetryQueueDir != "" {
+		var err error
+		i.queue, err = newQueue(conf.RetryQueueDir, conf.RetryQueueSize)
+		if err != nil {
+			return nil, errors.Wrap(err, "open retry queue error")
+		}
+
+		go i.retryLoop()
+	} else {
+		close(i.done)
+	}
+
+	return &i, nil
+}
+
+// SendLocationEvent sends the LocationEvent.
+func (i *Integration) SendLocationEvent(ctx context.Context, pl integration.LocationEvent) error {
+	return i.send(ctx, "location", &pl)
+}
+
+// SendGeofenceEvent sends the GeofenceEvent.
+func (i *Integration) SendGeofenceEvent(ctx context.Context, pl integration.GeofenceEvent) error {
+	return i.send(ctx, "geofence", &pl)
+}
+
+// Close closes the integration.
+func (i *Integration) Close() error {
+	close(i.closed)
+	<-i.done
+	return nil
+}
+
+func (i *Integration) send(ctx context.Context, event string, pl proto.Message) error {
+	b, err := marshaler.Marshal(i.marshaler, pl)
+	if err != nil {
+		return errors.Wrap(err, "marshal event error")
+	}
+
+	var out error
+	for _, e := range i.endpoints {
+		if err := i.deliver(ctx, e, event, b); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"endpoint": config.RedactURL(e),
+				"event":    event,
+			}).Error("integration/http: send event error")
+
+			if i.queue == nil {
+				deliveryCounter(event, "error").Inc()
+				out = err
+				continue
+			}
+
+			// when backing off, no delivery has been attempted
+			attempts := 1
+			if err == errBackoff {
+				attempts = 0
+			}
+
+			if err := i.queue.push(queueItem{
+				Endpoint: e,
+				Event:    event,
+				Payload:  b,
+				Attempts: attempts,
+			}); err != nil {
+				deliveryCounter(event, "dropped").Inc()
+				out = errors.Wrap(err, "queue event error")
+				continue
+			}
+
+			deliveryCounter(event, "queued").Inc()
+			continue
+		}
+
+		deliveryCounter(event, "success").Inc()
+	}
+
+	return out
+}
+
+// retryLoop retries the queued deliveries, until the integration is closed.
+func (i *Integration) retryLoop() {
+	defer close(i.done)
+
+	ticker := time.NewTicker(i.retryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-i.closed:
+			return
+		case <-ticker.C:
+			i.retry()
+		}
+	}
+}
+
+// retry retries the queued deliveries. Deliveries which keep failing are
+// dropped after the max. number of retries. The deliveries to endpoints
+// which are backed off are skipped. When an endpoint can't be reached, the
+// remaining deliveries are retried in the next pass.
+func (i *Integration) retry() {
+	items, err := i.queue.list()
+	if err != nil {
+		log.WithError(err).Error("integration/http: list retry queue error")
+		return
+	}
+
+	for _, id := range items {
+		select {
+		case <-i.closed:
+			return
+		default:
+		}
+
+		item, err := i.queue.get(id)
+		if err != nil {
+			log.WithError(err).WithField("id", id).Error("integration/http: read retry queue item error")
+			i.queue.remove(id)
+			continue
+		}
+
+		err = i.deliver(context.Background(), item.Endpoint, item.Event, item.Payload)
+		if err == nil {
+			deliveryCounter(item.Event, "success").Inc()
+			i.queue.remove(id)
+			continue
+		}
+
+		if err == errBackoff {
+			continue
+		}
+
+		item.Attempts++
+		logger := log.WithError(err).WithFields(log.Fields{
+			"endpoint": config.RedactURL(item.Endpoint),
+			"event":    item.Event,
+			"attempts": item.Attempts,
+		})
+
+		if i.maxRetries != 0 && item.Attempts > i.maxRetries {
+			logger.Error("integration/http: max retries reached, event dropped")
+			deliveryCounter(item.Event, "dropped").Inc()
+			i.queue.remove(id)
+			continue
+		}
+
+		logger.Warning("integration/http: retry event error")
+		if err := i.queue.update(id, item); err != nil {
+			log.WithError(err).WithField("id", id).Error("integration/http: update retry queue item error")
+		}
+
+		if _, ok := err.(*connectionError); ok {
+			return
+		}
+	}
+}
+
+// deliver posts the event to the given endpoint, unless the endpoint is
+// backed off. It updates the backoff state of the endpoint.
+func (i *Integration) deliver(ctx context.Context, endpoint, event string, b []byte) error {
+	i.backoffMu.Lock()
+	bo, ok := i.backoff[endpoint]
+	backingOff := ok && time.Now().Before(bo.until)
+	i.backoffMu.Unlock()
+
+	if backingOff {
+		return errBackoff
+	}
+
+	err := i.post(ctx, endpoint, event, b)
+
+	i.backoffMu.Lock()
+	defer i.backoffMu.Unlock()
+
+	if _, ok := err.(*connectionError); !ok {
+		delete(i.backoff, endpoint)
+		return err
+	}
+
+	if bo = i.backoff[endpoint]; bo == nil {
+		bo = &backoff{}
+		i.backoff[endpoint] = bo
+	}
+	bo.failures++
+
+	d := maxBackoff
+	if bo.failures <= 10 {
+		if dd := minBackoff << uint(bo.failures-1); dd < maxBackoff {
+			d = dd
+		}
+	}
+	bo.until = time.Now().Add(d)
+
+	log.WithFields(log.Fields{
+		"endpoint": config.RedactURL(endpoint),
+		"backoff":  d,
+	}).Warning("integration/http: endpoint unavailable, backing off")
+
+	return err
+}
+
+func (i *Integration) post(ctx context.Context, endpoint, event string, b []byte) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return errors.Wrap(err, "parse url error")
+	}
+
+	q := u.Query()
+	q.Set("event", event)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("POST", u.String(), bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "new request error")
+	}
+
+	for k, v := range i.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", marshaler.ContentType(i.marshaler))
+
+	if len(i.hmacSecret) != 0 {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(i.hmacSecret, b))
+	}
+
+	reqCTX, cancel := context.WithTimeout(ctx, i.timeout)
+	defer cancel()
+
+	start := time.Now()
+	req = req.WithContext(reqCTX)
+	resp, err := http.DefaultClient.Do(req)
+	deliveryDuration(event).Observe(float64(time.Since(start)) / float64(time.Second))
+	if err != nil {
+		return &connectionError{err: errors.Wrap(err, "http request error")}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		bb, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("expected 2XX, got: %d (%s)", resp.StatusCode, string(bb))
+	}
+
+	log.WithFields(log.Fields{
+		"endpoint": config.RedactURL(endpoint),
+		"event":    event,
+	}).Debug("integration/http: event sent")
+
+	return nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 signature of the given payload.
+func Sign(secret, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
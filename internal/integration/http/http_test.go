@@ -0,0 +1,295 @@
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/brocaar/chirpstack-geolocation-server/api/integration"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+)
+
+type request struct {
+	event   string
+	headers http.Header
+	body    []byte
+}
+
+type HTTPTestSuite struct {
+	suite.Suite
+
+	server   *httptest.Server
+	mu       sync.Mutex
+	status   int
+	requests chan request
+	queueDir string
+}
+
+func (ts *HTTPTestSuite) SetupTest() {
+	assert := require.New(ts.T())
+
+	ts.status = http.StatusOK
+	ts.requests = make(chan request, 10)
+	ts.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		ts.requests <- request{
+			event:   r.URL.Query().Get("event"),
+			headers: r.Header,
+			body:    b,
+		}
+
+		ts.mu.Lock()
+		defer ts.mu.Unlock()
+		w.WriteHeader(ts.status)
+	}))
+
+	var err error
+	ts.queueDir, err = ioutil.TempDir("", "http-queue")
+	assert.NoError(err)
+}
+
+func (ts *HTTPTestSuite) TearDownTest() {
+	ts.server.Close()
+	os.RemoveAll(ts.queueDir)
+}
+
+func (ts *HTTPTestSuite) setStatus(status int) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.status = status
+}
+
+// drain discards the pending requests.
+func (ts *HTTPTestSuite) drain() {
+	for {
+		select {
+		case <-ts.requests:
+		default:
+			return
+		}
+	}
+}
+
+// queueEmpty waits until the retry queue is empty.
+func (ts *HTTPTestSuite) queueEmpty(q *queue) bool {
+	for n := 0; n < 100; n++ {
+		items, err := q.list()
+		if err == nil && len(items) == 0 {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func (ts *HTTPTestSuite) getConfig() config.Config {
+	var c config.Config
+	c.GeoServer.Integration.Marshaler = "json"
+	c.GeoServer.Integration.HTTP.Endpoints = []string{ts.server.URL}
+	c.GeoServer.Integration.HTTP.Headers = map[string]string{"Authorization": "Bearer foo"}
+	c.GeoServer.Integration.HTTP.HMACSecret = "secret"
+	c.GeoServer.Integration.HTTP.Timeout = time.Second
+	c.GeoServer.Integration.HTTP.RetryQueueDir = ts.queueDir
+	c.GeoServer.Integration.HTTP.RetryQueueSize = 2
+	c.GeoServer.Integration.HTTP.RetryInterval = 10 * time.Millisecond
+	c.GeoServer.Integration.HTTP.MaxRetries = 2
+	return c
+}
+
+func (ts *HTTPTestSuite) TestSend() {
+	assert := require.New(ts.T())
+
+	i, err := New(ts.getConfig())
+	assert.NoError(err)
+	defer i.Close()
+
+	assert.NoError(i.SendLocationEvent(context.Background(), integration.LocationEvent{
+		DevEui: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+	}))
+
+	req := <-ts.requests
+	assert.Equal("location", req.event)
+	assert.Equal("Bearer foo", req.headers.Get("Authorization"))
+	assert.Equal("application/json", req.headers.Get("Content-Type"))
+	assert.Equal("sha256="+Sign([]byte("secret"), req.body), req.headers.Get(SignatureHeader))
+}
+
+func (ts *HTTPTestSuite) TestRetry() {
+	ts.Run("failed delivery is retried", func() {
+		assert := require.New(ts.T())
+		ts.setStatus(http.StatusInternalServerError)
+
+		i, err := New(ts.getConfig())
+		assert.NoError(err)
+
+		assert.NoError(i.SendGeofenceEvent(context.Background(), integration.GeofenceEvent{
+			GeofenceId: "site-1",
+		}))
+		req := <-ts.requests
+		assert.Equal("geofence", req.event)
+
+		// wait for the first retry, then close
+		<-ts.requests
+		assert.NoError(i.Close())
+
+		items, err := i.queue.list()
+		assert.NoError(err)
+		assert.Len(items, 1)
+	})
+
+	ts.Run("queue is picked up after restart", func() {
+		assert := require.New(ts.T())
+		ts.drain()
+		ts.setStatus(http.StatusOK)
+
+		i, err := New(ts.getConfig())
+		assert.NoError(err)
+		defer i.Close()
+
+		req := <-ts.requests
+		assert.Equal("geofence", req.event)
+		assert.Equal("sha256="+Sign([]byte("secret"), req.body), req.headers.Get(SignatureHeader))
+
+		assert.True(ts.queueEmpty(i.queue))
+	})
+
+	ts.Run("dropped after max retries", func() {
+		assert := require.New(ts.T())
+		ts.drain()
+		ts.setStatus(http.StatusInternalServerError)
+
+		i, err := New(ts.getConfig())
+		assert.NoError(err)
+		defer i.Close()
+
+		assert.NoError(i.SendLocationEvent(context.Background(), integration.LocationEvent{}))
+
+		// initial delivery + 2 retries, the last one exceeding the max
+		for n := 0; n < 3; n++ {
+			<-ts.requests
+		}
+
+		assert.True(ts.queueEmpty(i.queue))
+	})
+
+	ts.Run("queue full", func() {
+		assert := require.New(ts.T())
+		ts.setStatus(http.StatusInternalServerError)
+
+		c := ts.getConfig()
+		c.GeoServer.Integration.HTTP.RetryInterval = time.Hour
+
+		i, err := New(c)
+		assert.NoError(err)
+		defer i.Close()
+
+		assert.NoError(i.SendLocationEvent(context.Background(), integration.LocationEvent{}))
+		assert.NoError(i.SendLocationEvent(context.Background(), integration.LocationEvent{}))
+		assert.Error(i.SendLocationEvent(context.Background(), integration.LocationEvent{}))
+	})
+
+}
+
+func (ts *HTTPTestSuite) TestBackoff() {
+	assert := require.New(ts.T())
+
+	// an endpoint which refuses connections
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	c := ts.getConfig()
+	c.GeoServer.Integration.HTTP.Endpoints = []string{server.URL}
+	c.GeoServer.Integration.HTTP.RetryInterval = time.Hour
+
+	i, err := New(c)
+	assert.NoError(err)
+	defer i.Close()
+
+	assert.NoError(i.SendLocationEvent(context.Background(), integration.LocationEvent{}))
+	assert.Equal(1, i.backoff[server.URL].failures)
+
+	// the endpoint is not posted to while backing off
+	assert.Equal(errBackoff, i.deliver(context.Background(), server.URL, "location", nil))
+	assert.NoError(i.SendLocationEvent(context.Background(), integration.LocationEvent{}))
+	assert.Equal(1, i.backoff[server.URL].failures)
+
+	ids, err := i.queue.list()
+	assert.NoError(err)
+	assert.Len(ids, 2)
+
+	var attempts []int
+	for _, id := range ids {
+		item, err := i.queue.get(id)
+		assert.NoError(err)
+		attempts = append(attempts, item.Attempts)
+	}
+	assert.Equal([]int{1, 0}, attempts)
+
+	// after the backoff, the retry pass stops at the first connection
+	// failure
+	i.backoff[server.URL].until = time.Now()
+	i.retry()
+	assert.Equal(2, i.backoff[server.URL].failures)
+
+	item, err := i.queue.get(ids[0])
+	assert.NoError(err)
+	assert.Equal(2, item.Attempts)
+
+	item, err = i.queue.get(ids[1])
+	assert.NoError(err)
+	assert.Equal(0, item.Attempts)
+}
+
+func TestQueue(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "http-queue")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	// left behind by an interrupted write
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "00000000000000000001-000001.json.tmp"), []byte("{"), 0600))
+
+	q, err := newQueue(dir, 2)
+	assert.NoError(err)
+	assert.Equal(0, q.size())
+
+	tmpFiles, err := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	assert.NoError(err)
+	assert.Len(tmpFiles, 0)
+
+	assert.NoError(q.push(queueItem{Event: "location"}))
+	assert.NoError(q.push(queueItem{Event: "geofence"}))
+	assert.EqualError(q.push(queueItem{}), "retry queue is full")
+	assert.Equal(2, q.size())
+
+	ids, err := q.list()
+	assert.NoError(err)
+	assert.Len(ids, 2)
+
+	item, err := q.get(ids[0])
+	assert.NoError(err)
+	assert.Equal("location", item.Event)
+
+	q.remove(ids[0])
+	q.remove(ids[0])
+	assert.Equal(1, q.size())
+
+	// the count is restored on open
+	q, err = newQueue(dir, 2)
+	assert.NoError(err)
+	assert.Equal(1, q.size())
+}
+
+func TestHTTP(t *testing.T) {
+	suite.Run(t, new(HTTPTestSuite))
+}
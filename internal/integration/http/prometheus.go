@@ -0,0 +1,35 @@
+package http
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	dc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_http_delivery_count",
+		Help: "The number of event deliveries (per event and status).",
+	}, []string{"event", "status"})
+
+	dd = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "integration_http_delivery_duration_seconds",
+		Help: "The duration of event delivery requests (per event).",
+	}, []string{"event"})
+
+	qs = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "integration_http_retry_queue_size",
+		Help: "The number of deliveries in the retry queue.",
+	})
+)
+
+func deliveryCounter(event, status string) prometheus.Counter {
+	return dc.With(prometheus.Labels{"event": event, "status": status})
+}
+
+func deliveryDuration(event string) prometheus.Observer {
+	return dd.With(prometheus.Labels{"event": event})
+}
+
+func retryQueueSize() prometheus.Gauge {
+	return qs
+}
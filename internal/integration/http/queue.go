@@ -0,0 +1,203 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	queueItemSuffix = ".json"
+	tmpSuffix       = ".tmp"
+)
+
+// queueItem defines a failed delivery, to be retried.
+type queueItem struct {
+	Endpoint string `json:"endpoint"`
+	Event    string `json:"event"`
+	Payload  []byte `json:"payload"`
+	Attempts int    `json:"attempts"`
+}
+
+// queue implements a bounded, file-based retry queue. Each item is stored
+// as a separate file, so that pending deliveries survive a restart. The
+// number of items is kept in memory, so that pushing and removing items
+// does not require a directory scan.
+type queue struct {
+	mu      sync.Mutex
+	dir     string
+	maxSize int
+	seq     int
+	count   int
+}
+
+func newQueue(dir string, maxSize int) (*queue, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, errors.Wrap(err, "make queue directory error")
+	}
+
+	q := queue{
+		dir:     dir,
+		maxSize: maxSize,
+	}
+
+	// temporary files are left behind when the process was stopped while
+	// writing an item, these items were never queued
+	tmpFiles, err := filepath.Glob(filepath.Join(dir, "*"+tmpSuffix))
+	if err != nil {
+		return nil, errors.Wrap(err, "list temporary files error")
+	}
+	for _, f := range tmpFiles {
+		if err := os.Remove(f); err != nil {
+			return nil, errors.Wrap(err, "remove temporary file error")
+		}
+	}
+
+	ids, err := q.list()
+	if err != nil {
+		return nil, err
+	}
+	q.count = len(ids)
+	retryQueueSize().Set(float64(q.count))
+
+	return &q, nil
+}
+
+// push adds the given item to the queue. It returns an error when the
+// queue is full.
+func (q *queue) push(item queueItem) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.maxSize != 0 && q.count >= q.maxSize {
+		return errors.New("retry queue is full")
+	}
+
+	b, err := json.Marshal(item)
+	if err != nil {
+		return errors.Wrap(err, "marshal queue item error")
+	}
+
+	// the id is sortable by insertion order
+	q.seq++
+	id := fmt.Sprintf("%020d-%06d", time.Now().UnixNano(), q.seq%1000000)
+
+	if err := writeFile(filepath.Join(q.dir, id+queueItemSuffix), b); err != nil {
+		return errors.Wrap(err, "write queue item error")
+	}
+
+	q.count++
+	retryQueueSize().Set(float64(q.count))
+
+	return nil
+}
+
+// list returns the ids of the queued items, oldest first.
+func (q *queue) list() ([]string, error) {
+	files, err := ioutil.ReadDir(q.dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "read queue directory error")
+	}
+
+	var out []string
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), queueItemSuffix) {
+			continue
+		}
+		out = append(out, strings.TrimSuffix(f.Name(), queueItemSuffix))
+	}
+
+	sort.Strings(out)
+
+	return out, nil
+}
+
+// get returns the queue item for the given id.
+func (q *queue) get(id string) (queueItem, error) {
+	var item queueItem
+
+	b, err := ioutil.ReadFile(filepath.Join(q.dir, id+queueItemSuffix))
+	if err != nil {
+		return item, errors.Wrap(err, "read queue item error")
+	}
+
+	if err := json.Unmarshal(b, &item); err != nil {
+		return item, errors.Wrap(err, "unmarshal queue item error")
+	}
+
+	return item, nil
+}
+
+// update overwrites the queue item for the given id.
+func (q *queue) update(id string, item queueItem) error {
+	b, err := json.Marshal(item)
+	if err != nil {
+		return errors.Wrap(err, "marshal queue item error")
+	}
+
+	if err := writeFile(filepath.Join(q.dir, id+queueItemSuffix), b); err != nil {
+		return errors.Wrap(err, "write queue item error")
+	}
+
+	return nil
+}
+
+// remove removes the queue item for the given id.
+func (q *queue) remove(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := os.Remove(filepath.Join(q.dir, id+queueItemSuffix)); err != nil {
+		return
+	}
+
+	q.count--
+	retryQueueSize().Set(float64(q.count))
+}
+
+// size returns the number of queued items.
+func (q *queue) size() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.count
+}
+
+// writeFile writes the file using a temporary file, such that readers never
+// see a partially written queue item. The file is synced before it is
+// renamed, such that a queue item is not lost (or empty) after a crash.
+func writeFile(path string, b []byte) error {
+	tmpPath := path + tmpSuffix
+
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
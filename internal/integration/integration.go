@@ -0,0 +1,69 @@
+// Package integration implements the integrations to which the
+// geolocation events are sent.
+package integration
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/integration/async"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/integration/http"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/integration/logger"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/integration/models"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/integration/mqtt"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/integration/multi"
+)
+
+var integration models.Integrator
+
+// Setup configures the integrations.
+func Setup(c config.Config) error {
+	var integrations []models.Integrator
+
+	for _, name := range c.GeoServer.Integration.Enabled {
+		var i models.Integrator
+		var err error
+
+		switch name {
+		case "log":
+			i = logger.New()
+		case "http":
+			i, err = http.New(c)
+		case "mqtt":
+			i, err = mqtt.New(c)
+		default:
+			return fmt.Errorf("unknown integration: %s", name)
+		}
+
+		if err != nil {
+			return errors.Wrapf(err, "new %s integration error", name)
+		}
+
+		integrations = append(integrations, i)
+	}
+
+	integration = async.New(multi.New(integrations), c.GeoServer.Integration.QueueSize)
+
+	return nil
+}
+
+// Integration returns the integration.
+func Integration() models.Integrator {
+	return integration
+}
+
+// Close closes the integration, sending the queued events first.
+func Close() error {
+	if integration == nil {
+		return nil
+	}
+
+	return integration.Close()
+}
+
+// SetIntegration sets the given integration.
+func SetIntegration(i models.Integrator) {
+	integration = i
+}
@@ -0,0 +1,77 @@
+// Package logger implements an integration which logs all events.
+package logger
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/ptypes"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-geolocation-server/api/integration"
+	"github.com/brocaar/lorawan"
+)
+
+// Integration implements the logger integration.
+type Integration struct{}
+
+// New creates a new logger integration.
+func New() *Integration {
+	return &Integration{}
+}
+
+// SendLocationEvent logs the given LocationEvent.
+func (i *Integration) SendLocationEvent(ctx context.Context, pl integration.LocationEvent) error {
+	var devEUI lorawan.EUI64
+	copy(devEUI[:], pl.DevEui)
+
+	fields := log.Fields{
+		"dev_eui":     devEUI,
+		"backend":     pl.Backend,
+		"frame_count": pl.FrameCount,
+		"gateways":    len(pl.RxInfo),
+	}
+
+	if pl.Location != nil {
+		fields["latitude"] = pl.Location.Latitude
+		fields["longitude"] = pl.Location.Longitude
+		fields["accuracy"] = pl.Location.Accuracy
+	}
+
+	log.WithFields(fields).Info("integration/logger: location event")
+
+	return nil
+}
+
+// SendGeofenceEvent logs the given GeofenceEvent.
+func (i *Integration) SendGeofenceEvent(ctx context.Context, pl integration.GeofenceEvent) error {
+	var devEUI lorawan.EUI64
+	copy(devEUI[:], pl.DevEui)
+
+	fields := log.Fields{
+		"dev_eui":       devEUI,
+		"type":          pl.Type,
+		"geofence_id":   pl.GeofenceId,
+		"geofence_name": pl.GeofenceName,
+	}
+
+	if pl.Location != nil {
+		fields["latitude"] = pl.Location.Latitude
+		fields["longitude"] = pl.Location.Longitude
+		fields["accuracy"] = pl.Location.Accuracy
+	}
+
+	if pl.DwellTime != nil {
+		if d, err := ptypes.Duration(pl.DwellTime); err == nil {
+			fields["dwell_time"] = d
+		}
+	}
+
+	log.WithFields(fields).Info("integration/logger: geofence event")
+
+	return nil
+}
+
+// Close closes the integration.
+func (i *Integration) Close() error {
+	return nil
+}
@@ -0,0 +1,60 @@
+// Package marshaler implements the marshaling of integration events.
+package marshaler
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+)
+
+// Type defines the marshaler type.
+type Type string
+
+// Marshaler types.
+const (
+	JSON     Type = "json"
+	Protobuf Type = "protobuf"
+)
+
+// Validate returns an error when the given marshaler type is not valid.
+func Validate(t Type) error {
+	switch t {
+	case JSON, Protobuf:
+		return nil
+	default:
+		return fmt.Errorf("invalid marshaler: %s", t)
+	}
+}
+
+// ContentType returns the content-type of the given marshaler type.
+func ContentType(t Type) string {
+	if t == Protobuf {
+		return "application/octet-stream"
+	}
+	return "application/json"
+}
+
+// Marshal marshals the given message using the given marshaler type.
+func Marshal(t Type, msg proto.Message) ([]byte, error) {
+	switch t {
+	case JSON:
+		m := jsonpb.Marshaler{
+			EmitDefaults: true,
+		}
+		s, err := m.MarshalToString(msg)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal json error")
+		}
+		return []byte(s), nil
+	case Protobuf:
+		b, err := proto.Marshal(msg)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal protobuf error")
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("invalid marshaler: %s", t)
+	}
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"context"
+
+	"github.com/brocaar/chirpstack-geolocation-server/api/integration"
+)
+
+// Integrator defines the interface that an integration must implement.
+type Integrator interface {
+	// SendLocationEvent sends a LocationEvent.
+	SendLocationEvent(ctx context.Context, pl integration.LocationEvent) error
+
+	// SendGeofenceEvent sends a GeofenceEvent.
+	SendGeofenceEvent(ctx context.Context, pl integration.GeofenceEvent) error
+
+	// Close closes the integration.
+	Close() error
+}
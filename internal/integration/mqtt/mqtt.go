@@ -0,0 +1,197 @@
+// Package mqtt implements a MQTT integration.
+package mqtt
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"text/template"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-geolocation-server/api/integration"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/integration/marshaler"
+	"github.com/brocaar/lorawan"
+)
+
+// publishTimeout defines the max. time to wait for a publish to complete.
+const publishTimeout = 10 * time.Second
+
+// Integration implements the MQTT integration.
+type Integration struct {
+	conn                  paho.Client
+	qos                   uint8
+	marshaler             marshaler.Type
+	locationTopicTemplate *template.Template
+	geofenceTopicTemplate *template.Template
+	closed                chan struct{}
+}
+
+// New creates a new MQTT integration. The connection to the MQTT broker is
+// established in the background, events sent while not connected return
+// an error.
+func New(c config.Config) (*Integration, error) {
+	conf := c.GeoServer.Integration.MQTT
+
+	var err error
+	i := Integration{
+		qos:       conf.QOS,
+		marshaler: marshaler.Type(c.GeoServer.Integration.Marshaler),
+		closed:    make(chan struct{}),
+	}
+
+	if err := marshaler.Validate(i.marshaler); err != nil {
+		return nil, err
+	}
+
+	i.locationTopicTemplate, err = template.New("location").Parse(conf.LocationTopicTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse location topic template error")
+	}
+
+	i.geofenceTopicTemplate, err = template.New("geofence").Parse(conf.GeofenceTopicTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse geofence topic template error")
+	}
+
+	opts := paho.NewClientOptions()
+	opts.AddBroker(conf.Server)
+	opts.SetUsername(conf.Username)
+	opts.SetPassword(conf.Password)
+	opts.SetClientID(conf.ClientID)
+	opts.SetCleanSession(conf.CleanSession)
+	opts.SetAutoReconnect(true)
+	opts.SetOnConnectHandler(func(c paho.Client) {
+		log.Info("integration/mqtt: connected to mqtt broker")
+	})
+	opts.SetConnectionLostHandler(func(c paho.Client, err error) {
+		log.WithError(err).Error("integration/mqtt: mqtt connection error")
+	})
+
+	tlsconfig, err := newTLSConfig(conf.CACert, conf.TLSCert, conf.TLSKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "read tls config error")
+	}
+	if tlsconfig != nil {
+		opts.SetTLSConfig(tlsconfig)
+	}
+
+	log.WithField("server", config.RedactURL(conf.Server)).Info("integration/mqtt: connecting to mqtt broker")
+	i.conn = paho.NewClient(opts)
+	go i.connectLoop()
+
+	return &i, nil
+}
+
+// SendLocationEvent sends the LocationEvent.
+func (i *Integration) SendLocationEvent(ctx context.Context, pl integration.LocationEvent) error {
+	return i.publish(i.locationTopicTemplate, pl.DevEui, &pl)
+}
+
+// SendGeofenceEvent sends the GeofenceEvent.
+func (i *Integration) SendGeofenceEvent(ctx context.Context, pl integration.GeofenceEvent) error {
+	return i.publish(i.geofenceTopicTemplate, pl.DevEui, &pl)
+}
+
+// Close closes the integration.
+func (i *Integration) Close() error {
+	log.Info("integration/mqtt: closing connection to mqtt broker")
+	close(i.closed)
+	i.conn.Disconnect(250)
+	return nil
+}
+
+// connectLoop connects to the broker, retrying until the initial connect
+// succeeds or the integration is closed. Once connected, reconnects are
+// handled by the client.
+func (i *Integration) connectLoop() {
+	for {
+		token := i.conn.Connect()
+		if token.Wait() && token.Error() == nil {
+			return
+		}
+
+		log.WithError(token.Error()).Error("integration/mqtt: connecting to broker error, will retry in 2s")
+
+		select {
+		case <-i.closed:
+			return
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+func (i *Integration) publish(topicTemplate *template.Template, devEUIB []byte, pl proto.Message) error {
+	var devEUI lorawan.EUI64
+	copy(devEUI[:], devEUIB)
+
+	topic := bytes.NewBuffer(nil)
+	if err := topicTemplate.Execute(topic, struct{ DevEUI lorawan.EUI64 }{devEUI}); err != nil {
+		return errors.Wrap(err, "execute topic template error")
+	}
+
+	b, err := marshaler.Marshal(i.marshaler, pl)
+	if err != nil {
+		return errors.Wrap(err, "marshal event error")
+	}
+
+	if !i.conn.IsConnected() {
+		return errors.New("not connected to mqtt broker")
+	}
+
+	log.WithFields(log.Fields{
+		"topic":   topic.String(),
+		"qos":     i.qos,
+		"dev_eui": devEUI,
+	}).Debug("integration/mqtt: publishing message")
+
+	token := i.conn.Publish(topic.String(), i.qos, false, b)
+	if !token.WaitTimeout(publishTimeout) {
+		return errors.New("publish timeout")
+	}
+	if err := token.Error(); err != nil {
+		return errors.Wrap(err, "publish error")
+	}
+
+	return nil
+}
+
+func newTLSConfig(cafile, certFile, certKeyFile string) (*tls.Config, error) {
+	if cafile == "" && certFile == "" && certKeyFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{}
+
+	// Import trusted certificates from CAfile.pem.
+	if cafile != "" {
+		cacert, err := ioutil.ReadFile(cafile)
+		if err != nil {
+			return nil, errors.Wrap(err, "load ca-cert error")
+		}
+		certpool := x509.NewCertPool()
+		if !certpool.AppendCertsFromPEM(cacert) {
+			return nil, errors.New("append ca certificate error")
+		}
+
+		tlsConfig.RootCAs = certpool // RootCAs = certs used to verify server cert.
+	}
+
+	// Import certificate and the key
+	if certFile != "" || certKeyFile != "" {
+		kp, err := tls.LoadX509KeyPair(certFile, certKeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "load tls key-pair error")
+		}
+		tlsConfig.Certificates = []tls.Certificate{kp}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,216 @@
+package mqtt
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/brocaar/chirpstack-geolocation-server/api/integration"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+)
+
+// testBroker implements a minimal MQTT broker stand-in, which accepts all
+// connections and forwards all published messages to the messages channel.
+type testBroker struct {
+	ln       net.Listener
+	messages chan *packets.PublishPacket
+}
+
+func newTestBroker() (*testBroker, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	b := testBroker{
+		ln:       ln,
+		messages: make(chan *packets.PublishPacket, 10),
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.handle(conn)
+		}
+	}()
+
+	return &b, nil
+}
+
+func (b *testBroker) handle(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		cp, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+
+		switch p := cp.(type) {
+		case *packets.ConnectPacket:
+			ack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+			ack.ReturnCode = packets.Accepted
+			ack.Write(conn)
+		case *packets.PublishPacket:
+			if p.Qos == 1 {
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				ack.Write(conn)
+			}
+			b.messages <- p
+		case *packets.PingreqPacket:
+			packets.NewControlPacket(packets.Pingresp).Write(conn)
+		case *packets.DisconnectPacket:
+			return
+		}
+	}
+}
+
+func (b *testBroker) Close() error {
+	return b.ln.Close()
+}
+
+type MQTTTestSuite struct {
+	suite.Suite
+
+	broker *testBroker
+}
+
+func (ts *MQTTTestSuite) SetupSuite() {
+	log.SetLevel(log.ErrorLevel)
+
+	var err error
+	ts.broker, err = newTestBroker()
+	ts.Require().NoError(err)
+}
+
+func (ts *MQTTTestSuite) TearDownSuite() {
+	ts.broker.Close()
+}
+
+func (ts *MQTTTestSuite) newIntegration(marshaler string) *Integration {
+	assert := require.New(ts.T())
+
+	var c config.Config
+	c.GeoServer.Integration.Marshaler = marshaler
+	c.GeoServer.Integration.MQTT.Server = "tcp://" + ts.broker.ln.Addr().String()
+	c.GeoServer.Integration.MQTT.QOS = 1
+	c.GeoServer.Integration.MQTT.CleanSession = true
+	c.GeoServer.Integration.MQTT.LocationTopicTemplate = "geo/{{ .DevEUI }}/location"
+	c.GeoServer.Integration.MQTT.GeofenceTopicTemplate = "geo/{{ .DevEUI }}/geofence"
+
+	i, err := New(c)
+	assert.NoError(err)
+
+	for start := time.Now(); !i.conn.IsConnected(); time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			ts.T().Fatal("connect timeout")
+		}
+	}
+
+	return i
+}
+
+func (ts *MQTTTestSuite) TestLocationEvent() {
+	pl := integration.LocationEvent{
+		DevEui:  []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		Backend: "lora_cloud",
+		Location: &integration.Location{
+			Latitude:  1.123,
+			Longitude: 2.123,
+			Altitude:  3.123,
+			Accuracy:  10,
+		},
+		FrameCount: 1,
+		RxInfo: []*integration.GatewayRXInfo{
+			{
+				GatewayId: []byte{1, 1, 1, 1, 1, 1, 1, 1},
+				Rssi:      -60,
+				LoraSnr:   5.5,
+			},
+		},
+	}
+
+	ts.T().Run("JSON", func(t *testing.T) {
+		assert := require.New(t)
+
+		i := ts.newIntegration("json")
+		defer i.Close()
+
+		assert.NoError(i.SendLocationEvent(context.Background(), pl))
+
+		msg := <-ts.broker.messages
+		assert.Equal("geo/0102030405060708/location", msg.TopicName)
+		assert.EqualValues(1, msg.Qos)
+
+		var out integration.LocationEvent
+		assert.NoError(jsonpb.UnmarshalString(string(msg.Payload), &out))
+		assert.True(proto.Equal(&pl, &out))
+	})
+
+	ts.T().Run("Protobuf", func(t *testing.T) {
+		assert := require.New(t)
+
+		i := ts.newIntegration("protobuf")
+		defer i.Close()
+
+		assert.NoError(i.SendLocationEvent(context.Background(), pl))
+
+		msg := <-ts.broker.messages
+		assert.Equal("geo/0102030405060708/location", msg.TopicName)
+
+		var out integration.LocationEvent
+		assert.NoError(proto.Unmarshal(msg.Payload, &out))
+		assert.True(proto.Equal(&pl, &out))
+	})
+}
+
+func (ts *MQTTTestSuite) TestGeofenceEvent() {
+	assert := require.New(ts.T())
+
+	i := ts.newIntegration("json")
+	defer i.Close()
+
+	pl := integration.GeofenceEvent{
+		DevEui:     []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		Type:       integration.GeofenceEventType_EXIT,
+		GeofenceId: "site",
+	}
+	assert.NoError(i.SendGeofenceEvent(context.Background(), pl))
+
+	msg := <-ts.broker.messages
+	assert.Equal("geo/0102030405060708/geofence", msg.TopicName)
+
+	var out integration.GeofenceEvent
+	assert.NoError(jsonpb.UnmarshalString(string(msg.Payload), &out))
+	assert.True(proto.Equal(&pl, &out))
+}
+
+func (ts *MQTTTestSuite) TestNotConnected() {
+	assert := require.New(ts.T())
+
+	var c config.Config
+	c.GeoServer.Integration.Marshaler = "json"
+	c.GeoServer.Integration.MQTT.Server = "tcp://127.0.0.1:1"
+
+	i, err := New(c)
+	assert.NoError(err)
+	defer i.Close()
+
+	assert.Error(i.SendLocationEvent(context.Background(), integration.LocationEvent{}))
+}
+
+func TestMQTT(t *testing.T) {
+	suite.Run(t, new(MQTTTestSuite))
+}
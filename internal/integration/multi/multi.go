@@ -0,0 +1,60 @@
+// Package multi implements a multi-integration handler.
+package multi
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-geolocation-server/api/integration"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/integration/models"
+)
+
+// Integration implements the multi integration, it forwards the events
+// to all the given integrations.
+type Integration struct {
+	integrations []models.Integrator
+}
+
+// New creates a new multi integration.
+func New(integrations []models.Integrator) *Integration {
+	return &Integration{
+		integrations: integrations,
+	}
+}
+
+// SendLocationEvent sends the LocationEvent to all integrations.
+func (i *Integration) SendLocationEvent(ctx context.Context, pl integration.LocationEvent) error {
+	var out error
+	for _, ii := range i.integrations {
+		if err := ii.SendLocationEvent(ctx, pl); err != nil {
+			log.WithError(err).Error("integration/multi: send location event error")
+			out = errors.Wrap(err, "send location event error")
+		}
+	}
+	return out
+}
+
+// SendGeofenceEvent sends the GeofenceEvent to all integrations.
+func (i *Integration) SendGeofenceEvent(ctx context.Context, pl integration.GeofenceEvent) error {
+	var out error
+	for _, ii := range i.integrations {
+		if err := ii.SendGeofenceEvent(ctx, pl); err != nil {
+			log.WithError(err).Error("integration/multi: send geofence event error")
+			out = errors.Wrap(err, "send geofence event error")
+		}
+	}
+	return out
+}
+
+// Close closes all integrations.
+func (i *Integration) Close() error {
+	var out error
+	for _, ii := range i.integrations {
+		if err := ii.Close(); err != nil {
+			out = errors.Wrap(err, "close integration error")
+		}
+	}
+	return out
+}
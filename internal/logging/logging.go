@@ -0,0 +1,142 @@
+// Package logging implements the log format configuration and the request
+// ID propagation, used to correlate the log lines of a single request.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"unicode"
+
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Log formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// RequestIDHeader is the HTTP header (and gRPC metadata key) containing the
+// request ID.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the max. length of a request ID provided by the
+// client. Longer (or otherwise invalid) IDs are replaced.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// SetFormat sets the log format.
+func SetFormat(format string) error {
+	switch format {
+	case "", FormatText:
+		log.SetFormatter(&log.TextFormatter{})
+	case FormatJSON:
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		return fmt.Errorf("unknown log format: %s", format)
+	}
+
+	return nil
+}
+
+// NewRequestID returns a new random (UUID v4) request ID.
+func NewRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// RequestID returns the given request ID when it is valid, or a new
+// request ID otherwise.
+func RequestID(id string) string {
+	if id == "" || len(id) > maxRequestIDLength || strings.IndexFunc(id, func(r rune) bool {
+		return r > unicode.MaxASCII || !unicode.IsPrint(r) || unicode.IsSpace(r)
+	}) != -1 {
+		return NewRequestID()
+	}
+	return id
+}
+
+// NewContext returns a new context containing the given request ID.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID from the context.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok
+}
+
+// FromContext returns a log entry, containing the request ID from the
+// given context (if any).
+func FromContext(ctx context.Context) *log.Entry {
+	if id, ok := RequestIDFromContext(ctx); ok {
+		return log.WithField("request_id", id)
+	}
+	return log.NewEntry(log.StandardLogger())
+}
+
+// UnaryServerInterceptor adds the request ID to the context and to the
+// request tags (and thus to the request logs). When the client provides a
+// request ID in the x-request-id metadata, this ID is used, else a new ID
+// is generated. The request ID is returned to the client in the response
+// header.
+func UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, id := requestContext(ctx)
+
+	if err := grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, id)); err != nil {
+		log.WithError(err).Debug("logging: set request id header error")
+	}
+
+	return handler(ctx, req)
+}
+
+// StreamServerInterceptor is the stream equivalent of
+// UnaryServerInterceptor.
+func StreamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, id := requestContext(ss.Context())
+
+	if err := ss.SetHeader(metadata.Pairs(RequestIDHeader, id)); err != nil {
+		log.WithError(err).Debug("logging: set request id header error")
+	}
+
+	return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+}
+
+// requestContext returns the context containing the request ID from the
+// incoming metadata (or a new request ID), and tags the request with it.
+func requestContext(ctx context.Context) (context.Context, string) {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(RequestIDHeader); len(v) != 0 {
+			id = v[0]
+		}
+	}
+	id = RequestID(id)
+
+	ctx = NewContext(ctx, id)
+	grpc_ctxtags.Extract(ctx).Set("request_id", id)
+
+	return ctx, id
+}
+
+// serverStream wraps a grpc.ServerStream, adding the request ID to the
+// context.
+type serverStream struct {
+	grpc.ServerStream
+
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
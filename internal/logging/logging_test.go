@@ -0,0 +1,168 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestSetFormat(t *testing.T) {
+	assert := require.New(t)
+	defer SetFormat(FormatText)
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(log.StandardLogger().Out)
+
+	assert.NoError(SetFormat(FormatJSON))
+	FromContext(NewContext(context.Background(), "abc")).Info("test")
+
+	var entry map[string]interface{}
+	assert.NoError(json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal("test", entry["msg"])
+	assert.Equal("abc", entry["request_id"])
+
+	assert.NoError(SetFormat(""))
+	assert.EqualError(SetFormat("xml"), "unknown log format: xml")
+}
+
+func TestRequestID(t *testing.T) {
+	assert := require.New(t)
+
+	generated := NewRequestID()
+	assert.Regexp("^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$", generated)
+	assert.NotEqual(generated, NewRequestID())
+
+	tests := []struct {
+		Name  string
+		ID    string
+		Valid bool
+	}{
+		{"valid", "req-123", true},
+		{"empty", "", false},
+		{"space", "req 123", false},
+		{"control character", "req\n123", false},
+		{"non-ascii", "réq", false},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+		{"max length", strings.Repeat("a", maxRequestIDLength), true},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+			id := RequestID(tst.ID)
+			if tst.Valid {
+				assert.Equal(tst.ID, id)
+			} else {
+				assert.NotEqual(tst.ID, id)
+				assert.Len(id, 36)
+			}
+		})
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	assert := require.New(t)
+
+	_, ok := RequestIDFromContext(context.Background())
+	assert.False(ok)
+	assert.NotContains(FromContext(context.Background()).Data, "request_id")
+
+	ctx := NewContext(context.Background(), "abc")
+	id, ok := RequestIDFromContext(ctx)
+	assert.True(ok)
+	assert.Equal("abc", id)
+	assert.Equal("abc", FromContext(ctx).Data["request_id"])
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	info := grpc.UnaryServerInfo{FullMethod: "/geo.GeolocationServerService/ResolveTDOA"}
+	interceptor := grpc_middleware.ChainUnaryServer(grpc_ctxtags.UnaryServerInterceptor(), UnaryServerInterceptor)
+
+	t.Run("provided", func(t *testing.T) {
+		assert := require.New(t)
+
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(RequestIDHeader, "req-123"))
+		_, err := interceptor(ctx, nil, &info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			id, ok := RequestIDFromContext(ctx)
+			assert.True(ok)
+			assert.Equal("req-123", id)
+			assert.Equal("req-123", grpc_ctxtags.Extract(ctx).Values()["request_id"])
+			return nil, nil
+		})
+		assert.NoError(err)
+	})
+
+	t.Run("generated", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := interceptor(context.Background(), nil, &info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			id, ok := RequestIDFromContext(ctx)
+			assert.True(ok)
+			assert.Len(id, 36)
+			assert.Equal(id, grpc_ctxtags.Extract(ctx).Values()["request_id"])
+			return nil, nil
+		})
+		assert.NoError(err)
+	})
+}
+
+type testServerStream struct {
+	grpc.ServerStream
+
+	ctx    context.Context
+	header metadata.MD
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *testServerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	info := grpc.StreamServerInfo{FullMethod: "/grpc.testing.TestService/StreamingOutputCall", IsServerStream: true}
+	interceptor := grpc_middleware.ChainStreamServer(grpc_ctxtags.StreamServerInterceptor(), StreamServerInterceptor)
+
+	t.Run("provided", func(t *testing.T) {
+		assert := require.New(t)
+
+		ss := testServerStream{ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs(RequestIDHeader, "req-123"))}
+		err := interceptor(nil, &ss, &info, func(srv interface{}, stream grpc.ServerStream) error {
+			id, ok := RequestIDFromContext(stream.Context())
+			assert.True(ok)
+			assert.Equal("req-123", id)
+			assert.Equal("req-123", grpc_ctxtags.Extract(stream.Context()).Values()["request_id"])
+			return nil
+		})
+		assert.NoError(err)
+		assert.Equal([]string{"req-123"}, ss.header.Get(RequestIDHeader))
+	})
+
+	t.Run("generated", func(t *testing.T) {
+		assert := require.New(t)
+
+		ss := testServerStream{ctx: context.Background()}
+		err := interceptor(nil, &ss, &info, func(srv interface{}, stream grpc.ServerStream) error {
+			id, ok := RequestIDFromContext(stream.Context())
+			assert.True(ok)
+			assert.Len(id, 36)
+			assert.Equal(id, grpc_ctxtags.Extract(stream.Context()).Values()["request_id"])
+			return nil
+		})
+		assert.NoError(err)
+		assert.Len(ss.header.Get(RequestIDHeader), 1)
+	})
+}
@@ -1,15 +1,21 @@
 package metrics
 
 import (
+	"context"
+	"net"
 	"net/http"
 
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/health"
 )
 
+var server *http.Server
+
 // Setup configures the metrics server.
 func Setup(c config.Config) error {
 	if !c.Metrics.Prometheus.EndpointEnabled {
@@ -24,15 +30,36 @@ func Setup(c config.Config) error {
 		"bind": c.Metrics.Prometheus.Bind,
 	}).Info("metrics: starting prometheus metrics server")
 
-	server := http.Server{
-		Handler: promhttp.Handler(),
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", health.LivenessHandler)
+	mux.HandleFunc("/readyz", health.ReadinessHandler)
+	mux.Handle("/", promhttp.Handler())
+
+	server = &http.Server{
+		Handler: mux,
 		Addr:    c.Metrics.Prometheus.Bind,
 	}
 
+	ln, err := net.Listen("tcp", c.Metrics.Prometheus.Bind)
+	if err != nil {
+		return errors.Wrap(err, "start metrics listener error")
+	}
+
 	go func() {
-		err := server.ListenAndServe()
-		log.WithError(err).Error("metrics: prometheus metrics server error")
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Fatal("metrics: prometheus metrics server error")
+		}
 	}()
 
 	return nil
 }
+
+// Shutdown stops the metrics server.
+func Shutdown(ctx context.Context) error {
+	if server == nil {
+		return nil
+	}
+
+	log.Info("metrics: stopping prometheus metrics server")
+	return server.Shutdown(ctx)
+}
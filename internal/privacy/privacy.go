@@ -0,0 +1,229 @@
+// Package privacy implements the pseudonymization and redaction of logged
+// geolocation requests, such that request logs can be shared while they
+// remain replayable.
+package privacy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/geo"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+)
+
+// HMAC domains, such that a DevEUI and gateway ID with the same value do not
+// map to the same pseudonym.
+const (
+	devEUIDomain    = "dev_eui"
+	gatewayIDDomain = "gateway_id"
+	keyIDDomain     = "key_id"
+)
+
+// Privacy holds the privacy settings.
+type Privacy struct {
+	key                []byte
+	coordinateDecimals int
+	dropFields         [][]string
+}
+
+// New creates a new Privacy from the request log privacy configuration.
+func New(c config.Config) (*Privacy, error) {
+	conf := c.GeoServer.Backend.RequestLog.Privacy
+
+	if conf.CoordinateDecimals < 0 {
+		return nil, errors.Errorf("invalid coordinate decimals: %d", conf.CoordinateDecimals)
+	}
+
+	p := Privacy{
+		key:                []byte(conf.HMACKey),
+		coordinateDecimals: conf.CoordinateDecimals,
+	}
+
+	for _, f := range conf.DropFields {
+		if f == "" || strings.HasPrefix(f, ".") || strings.HasSuffix(f, ".") || strings.Contains(f, "..") {
+			return nil, errors.Errorf("invalid drop field: '%s'", f)
+		}
+		p.dropFields = append(p.dropFields, strings.Split(f, "."))
+	}
+
+	return &p, nil
+}
+
+// Pseudonymizes returns true when the DevEUIs and gateway IDs are
+// pseudonymized.
+func (p *Privacy) Pseudonymizes() bool {
+	return len(p.key) != 0
+}
+
+// Redacts returns true when the identifiers or coordinates are modified.
+// In this case, data which can't be redacted (e.g. the bodies of the
+// upstream API calls) must not be logged.
+func (p *Privacy) Redacts() bool {
+	return p.Pseudonymizes() || p.coordinateDecimals != 0
+}
+
+// DropsFields returns true when fields are dropped from the logged records.
+func (p *Privacy) DropsFields() bool {
+	return len(p.dropFields) != 0
+}
+
+// KeyID returns an identifier of the HMAC key, such that pseudonymized data
+// can be matched with the key. It is empty when no key is configured.
+func (p *Privacy) KeyID() string {
+	if !p.Pseudonymizes() {
+		return ""
+	}
+	return hex.EncodeToString(p.hmac(keyIDDomain, nil)[:4])
+}
+
+// DevEUI returns the pseudonym of the given DevEUI.
+func (p *Privacy) DevEUI(devEUI []byte) []byte {
+	return p.pseudonym(devEUIDomain, devEUI)
+}
+
+// GatewayID returns the pseudonym of the given gateway ID.
+func (p *Privacy) GatewayID(gatewayID []byte) []byte {
+	return p.pseudonym(gatewayIDDomain, gatewayID)
+}
+
+// Apply returns a copy of the given request or response, with the
+// identifiers pseudonymized and the coordinates rounded. Unknown message
+// types are returned as-is.
+func (p *Privacy) Apply(msg proto.Message) proto.Message {
+	if !p.Redacts() {
+		return msg
+	}
+	return p.apply(msg, true)
+}
+
+// Pseudonymize returns a copy of the given request, with only the
+// identifiers pseudonymized. Unlike Apply, the coordinates are not modified.
+// Unknown message types are returned as-is.
+func (p *Privacy) Pseudonymize(msg proto.Message) proto.Message {
+	if !p.Pseudonymizes() {
+		return msg
+	}
+	return p.apply(msg, false)
+}
+
+func (p *Privacy) apply(msg proto.Message, roundCoordinates bool) proto.Message {
+	switch v := proto.Clone(msg).(type) {
+	case *geo.ResolveTDOARequest:
+		v.DevEui = p.DevEUI(v.DevEui)
+		p.applyFrame(v.FrameRxInfo, roundCoordinates)
+		return v
+	case *geo.ResolveMultiFrameTDOARequest:
+		v.DevEui = p.DevEUI(v.DevEui)
+		for _, frame := range v.FrameRxInfoSet {
+			p.applyFrame(frame, roundCoordinates)
+		}
+		return v
+	case *geo.ResolveTDOAResponse:
+		if roundCoordinates {
+			p.applyLocation(v.GetResult().GetLocation())
+		}
+		return v
+	case *geo.ResolveMultiFrameTDOAResponse:
+		if roundCoordinates {
+			p.applyLocation(v.GetResult().GetLocation())
+		}
+		return v
+	default:
+		return msg
+	}
+}
+
+// DropFields removes the configured fields from the given JSON object.
+// Fields are dot-separated paths, arrays are traversed, e.g.
+// request.frameRXInfo.rxInfo.rssi removes the RSSI of each reception.
+func (p *Privacy) DropFields(b []byte) ([]byte, error) {
+	if len(p.dropFields) == 0 {
+		return b, nil
+	}
+
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, errors.Wrap(err, "unmarshal json error")
+	}
+
+	for _, path := range p.dropFields {
+		dropField(v, path)
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal json error")
+	}
+	return b, nil
+}
+
+func (p *Privacy) applyFrame(frame *geo.FrameRXInfo, roundCoordinates bool) {
+	for _, rxInfo := range frame.GetRxInfo() {
+		rxInfo.GatewayId = p.GatewayID(rxInfo.GatewayId)
+		if roundCoordinates {
+			p.applyLocation(rxInfo.Location)
+		}
+	}
+}
+
+func (p *Privacy) applyLocation(loc *common.Location) {
+	if loc == nil || p.coordinateDecimals == 0 {
+		return
+	}
+
+	loc.Latitude = round(loc.Latitude, p.coordinateDecimals)
+	loc.Longitude = round(loc.Longitude, p.coordinateDecimals)
+}
+
+func (p *Privacy) pseudonym(domain string, id []byte) []byte {
+	if !p.Pseudonymizes() || len(id) == 0 {
+		return id
+	}
+
+	h := p.hmac(domain, id)
+	if len(id) < len(h) {
+		h = h[:len(id)]
+	}
+	return h
+}
+
+func (p *Privacy) hmac(domain string, id []byte) []byte {
+	h := hmac.New(sha256.New, p.key)
+	h.Write([]byte(domain))
+	h.Write([]byte{0})
+	h.Write(id)
+	return h.Sum(nil)
+}
+
+func dropField(v interface{}, path []string) {
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			delete(vv, path[0])
+			return
+		}
+		if child, ok := vv[path[0]]; ok {
+			dropField(child, path[1:])
+		}
+	case []interface{}:
+		for _, item := range vv {
+			dropField(item, path)
+		}
+	}
+}
+
+func round(f float64, decimals int) float64 {
+	pow := math.Pow(10, float64(decimals))
+	return math.Round(f*pow) / pow
+}
@@ -0,0 +1,144 @@
+package privacy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-api/go/v3/geo"
+	"github.com/brocaar/chirpstack-api/go/v3/gw"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+)
+
+func testRequest() *geo.ResolveTDOARequest {
+	return &geo.ResolveTDOARequest{
+		DevEui: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		FrameRxInfo: &geo.FrameRXInfo{
+			RxInfo: []*gw.UplinkRXInfo{
+				{
+					GatewayId: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+					Rssi:      -60,
+					Location:  &common.Location{Latitude: 52.123456, Longitude: 4.987654, Altitude: 10.5},
+				},
+			},
+		},
+	}
+}
+
+func TestPrivacy(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		assert := require.New(t)
+
+		p, err := New(config.Config{})
+		assert.NoError(err)
+		assert.False(p.Pseudonymizes())
+		assert.False(p.Redacts())
+		assert.False(p.DropsFields())
+		assert.Equal("", p.KeyID())
+
+		req := testRequest()
+		assert.True(req == p.Apply(req))
+	})
+
+	t.Run("pseudonymization", func(t *testing.T) {
+		assert := require.New(t)
+
+		var c config.Config
+		c.GeoServer.Backend.RequestLog.Privacy.HMACKey = "secret"
+
+		p, err := New(c)
+		assert.NoError(err)
+		assert.True(p.Pseudonymizes())
+		assert.True(p.Redacts())
+		assert.Len(p.KeyID(), 8)
+
+		req := testRequest()
+		out := p.Apply(req).(*geo.ResolveTDOARequest)
+
+		// the original request is not modified
+		assert.Equal(testRequest(), req)
+
+		// pseudonyms have the same length, are stable and depend on the
+		// type of identifier
+		assert.Len(out.DevEui, 8)
+		assert.NotEqual(req.DevEui, out.DevEui)
+		assert.Equal(p.DevEUI(req.DevEui), out.DevEui)
+		assert.Equal(p.GatewayID(req.FrameRxInfo.RxInfo[0].GatewayId), out.FrameRxInfo.RxInfo[0].GatewayId)
+		assert.NotEqual(out.DevEui, out.FrameRxInfo.RxInfo[0].GatewayId)
+		assert.Equal(req.FrameRxInfo.RxInfo[0].Location, out.FrameRxInfo.RxInfo[0].Location)
+
+		// a different key results in different pseudonyms
+		c.GeoServer.Backend.RequestLog.Privacy.HMACKey = "other"
+		p2, err := New(c)
+		assert.NoError(err)
+		assert.NotEqual(p.DevEUI(req.DevEui), p2.DevEUI(req.DevEui))
+		assert.NotEqual(p.KeyID(), p2.KeyID())
+	})
+
+	t.Run("coordinate rounding", func(t *testing.T) {
+		assert := require.New(t)
+
+		var c config.Config
+		c.GeoServer.Backend.RequestLog.Privacy.CoordinateDecimals = 2
+
+		p, err := New(c)
+		assert.NoError(err)
+		assert.False(p.Pseudonymizes())
+		assert.True(p.Redacts())
+
+		out := p.Apply(testRequest()).(*geo.ResolveTDOARequest)
+		assert.Equal([]byte{1, 2, 3, 4, 5, 6, 7, 8}, out.DevEui)
+		assert.Equal(&common.Location{Latitude: 52.12, Longitude: 4.99, Altitude: 10.5}, out.FrameRxInfo.RxInfo[0].Location)
+
+		// only the identifiers are pseudonymized
+		req := testRequest()
+		assert.True(req == p.Pseudonymize(req))
+
+		c.GeoServer.Backend.RequestLog.Privacy.HMACKey = "secret"
+		p, err = New(c)
+		assert.NoError(err)
+
+		out = p.Pseudonymize(req).(*geo.ResolveTDOARequest)
+		assert.Equal(p.DevEUI(req.DevEui), out.DevEui)
+		assert.Equal(p.GatewayID(req.FrameRxInfo.RxInfo[0].GatewayId), out.FrameRxInfo.RxInfo[0].GatewayId)
+		assert.Equal(req.FrameRxInfo.RxInfo[0].Location, out.FrameRxInfo.RxInfo[0].Location)
+
+		resp := p.Apply(&geo.ResolveTDOAResponse{
+			Result: &geo.ResolveResult{
+				Location: &common.Location{Latitude: -1.23456, Longitude: 1.23456, Accuracy: 10},
+			},
+		}).(*geo.ResolveTDOAResponse)
+		assert.Equal(&common.Location{Latitude: -1.23, Longitude: 1.23, Accuracy: 10}, resp.Result.Location)
+	})
+
+	t.Run("drop fields", func(t *testing.T) {
+		assert := require.New(t)
+
+		var c config.Config
+		c.GeoServer.Backend.RequestLog.Privacy.DropFields = []string{"request.frameRXInfo.rxInfo.rssi", "error", "request.unknown.field"}
+
+		p, err := New(c)
+		assert.NoError(err)
+		assert.True(p.DropsFields())
+		assert.False(p.Redacts())
+
+		b, err := p.DropFields([]byte(`{"error": {"code": "Unknown"}, "request": {"frameRXInfo": {"rxInfo": [{"rssi": -60, "loRaSNR": 7.5}, {"rssi": -70, "loRaSNR": 12345678901234567890}]}}}`))
+		assert.NoError(err)
+		assert.JSONEq(`{"request": {"frameRXInfo": {"rxInfo": [{"loRaSNR": 7.5}, {"loRaSNR": 12345678901234567890}]}}}`, string(b))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		assert := require.New(t)
+
+		var c config.Config
+		c.GeoServer.Backend.RequestLog.Privacy.CoordinateDecimals = -1
+		_, err := New(c)
+		assert.EqualError(err, "invalid coordinate decimals: -1")
+
+		c.GeoServer.Backend.RequestLog.Privacy.CoordinateDecimals = 0
+		c.GeoServer.Backend.RequestLog.Privacy.DropFields = []string{"request..rssi"}
+		_, err = New(c)
+		assert.EqualError(err, "invalid drop field: 'request..rssi'")
+	})
+}
@@ -0,0 +1,77 @@
+package profile
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+	"github.com/brocaar/lorawan"
+)
+
+// Profile defines the post-processing settings of a device.
+type Profile struct {
+	// Name of the profile (blank for the default profile).
+	Name string
+
+	// SmoothingProcessNoise defines the Kalman filter process noise,
+	// expressed as acceleration in m/s².
+	SmoothingProcessNoise float64
+
+	// MaxSpeed defines the max. plausible speed (m/s) between two
+	// successive locations.
+	MaxSpeed float64
+}
+
+// Profiles holds the device profiles.
+type Profiles struct {
+	defaultProfile Profile
+	devices        map[lorawan.EUI64]Profile
+}
+
+// New creates the device profiles from the given configuration. Profile
+// settings that are not set inherit the default settings.
+func New(c config.Config) (*Profiles, error) {
+	p := Profiles{
+		defaultProfile: Profile{
+			SmoothingProcessNoise: c.GeoServer.Smoothing.ProcessNoise,
+			MaxSpeed:              c.GeoServer.Plausibility.MaxSpeed,
+		},
+		devices: make(map[lorawan.EUI64]Profile),
+	}
+
+	for _, dp := range c.GeoServer.DeviceProfiles {
+		prof := p.defaultProfile
+		prof.Name = dp.Name
+
+		if dp.SmoothingProcessNoise != nil {
+			prof.SmoothingProcessNoise = *dp.SmoothingProcessNoise
+		}
+
+		if dp.MaxSpeed != nil {
+			prof.MaxSpeed = *dp.MaxSpeed
+		}
+
+		for _, s := range dp.DevEUIs {
+			var devEUI lorawan.EUI64
+			if err := devEUI.UnmarshalText([]byte(s)); err != nil {
+				return nil, errors.Wrapf(err, "profile %s: decode dev_eui error", dp.Name)
+			}
+
+			if other, ok := p.devices[devEUI]; ok {
+				return nil, errors.Errorf("profile %s: dev_eui %s is already assigned to profile %s", dp.Name, devEUI, other.Name)
+			}
+
+			p.devices[devEUI] = prof
+		}
+	}
+
+	return &p, nil
+}
+
+// Get returns the profile for the given device. When the device has not
+// been assigned to a profile, the default profile is returned.
+func (p *Profiles) Get(devEUI lorawan.EUI64) Profile {
+	if prof, ok := p.devices[devEUI]; ok {
+		return prof
+	}
+	return p.defaultProfile
+}
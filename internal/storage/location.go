@@ -0,0 +1,379 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/brocaar/lorawan"
+)
+
+// earthRadius defines the mean earth radius in meters.
+const earthRadius = 6371000
+
+// Location defines a resolved device location.
+type Location struct {
+	DevEUI    lorawan.EUI64 `json:"devEUI"`
+	Time      time.Time     `json:"time"`
+	Latitude  float64       `json:"latitude"`
+	Longitude float64       `json:"longitude"`
+	Altitude  float64       `json:"altitude"`
+	Accuracy  uint32        `json:"accuracy"`
+}
+
+// BoundingBox defines a bounding-box by its south-west and north-east
+// corners.
+type BoundingBox struct {
+	MinLatitude  float64
+	MinLongitude float64
+	MaxLatitude  float64
+	MaxLongitude float64
+}
+
+// Contains returns true when the given location is within the bounding-box.
+func (b BoundingBox) Contains(loc Location) bool {
+	return loc.Latitude >= b.MinLatitude && loc.Latitude <= b.MaxLatitude &&
+		loc.Longitude >= b.MinLongitude && loc.Longitude <= b.MaxLongitude
+}
+
+// Distance returns the great-circle distance in meters between the given
+// coordinates.
+func Distance(lat1, lng1, lat2, lng2 float64) float64 {
+	lat1 = lat1 * math.Pi / 180
+	lat2 = lat2 * math.Pi / 180
+	dLat := lat2 - lat1
+	dLng := (lng2 - lng1) * math.Pi / 180
+
+	a := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLng/2), 2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// CreateLocation stores the given location. It updates the last location of
+// the device when the given location is more recent.
+func CreateLocation(db *bolt.DB, loc Location) error {
+	b, err := json.Marshal(loc)
+	if err != nil {
+		return errors.Wrap(err, "marshal location error")
+	}
+
+	// Batch coalesces the writes of concurrent requests into a single
+	// transaction, such that not every location results in a disk sync.
+	err = db.Batch(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(locationsBucket).CreateBucketIfNotExists(loc.DevEUI[:])
+		if err != nil {
+			return errors.Wrap(err, "create device bucket error")
+		}
+
+		// the sequence makes sure that locations with the same timestamp
+		// do not overwrite each other
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return errors.Wrap(err, "get sequence error")
+		}
+
+		if err := bucket.Put(locationKey(loc.Time, seq), b); err != nil {
+			return errors.Wrap(err, "put location error")
+		}
+
+		last := tx.Bucket(lastLocationsBucket)
+		if v := last.Get(loc.DevEUI[:]); v != nil {
+			var lastLoc Location
+			if err := json.Unmarshal(v, &lastLoc); err != nil {
+				return errors.Wrap(err, "unmarshal last location error")
+			}
+			if lastLoc.Time.After(loc.Time) {
+				return nil
+			}
+		}
+
+		if err := last.Put(loc.DevEUI[:], b); err != nil {
+			return errors.Wrap(err, "put last location error")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "update error")
+	}
+
+	return nil
+}
+
+// GetLastLocation returns the last location of the given device.
+func GetLastLocation(db *bolt.DB, devEUI lorawan.EUI64) (Location, error) {
+	var loc Location
+
+	err := db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(lastLocationsBucket).Get(devEUI[:])
+		if v == nil {
+			return ErrDoesNotExist
+		}
+		return json.Unmarshal(v, &loc)
+	})
+	if err != nil {
+		if err == ErrDoesNotExist {
+			return loc, err
+		}
+		return loc, errors.Wrap(err, "get last location error")
+	}
+
+	return loc, nil
+}
+
+// GetLocationCount returns the number of locations of the given device
+// within the given time-range (start inclusive, end exclusive).
+func GetLocationCount(db *bolt.DB, devEUI lorawan.EUI64, start, end time.Time) (int, error) {
+	var count int
+
+	err := db.View(func(tx *bolt.Tx) error {
+		return forEachLocation(tx, devEUI, start, end, func(_ []byte) (bool, error) {
+			count++
+			return true, nil
+		})
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "get location count error")
+	}
+
+	return count, nil
+}
+
+// GetLocations returns the locations of the given device within the given
+// time-range (start inclusive, end exclusive), ordered by time.
+func GetLocations(db *bolt.DB, devEUI lorawan.EUI64, start, end time.Time, limit, offset int) ([]Location, error) {
+	var out []Location
+	var i int
+
+	err := db.View(func(tx *bolt.Tx) error {
+		return forEachLocation(tx, devEUI, start, end, func(v []byte) (bool, error) {
+			i++
+			if i <= offset {
+				return true, nil
+			}
+
+			var loc Location
+			if err := json.Unmarshal(v, &loc); err != nil {
+				return false, errors.Wrap(err, "unmarshal location error")
+			}
+			out = append(out, loc)
+
+			return len(out) < limit, nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "get locations error")
+	}
+
+	return out, nil
+}
+
+// GetLastLocationCountInBoundingBox returns the number of devices of which
+// the last location is within the given bounding-box.
+func GetLastLocationCountInBoundingBox(db *bolt.DB, bbox BoundingBox) (int, error) {
+	return getLastLocationCount(db, bbox.Contains)
+}
+
+// GetLastLocationsInBoundingBox returns the last location of the devices
+// within the given bounding-box, ordered by DevEUI.
+func GetLastLocationsInBoundingBox(db *bolt.DB, bbox BoundingBox, limit, offset int) ([]Location, error) {
+	return getLastLocations(db, bbox.Contains, limit, offset)
+}
+
+// GetLastLocationCountInRadius returns the number of devices of which the
+// last location is within the given radius (in meters).
+func GetLastLocationCountInRadius(db *bolt.DB, lat, lng, radius float64) (int, error) {
+	return getLastLocationCount(db, inRadius(lat, lng, radius))
+}
+
+// GetLastLocationsInRadius returns the last location of the devices within
+// the given radius (in meters), ordered by DevEUI.
+func GetLastLocationsInRadius(db *bolt.DB, lat, lng, radius float64, limit, offset int) ([]Location, error) {
+	return getLastLocations(db, inRadius(lat, lng, radius), limit, offset)
+}
+
+func inRadius(lat, lng, radius float64) func(Location) bool {
+	return func(loc Location) bool {
+		return Distance(lat, lng, loc.Latitude, loc.Longitude) <= radius
+	}
+}
+
+func getLastLocationCount(db *bolt.DB, filter func(Location) bool) (int, error) {
+	var count int
+
+	err := db.View(func(tx *bolt.Tx) error {
+		return forEachLastLocation(tx, func(loc Location) (bool, error) {
+			if filter(loc) {
+				count++
+			}
+			return true, nil
+		})
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "get last location count error")
+	}
+
+	return count, nil
+}
+
+func getLastLocations(db *bolt.DB, filter func(Location) bool, limit, offset int) ([]Location, error) {
+	var out []Location
+	var i int
+
+	err := db.View(func(tx *bolt.Tx) error {
+		return forEachLastLocation(tx, func(loc Location) (bool, error) {
+			if !filter(loc) {
+				return true, nil
+			}
+
+			i++
+			if i <= offset {
+				return true, nil
+			}
+
+			out = append(out, loc)
+			return len(out) < limit, nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "get last locations error")
+	}
+
+	return out, nil
+}
+
+// forEachLocation calls f for each stored location of the given device
+// within the given time-range. The iteration stops when f returns false.
+func forEachLocation(tx *bolt.Tx, devEUI lorawan.EUI64, start, end time.Time, f func(v []byte) (bool, error)) error {
+	bucket := tx.Bucket(locationsBucket).Bucket(devEUI[:])
+	if bucket == nil {
+		return nil
+	}
+
+	c := bucket.Cursor()
+	endKey := timeKey(end)
+
+	for k, v := c.Seek(timeKey(start)); k != nil && bytes.Compare(k, endKey) < 0; k, v = c.Next() {
+		cont, err := f(v)
+		if err != nil {
+			return err
+		}
+		if !cont {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// forEachLastLocation calls f for the last location of each device. The
+// iteration stops when f returns false.
+func forEachLastLocation(tx *bolt.Tx, f func(loc Location) (bool, error)) error {
+	c := tx.Bucket(lastLocationsBucket).Cursor()
+
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		var loc Location
+		if err := json.Unmarshal(v, &loc); err != nil {
+			return errors.Wrap(err, "unmarshal location error")
+		}
+
+		cont, err := f(loc)
+		if err != nil {
+			return err
+		}
+		if !cont {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// DeleteLocationsBefore deletes the locations (including the last
+// locations) older than the given timestamp. It returns the number of
+// deleted locations.
+func DeleteLocationsBefore(db *bolt.DB, t time.Time) (int, error) {
+	var count int
+	endKey := timeKey(t)
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		locations := tx.Bucket(locationsBucket)
+
+		var empty [][]byte
+		err := locations.ForEach(func(devEUI, _ []byte) error {
+			bucket := locations.Bucket(devEUI)
+			if bucket == nil {
+				return nil
+			}
+
+			c := bucket.Cursor()
+			for k, _ := c.First(); k != nil && bytes.Compare(k, endKey) < 0; k, _ = c.First() {
+				if err := c.Delete(); err != nil {
+					return errors.Wrap(err, "delete location error")
+				}
+				count++
+			}
+
+			if k, _ := c.First(); k == nil {
+				empty = append(empty, devEUI)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// buckets must not be deleted while iterating
+		for _, devEUI := range empty {
+			if err := locations.DeleteBucket(devEUI); err != nil {
+				return errors.Wrap(err, "delete device bucket error")
+			}
+		}
+
+		var expired [][]byte
+		err = forEachLastLocation(tx, func(loc Location) (bool, error) {
+			if loc.Time.Before(t) {
+				expired = append(expired, append([]byte(nil), loc.DevEUI[:]...))
+			}
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		last := tx.Bucket(lastLocationsBucket)
+		for _, devEUI := range expired {
+			if err := last.Delete(devEUI); err != nil {
+				return errors.Wrap(err, "delete last location error")
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "delete locations error")
+	}
+
+	return count, nil
+}
+
+// timeKey returns the (sortable) bucket key prefix for the given timestamp.
+func timeKey(t time.Time) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(t.UnixNano()))
+	return b
+}
+
+// locationKey returns the bucket key for the given timestamp and sequence.
+// As the key is prefixed by the timestamp, it sorts by time.
+func locationKey(t time.Time, seq uint64) []byte {
+	b := make([]byte, 16)
+	copy(b, timeKey(t))
+	binary.BigEndian.PutUint64(b[8:], seq)
+	return b
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/brocaar/lorawan"
+)
+
+type LocationTestSuite struct {
+	suite.Suite
+
+	tempDir string
+	db      *bolt.DB
+}
+
+func (ts *LocationTestSuite) SetupTest() {
+	assert := require.New(ts.T())
+
+	var err error
+	ts.tempDir, err = ioutil.TempDir("", "storage")
+	assert.NoError(err)
+
+	ts.db, err = Open(filepath.Join(ts.tempDir, "history.db"))
+	assert.NoError(err)
+}
+
+func (ts *LocationTestSuite) TearDownTest() {
+	ts.db.Close()
+	os.RemoveAll(ts.tempDir)
+}
+
+func (ts *LocationTestSuite) TestLocations() {
+	assert := require.New(ts.T())
+
+	devEUI := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	now := time.Now().UTC().Truncate(time.Second)
+
+	_, err := GetLastLocation(ts.db, devEUI)
+	assert.Equal(ErrDoesNotExist, err)
+
+	var locs []Location
+	for i := 0; i < 5; i++ {
+		loc := Location{
+			DevEUI:    devEUI,
+			Time:      now.Add(time.Duration(i) * time.Minute),
+			Latitude:  1.1 + float64(i),
+			Longitude: 2.2,
+			Altitude:  3.3,
+			Accuracy:  10,
+		}
+		locs = append(locs, loc)
+	}
+
+	// store out of order to test the last location
+	for _, i := range []int{0, 1, 4, 2, 3} {
+		assert.NoError(CreateLocation(ts.db, locs[i]))
+	}
+
+	ts.T().Run("GetLastLocation", func(t *testing.T) {
+		assert := require.New(t)
+
+		loc, err := GetLastLocation(ts.db, devEUI)
+		assert.NoError(err)
+		assert.Equal(locs[4], loc)
+	})
+
+	ts.T().Run("GetLocations", func(t *testing.T) {
+		assert := require.New(t)
+
+		count, err := GetLocationCount(ts.db, devEUI, now.Add(time.Minute), now.Add(4*time.Minute))
+		assert.NoError(err)
+		assert.Equal(3, count)
+
+		out, err := GetLocations(ts.db, devEUI, now.Add(time.Minute), now.Add(4*time.Minute), 2, 0)
+		assert.NoError(err)
+		assert.Equal(locs[1:3], out)
+
+		out, err = GetLocations(ts.db, devEUI, now.Add(time.Minute), now.Add(4*time.Minute), 2, 2)
+		assert.NoError(err)
+		assert.Equal(locs[3:4], out)
+
+		out, err = GetLocations(ts.db, lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 1}, now, now.Add(time.Hour), 10, 0)
+		assert.NoError(err)
+		assert.Len(out, 0)
+	})
+}
+
+func (ts *LocationTestSuite) TestLastLocations() {
+	assert := require.New(ts.T())
+
+	now := time.Now().UTC().Truncate(time.Second)
+	locs := []Location{
+		{DevEUI: lorawan.EUI64{1}, Time: now, Latitude: 52.3676, Longitude: 4.9041}, // Amsterdam
+		{DevEUI: lorawan.EUI64{2}, Time: now, Latitude: 52.0907, Longitude: 5.1214}, // Utrecht
+		{DevEUI: lorawan.EUI64{3}, Time: now, Latitude: 48.8566, Longitude: 2.3522}, // Paris
+		{DevEUI: lorawan.EUI64{4}, Time: now, Latitude: 52.3702, Longitude: 4.8952}, // Amsterdam
+	}
+
+	for _, loc := range locs {
+		assert.NoError(CreateLocation(ts.db, loc))
+	}
+
+	ts.T().Run("BoundingBox", func(t *testing.T) {
+		assert := require.New(t)
+
+		bbox := BoundingBox{
+			MinLatitude:  51,
+			MinLongitude: 3,
+			MaxLatitude:  54,
+			MaxLongitude: 7,
+		}
+
+		count, err := GetLastLocationCountInBoundingBox(ts.db, bbox)
+		assert.NoError(err)
+		assert.Equal(3, count)
+
+		out, err := GetLastLocationsInBoundingBox(ts.db, bbox, 2, 1)
+		assert.NoError(err)
+		assert.Equal([]Location{locs[1], locs[3]}, out)
+	})
+
+	ts.T().Run("Radius", func(t *testing.T) {
+		assert := require.New(t)
+
+		count, err := GetLastLocationCountInRadius(ts.db, 52.3676, 4.9041, 5000)
+		assert.NoError(err)
+		assert.Equal(2, count)
+
+		out, err := GetLastLocationsInRadius(ts.db, 52.3676, 4.9041, 5000, 10, 0)
+		assert.NoError(err)
+		assert.Equal([]Location{locs[0], locs[3]}, out)
+	})
+}
+
+func (ts *LocationTestSuite) TestSameTime() {
+	assert := require.New(ts.T())
+
+	devEUI := lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	now := time.Now().UTC().Truncate(time.Second)
+
+	locs := []Location{
+		{DevEUI: devEUI, Time: now, Latitude: 1.1},
+		{DevEUI: devEUI, Time: now, Latitude: 2.2},
+	}
+	for _, loc := range locs {
+		assert.NoError(CreateLocation(ts.db, loc))
+	}
+
+	out, err := GetLocations(ts.db, devEUI, now, now.Add(time.Second), 10, 0)
+	assert.NoError(err)
+	assert.Equal(locs, out)
+
+	count, err := GetLocationCount(ts.db, devEUI, now.Add(-time.Second), now)
+	assert.NoError(err)
+	assert.Equal(0, count)
+}
+
+func (ts *LocationTestSuite) TestDeleteLocationsBefore() {
+	assert := require.New(ts.T())
+
+	now := time.Now().UTC().Truncate(time.Second)
+	locs := []Location{
+		{DevEUI: lorawan.EUI64{1}, Time: now.Add(-2 * time.Hour)},
+		{DevEUI: lorawan.EUI64{1}, Time: now},
+		{DevEUI: lorawan.EUI64{2}, Time: now.Add(-2 * time.Hour)},
+	}
+	for _, loc := range locs {
+		assert.NoError(CreateLocation(ts.db, loc))
+	}
+
+	count, err := DeleteLocationsBefore(ts.db, now.Add(-time.Hour))
+	assert.NoError(err)
+	assert.Equal(2, count)
+
+	out, err := GetLocations(ts.db, lorawan.EUI64{1}, now.Add(-24*time.Hour), now.Add(time.Hour), 10, 0)
+	assert.NoError(err)
+	assert.Equal(locs[1:2], out)
+
+	loc, err := GetLastLocation(ts.db, lorawan.EUI64{1})
+	assert.NoError(err)
+	assert.Equal(locs[1], loc)
+
+	_, err = GetLastLocation(ts.db, lorawan.EUI64{2})
+	assert.Equal(ErrDoesNotExist, err)
+
+	count, err = GetLocationCount(ts.db, lorawan.EUI64{2}, now.Add(-24*time.Hour), now.Add(time.Hour))
+	assert.NoError(err)
+	assert.Equal(0, count)
+}
+
+func TestLocation(t *testing.T) {
+	suite.Run(t, new(LocationTestSuite))
+}
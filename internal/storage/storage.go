@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+)
+
+// ErrDoesNotExist is returned when the requested object does not exist.
+var ErrDoesNotExist = errors.New("object does not exist")
+
+var (
+	locationsBucket     = []byte("locations")
+	lastLocationsBucket = []byte("last_locations")
+)
+
+// pruneInterval defines the interval in which locations older than the
+// configured max. age are deleted.
+const pruneInterval = time.Hour
+
+var (
+	db *bolt.DB
+
+	pruneStop chan struct{}
+	pruneWG   sync.WaitGroup
+)
+
+// Setup opens the storage database (when configured).
+func Setup(c config.Config) error {
+	if c.GeoServer.History.Path == "" {
+		return nil
+	}
+
+	log.WithField("path", c.GeoServer.History.Path).Info("storage: opening database")
+
+	var err error
+	db, err = Open(c.GeoServer.History.Path)
+	if err != nil {
+		return errors.Wrap(err, "open database error")
+	}
+
+	if maxAge := c.GeoServer.History.MaxAge; maxAge > 0 {
+		pruneStop = make(chan struct{})
+		pruneWG.Add(1)
+		go pruneLoop(db, maxAge, pruneStop)
+	}
+
+	return nil
+}
+
+// Close closes the storage database (when opened).
+func Close() error {
+	if db == nil {
+		return nil
+	}
+
+	if pruneStop != nil {
+		close(pruneStop)
+		pruneWG.Wait()
+		pruneStop = nil
+	}
+
+	log.Info("storage: closing database")
+	return db.Close()
+}
+
+// DB returns the database object. Note that this returns nil when the
+// location history has not been configured.
+func DB() *bolt.DB {
+	return db
+}
+
+// Open opens the database at the given path and makes sure that all buckets
+// exist.
+func Open(path string) (*bolt.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, errors.Wrap(err, "make database directory error")
+	}
+
+	d, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.Wrap(err, "open bolt database error")
+	}
+
+	err = d.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{locationsBucket, lastLocationsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return errors.Wrapf(err, "create bucket %s error", name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		d.Close()
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// pruneLoop deletes the locations older than the given max. age, until stop
+// is closed.
+func pruneLoop(db *bolt.DB, maxAge time.Duration, stop chan struct{}) {
+	defer pruneWG.Done()
+
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		prune(db, maxAge)
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func prune(db *bolt.DB, maxAge time.Duration) {
+	count, err := DeleteLocationsBefore(db, time.Now().Add(-maxAge))
+	if err != nil {
+		log.WithError(err).Error("storage: delete expired locations error")
+		return
+	}
+
+	if count != 0 {
+		log.WithFields(log.Fields{
+			"count":   count,
+			"max_age": maxAge,
+		}).Info("storage: expired locations deleted")
+	}
+}
@@ -0,0 +1,365 @@
+package test
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/logger"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/privacy"
+	"github.com/brocaar/lorawan"
+)
+
+// Position holds a surveyed position.
+type Position struct {
+	Latitude  float64
+	Longitude float64
+	Altitude  float64
+}
+
+// GroundTruth holds the surveyed positions, per device and per request.
+type GroundTruth struct {
+	devices  map[string]Position
+	requests map[string]Position
+}
+
+// LoadGroundTruth loads the ground-truth from the given CSV file. The first
+// line must contain the column names:
+//   - dev_eui: the DevEUI of a device which did not move (optional)
+//   - id: the ID of a logged request, as used in the report (optional)
+//   - latitude, longitude: the surveyed position
+//   - altitude: the surveyed altitude (optional)
+//
+// Each row must either set the dev_eui or id column. Per request positions
+// take precedence over device positions. When a HMAC key is configured,
+// the DevEUIs are pseudonymized such that they match pseudonymized requests.
+func LoadGroundTruth(filePath string, p *privacy.Privacy) (*GroundTruth, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "open ground-truth file error")
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "read ground-truth header error")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"latitude", "longitude"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("ground-truth column missing: %s", name)
+		}
+	}
+	_, hasDevEUI := columns["dev_eui"]
+	_, hasID := columns["id"]
+	if !hasDevEUI && !hasID {
+		return nil, errors.New("ground-truth column missing: dev_eui or id")
+	}
+
+	g := GroundTruth{
+		devices:  make(map[string]Position),
+		requests: make(map[string]Position),
+	}
+
+	column := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	for line := 2; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "read ground-truth error")
+		}
+
+		var pos Position
+		if pos.Latitude, err = strconv.ParseFloat(column(record, "latitude"), 64); err != nil {
+			return nil, errors.Wrapf(err, "line %d: parse latitude error", line)
+		}
+		if pos.Longitude, err = strconv.ParseFloat(column(record, "longitude"), 64); err != nil {
+			return nil, errors.Wrapf(err, "line %d: parse longitude error", line)
+		}
+		if s := column(record, "altitude"); s != "" {
+			if pos.Altitude, err = strconv.ParseFloat(s, 64); err != nil {
+				return nil, errors.Wrapf(err, "line %d: parse altitude error", line)
+			}
+		}
+
+		id := column(record, "id")
+		devEUI := column(record, "dev_eui")
+
+		switch {
+		case id != "":
+			g.requests[id] = pos
+		case devEUI != "":
+			var eui lorawan.EUI64
+			if err := eui.UnmarshalText([]byte(devEUI)); err != nil {
+				return nil, errors.Wrapf(err, "line %d: decode dev_eui error", line)
+			}
+			g.devices[hex.EncodeToString(p.DevEUI(eui[:]))] = pos
+		default:
+			return nil, fmt.Errorf("line %d: dev_eui or id must be set", line)
+		}
+	}
+
+	return &g, nil
+}
+
+// Lookup returns the surveyed position for the given request ID and
+// DevEUI.
+func (g *GroundTruth) Lookup(id string, devEUI []byte) (Position, bool) {
+	if pos, ok := g.requests[id]; ok {
+		return pos, true
+	}
+	pos, ok := g.devices[hex.EncodeToString(devEUI)]
+	return pos, ok
+}
+
+// ErrorDistance returns the horizontal distance (in meters) between the
+// surveyed position and the given resolved position. Altitudes are ignored,
+// as these are not resolved by all backends.
+func (p Position) ErrorDistance(lat, long float64) float64 {
+	return NewPoint(p.Latitude, p.Longitude, 0).Distance(NewPoint(lat, long, 0))
+}
+
+// Summary holds the error statistics of a single backend.
+type Summary struct {
+	Backend string
+
+	// Count holds the number of resolved requests with ground-truth.
+	Count int
+
+	// Failures holds the number of requests with ground-truth which could
+	// not be resolved.
+	Failures int
+
+	// Missing holds the number of requests with ground-truth for which no
+	// location was returned.
+	Missing int
+
+	// Error distances (in meters).
+	Mean   float64
+	Median float64
+	CEP50  float64
+	CEP90  float64
+	CEP95  float64
+
+	// WithinAccuracy holds the fraction of resolved locations for which
+	// the error distance is within the reported accuracy.
+	WithinAccuracy float64
+}
+
+// evaluation collects the error distances of the resolved requests.
+type evaluation struct {
+	truth          *GroundTruth
+	privacy        *privacy.Privacy
+	distances      []float64
+	withinAccuracy int
+	failures       int
+	missing        int
+}
+
+// newEvaluation creates a new evaluation, using the given ground-truth file.
+// When no file is given, nothing is evaluated.
+func newEvaluation(groundTruthFile string, p *privacy.Privacy) (*evaluation, error) {
+	e := evaluation{privacy: p}
+	if groundTruthFile == "" {
+		return &e, nil
+	}
+
+	var err error
+	if e.truth, err = LoadGroundTruth(groundTruthFile, p); err != nil {
+		return nil, errors.Wrap(err, "load ground-truth error")
+	}
+	return &e, nil
+}
+
+// reportHeader returns the additional report columns.
+func (e *evaluation) reportHeader() []string {
+	if e.truth == nil {
+		return nil
+	}
+	return []string{"error_distance", "within_accuracy"}
+}
+
+// checkEntry returns an error when the given entry can't be matched with
+// the ground-truth DevEUIs. This is the case when the request has been
+// pseudonymized, but no HMAC key is configured.
+func (e *evaluation) checkEntry(entry logger.Entry) error {
+	if e.truth == nil || len(e.truth.devices) == 0 || entry.KeyID == "" || e.privacy.Pseudonymizes() {
+		return nil
+	}
+
+	return errors.Errorf("%s: request has been pseudonymized (key id: %s), but no hmac key is configured to pseudonymize the ground-truth dev_euis", entry.ID, entry.KeyID)
+}
+
+// fail records a request which could not be resolved.
+func (e *evaluation) fail(id string, devEUI []byte) {
+	if e.truth == nil {
+		return
+	}
+	if _, ok := e.truth.Lookup(id, devEUI); ok {
+		e.failures++
+	}
+}
+
+// miss records a request for which no location was returned.
+func (e *evaluation) miss(id string, devEUI []byte) {
+	if e.truth == nil {
+		return
+	}
+	if _, ok := e.truth.Lookup(id, devEUI); ok {
+		e.missing++
+	}
+}
+
+// evaluate evaluates the resolved location of the given request and returns
+// the additional report columns. These are empty when there is no
+// ground-truth for the request.
+func (e *evaluation) evaluate(id string, devEUI []byte, loc *common.Location) []string {
+	if e.truth == nil {
+		return nil
+	}
+
+	pos, ok := e.truth.Lookup(id, devEUI)
+	if !ok {
+		return []string{"", ""}
+	}
+
+	distance := pos.ErrorDistance(loc.Latitude, loc.Longitude)
+	e.add(distance, float64(loc.Accuracy))
+
+	return []string{
+		strconv.FormatFloat(distance, 'f', 1, 64),
+		strconv.FormatBool(distance <= float64(loc.Accuracy)),
+	}
+}
+
+// finish prints the summary and writes it next to the given report file.
+func (e *evaluation) finish(reportFilePath, backend string) error {
+	if e.truth == nil {
+		return nil
+	}
+
+	s := e.summary(backend)
+	if err := printSummary(os.Stdout, s); err != nil {
+		return errors.Wrap(err, "print summary error")
+	}
+	return writeSummary(strings.TrimSuffix(reportFilePath, ".csv")+".summary.csv", s)
+}
+
+// add adds the error distance of a resolved location with the given
+// reported accuracy.
+func (e *evaluation) add(distance, accuracy float64) {
+	e.distances = append(e.distances, distance)
+	if distance <= accuracy {
+		e.withinAccuracy++
+	}
+}
+
+// summary returns the summary of the collected error distances.
+func (e *evaluation) summary(backend string) Summary {
+	s := Summary{
+		Backend:  backend,
+		Count:    len(e.distances),
+		Failures: e.failures,
+		Missing:  e.missing,
+	}
+	if s.Count == 0 {
+		return s
+	}
+
+	distances := append([]float64(nil), e.distances...)
+	sort.Float64s(distances)
+
+	var sum float64
+	for _, d := range distances {
+		sum += d
+	}
+
+	s.Mean = sum / float64(s.Count)
+	s.Median = percentile(distances, 50)
+	s.CEP50 = percentile(distances, 50)
+	s.CEP90 = percentile(distances, 90)
+	s.CEP95 = percentile(distances, 95)
+	s.WithinAccuracy = float64(e.withinAccuracy) / float64(s.Count)
+
+	return s
+}
+
+// percentile returns the given percentile of the sorted values, using
+// linear interpolation between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (rank-float64(lower))*(sorted[upper]-sorted[lower])
+}
+
+// summaryHeader holds the column names of the summary report.
+var summaryHeader = []string{"backend", "count", "failures", "missing", "mean", "median", "cep50", "cep90", "cep95", "within_accuracy"}
+
+func (s Summary) values() []string {
+	return []string{
+		s.Backend,
+		strconv.Itoa(s.Count),
+		strconv.Itoa(s.Failures),
+		strconv.Itoa(s.Missing),
+		strconv.FormatFloat(s.Mean, 'f', 1, 64),
+		strconv.FormatFloat(s.Median, 'f', 1, 64),
+		strconv.FormatFloat(s.CEP50, 'f', 1, 64),
+		strconv.FormatFloat(s.CEP90, 'f', 1, 64),
+		strconv.FormatFloat(s.CEP95, 'f', 1, 64),
+		strconv.FormatFloat(s.WithinAccuracy, 'f', 3, 64),
+	}
+}
+
+// writeSummary writes the given summary as CSV to the given file.
+func writeSummary(filePath string, s Summary) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return errors.Wrap(err, "open summary file error")
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err := w.WriteAll([][]string{summaryHeader, s.values()}); err != nil {
+		return errors.Wrap(err, "csv write error")
+	}
+
+	return errors.Wrap(f.Close(), "close summary file error")
+}
+
+// printSummary prints the given summary as table.
+func printSummary(out io.Writer, s Summary) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(summaryHeader, "\t"))
+	fmt.Fprintln(w, strings.Join(s.values(), "\t"))
+	return w.Flush()
+}
@@ -0,0 +1,168 @@
+package test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/common"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/logger"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/privacy"
+)
+
+func TestGroundTruth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ground-truth")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(content string) string {
+		p := filepath.Join(dir, "ground-truth.csv")
+		require.NoError(t, ioutil.WriteFile(p, []byte(content), 0644))
+		return p
+	}
+
+	devEUI := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	content := "dev_eui,id,latitude,longitude,altitude\n" +
+		"0102030405060708,,52.1,4.9,10\n" +
+		",request-1,52.2,4.8,\n"
+
+	t.Run("plain", func(t *testing.T) {
+		assert := require.New(t)
+
+		p, err := privacy.New(config.Config{})
+		assert.NoError(err)
+
+		g, err := LoadGroundTruth(write(content), p)
+		assert.NoError(err)
+
+		pos, ok := g.Lookup("request-2", devEUI)
+		assert.True(ok)
+		assert.Equal(Position{Latitude: 52.1, Longitude: 4.9, Altitude: 10}, pos)
+
+		// per request positions take precedence
+		pos, ok = g.Lookup("request-1", devEUI)
+		assert.True(ok)
+		assert.Equal(Position{Latitude: 52.2, Longitude: 4.8}, pos)
+
+		_, ok = g.Lookup("request-2", []byte{8, 7, 6, 5, 4, 3, 2, 1})
+		assert.False(ok)
+	})
+
+	t.Run("pseudonymized", func(t *testing.T) {
+		assert := require.New(t)
+
+		var c config.Config
+		c.GeoServer.Backend.RequestLog.Privacy.HMACKey = "secret"
+		p, err := privacy.New(c)
+		assert.NoError(err)
+
+		g, err := LoadGroundTruth(write(content), p)
+		assert.NoError(err)
+
+		_, ok := g.Lookup("request-2", devEUI)
+		assert.False(ok)
+		_, ok = g.Lookup("request-2", p.DevEUI(devEUI))
+		assert.True(ok)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		assert := require.New(t)
+
+		p, err := privacy.New(config.Config{})
+		assert.NoError(err)
+
+		_, err = LoadGroundTruth(write("dev_eui,latitude\n"), p)
+		assert.EqualError(err, "ground-truth column missing: longitude")
+
+		_, err = LoadGroundTruth(write("latitude,longitude\n"), p)
+		assert.EqualError(err, "ground-truth column missing: dev_eui or id")
+
+		_, err = LoadGroundTruth(write("dev_eui,latitude,longitude\n0102030405060708,52.1,4.9\n,52.1,4.9\n"), p)
+		assert.EqualError(err, "line 3: dev_eui or id must be set")
+
+		_, err = LoadGroundTruth(write("dev_eui,latitude,longitude\n0102030405060708,north,4.9\n"), p)
+		assert.Error(err)
+		assert.Contains(err.Error(), "line 2: parse latitude error")
+	})
+}
+
+func TestEvaluation(t *testing.T) {
+	assert := require.New(t)
+
+	p, err := privacy.New(config.Config{})
+	assert.NoError(err)
+
+	e := evaluation{privacy: p}
+	assert.Nil(e.reportHeader())
+	assert.Nil(e.evaluate("request-1", nil, &common.Location{}))
+	e.fail("request-1", nil)
+	e.miss("request-1", nil)
+	assert.Equal(Summary{Backend: "lora_cloud", Count: 0}, e.summary("lora_cloud"))
+
+	e.truth = &GroundTruth{
+		devices:  map[string]Position{"0102030405060708": {Latitude: 52.1, Longitude: 4.9}},
+		requests: map[string]Position{"request-1": {Latitude: 52, Longitude: 4}},
+	}
+	assert.Equal([]string{"error_distance", "within_accuracy"}, e.reportHeader())
+	assert.Equal([]string{"", ""}, e.evaluate("request-2", nil, &common.Location{}))
+
+	// 0.001 degree latitude is roughly 111 meters
+	assert.Equal([]string{"111.2", "false"}, e.evaluate("request-1", nil, &common.Location{Latitude: 52.001, Longitude: 4, Accuracy: 100}))
+
+	// failures and missing locations are only counted for requests with
+	// ground-truth
+	e.fail("request-1", nil)
+	e.fail("request-2", nil)
+	e.miss("request-2", []byte{1, 2, 3, 4, 5, 6, 7, 8})
+	e.miss("request-2", []byte{8, 7, 6, 5, 4, 3, 2, 1})
+	s := e.summary("lora_cloud")
+	assert.Equal(1, s.Failures)
+	assert.Equal(1, s.Missing)
+
+	// pseudonymized requests can't be matched without hmac key
+	assert.NoError(e.checkEntry(logger.Entry{ID: "request-1"}))
+	assert.EqualError(e.checkEntry(logger.Entry{ID: "request-1", KeyID: "01020304"}), "request-1: request has been pseudonymized (key id: 01020304), but no hmac key is configured to pseudonymize the ground-truth dev_euis")
+
+	var c config.Config
+	c.GeoServer.Backend.RequestLog.Privacy.HMACKey = "secret"
+	e.privacy, err = privacy.New(c)
+	assert.NoError(err)
+	assert.NoError(e.checkEntry(logger.Entry{ID: "request-1", KeyID: e.privacy.KeyID()}))
+
+	e = evaluation{failures: 1, missing: 2}
+	for i, d := range []float64{40, 10, 30, 20, 50} {
+		e.add(d, float64(i*10))
+	}
+
+	s = e.summary("lora_cloud")
+	assert.Equal(Summary{
+		Backend:        "lora_cloud",
+		Count:          5,
+		Failures:       1,
+		Missing:        2,
+		Mean:           30,
+		Median:         30,
+		CEP50:          30,
+		CEP90:          46,
+		CEP95:          48,
+		WithinAccuracy: 0.4,
+	}, s)
+
+	var buf bytes.Buffer
+	assert.NoError(printSummary(&buf, s))
+	assert.Equal("backend     count  failures  missing  mean  median  cep50  cep90  cep95  within_accuracy\nlora_cloud  5      1         2        30.0  30.0    30.0   46.0   48.0   0.400\n", buf.String())
+}
+
+func TestPercentile(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Equal(0.0, percentile(nil, 50))
+	assert.Equal(7.0, percentile([]float64{7}, 95))
+	assert.Equal(15.0, percentile([]float64{10, 20}, 50))
+	assert.Equal(20.0, percentile([]float64{10, 20}, 100))
+}
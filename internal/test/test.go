@@ -3,25 +3,30 @@ package test
 import (
 	"context"
 	"encoding/csv"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/collos"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/logger"
 	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/loracloud"
 	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/privacy"
 	geo "github.com/brocaar/chirpstack-api/go/v3/geo"
 )
 
 // ResolveTDOA runs the given Resolve TDOA test-suite.
-func ResolveTDOA(logDir string) error {
+// When a ground-truth file is given, the error distance of each resolved
+// location is added to the report, and a summary is printed and written.
+// The summary also contains the number of failed requests and requests
+// without location.
+func ResolveTDOA(logDir, groundTruthFile string) error {
 	var backend geo.GeolocationServerServiceServer
 	var err error
 
@@ -35,6 +40,16 @@ func ResolveTDOA(logDir string) error {
 		return errors.Wrap(err, "new backend error")
 	}
 
+	p, err := privacy.New(config.C)
+	if err != nil {
+		return errors.Wrap(err, "privacy error")
+	}
+
+	eval, err := newEvaluation(groundTruthFile, p)
+	if err != nil {
+		return err
+	}
+
 	reportFilePath := filepath.Join(logDir, config.C.GeoServer.Backend.Type+"-report-"+time.Now().UTC().Format(time.RFC3339)+".csv")
 	f, err := os.Create(reportFilePath)
 	if err != nil {
@@ -45,65 +60,81 @@ func ResolveTDOA(logDir string) error {
 	w := csv.NewWriter(f)
 	defer w.Flush()
 
-	if err := w.Write([]string{
+	if err := w.Write(append([]string{
 		"id",
 		"latitude",
 		"longitude",
 		"altitude",
 		"accuracy",
-	}); err != nil {
+	}, eval.reportHeader()...)); err != nil {
 		log.Fatal(err)
 	}
 
-	files, err := ioutil.ReadDir(logDir)
-	if err != nil {
-		return errors.Wrap(err, "read directory error")
-	}
+	err = logger.WalkDir(logDir, func(e logger.Entry) error {
+		if e.Method != "" && e.Method != "ResolveTDOA" {
+			return nil
+		}
+
+		var req geo.ResolveTDOARequest
+		if err := e.UnmarshalRequest(&req); err != nil {
+			return errors.Wrap(err, "load ResolveTDOARequest error")
+		}
 
-	for _, f := range files {
-		if !strings.HasSuffix(f.Name(), ".request.json") {
-			continue
+		if err := eval.checkEntry(e); err != nil {
+			return err
 		}
 
-		req, err := loadResolveTDOARequest(logDir, f.Name())
+		msg, err := pseudonymize(p, e, &req)
 		if err != nil {
-			return errors.Wrap(err, "load ResolveTDOARequest error")
+			return err
 		}
+		devEUI := msg.(*geo.ResolveTDOARequest).DevEui
 
-		res, err := backend.ResolveTDOA(context.Background(), &req)
+		res, err := backend.ResolveTDOA(context.Background(), msg.(*geo.ResolveTDOARequest))
 		if err != nil {
-			log.WithField("file", f.Name()).WithError(err).Error("ResolveTDOA error")
-			continue
+			log.WithField("id", e.ID).WithError(err).Error("ResolveTDOA error")
+			eval.fail(e.ID, devEUI)
+			return nil
 		}
 
-		if err := writeResolveTDOAResponse(logDir, strings.TrimRight(f.Name(), ".request.json")+"."+config.C.GeoServer.Backend.Type+".response.json", res); err != nil {
+		if err := writeResolveTDOAResponse(logDir, e.ID+"."+config.C.GeoServer.Backend.Type+".response.json", res); err != nil {
 			return errors.Wrap(err, "write ResolveTDOAResponse error")
 		}
 
 		if res.Result == nil {
-			log.WithField("file", f.Name()).Warning("nil result")
+			log.WithField("id", e.ID).Warning("nil result")
+			eval.miss(e.ID, devEUI)
+			return nil
 		}
 
 		if res.Result.Location == nil {
-			log.WithField("file", f.Name()).Warning("nil location")
+			log.WithField("id", e.ID).Warning("nil location")
+			eval.miss(e.ID, devEUI)
+			return nil
 		}
 
-		if err := w.Write([]string{
-			f.Name(),
+		if err := w.Write(append([]string{
+			e.ID,
 			strconv.FormatFloat(res.Result.Location.Latitude, 'f', 6, 64),
 			strconv.FormatFloat(res.Result.Location.Longitude, 'f', 6, 64),
 			strconv.FormatFloat(res.Result.Location.Altitude, 'f', 6, 64),
 			strconv.FormatInt(int64(res.Result.Location.Accuracy), 10),
-		}); err != nil {
+		}, eval.evaluate(e.ID, devEUI, res.Result.Location)...)); err != nil {
 			return errors.Wrap(err, "csv write error")
 		}
+
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return eval.finish(reportFilePath, config.C.GeoServer.Backend.Type)
 }
 
 // ResolveMultiFrameTDOA runs the given Resolve multi-frame TDOA test-suite.
-func ResolveMultiFrameTDOA(logDir string) error {
+// See ResolveTDOA for the ground-truth evaluation.
+func ResolveMultiFrameTDOA(logDir, groundTruthFile string) error {
 	var backend geo.GeolocationServerServiceServer
 	var err error
 
@@ -117,6 +148,16 @@ func ResolveMultiFrameTDOA(logDir string) error {
 		return errors.Wrap(err, "new backend error")
 	}
 
+	p, err := privacy.New(config.C)
+	if err != nil {
+		return errors.Wrap(err, "privacy error")
+	}
+
+	eval, err := newEvaluation(groundTruthFile, p)
+	if err != nil {
+		return err
+	}
+
 	reportFilePath := filepath.Join(logDir, config.C.GeoServer.Backend.Type+"-report-"+time.Now().UTC().Format(time.RFC3339)+".csv")
 	f, err := os.Create(reportFilePath)
 	if err != nil {
@@ -127,101 +168,94 @@ func ResolveMultiFrameTDOA(logDir string) error {
 	w := csv.NewWriter(f)
 	defer w.Flush()
 
-	if err := w.Write([]string{
+	if err := w.Write(append([]string{
 		"id",
 		"latitude",
 		"longitude",
 		"altitude",
 		"accuracy",
-	}); err != nil {
+	}, eval.reportHeader()...)); err != nil {
 		log.Fatal(err)
 	}
 
-	files, err := ioutil.ReadDir(logDir)
-	if err != nil {
-		return errors.Wrap(err, "read directory error")
-	}
+	err = logger.WalkDir(logDir, func(e logger.Entry) error {
+		if e.Method != "" && e.Method != "ResolveMultiFrameTDOA" {
+			return nil
+		}
+
+		var req geo.ResolveMultiFrameTDOARequest
+		if err := e.UnmarshalRequest(&req); err != nil {
+			return errors.Wrap(err, "load ResolveTDOARequest error")
+		}
 
-	for _, f := range files {
-		if !strings.HasSuffix(f.Name(), ".request.json") {
-			continue
+		if err := eval.checkEntry(e); err != nil {
+			return err
 		}
 
-		req, err := loadResolveMultiFrameTDOARequest(logDir, f.Name())
+		msg, err := pseudonymize(p, e, &req)
 		if err != nil {
-			return errors.Wrap(err, "load ResolveTDOARequest error")
+			return err
 		}
+		devEUI := msg.(*geo.ResolveMultiFrameTDOARequest).DevEui
 
-		res, err := backend.ResolveMultiFrameTDOA(context.Background(), &req)
+		res, err := backend.ResolveMultiFrameTDOA(context.Background(), msg.(*geo.ResolveMultiFrameTDOARequest))
 		if err != nil {
-			log.WithField("file", f.Name()).WithError(err).Error("ResolveTDOA error")
-			continue
+			log.WithField("id", e.ID).WithError(err).Error("ResolveMultiFrameTDOA error")
+			eval.fail(e.ID, devEUI)
+			return nil
 		}
 
-		if err := writeResolveMultiFrameTDOAResponse(logDir, strings.TrimRight(f.Name(), ".request.json")+"."+config.C.GeoServer.Backend.Type+".response.json", res); err != nil {
+		if err := writeResolveMultiFrameTDOAResponse(logDir, e.ID+"."+config.C.GeoServer.Backend.Type+".response.json", res); err != nil {
 			return errors.Wrap(err, "write ResolveTDOAResponse error")
 		}
 
 		if res.Result == nil {
-			log.WithField("file", f.Name()).Warning("nil result")
+			log.WithField("id", e.ID).Warning("nil result")
+			eval.miss(e.ID, devEUI)
+			return nil
 		}
 
 		if res.Result.Location == nil {
-			log.WithField("file", f.Name()).Warning("nil location")
+			log.WithField("id", e.ID).Warning("nil location")
+			eval.miss(e.ID, devEUI)
+			return nil
 		}
 
-		if err := w.Write([]string{
-			f.Name(),
+		if err := w.Write(append([]string{
+			e.ID,
 			strconv.FormatFloat(res.Result.Location.Latitude, 'f', 6, 64),
 			strconv.FormatFloat(res.Result.Location.Longitude, 'f', 6, 64),
 			strconv.FormatFloat(res.Result.Location.Altitude, 'f', 6, 64),
 			strconv.FormatInt(int64(res.Result.Location.Accuracy), 10),
-		}); err != nil {
+		}, eval.evaluate(e.ID, devEUI, res.Result.Location)...)); err != nil {
 			return errors.Wrap(err, "csv write error")
 		}
-	}
-
-	return nil
-}
 
-func loadResolveTDOARequest(logDir, fn string) (geo.ResolveTDOARequest, error) {
-	var out geo.ResolveTDOARequest
-
-	f, err := os.Open(filepath.Join(logDir, fn))
+		return nil
+	})
 	if err != nil {
-		return out, errors.Wrap(err, "open file error")
-	}
-	defer f.Close()
-
-	m := jsonpb.Unmarshaler{
-		AllowUnknownFields: true,
-	}
-
-	if err := m.Unmarshal(f, &out); err != nil {
-		return out, errors.Wrap(err, "unmarshal error")
+		return err
 	}
 
-	return out, nil
+	return eval.finish(reportFilePath, config.C.GeoServer.Backend.Type)
 }
 
-func loadResolveMultiFrameTDOARequest(logDir, fn string) (geo.ResolveMultiFrameTDOARequest, error) {
-	var out geo.ResolveMultiFrameTDOARequest
-
-	f, err := os.Open(filepath.Join(logDir, fn))
-	if err != nil {
-		return out, errors.Wrap(err, "open file error")
-	}
-	defer f.Close()
-
-	m := jsonpb.Unmarshaler{
-		AllowUnknownFields: true,
+// pseudonymize maps the identifiers of the request of the given entry
+// through the configured HMAC key (if any), such that requests logged
+// before pseudonymization was enabled can be replayed (and shared) in the
+// same way as pseudonymized requests. The coordinates are replayed as
+// logged. Requests which are already pseudonymized must have been
+// pseudonymized using the configured HMAC key (if any).
+func pseudonymize(p *privacy.Privacy, e logger.Entry, req proto.Message) (proto.Message, error) {
+	if e.KeyID == "" {
+		return p.Pseudonymize(req), nil
 	}
 
-	if err := m.Unmarshal(f, &out); err != nil {
-		return out, errors.Wrap(err, "unmarshal error")
+	if p.Pseudonymizes() && e.KeyID != p.KeyID() {
+		return nil, errors.Errorf("%s: request has been pseudonymized using a different hmac key (key id: %s, configured key id: %s)", e.ID, e.KeyID, p.KeyID())
 	}
 
-	return out, nil
+	return req, nil
 }
 
 func writeResolveTDOAResponse(logDir, fn string, resp *geo.ResolveTDOAResponse) error {
@@ -0,0 +1,204 @@
+// Package tlsconfig implements a server TLS configuration of which the
+// certificate, key and CA certificate are reloaded from disk when they
+// change, e.g. after being rotated by cert-manager.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Client authentication modes.
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequired = "required"
+)
+
+// Reloader holds the server TLS configuration. The files are checked for
+// changes at most once per check interval, on incoming connections. When
+// reloading fails, the previous certificates are kept.
+type Reloader struct {
+	certFile      string
+	keyFile       string
+	caFile        string
+	clientAuth    tls.ClientAuthType
+	checkInterval time.Duration
+
+	mu        sync.Mutex
+	config    *tls.Config
+	modTimes  []time.Time
+	lastCheck time.Time
+}
+
+// NewReloader creates a new Reloader. The CA certificate is optional, but
+// must be set when client certificates are optional or required. When the
+// client authentication mode is blank, client certificates are required
+// when a CA certificate is set (for backwards compatibility).
+func NewReloader(certFile, keyFile, caFile, clientAuth string, checkInterval time.Duration) (*Reloader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("tls certificate and key must be set")
+	}
+
+	if clientAuth == "" {
+		clientAuth = ClientAuthNone
+		if caFile != "" {
+			clientAuth = ClientAuthRequired
+		}
+	}
+
+	r := Reloader{
+		certFile:      certFile,
+		keyFile:       keyFile,
+		caFile:        caFile,
+		checkInterval: checkInterval,
+	}
+
+	switch clientAuth {
+	case ClientAuthNone:
+		r.clientAuth = tls.NoClientCert
+	case ClientAuthOptional:
+		r.clientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequired:
+		r.clientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("invalid client auth mode: %s", clientAuth)
+	}
+
+	if r.clientAuth != tls.NoClientCert && caFile == "" {
+		return nil, fmt.Errorf("client auth mode %s requires a ca certificate", clientAuth)
+	}
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// TLSConfig returns the TLS configuration, advertising the given
+// application protocols (ALPN), e.g. h2 for gRPC. The returned configuration
+// always uses the latest certificates.
+//
+// Note that the protocols must be passed here, as the configuration
+// returned for each connection replaces the returned configuration,
+// including the protocols which are added to it by e.g. the gRPC
+// credentials.
+func (r *Reloader) TLSConfig(nextProtos ...string) *tls.Config {
+	return &tls.Config{
+		NextProtos: nextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			conf := r.get().Clone()
+			conf.NextProtos = nextProtos
+			return conf, nil
+		},
+	}
+}
+
+// get returns the current configuration, after reloading the files when
+// they have been changed.
+func (r *Reloader) get() *tls.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.lastCheck) < r.checkInterval {
+		return r.config
+	}
+	r.lastCheck = time.Now()
+
+	modTimes, err := r.getModTimes()
+	if err != nil {
+		log.WithError(err).Error("tlsconfig: check certificate files error")
+		return r.config
+	}
+
+	if equalTimes(modTimes, r.modTimes) {
+		return r.config
+	}
+
+	if err := r.load(); err != nil {
+		log.WithError(err).Error("tlsconfig: reload certificates error, keeping current certificates")
+		// prevent retrying until the files are changed again
+		r.modTimes = modTimes
+		return r.config
+	}
+
+	log.WithFields(log.Fields{
+		"tls_cert": r.certFile,
+		"tls_key":  r.keyFile,
+		"ca_cert":  r.caFile,
+	}).Info("tlsconfig: certificates reloaded")
+
+	return r.config
+}
+
+func (r *Reloader) load() error {
+	modTimes, err := r.getModTimes()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "load key-pair error")
+	}
+
+	conf := tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   r.clientAuth,
+	}
+
+	if r.caFile != "" {
+		rawCACert, err := ioutil.ReadFile(r.caFile)
+		if err != nil {
+			return errors.Wrap(err, "load ca cert error")
+		}
+
+		conf.ClientCAs = x509.NewCertPool()
+		if !conf.ClientCAs.AppendCertsFromPEM(rawCACert) {
+			return errors.New("append ca certificate error")
+		}
+	}
+
+	r.config = &conf
+	r.modTimes = modTimes
+	r.lastCheck = time.Now()
+
+	return nil
+}
+
+func (r *Reloader) getModTimes() ([]time.Time, error) {
+	var out []time.Time
+	for _, f := range []string{r.certFile, r.keyFile, r.caFile} {
+		if f == "" {
+			continue
+		}
+
+		fi, err := os.Stat(f)
+		if err != nil {
+			return nil, errors.Wrap(err, "stat file error")
+		}
+		out = append(out, fi.ModTime())
+	}
+	return out, nil
+}
+
+func equalTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
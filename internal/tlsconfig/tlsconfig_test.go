@@ -0,0 +1,312 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+)
+
+type keyPair struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newKeyPair creates a new certificate, signed by the given parent (or
+// self-signed when nil).
+func newKeyPair(cn string, isCA bool, parent *keyPair) (*keyPair, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+
+	signCert, signKey := &tmpl, key
+	if parent != nil {
+		signCert, signKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, signCert, &key.PublicKey, signKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &keyPair{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
+
+type TLSConfigTestSuite struct {
+	suite.Suite
+
+	tempDir string
+	ca      *keyPair
+	client  *keyPair
+}
+
+func (ts *TLSConfigTestSuite) SetupSuite() {
+	assert := require.New(ts.T())
+	log.SetLevel(log.ErrorLevel)
+
+	var err error
+	ts.tempDir, err = ioutil.TempDir("", "tlsconfig")
+	assert.NoError(err)
+
+	ts.ca, err = newKeyPair("ca", true, nil)
+	assert.NoError(err)
+
+	ts.client, err = newKeyPair("client", false, ts.ca)
+	assert.NoError(err)
+
+	assert.NoError(ioutil.WriteFile(ts.path("ca.pem"), ts.ca.certPEM, 0600))
+	ts.writeServerCert("server-1")
+}
+
+func (ts *TLSConfigTestSuite) TearDownSuite() {
+	os.RemoveAll(ts.tempDir)
+}
+
+func (ts *TLSConfigTestSuite) path(name string) string {
+	return filepath.Join(ts.tempDir, name)
+}
+
+func (ts *TLSConfigTestSuite) writeServerCert(cn string) {
+	assert := require.New(ts.T())
+
+	kp, err := newKeyPair(cn, false, ts.ca)
+	assert.NoError(err)
+
+	assert.NoError(ioutil.WriteFile(ts.path("server.pem"), kp.certPEM, 0600))
+	assert.NoError(ioutil.WriteFile(ts.path("server.key"), kp.keyPEM, 0600))
+
+	// make sure the modification time changes
+	mt := time.Now().Add(time.Duration(len(cn)) * time.Second)
+	assert.NoError(os.Chtimes(ts.path("server.pem"), mt, mt))
+}
+
+// dial connects to a TLS server using the given reloader and returns the
+// common name of the server certificate.
+func (ts *TLSConfigTestSuite) dial(r *Reloader, withClientCert bool) (string, error) {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", r.TLSConfig())
+	if err != nil {
+		return "", err
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		b := make([]byte, 1)
+		if _, err := conn.Read(b); err != nil {
+			return
+		}
+		conn.Write(b)
+	}()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.ca.cert)
+
+	conf := tls.Config{
+		RootCAs: pool,
+	}
+
+	if withClientCert {
+		cert, err := tls.X509KeyPair(ts.client.certPEM, ts.client.keyPEM)
+		if err != nil {
+			return "", err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &conf)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	// with TLS 1.3, client certificate errors are reported after the
+	// handshake, the server echoes one byte to complete the exchange
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write([]byte{0}); err != nil {
+		return "", err
+	}
+	if _, err := conn.Read(make([]byte, 1)); err != nil {
+		return "", err
+	}
+
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+}
+
+func (ts *TLSConfigTestSuite) TestClientAuth() {
+	tests := []struct {
+		Name           string
+		CACert         string
+		ClientAuth     string
+		WithClientCert bool
+		ExpectedError  bool
+	}{
+		{Name: "server-only", ClientAuth: ClientAuthNone},
+		{Name: "server-only, no ca and blank mode", ClientAuth: ""},
+		{Name: "optional without client cert", CACert: "ca.pem", ClientAuth: ClientAuthOptional},
+		{Name: "optional with client cert", CACert: "ca.pem", ClientAuth: ClientAuthOptional, WithClientCert: true},
+		{Name: "required with client cert", CACert: "ca.pem", ClientAuth: ClientAuthRequired, WithClientCert: true},
+		{Name: "required without client cert", CACert: "ca.pem", ClientAuth: ClientAuthRequired, ExpectedError: true},
+		{Name: "ca defaults to required", CACert: "ca.pem", ClientAuth: "", ExpectedError: true},
+	}
+
+	for _, tst := range tests {
+		ts.T().Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			var caCert string
+			if tst.CACert != "" {
+				caCert = ts.path(tst.CACert)
+			}
+
+			r, err := NewReloader(ts.path("server.pem"), ts.path("server.key"), caCert, tst.ClientAuth, time.Hour)
+			assert.NoError(err)
+
+			_, err = ts.dial(r, tst.WithClientCert)
+			if tst.ExpectedError {
+				assert.Error(err)
+			} else {
+				assert.NoError(err)
+			}
+		})
+	}
+}
+
+func (ts *TLSConfigTestSuite) TestInvalid() {
+	assert := require.New(ts.T())
+
+	_, err := NewReloader(ts.path("server.pem"), ts.path("server.key"), "", ClientAuthRequired, 0)
+	assert.Error(err)
+
+	_, err = NewReloader(ts.path("server.pem"), ts.path("server.key"), "", "foo", 0)
+	assert.Error(err)
+
+	_, err = NewReloader(ts.path("server.pem"), ts.path("server.key"), ts.path("missing.pem"), ClientAuthRequired, 0)
+	assert.Error(err)
+}
+
+func (ts *TLSConfigTestSuite) TestReload() {
+	assert := require.New(ts.T())
+
+	ts.writeServerCert("server-1")
+	r, err := NewReloader(ts.path("server.pem"), ts.path("server.key"), "", ClientAuthNone, 0)
+	assert.NoError(err)
+
+	cn, err := ts.dial(r, false)
+	assert.NoError(err)
+	assert.Equal("server-1", cn)
+
+	ts.writeServerCert("server-22")
+	cn, err = ts.dial(r, false)
+	assert.NoError(err)
+	assert.Equal("server-22", cn)
+
+	// an invalid key is ignored
+	assert.NoError(ioutil.WriteFile(ts.path("server.key"), []byte("invalid"), 0600))
+	mt := time.Now().Add(time.Minute)
+	assert.NoError(os.Chtimes(ts.path("server.key"), mt, mt))
+
+	cn, err = ts.dial(r, false)
+	assert.NoError(err)
+	assert.Equal("server-22", cn)
+}
+
+func (ts *TLSConfigTestSuite) TestGRPC() {
+	assert := require.New(ts.T())
+
+	ts.writeServerCert("server-1")
+	r, err := NewReloader(ts.path("server.pem"), ts.path("server.key"), "", ClientAuthNone, time.Hour)
+	assert.NoError(err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+
+	gs := grpc.NewServer(grpc.Creds(credentials.NewTLS(r.TLSConfig("h2"))))
+	grpc_health_v1.RegisterHealthServer(gs, health.NewServer())
+	go gs.Serve(ln)
+	defer gs.Stop()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.ca.cert)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, ln.Addr().String(),
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: pool})),
+		grpc.WithBlock(),
+	)
+	assert.NoError(err)
+	defer conn.Close()
+
+	var p peer.Peer
+	_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{}, grpc.Peer(&p))
+	assert.NoError(err)
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	assert.True(ok)
+	assert.Equal("h2", tlsInfo.State.NegotiatedProtocol)
+}
+
+func TestTLSConfig(t *testing.T) {
+	suite.Run(t, new(TLSConfigTestSuite))
+}
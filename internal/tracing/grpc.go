@@ -0,0 +1,48 @@
+package tracing
+
+import (
+	"context"
+
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc/filters"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+// ServerOption returns the gRPC server option which starts a server span
+// for each (unary and stream) call, except for the health checks. The
+// trace context is extracted from the traceparent metadata (if any).
+func ServerOption() grpc.ServerOption {
+	return grpc.StatsHandler(otelgrpc.NewServerHandler(
+		otelgrpc.WithFilter(filters.Not(filters.HealthCheck())),
+	))
+}
+
+// UnaryServerInterceptor adds the trace ID of the server span to the
+// request tags (and thus to the request logs) and sets the DevEUI of the
+// request as span attribute.
+func UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	span := trace.SpanFromContext(ctx)
+	if !span.SpanContext().IsValid() {
+		return handler(ctx, req)
+	}
+
+	grpc_ctxtags.Extract(ctx).Set("trace_id", span.SpanContext().TraceID().String())
+
+	if r, ok := req.(interface{ GetDevEui() []byte }); ok {
+		span.SetAttributes(DevEUI(r.GetDevEui()))
+	}
+
+	return handler(ctx, req)
+}
+
+// StreamServerInterceptor adds the trace ID of the server span to the
+// request tags (and thus to the request logs).
+func StreamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if sc := trace.SpanFromContext(ss.Context()).SpanContext(); sc.IsValid() {
+		grpc_ctxtags.Extract(ss.Context()).Set("trace_id", sc.TraceID().String())
+	}
+
+	return handler(srv, ss)
+}
@@ -0,0 +1,24 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// TraceparentHeader is the W3C Trace Context header (and gRPC metadata
+// key) used to propagate the span context.
+const TraceparentHeader = "traceparent"
+
+// Extract returns a context containing the remote span context from the
+// given headers. Invalid values are ignored.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(h))
+}
+
+// Inject sets the trace context headers for the span in the given context.
+func Inject(ctx context.Context, h http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(h))
+}
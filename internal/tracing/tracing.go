@@ -0,0 +1,136 @@
+// Package tracing implements distributed tracing using OpenTelemetry. The
+// trace context is propagated using the W3C Trace Context (traceparent)
+// format and spans are exported using OTLP (HTTP) or written to stdout.
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+)
+
+// Exporter types.
+const (
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// instrumentationName defines the name of the tracer.
+const instrumentationName = "github.com/brocaar/chirpstack-geolocation-server"
+
+var (
+	providerMu sync.Mutex
+	provider   *sdktrace.TracerProvider
+)
+
+func init() {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+}
+
+// Setup configures the global tracer provider. Tracing is disabled when no
+// exporter is configured.
+func Setup(c config.Config) error {
+	conf := c.Tracing
+
+	var exp sdktrace.SpanExporter
+	var err error
+
+	switch conf.Exporter {
+	case "":
+		return nil
+	case ExporterStdout:
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return errors.Wrap(err, "new stdout exporter error")
+		}
+	case ExporterOTLP:
+		exp, err = otlptracehttp.New(context.Background(),
+			otlptracehttp.WithEndpointURL(conf.OTLP.Endpoint),
+			otlptracehttp.WithHeaders(conf.OTLP.Headers),
+			otlptracehttp.WithTimeout(conf.OTLP.Timeout),
+		)
+		if err != nil {
+			return errors.Wrap(err, "new otlp exporter error")
+		}
+	default:
+		return fmt.Errorf("unknown exporter: %s", conf.Exporter)
+	}
+
+	log.WithFields(log.Fields{
+		"exporter":     conf.Exporter,
+		"sample_ratio": conf.SampleRatio,
+	}).Info("tracing: tracing enabled")
+
+	SetTracerProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(conf.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", conf.ServiceName))),
+	))
+
+	return nil
+}
+
+// SetTracerProvider sets the global tracer provider. This provider is shut
+// down by Close.
+func SetTracerProvider(tp *sdktrace.TracerProvider) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+
+	provider = tp
+	otel.SetTracerProvider(tp)
+}
+
+// Close shuts down the global tracer provider (if any), exporting the
+// queued spans. Tracing is disabled afterwards.
+func Close() error {
+	providerMu.Lock()
+	tp := provider
+	provider = nil
+	providerMu.Unlock()
+
+	if tp == nil {
+		return nil
+	}
+
+	otel.SetTracerProvider(noop.NewTracerProvider())
+	return tp.Shutdown(context.Background())
+}
+
+// Start starts a new span using the global tracer provider. When the
+// context contains a span (or a remote span context), the new span becomes
+// its child.
+func Start(ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+}
+
+// SetError marks the span as failed. Nil errors are ignored.
+func SetError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(otelcodes.Error, err.Error())
+}
+
+// DevEUI returns the DevEUI attribute.
+func DevEUI(devEUI []byte) attribute.KeyValue {
+	return attribute.String("geo.dev_eui", hex.EncodeToString(devEUI))
+}
@@ -0,0 +1,256 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/brocaar/chirpstack-api/go/v3/geo"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// testTracerProvider sets a global tracer provider, recording the ended
+// spans.
+func testTracerProvider(opts ...sdktrace.TracerProviderOption) *tracetest.SpanRecorder {
+	sr := tracetest.NewSpanRecorder()
+	SetTracerProvider(sdktrace.NewTracerProvider(append(opts, sdktrace.WithSpanProcessor(sr))...))
+	return sr
+}
+
+func attributes(s sdktrace.ReadOnlySpan) map[string]interface{} {
+	out := make(map[string]interface{})
+	for _, a := range s.Attributes() {
+		out[string(a.Key)] = a.Value.AsInterface()
+	}
+	return out
+}
+
+func TestStart(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, span := Start(context.Background(), "test", trace.SpanKindInternal)
+		assert.False(span.IsRecording())
+
+		// calls on a disabled span are no-op
+		span.SetAttributes(attribute.String("foo", "bar"))
+		SetError(span, errors.New("test"))
+		span.End()
+	})
+
+	t.Run("propagation", func(t *testing.T) {
+		assert := require.New(t)
+
+		sr := testTracerProvider()
+		defer Close()
+
+		h := make(http.Header)
+		h.Set(TraceparentHeader, testTraceparent)
+
+		ctx := Extract(context.Background(), h)
+		ctx, parent := Start(ctx, "parent", trace.SpanKindServer, attribute.String("foo", "bar"))
+		ctx, child := Start(ctx, "child", trace.SpanKindClient)
+
+		h = make(http.Header)
+		Inject(ctx, h)
+		assert.Equal("00-4bf92f3577b34da6a3ce929d0e0e4736-"+child.SpanContext().SpanID().String()+"-01", h.Get(TraceparentHeader))
+
+		SetError(child, errors.New("boom"))
+		SetError(parent, nil)
+		child.End()
+		parent.End()
+
+		spans := sr.Ended()
+		assert.Len(spans, 2)
+
+		c, p := spans[0], spans[1]
+		assert.Equal("child", c.Name())
+		assert.Equal(trace.SpanKindClient, c.SpanKind())
+		assert.Equal(otelcodes.Error, c.Status().Code)
+		assert.Equal("boom", c.Status().Description)
+		assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", c.SpanContext().TraceID().String())
+		assert.Equal(p.SpanContext().SpanID(), c.Parent().SpanID())
+
+		assert.Equal("parent", p.Name())
+		assert.Equal(otelcodes.Unset, p.Status().Code)
+		assert.Equal("00f067aa0ba902b7", p.Parent().SpanID().String())
+		assert.Equal(map[string]interface{}{"foo": "bar"}, attributes(p))
+	})
+
+	t.Run("not sampled", func(t *testing.T) {
+		assert := require.New(t)
+
+		sr := testTracerProvider(sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(0))))
+		defer Close()
+
+		_, span := Start(context.Background(), "root", trace.SpanKindInternal)
+		assert.True(span.SpanContext().IsValid())
+		assert.False(span.SpanContext().IsSampled())
+		span.End()
+
+		// the sampling decision of the remote parent is followed
+		h := make(http.Header)
+		h.Set(TraceparentHeader, testTraceparent)
+		_, span = Start(Extract(context.Background(), h), "child", trace.SpanKindInternal)
+		span.End()
+
+		assert.Len(sr.Ended(), 1)
+		assert.Equal("child", sr.Ended()[0].Name())
+	})
+}
+
+func TestSetup(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(Setup(config.Config{}))
+		assert.NoError(Close())
+	})
+
+	t.Run("unknown exporter", func(t *testing.T) {
+		assert := require.New(t)
+
+		var c config.Config
+		c.Tracing.Exporter = "foo"
+		assert.EqualError(Setup(c), "unknown exporter: foo")
+	})
+
+	t.Run("otlp", func(t *testing.T) {
+		assert := require.New(t)
+
+		requests := make(chan *http.Request, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests <- r
+		}))
+		defer server.Close()
+
+		var c config.Config
+		c.Tracing.Exporter = ExporterOTLP
+		c.Tracing.ServiceName = "test-service"
+		c.Tracing.SampleRatio = 1
+		c.Tracing.OTLP.Endpoint = server.URL + "/v1/traces"
+		c.Tracing.OTLP.Headers = map[string]string{"Authorization": "Bearer token"}
+		c.Tracing.OTLP.Timeout = time.Second
+		assert.NoError(Setup(c))
+
+		_, span := Start(context.Background(), "test", trace.SpanKindInternal)
+		span.End()
+
+		// the queued spans are exported on close
+		assert.NoError(Close())
+
+		r := <-requests
+		assert.Equal("/v1/traces", r.URL.Path)
+		assert.Equal("application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal("Bearer token", r.Header.Get("Authorization"))
+	})
+}
+
+type testGeoServer struct {
+	geo.UnimplementedGeolocationServerServiceServer
+
+	tags map[string]interface{}
+}
+
+func (s *testGeoServer) ResolveTDOA(ctx context.Context, req *geo.ResolveTDOARequest) (*geo.ResolveTDOAResponse, error) {
+	s.tags = grpc_ctxtags.Extract(ctx).Values()
+	return nil, status.Error(codes.Unavailable, "upstream unavailable")
+}
+
+type testStreamServer struct {
+	grpc_testing.UnimplementedTestServiceServer
+
+	tags map[string]interface{}
+}
+
+func (s *testStreamServer) StreamingOutputCall(req *grpc_testing.StreamingOutputCallRequest, ss grpc_testing.TestService_StreamingOutputCallServer) error {
+	s.tags = grpc_ctxtags.Extract(ss.Context()).Values()
+	return ss.Send(&grpc_testing.StreamingOutputCallResponse{})
+}
+
+func TestServerOption(t *testing.T) {
+	assert := require.New(t)
+
+	sr := testTracerProvider()
+	defer Close()
+
+	geoServer := testGeoServer{}
+	streamServer := testStreamServer{}
+
+	server := grpc.NewServer(
+		ServerOption(),
+		grpc_middleware.WithUnaryServerChain(grpc_ctxtags.UnaryServerInterceptor(), UnaryServerInterceptor),
+		grpc_middleware.WithStreamServerChain(grpc_ctxtags.StreamServerInterceptor(), StreamServerInterceptor),
+	)
+	geo.RegisterGeolocationServerServiceServer(server, &geoServer)
+	grpc_testing.RegisterTestServiceServer(server, &streamServer)
+	grpc_health_v1.RegisterHealthServer(server, health.NewServer())
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	go server.Serve(ln)
+	defer server.Stop()
+
+	conn, err := grpc.Dial(ln.Addr().String(), grpc.WithInsecure())
+	assert.NoError(err)
+	defer conn.Close()
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), TraceparentHeader, testTraceparent)
+
+	// health checks are not traced
+	_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	assert.NoError(err)
+
+	_, err = geo.NewGeolocationServerServiceClient(conn).ResolveTDOA(ctx, &geo.ResolveTDOARequest{DevEui: []byte{1, 2, 3, 4, 5, 6, 7, 8}})
+	assert.Equal(codes.Unavailable, status.Code(err))
+	assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", geoServer.tags["trace_id"])
+
+	stream, err := grpc_testing.NewTestServiceClient(conn).StreamingOutputCall(ctx, &grpc_testing.StreamingOutputCallRequest{})
+	assert.NoError(err)
+	_, err = stream.Recv()
+	assert.NoError(err)
+	_, err = stream.Recv()
+	assert.Error(err)
+	assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", streamServer.tags["trace_id"])
+
+	server.GracefulStop()
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range sr.Ended() {
+		spans[s.Name()] = s
+	}
+	assert.Len(spans, 2)
+
+	s := spans["geo.GeolocationServerService/ResolveTDOA"]
+	assert.NotNil(s)
+	assert.Equal(trace.SpanKindServer, s.SpanKind())
+	assert.Equal(otelcodes.Error, s.Status().Code)
+	assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", s.SpanContext().TraceID().String())
+	assert.Equal("0102030405060708", attributes(s)["geo.dev_eui"])
+
+	s = spans["grpc.testing.TestService/StreamingOutputCall"]
+	assert.NotNil(s)
+	assert.Equal(trace.SpanKindServer, s.SpanKind())
+}
@@ -0,0 +1,405 @@
+// Package validation implements the validation of the configuration, so
+// that configuration errors are reported at once on startup (or reload),
+// instead of on the first request.
+package validation
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/brocaar/lorawan"
+	"github.com/pkg/errors"
+
+	"github.com/brocaar/chirpstack-geolocation-server/internal/auth"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/logger"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/plausibility"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/integration/marshaler"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/logging"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/privacy"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/profile"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/tlsconfig"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/tracing"
+)
+
+// Errors contains all validation errors.
+type Errors []error
+
+// Error implements the error interface.
+func (e Errors) Error() string {
+	var out []string
+	for _, err := range e {
+		out = append(out, err.Error())
+	}
+	return strings.Join(out, "; ")
+}
+
+type validator struct {
+	errors Errors
+}
+
+func (v *validator) add(key string, err error) {
+	if err != nil {
+		v.errors = append(v.errors, errors.Wrap(err, key))
+	}
+}
+
+func (v *validator) addf(key, format string, a ...interface{}) {
+	v.errors = append(v.errors, fmt.Errorf("%s: "+format, append([]interface{}{key}, a...)...))
+}
+
+func (v *validator) err() error {
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return v.errors
+}
+
+// Validate validates the given configuration. When the configuration is
+// invalid, an Errors value containing all problems is returned.
+func Validate(c config.Config) error {
+	var v validator
+
+	if c.General.LogLevel < 0 || c.General.LogLevel > 5 {
+		v.addf("general.log_level", "must be between 0 and 5, got: %d", c.General.LogLevel)
+	}
+
+	switch c.General.LogFormat {
+	case "", logging.FormatText, logging.FormatJSON:
+	default:
+		v.addf("general.log_format", "invalid log format: '%s'", c.General.LogFormat)
+	}
+
+	validateAPI(&v, c)
+	validateBackend(&v, c)
+	validatePostProcessing(&v, c)
+	validateIntegration(&v, c)
+
+	_, err := auth.New(c)
+	v.add("geo_server.auth", err)
+
+	_, err = profile.New(c)
+	v.add("geo_server.device_profiles", err)
+
+	if c.Metrics.Prometheus.EndpointEnabled {
+		v.add("metrics.prometheus.bind", validateBind(c.Metrics.Prometheus.Bind))
+	}
+
+	validateTracing(&v, c)
+
+	return v.err()
+}
+
+// Backend validates the backend configuration only.
+func Backend(c config.Config) error {
+	var v validator
+	validateBackend(&v, c)
+	return v.err()
+}
+
+func validateAPI(v *validator, c config.Config) {
+	apiConf := c.GeoServer.API
+
+	v.add("geo_server.api.bind", validateBind(apiConf.Bind))
+	if apiConf.CACert != "" || apiConf.TLSCert != "" || apiConf.TLSKey != "" {
+		_, err := tlsconfig.NewReloader(apiConf.TLSCert, apiConf.TLSKey, apiConf.CACert, apiConf.ClientAuth, apiConf.CertReloadInterval)
+		v.add("geo_server.api", err)
+	} else if apiConf.ClientAuth != "" && apiConf.ClientAuth != tlsconfig.ClientAuthNone {
+		v.addf("geo_server.api.client_auth", "%s requires tls_cert, tls_key and ca_cert to be set", apiConf.ClientAuth)
+	}
+	validatePositive(v, "geo_server.api.drain_timeout", apiConf.DrainTimeout)
+	validateNotNegative(v, "geo_server.api.cert_reload_interval", apiConf.CertReloadInterval)
+
+	restConf := c.GeoServer.RESTAPI
+	if restConf.Bind != "" {
+		v.add("geo_server.rest_api.bind", validateBind(restConf.Bind))
+	}
+	if restConf.TLSCert != "" || restConf.TLSKey != "" {
+		_, err := tlsconfig.NewReloader(restConf.TLSCert, restConf.TLSKey, "", tlsconfig.ClientAuthNone, restConf.CertReloadInterval)
+		v.add("geo_server.rest_api", err)
+	}
+	validateNotNegative(v, "geo_server.rest_api.cert_reload_interval", restConf.CertReloadInterval)
+}
+
+func validateBackend(v *validator, c config.Config) {
+	backendConf := c.GeoServer.Backend
+
+	switch backendConf.Type {
+	case "collos":
+		if backendConf.Collos.SubscriptionKey == "" {
+			v.addf("geo_server.backend.collos.subscription_key", "must be set")
+		}
+		validatePositive(v, "geo_server.backend.collos.request_timeout", backendConf.Collos.RequestTimeout)
+	case "lora_cloud":
+		v.add("geo_server.backend.lora_cloud.uri", validateURL(backendConf.LoRaCloud.URI, "http", "https"))
+		if backendConf.LoRaCloud.Token == "" {
+			v.addf("geo_server.backend.lora_cloud.token", "must be set")
+		}
+		validatePositive(v, "geo_server.backend.lora_cloud.request_timeout", backendConf.LoRaCloud.RequestTimeout)
+	default:
+		v.addf("geo_server.backend.type", "unknown backend: '%s' (valid options are collos and lora_cloud)", backendConf.Type)
+	}
+
+	logConf := backendConf.RequestLog
+	sinks := logger.Sinks()
+	validSink := logConf.Sink == ""
+	for _, sink := range sinks {
+		if sink == logConf.Sink {
+			validSink = true
+		}
+	}
+	if !validSink {
+		v.addf("geo_server.backend.request_log.sink", "invalid sink: '%s' (valid options are %s and %s)", logConf.Sink, strings.Join(sinks[:len(sinks)-1], ", "), sinks[len(sinks)-1])
+	}
+
+	if logConf.Sink == logger.SinkS3 {
+		s3Conf := logConf.S3
+		v.add("geo_server.backend.request_log.s3.endpoint", validateURL(s3Conf.Endpoint, "http", "https"))
+		if s3Conf.Bucket == "" {
+			v.addf("geo_server.backend.request_log.s3.bucket", "must be set")
+		}
+		if s3Conf.BatchSize < 1 {
+			v.addf("geo_server.backend.request_log.s3.batch_size", "must be at least 1, got: %d", s3Conf.BatchSize)
+		}
+		validatePositive(v, "geo_server.backend.request_log.s3.batch_interval", s3Conf.BatchInterval)
+		validatePositive(v, "geo_server.backend.request_log.s3.request_timeout", s3Conf.RequestTimeout)
+	}
+
+	if backendConf.RequestLogDir != "" || (logConf.Sink != "" && logConf.Sink != logger.SinkFile) {
+		switch logConf.Mode {
+		case logger.ModeFile, logger.ModeNDJSON:
+		default:
+			v.addf("geo_server.backend.request_log.mode", "invalid mode: '%s' (valid options are %s and %s)", logConf.Mode, logger.ModeFile, logger.ModeNDJSON)
+		}
+		switch logConf.NDJSONPeriod {
+		case logger.PeriodHourly, logger.PeriodDaily:
+		default:
+			v.addf("geo_server.backend.request_log.ndjson_period", "invalid period: '%s' (valid options are %s and %s)", logConf.NDJSONPeriod, logger.PeriodHourly, logger.PeriodDaily)
+		}
+		switch logConf.Compression {
+		case "", logger.CompressionNone, logger.CompressionGzip, logger.CompressionZstd:
+		default:
+			v.addf("geo_server.backend.request_log.compression", "invalid compression: '%s' (valid options are %s, %s and %s)", logConf.Compression, logger.CompressionNone, logger.CompressionGzip, logger.CompressionZstd)
+		}
+		if logConf.MaxFileSizeMB < 0 {
+			v.addf("geo_server.backend.request_log.max_file_size_mb", "must not be negative, got: %d", logConf.MaxFileSizeMB)
+		}
+		validateNotNegative(v, "geo_server.backend.request_log.max_age", logConf.MaxAge)
+		if logConf.MaxTotalSizeMB < 0 {
+			v.addf("geo_server.backend.request_log.max_total_size_mb", "must not be negative, got: %d", logConf.MaxTotalSizeMB)
+		}
+		if logConf.QueueSize < 1 {
+			v.addf("geo_server.backend.request_log.queue_size", "must be at least 1, got: %d", logConf.QueueSize)
+		}
+
+		_, err := privacy.New(c)
+		v.add("geo_server.backend.request_log.privacy", err)
+
+		samplingConf := logConf.Sampling
+		if samplingConf.Percentage < 0 || samplingConf.Percentage > 100 {
+			v.addf("geo_server.backend.request_log.sampling.percentage", "must be between 0 and 100, got: %f", samplingConf.Percentage)
+		}
+		for _, s := range samplingConf.DevEUIs {
+			var devEUI lorawan.EUI64
+			if err := devEUI.UnmarshalText([]byte(s)); err != nil {
+				v.addf("geo_server.backend.request_log.sampling.dev_euis", "invalid dev_eui: '%s'", s)
+			}
+		}
+		if samplingConf.MinGatewayCount < 0 {
+			v.addf("geo_server.backend.request_log.sampling.min_gateway_count", "must not be negative, got: %d", samplingConf.MinGatewayCount)
+		}
+	}
+
+	probeConf := backendConf.UpstreamProbe
+	validateNotNegative(v, "geo_server.backend.upstream_probe.interval", probeConf.Interval)
+	if probeConf.Interval > 0 {
+		validatePositive(v, "geo_server.backend.upstream_probe.timeout", probeConf.Timeout)
+		if probeConf.FailureThreshold < 1 {
+			v.addf("geo_server.backend.upstream_probe.failure_threshold", "must be at least 1, got: %d", probeConf.FailureThreshold)
+		}
+	}
+}
+
+func validatePostProcessing(v *validator, c config.Config) {
+	validateNotNegative(v, "geo_server.history.max_age", c.GeoServer.History.MaxAge)
+
+	if c.GeoServer.Smoothing.Enabled {
+		if c.GeoServer.Smoothing.ProcessNoise <= 0 {
+			v.addf("geo_server.smoothing.process_noise", "must be positive, got: %f", c.GeoServer.Smoothing.ProcessNoise)
+		}
+		validateNotNegative(v, "geo_server.smoothing.state_timeout", c.GeoServer.Smoothing.StateTimeout)
+	}
+
+	if plausibilityConf := c.GeoServer.Plausibility; plausibilityConf.Enabled {
+		switch plausibilityConf.Action {
+		case plausibility.ActionReject, plausibility.ActionLastLocation, plausibility.ActionFlag:
+		default:
+			v.addf("geo_server.plausibility.action", "invalid action: '%s'", plausibilityConf.Action)
+		}
+
+		if plausibilityConf.MaxSpeed < 0 {
+			v.addf("geo_server.plausibility.max_speed", "must not be negative, got: %f", plausibilityConf.MaxSpeed)
+		}
+		validateNotNegative(v, "geo_server.plausibility.state_timeout", plausibilityConf.StateTimeout)
+
+		r := plausibilityConf.AllowedRegion
+		if r.MinLatitude > r.MaxLatitude || r.MinLongitude > r.MaxLongitude {
+			v.addf("geo_server.plausibility.allowed_region", "min values must be <= max values")
+		}
+	}
+
+	if geofenceConf := c.GeoServer.Geofence; geofenceConf.Source != "" {
+		if strings.HasPrefix(geofenceConf.Source, "http://") || strings.HasPrefix(geofenceConf.Source, "https://") {
+			v.add("geo_server.geofence.source", validateURL(geofenceConf.Source, "http", "https"))
+		} else if _, err := os.Stat(geofenceConf.Source); err != nil {
+			v.add("geo_server.geofence.source", err)
+		}
+		validateNotNegative(v, "geo_server.geofence.refresh_interval", geofenceConf.RefreshInterval)
+		validateNotNegative(v, "geo_server.geofence.dwell_time", geofenceConf.DwellTime)
+		validateNotNegative(v, "geo_server.geofence.state_timeout", geofenceConf.StateTimeout)
+	}
+}
+
+func validateIntegration(v *validator, c config.Config) {
+	intConf := c.GeoServer.Integration
+	if len(intConf.Enabled) == 0 {
+		return
+	}
+
+	v.add("geo_server.integration.marshaler", marshaler.Validate(marshaler.Type(intConf.Marshaler)))
+	if intConf.QueueSize < 1 {
+		v.addf("geo_server.integration.queue_size", "must be at least 1, got: %d", intConf.QueueSize)
+	}
+
+	for _, name := range intConf.Enabled {
+		switch name {
+		case "log":
+		case "http":
+			httpConf := intConf.HTTP
+			if len(httpConf.Endpoints) == 0 {
+				v.addf("geo_server.integration.http.endpoints", "at least one endpoint must be set")
+			}
+			for _, e := range httpConf.Endpoints {
+				v.add("geo_server.integration.http.endpoints", validateURL(e, "http", "https"))
+			}
+			validatePositive(v, "geo_server.integration.http.timeout", httpConf.Timeout)
+			if httpConf.RetryQueueDir != "" {
+				validatePositive(v, "geo_server.integration.http.retry_interval", httpConf.RetryInterval)
+			}
+		case "mqtt":
+			mqttConf := intConf.MQTT
+			v.add("geo_server.integration.mqtt.server", validateURL(mqttConf.Server, "tcp", "ssl", "tls", "ws", "wss"))
+			if mqttConf.QOS > 2 {
+				v.addf("geo_server.integration.mqtt.qos", "must be 0, 1 or 2, got: %d", mqttConf.QOS)
+			}
+			if _, err := template.New("").Parse(mqttConf.LocationTopicTemplate); err != nil {
+				v.add("geo_server.integration.mqtt.location_topic_template", err)
+			}
+			if _, err := template.New("").Parse(mqttConf.GeofenceTopicTemplate); err != nil {
+				v.add("geo_server.integration.mqtt.geofence_topic_template", err)
+			}
+			if mqttConf.CACert != "" {
+				v.add("geo_server.integration.mqtt.ca_cert", validateCACert(mqttConf.CACert))
+			}
+			if mqttConf.TLSCert != "" || mqttConf.TLSKey != "" {
+				if _, err := tls.LoadX509KeyPair(mqttConf.TLSCert, mqttConf.TLSKey); err != nil {
+					v.add("geo_server.integration.mqtt.tls_cert", err)
+				}
+			}
+		default:
+			v.addf("geo_server.integration.enabled", "unknown integration: '%s'", name)
+		}
+	}
+}
+
+func validateTracing(v *validator, c config.Config) {
+	conf := c.Tracing
+
+	switch conf.Exporter {
+	case "":
+		return
+	case tracing.ExporterStdout:
+	case tracing.ExporterOTLP:
+		v.add("tracing.otlp.endpoint", validateURL(conf.OTLP.Endpoint, "http", "https"))
+		validatePositive(v, "tracing.otlp.timeout", conf.OTLP.Timeout)
+	default:
+		v.addf("tracing.exporter", "invalid exporter: '%s'", conf.Exporter)
+	}
+
+	if conf.SampleRatio < 0 || conf.SampleRatio > 1 {
+		v.addf("tracing.sample_ratio", "must be between 0 and 1, got: %f", conf.SampleRatio)
+	}
+}
+
+func validateBind(bind string) error {
+	host, port, err := net.SplitHostPort(bind)
+	if err != nil {
+		return err
+	}
+
+	if host != "" && net.ParseIP(host) == nil {
+		if _, err := net.LookupHost(host); err != nil {
+			return fmt.Errorf("invalid host: %s", host)
+		}
+	}
+
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 0 || p > 65535 {
+		return fmt.Errorf("invalid port: %s", port)
+	}
+
+	return nil
+}
+
+func validateURL(s string, schemes ...string) error {
+	if s == "" {
+		return errors.New("must be set")
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+
+	for _, scheme := range schemes {
+		if u.Scheme == scheme && u.Host != "" {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid url '%s', expected scheme: %s", s, strings.Join(schemes, ", "))
+}
+
+func validateCACert(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if !x509.NewCertPool().AppendCertsFromPEM(b) {
+		return fmt.Errorf("no certificates found in %s", path)
+	}
+
+	return nil
+}
+
+func validatePositive(v *validator, key string, d time.Duration) {
+	if d <= 0 {
+		v.addf(key, "must be positive, got: %s", d)
+	}
+}
+
+func validateNotNegative(v *validator, key string, d time.Duration) {
+	if d < 0 {
+		v.addf(key, "must not be negative, got: %s", d)
+	}
+}
@@ -0,0 +1,158 @@
+package validation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-geolocation-server/internal/backend/logger"
+	"github.com/brocaar/chirpstack-geolocation-server/internal/config"
+)
+
+func validConfig() config.Config {
+	var c config.Config
+	c.General.LogLevel = 4
+	c.GeoServer.API.Bind = "0.0.0.0:8005"
+	c.GeoServer.API.DrainTimeout = 30 * time.Second
+	c.GeoServer.Backend.Type = "lora_cloud"
+	c.GeoServer.Backend.LoRaCloud.URI = "https://gls.loracloud.com"
+	c.GeoServer.Backend.LoRaCloud.Token = "token"
+	c.GeoServer.Backend.LoRaCloud.RequestTimeout = time.Second
+	c.GeoServer.Integration.Enabled = []string{"http", "mqtt"}
+	c.GeoServer.Integration.Marshaler = "json"
+	c.GeoServer.Integration.QueueSize = 100
+	c.GeoServer.Integration.HTTP.Endpoints = []string{"http://localhost:8080/events"}
+	c.GeoServer.Integration.HTTP.Timeout = time.Second
+	c.GeoServer.Integration.MQTT.Server = "tcp://localhost:1883"
+	c.GeoServer.Integration.MQTT.LocationTopicTemplate = "geo/{{ .DevEUI }}/location"
+	c.GeoServer.Integration.MQTT.GeofenceTopicTemplate = "geo/{{ .DevEUI }}/geofence"
+	c.Metrics.Prometheus.EndpointEnabled = true
+	c.Metrics.Prometheus.Bind = "0.0.0.0:9100"
+	return c
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		assert := require.New(t)
+		assert.NoError(Validate(validConfig()))
+	})
+
+	t.Run("all errors are reported", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := validConfig()
+		c.GeoServer.API.Bind = "0.0.0.0"
+		c.GeoServer.API.TLSCert = "/does/not/exist.pem"
+		c.GeoServer.Backend.LoRaCloud.URI = ""
+		c.GeoServer.Backend.LoRaCloud.Token = ""
+		c.GeoServer.Backend.LoRaCloud.RequestTimeout = 0
+		c.GeoServer.Integration.Enabled = []string{"http", "foo"}
+		c.GeoServer.Integration.HTTP.Endpoints = []string{"localhost:8080"}
+		c.GeoServer.Auth.Enabled = true
+		c.GeoServer.Auth.Clients = []config.AuthClient{{Tokens: []string{"foo"}}}
+		c.GeoServer.DeviceProfiles = []config.DeviceProfile{{Name: "vehicle", DevEUIs: []string{"foo"}}}
+		c.Metrics.Prometheus.Bind = "0.0.0.0:foo"
+		c.Tracing.Exporter = "otlp"
+		c.Tracing.OTLP.Endpoint = "localhost:4318"
+		c.Tracing.OTLP.Timeout = time.Second
+		c.Tracing.SampleRatio = 2
+
+		err := Validate(c)
+		assert.Error(err)
+
+		var messages []string
+		for _, e := range err.(Errors) {
+			messages = append(messages, e.Error())
+		}
+
+		assert.Equal([]string{
+			"geo_server.api.bind: address 0.0.0.0: missing port in address",
+			"geo_server.api: tls certificate and key must be set",
+			"geo_server.backend.lora_cloud.uri: must be set",
+			"geo_server.backend.lora_cloud.token: must be set",
+			"geo_server.backend.lora_cloud.request_timeout: must be positive, got: 0s",
+			"geo_server.integration.http.endpoints: invalid url 'localhost:8080', expected scheme: http, https",
+			"geo_server.integration.enabled: unknown integration: 'foo'",
+			"geo_server.auth: client 0: name must be set",
+			"geo_server.device_profiles: profile vehicle: decode dev_eui error: encoding/hex: invalid byte: U+006F 'o'",
+			"metrics.prometheus.bind: invalid port: foo",
+			"tracing.otlp.endpoint: invalid url 'localhost:4318', expected scheme: http, https",
+			"tracing.sample_ratio: must be between 0 and 1, got: 2.000000",
+		}, messages)
+	})
+
+	t.Run("backend", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := validConfig()
+		c.GeoServer.Backend.Type = "collos"
+		c.GeoServer.API.Bind = ""
+		assert.EqualError(Backend(c), "geo_server.backend.collos.subscription_key: must be set; geo_server.backend.collos.request_timeout: must be positive, got: 0s")
+	})
+
+	t.Run("request log", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := validConfig()
+		c.GeoServer.Backend.RequestLogDir = "/var/log/requests"
+		c.GeoServer.Backend.RequestLog.Mode = "file"
+		c.GeoServer.Backend.RequestLog.NDJSONPeriod = "hourly"
+		c.GeoServer.Backend.RequestLog.QueueSize = 1000
+		c.GeoServer.Backend.RequestLog.Sampling.Percentage = 100
+		c.GeoServer.Backend.RequestLog.Sampling.DevEUIs = []string{"0102030405060708"}
+		assert.NoError(Backend(c))
+
+		c.GeoServer.Backend.RequestLog.QueueSize = 0
+		c.GeoServer.Backend.RequestLog.Sampling.Percentage = 101
+		c.GeoServer.Backend.RequestLog.Sampling.DevEUIs = []string{"foo"}
+		c.GeoServer.Backend.RequestLog.Privacy.DropFields = []string{""}
+		assert.EqualError(Backend(c), "geo_server.backend.request_log.queue_size: must be at least 1, got: 0; geo_server.backend.request_log.privacy: invalid drop field: ''; geo_server.backend.request_log.sampling.percentage: must be between 0 and 100, got: 101.000000; geo_server.backend.request_log.sampling.dev_euis: invalid dev_eui: 'foo'")
+	})
+
+	t.Run("request log s3 sink", func(t *testing.T) {
+		assert := require.New(t)
+
+		c := validConfig()
+		c.GeoServer.Backend.RequestLog.Sink = "s3"
+		c.GeoServer.Backend.RequestLog.Mode = "file"
+		c.GeoServer.Backend.RequestLog.NDJSONPeriod = "hourly"
+		c.GeoServer.Backend.RequestLog.QueueSize = 1000
+		c.GeoServer.Backend.RequestLog.Sampling.Percentage = 100
+		c.GeoServer.Backend.RequestLog.S3.Endpoint = "http://localhost:9000"
+		c.GeoServer.Backend.RequestLog.S3.Bucket = "requests"
+		c.GeoServer.Backend.RequestLog.S3.BatchSize = 1000
+		c.GeoServer.Backend.RequestLog.S3.BatchInterval = time.Minute
+		c.GeoServer.Backend.RequestLog.S3.RequestTimeout = time.Second
+		assert.NoError(Backend(c))
+
+		c.GeoServer.Backend.RequestLog.S3.Endpoint = "localhost:9000"
+		c.GeoServer.Backend.RequestLog.S3.Bucket = ""
+		c.GeoServer.Backend.RequestLog.S3.BatchSize = 0
+		assert.EqualError(Backend(c), "geo_server.backend.request_log.s3.endpoint: invalid url 'localhost:9000', expected scheme: http, https; geo_server.backend.request_log.s3.bucket: must be set; geo_server.backend.request_log.s3.batch_size: must be at least 1, got: 0")
+
+		c.GeoServer.Backend.RequestLog.Sink = "kafka"
+		assert.EqualError(Backend(c), "geo_server.backend.request_log.sink: invalid sink: 'kafka' (valid options are file and s3)")
+	})
+
+	t.Run("request log registered sink", func(t *testing.T) {
+		assert := require.New(t)
+
+		logger.RegisterSink("test-kafka", func(c config.Config) (logger.Sink, error) {
+			return nil, nil
+		})
+
+		c := validConfig()
+		c.GeoServer.Backend.RequestLog.Sink = "test-kafka"
+		c.GeoServer.Backend.RequestLog.Mode = "file"
+		c.GeoServer.Backend.RequestLog.NDJSONPeriod = "hourly"
+		c.GeoServer.Backend.RequestLog.Sampling.Percentage = 100
+		assert.EqualError(Backend(c), "geo_server.backend.request_log.queue_size: must be at least 1, got: 0")
+
+		c.GeoServer.Backend.RequestLog.QueueSize = 1000
+		assert.NoError(Backend(c))
+
+		c.GeoServer.Backend.RequestLog.Sink = "kafka"
+		assert.EqualError(Backend(c), "geo_server.backend.request_log.sink: invalid sink: 'kafka' (valid options are file, s3 and test-kafka)")
+	})
+}